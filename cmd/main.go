@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,14 +19,21 @@ import (
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
 	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
 	"github.com/ehsanshojaei/go-otp-auth/internal/service"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/email"
 	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/metrics"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/sms"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/stats"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/version"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/helmet"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -48,8 +59,35 @@ import (
 // @name Authorization
 // @description Enter JWT token in format: Bearer {token}
 func main() {
+	normalizePhones := flag.Bool("normalize-phones", false, "convert legacy stored phone numbers to E.164 and exit")
+	dryRun := flag.Bool("dry-run", false, "with -normalize-phones, report what would change without writing")
+	flag.Parse()
+
 	// Load configuration
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if cfg.UsesDefaultJWTSecret() {
+		log.Println("WARNING: JWT_SECRET is a placeholder; anyone can forge tokens. Set a real secret, and ENV=prod to enforce it")
+	}
+	if cfg.Auth.BreakGlassTokenHash != "" {
+		log.Println("WARNING: BREAK_GLASS_TOKEN_HASH is set; the break-glass token grants full admin access and every use is audit-logged")
+	}
+	utils.SetDefaultPhoneRegion(cfg.OTP.DefaultRegion)
+	if cfg.Server.LogConfigSummary {
+		summary, err := json.Marshal(cfg.Summary())
+		if err != nil {
+			log.Printf("Failed to encode configuration summary: %v", err)
+		} else {
+			log.Printf("Effective configuration: %s", summary)
+		}
+	}
+
+	// Privacy mode stores HMACs, so there is no legacy format left to convert
+	if *normalizePhones && cfg.User.PhoneHMACKey != "" {
+		log.Fatal("-normalize-phones cannot run with USER_PHONE_HMAC_KEY set: stored phone numbers are HMACs")
+	}
 
 	// Initialize database
 	db, err := initDB(cfg)
@@ -57,29 +95,115 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// One-shot migration for numbers stored before E.164 was enforced
+	if *normalizePhones {
+		migrationService := service.NewPhoneMigrationService(repository.NewUserRepository(db, cfg), cfg)
+		if _, err := migrationService.Normalize(context.Background(), *dryRun); err != nil {
+			log.Fatalf("Phone normalization failed: %v", err)
+		}
+		return
+	}
+
 	// Initialize Redis
 	redisClient := initRedis(cfg)
 
-	// Initialize JWT manager
-	jwtManager := jwt.NewJWTManager(cfg.JWT.SecretKey, cfg.JWT.ExpiryHours)
+	if err := checkBackendVersions(cfg, db, redisClient); err != nil {
+		log.Fatalf("Unsupported backend: %v", err)
+	}
 
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(db)
-	otpRepo := repository.NewOTPRepository(redisClient)
+	// Initialize metrics
+	appMetrics := metrics.New()
+	appMetrics.SetOTPConfig(cfg.OTP.Length, cfg.OTP.ExpiryMinutes, cfg.OTP.MaxAttempts)
+
+	// Initialize JWT manager
+	jwtManager, err := newJWTManager(cfg)
+	if err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+	if _, err := cfg.JWTMinIssuedAt(); err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+	jwtManager.SetIssuer(cfg.JWT.Issuer)
+	jwtManager.SetAudience(cfg.JWT.Audience)
+
+	// Initialize repositories. The cache goes beneath the privacy layer, so it
+	// holds rows as stored and never a number a caller looked the user up by.
+	userRepo := repository.NewUserRepository(db, cfg)
+	if cfg.User.ProfileCacheTTL > 0 {
+		userRepo = repository.NewCachedUserRepository(userRepo, cfg.User.ProfileCacheTTL)
+	}
+	var protector *utils.PhoneProtector
+	if cfg.User.PhoneHMACKey != "" {
+		protector, err = utils.NewPhoneProtector(cfg.User.PhoneHMACKey, cfg.User.PhoneEncryptionKey)
+		if err != nil {
+			log.Fatalf("Invalid phone privacy configuration: %v", err)
+		}
+		userRepo = repository.NewPrivateUserRepository(userRepo, protector)
+	}
+	attemptRepo := repository.NewOTPAttemptRepository(db, protector)
+	sessionRepo := repository.NewSessionRepository(db)
+	otpRepo := repository.NewInstrumentedOTPRepository(repository.NewOTPRepository(redisClient), appMetrics)
+	maintenanceRepo := repository.NewMaintenanceRepository(redisClient)
+	tokenBlacklist := repository.NewTokenBlacklist(redisClient)
+
+	// Initialize OTP sender
+	baseSender, err := newOTPSender(cfg)
+	if err != nil {
+		log.Fatalf("Invalid SMS configuration: %v", err)
+	}
+	otpSender := service.NewInstrumentedSender(baseSender, appMetrics)
+	emailSender, err := newEmailSender(cfg)
+	if err != nil {
+		log.Fatalf("Invalid email configuration: %v", err)
+	}
 
 	// Initialize services
-	authService := service.NewAuthService(userRepo, otpRepo, jwtManager, cfg)
-	userService := service.NewUserService(userRepo)
+	tokenService := service.NewTokenService(tokenBlacklist)
+	sessionService := service.NewSessionService(sessionRepo, tokenService)
+	authService := service.NewAuthService(userRepo, otpRepo, attemptRepo, otpSender, emailSender, jwtManager, cfg)
+	authService = service.NewSessionAuthService(authService, sessionRepo, tokenService)
+	authService = service.NewInstrumentedAuthService(authService, appMetrics)
+	var statsCounters *stats.Counters
+	if cfg.Server.StatsEnabled {
+		statsCounters = stats.NewCounters()
+		authService = service.NewStatsAuthService(authService, statsCounters)
+	}
+	userService := service.NewUserService(userRepo, attemptRepo)
+	maintenanceService := service.NewMaintenanceService(maintenanceRepo, cfg)
+	userPurgeService := service.NewUserPurgeService(userRepo, cfg)
+	tokenCutoffService := service.NewTokenCutoffService(tokenBlacklist, jwtManager, cfg)
 
 	// Initialize handlers
-	authHandler := handler.NewAuthHandler(authService)
-	userHandler := handler.NewUserHandler(userService)
+	authHandler := handler.NewAuthHandler(authService, tokenService, sessionService)
+	userHandler := handler.NewUserHandler(userService, cfg)
+	adminHandler := handler.NewAdminHandler(maintenanceService, userService, tokenCutoffService, statsCounters)
+	healthHandler := handler.NewHealthHandler(map[string]handler.HealthCheck{
+		"database": func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+		"redis": func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		},
+	}, 3*time.Second)
+
+	jwksHandler := handler.NewJWKSHandler(jwtManager)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(jwtManager)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager, userService, tokenService, cfg, appMetrics)
+	maintenanceMiddleware := middleware.NewMaintenanceMiddleware(maintenanceService)
 
 	// Initialize Fiber app
-	app := setupApp(authHandler, userHandler, authMiddleware, db, redisClient)
+	ipRateLimiter := middleware.NewIPRateLimiter(cfg.Server.RateLimitMax, cfg.Server.RateLimitWindow, repository.NewLimiterStorage(redisClient), "/health", "/healthz", "/readyz")
+	app := setupApp(authHandler, userHandler, adminHandler, healthHandler, jwksHandler, authMiddleware, maintenanceMiddleware, ipRateLimiter, appMetrics, cfg.Server.AccessLogFormat)
+
+	// Start background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	userPurgeService.Start(jobsCtx)
+	tokenCutoffService.Start(jobsCtx)
 
 	// Start server with graceful shutdown
 	go func() {
@@ -95,6 +219,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopJobs()
 	if err := app.ShutdownWithTimeout(30 * time.Second); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
@@ -109,7 +234,7 @@ func initDB(cfg *config.Config) (*gorm.DB, error) {
 	}
 
 	// Auto migrate
-	if err := db.AutoMigrate(&model.User{}); err != nil {
+	if err := repository.Migrate(db, &model.User{}, &model.OTPAttempt{}, &model.Session{}, &model.SessionToken{}); err != nil {
 		return nil, err
 	}
 
@@ -138,7 +263,106 @@ func initRedis(cfg *config.Config) *redis.Client {
 	return client
 }
 
-func setupApp(authHandler *handler.AuthHandler, userHandler *handler.UserHandler, authMiddleware *middleware.AuthMiddleware, db *gorm.DB, redisClient *redis.Client) *fiber.App {
+// newOTPSender picks the SMS provider named by SMS_PROVIDER
+func newOTPSender(cfg *config.Config) (service.OTPSender, error) {
+	switch cfg.SMS.Provider {
+	case "", "console":
+		return service.NewConsoleSender(cfg.OTP.DebugLog), nil
+	case "twilio":
+		return sms.NewTwilioSender(cfg.SMS)
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", cfg.SMS.Provider)
+	}
+}
+
+// newEmailSender picks the email provider named by EMAIL_PROVIDER; "none"
+// returns nil, which turns email sign-in off
+func newEmailSender(cfg *config.Config) (service.EmailSender, error) {
+	switch cfg.Email.Provider {
+	case "", "console":
+		return service.NewConsoleEmailSender(cfg.OTP.DebugLog), nil
+	case "smtp":
+		return email.NewSMTPSender(cfg.Email.SMTP)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown email provider %q", cfg.Email.Provider)
+	}
+}
+
+func newJWTManager(cfg *config.Config) (*jwt.JWTManager, error) {
+	switch cfg.JWT.Algorithm {
+	case "", jwt.AlgorithmHS256:
+		manager := jwt.NewJWTManager(cfg.JWT.SecretKey, cfg.JWT.ExpiryHours, cfg.JWT.RefreshExpiryHours)
+		for i, entry := range cfg.JWT.Keys {
+			kid, secret, ok := strings.Cut(entry, ":")
+			if !ok {
+				return nil, fmt.Errorf("JWT_KEYS entry %d is not kid:secret", i+1)
+			}
+			if err := manager.AddKey(kid, []byte(secret)); err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				if err := manager.SetActiveKey(kid); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return manager, nil
+	case jwt.AlgorithmRS256:
+		publicPEM, err := os.ReadFile(cfg.JWT.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT public key: %w", err)
+		}
+		var privatePEM []byte
+		if cfg.JWT.PrivateKeyFile != "" {
+			if privatePEM, err = os.ReadFile(cfg.JWT.PrivateKeyFile); err != nil {
+				return nil, fmt.Errorf("failed to read JWT private key: %w", err)
+			}
+		}
+		manager, err := jwt.NewRS256Manager(privatePEM, publicPEM, cfg.JWT.ExpiryHours, cfg.JWT.RefreshExpiryHours)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range cfg.JWT.PreviousPublicKeyFiles {
+			previousPEM, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read previous JWT public key: %w", err)
+			}
+			if _, err := manager.AddPublicKey(previousPEM); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		return manager, nil
+	default:
+		return nil, fmt.Errorf("unknown JWT algorithm %q", cfg.JWT.Algorithm)
+	}
+}
+
+// checkBackendVersions compares Postgres and Redis against the configured minimums
+func checkBackendVersions(cfg *config.Config, db *gorm.DB, redisClient *redis.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return version.CheckBackends(ctx, cfg.Server.StrictVersionCheck,
+		version.Backend{
+			Name:    "Postgres",
+			Minimum: cfg.Database.MinVersion,
+			Fetch: func(ctx context.Context) (string, error) {
+				return repository.PostgresVersion(ctx, db)
+			},
+		},
+		version.Backend{
+			Name:    "Redis",
+			Minimum: cfg.Redis.MinVersion,
+			Fetch: func(ctx context.Context) (string, error) {
+				return repository.RedisVersion(ctx, redisClient)
+			},
+		},
+	)
+}
+
+func setupApp(authHandler *handler.AuthHandler, userHandler *handler.UserHandler, adminHandler *handler.AdminHandler, healthHandler *handler.HealthHandler, jwksHandler *handler.JWKSHandler, authMiddleware *middleware.AuthMiddleware, maintenanceMiddleware *middleware.MaintenanceMiddleware, ipRateLimiter fiber.Handler, appMetrics *metrics.Metrics, accessLogFormat string) *fiber.App {
 	// Create Fiber app with custom configuration
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
@@ -158,22 +382,11 @@ func setupApp(authHandler *handler.AuthHandler, userHandler *handler.UserHandler
 	// Global middleware
 	app.Use(recover.New())
 	app.Use(helmet.New())
-	app.Use(limiter.New(limiter.Config{
-		Max:        100, // 100 requests per minute per IP
-		Expiration: 1 * time.Minute,
-		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error":   "rate_limit_exceeded",
-				"message": "Too many requests from this IP",
-			})
-		},
-	}))
-	app.Use(logger.New(logger.Config{
-		Format: "[${time}] ${status} - ${method} ${path} - ${latency} - ${ip}\n",
-	}))
+	// Ahead of the IP limiter so its 429 is localized too
+	app.Use(middleware.Locale())
+	app.Use(ipRateLimiter)
+	app.Use(requestid.New())
+	app.Use(middleware.AccessLog(accessLogFormat, nil))
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:3000,http://127.0.0.1:3000",
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
@@ -182,39 +395,17 @@ func setupApp(authHandler *handler.AuthHandler, userHandler *handler.UserHandler
 	}))
 
 	// Health check endpoint with dependency checks
-	app.Get("/health", func(c *fiber.Ctx) error {
-		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer cancel()
-
-		status := fiber.Map{
-			"status":  "healthy",
-			"service": "OTP Service",
-			"version": "1.0",
-			"checks": fiber.Map{
-				"database": "healthy",
-				"redis":    "healthy",
-			},
-		}
+	app.Get("/health", healthHandler.Check)
 
-		// Check database connection
-		if sqlDB, err := db.DB(); err != nil || sqlDB.PingContext(ctx) != nil {
-			status["status"] = "unhealthy"
-			status["checks"].(fiber.Map)["database"] = "unhealthy"
-		}
+	// Kubernetes probes: liveness never touches dependencies, readiness does
+	app.Get("/healthz", healthHandler.Live)
+	app.Get("/readyz", healthHandler.Ready)
 
-		// Check Redis connection
-		if err := redisClient.Ping(ctx).Err(); err != nil {
-			status["status"] = "unhealthy"
-			status["checks"].(fiber.Map)["redis"] = "unhealthy"
-		}
+	// Public keys for services verifying RS256 tokens
+	app.Get("/.well-known/jwks.json", jwksHandler.GetJWKS)
 
-		statusCode := fiber.StatusOK
-		if status["status"] == "unhealthy" {
-			statusCode = fiber.StatusServiceUnavailable
-		}
-
-		return c.Status(statusCode).JSON(status)
-	})
+	// Prometheus metrics
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.HandlerFor(appMetrics.Registry(), promhttp.HandlerOpts{})))
 
 	// Swagger documentation
 	app.Get("/swagger/*", swagger.HandlerDefault)
@@ -222,17 +413,41 @@ func setupApp(authHandler *handler.AuthHandler, userHandler *handler.UserHandler
 	// API routes
 	v1 := app.Group("/api/v1")
 
+	// Logout sends no body, so it sits ahead of the JSON check on the auth group
+	v1.Post("/auth/logout", authMiddleware.RequireAuth(), authHandler.Logout)
+
 	// Auth routes (no authentication required)
 	auth := v1.Group("/auth")
+	auth.Use(maintenanceMiddleware.RejectWrites(), middleware.RequireJSON())
 	auth.Post("/send-otp", authHandler.SendOTP)
 	auth.Post("/verify-otp", authHandler.VerifyOTP)
+	auth.Post("/refresh", authHandler.RefreshToken)
+	auth.Get("/otp-status", authHandler.GetOTPStatus)
+	auth.Get("/userinfo", authMiddleware.RequireAuth(), userHandler.GetUserInfo)
 
 	// User routes (authentication required)
 	users := v1.Group("/users")
-	users.Use(authMiddleware.RequireAuth())
+	users.Use(authMiddleware.RequireAuth(), maintenanceMiddleware.RejectWrites())
 	users.Get("/profile", userHandler.GetProfile)
-	users.Get("/", userHandler.GetUsers)
-	users.Get("/:id", userHandler.GetUser)
+	users.Patch("/profile", authHandler.UpdateProfile)
+	users.Delete("/profile", authHandler.DeleteProfile)
+	users.Get("/limits", authHandler.GetLimits)
+	users.Get("/sessions", authHandler.GetSessions)
+	users.Delete("/sessions/:jti", authHandler.RevokeSession)
+	users.Get("/", authMiddleware.RequireRole(model.RoleAdmin), userHandler.GetUsers)
+	users.Get("/by-phone", authMiddleware.RequireRole(model.RoleAdmin), userHandler.GetUserByPhoneNumber)
+	users.Get("/:id", authMiddleware.RequireRole(model.RoleAdmin), userHandler.GetUser)
+	users.Get("/:id/otp-attempts", authMiddleware.RequireRole(model.RoleAdmin), userHandler.GetOTPAttempts)
+
+	// Admin routes (authentication and admin phone number required)
+	admin := v1.Group("/admin")
+	admin.Use(authMiddleware.RequireAuth(), authMiddleware.RequireAdmin())
+	admin.Get("/maintenance", adminHandler.GetMaintenance)
+	admin.Put("/maintenance", adminHandler.SetMaintenance)
+	admin.Put("/users/:id/status", adminHandler.SetUserStatus)
+	admin.Get("/stats", adminHandler.GetStats)
+	admin.Get("/token-cutoff", adminHandler.GetTokenCutoff)
+	admin.Put("/token-cutoff", adminHandler.SetTokenCutoff)
 
 	return app
 }
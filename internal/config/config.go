@@ -4,20 +4,72 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// OTP modes: every code by SMS, or an authenticator app once enrolled
+const (
+	OTPModeSMS  = "sms"
+	OTPModeTOTP = "totp"
+)
+
+// OTP delivery channels, as listed in OTP_ESCALATION_ORDER
+const (
+	ChannelSMS   = "sms"
+	ChannelVoice = "voice"
+	ChannelEmail = "email"
+)
+
+// Deployment environments, set with ENV
+const (
+	EnvDev  = "dev"
+	EnvProd = "prod"
+)
+
+// DefaultJWTSecret is the JWT_SECRET used when none is set; Validate refuses
+// it in prod
+const DefaultJWTSecret = "your-secret-key-change-in-production"
+
 type Config struct {
+	// dev or prod; prod refuses insecure defaults at startup
+	Env string
+
 	Server   ServerConfig
 	Database DatabaseConfig
 	Redis    RedisConfig
 	JWT      JWTConfig
+	Auth     AuthConfig
 	OTP      OTPConfig
+	User     UserConfig
+	SMS      SMSConfig
+	Email    EmailConfig
+
+	// Variables that were set but could not be parsed, so their default applies
+	malformed []string
 }
 
 type ServerConfig struct {
-	Host string
-	Port string
+	Host            string
+	Port            string
+	MaintenanceMode bool
+
+	// Refuse to start, rather than warn, when a backend is older than its minimum version
+	StrictVersionCheck bool
+
+	// Keep in-memory send/verify counts for GET /admin/stats
+	StatsEnabled bool
+
+	// Access log format: json (one object per request) or text
+	AccessLogFormat string
+
+	// Log the effective configuration, secrets redacted, once at startup
+	LogConfigSummary bool
+
+	// Requests allowed per client IP in each window, counted in Redis so the
+	// limit is shared by every instance
+	RateLimitMax    int
+	RateLimitWindow time.Duration
 }
 
 type DatabaseConfig struct {
@@ -27,6 +79,9 @@ type DatabaseConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	// Oldest supported Postgres server_version (empty skips the check)
+	MinVersion string
 }
 
 type RedisConfig struct {
@@ -34,25 +89,267 @@ type RedisConfig struct {
 	Port     string
 	Password string
 	DB       int
+
+	// Oldest supported redis_version (empty skips the check)
+	MinVersion string
 }
 
 type JWTConfig struct {
-	SecretKey string
-	ExpiryHours int
+	SecretKey          string
+	ExpiryHours        int
+	RefreshExpiryHours int
+
+	// iss and aud stamped on issued tokens and required on validated ones;
+	// empty skips the claim
+	Issuer   string
+	Audience string
+
+	// HS256 keys as "kid:secret", newest first. The first one signs new tokens
+	// with its kid in the header; the rest only verify. SecretKey still
+	// verifies tokens issued without a kid.
+	Keys []string
+
+	// "HS256" signs with SecretKey; "RS256" signs with the PEM private key and
+	// verifies with the public key, so verify-only services need no secret.
+	// PrivateKeyFile may be empty on a service that never issues tokens.
+	Algorithm      string
+	PrivateKeyFile string
+	PublicKeyFile  string
+
+	// Public keys of retired RS256 signing keys, still trusted and published
+	// in the JWKS until tokens they signed have expired
+	PreviousPublicKeyFiles []string
+
+	// What the phone_number claim carries: "full", "masked" or "hashed"
+	// (an HMAC keyed with SecretKey); handlers resolve the real number by user_id
+	PhoneClaim string
+
+	// Tokens issued before this RFC 3339 time (or Unix seconds) are rejected, a
+	// kill switch after a key leak. A later cutoff stored in Redis by the admin
+	// API overrides it and is picked up every MinIssuedAtRefresh.
+	MinIssuedAt        string
+	MinIssuedAtRefresh time.Duration
+}
+
+type AuthConfig struct {
+	UserCacheTTL      time.Duration
+	AdminPhoneNumbers []string
+
+	// SHA-256 hex of an emergency super-admin bearer token (empty disables)
+	BreakGlassTokenHash string
+}
+
+type UserConfig struct {
+	// Soft-deleted users older than PurgeAfter are hard-deleted (0 disables)
+	PurgeAfter     time.Duration
+	PurgeInterval  time.Duration
+	PurgeBatchSize int
+	PurgeDryRun    bool
+
+	// DELETE /users/profile erases the row at once instead of soft-deleting it,
+	// for jurisdictions that require full erasure
+	HardDelete bool
+
+	// Bounds on the phone_number search term in GET /users
+	SearchMinLength int
+	SearchMaxLength int
+
+	// Respond 404 instead of 200 with an empty list when a phone search matches
+	// nothing; clients can override it per request with ?not_found_404=
+	SearchNotFound404 bool
+
+	// Privacy mode: phone numbers are stored as an HMAC keyed by PhoneHMACKey
+	// (empty disables). PhoneEncryptionKey, 32 bytes hex, keeps them readable;
+	// without it they are write-only.
+	PhoneHMACKey       string
+	PhoneEncryptionKey string
+
+	// Region (ISO 3166 code, e.g. "US") assumed for stored numbers without a
+	// country code when -normalize-phones converts legacy rows to E.164
+	PhoneDefaultRegion string
+
+	// Users looked up at sign-in are kept this long so the profile fetch that
+	// follows is served from memory; 0 turns the cache off
+	ProfileCacheTTL time.Duration
+
+	// One-time SMS sent in the background when a user first registers
+	WelcomeSMSEnabled  bool
+	WelcomeSMSTemplate string
 }
 
 type OTPConfig struct {
-	Length         int
-	ExpiryMinutes  int
-	MaxAttempts    int
+	Length          int
+	ExpiryMinutes   int
+	MaxAttempts     int
 	RateLimitWindow time.Duration
+	ExtractDigits   bool
+	BindDevice      bool
+
+	// ISO 3166 region (e.g. "US") for numbers entered without a leading +;
+	// empty requires international format
+	DefaultRegion string
+	// RequireE164 refuses numbers not already sent in E.164, so a client sends
+	// and verifies the exact form it stores instead of relying on normalization
+	RequireE164 bool
+
+	// DebugLog writes codes sent through the console providers to the log, for
+	// local development only; otherwise just a masked destination is logged
+	DebugLog bool
+
+	// In "totp" mode a user's first SMS sign-in enrolls them in an authenticator
+	// app; later sign-ins verify its TOTP codes, accepting TOTPSkew steps of
+	// clock drift either way
+	Mode       string
+	TOTPIssuer string
+	TOTPPeriod time.Duration
+	TOTPSkew   int
+
+	// Minimum gap between sends to one number while its OTP is pending (0 disables)
+	ResendCooldown time.Duration
+
+	// Each failed verify in RateLimitWindow adds ResendCooldownPerFailure to
+	// the cooldown, capped at ResendCooldownMax (0 per failure disables)
+	ResendCooldownPerFailure time.Duration
+	ResendCooldownMax        time.Duration
+
+	// Characters codes are drawn from; letters must be upper case and are
+	// matched case-insensitively. Defaults to digits.
+	Alphabet string
+
+	// Append a Luhn check digit so typos are caught without spending an attempt
+	CheckDigit bool
+
+	// HMAC keys for storing OTP codes hashed (empty stores them as-is). The
+	// first key hashes new codes; the rest still verify codes issued before a
+	// rotation.
+	HashKeys []string
+
+	// Issue a one-time form token on send that the verify form must echo back
+	FormToken bool
+
+	// text/template for the send response's display_message (empty omits it)
+	DisplayMessageTemplate string
+
+	// After n wrong guesses on an OTP the next verify must wait
+	// VerifyBackoffBase * 2^n, capped at VerifyBackoffMax (0 base disables)
+	VerifyBackoffBase time.Duration
+	VerifyBackoffMax  time.Duration
+
+	// Cluster-wide lock held while one instance sends to a phone (0 disables)
+	SendLockTTL time.Duration
+
+	// Report an OTP that Redis evicted before its TTL as a retryable outage
+	// instead of as expired
+	EvictionUnavailable bool
+
+	// Failed verifies allowed per phone across resends within RateLimitWindow (0 disables)
+	CumulativeVerifyBudget int
+
+	// Regional SMS "from" IDs as "+<prefix>=<sender ID>"; longest prefix wins
+	// and unmatched numbers use DefaultSenderID
+	SenderIDs       []string
+	DefaultSenderID string
+
+	// Resends within one OTP session before the client may offer a voice call (0 disables)
+	VoiceFallbackAfterResends int
+
+	// Channels a session escalates through, one step per resend, starting from
+	// the channel the user signed in with (e.g. sms,voice,email; empty disables)
+	EscalationOrder []string
+
+	// Quiet hours: sends are refused inside a local "HH:MM-HH:MM" window (empty disables).
+	// Timezones map number prefixes to IANA zones, e.g. "+98=Asia/Tehran".
+	QuietHours                string
+	QuietHoursTimezones       []string
+	QuietHoursDefaultTimezone string
+
+	// Count a send against the rate limit only once the provider accepted it
+	FreeResendOnFailure bool
+
+	// Escalating backoff: each limit hit within the decay period doubles the next window
+	RateLimitBackoff              bool
+	RateLimitBackoffMaxMultiplier int
+	RateLimitBackoffDecay         time.Duration
+}
+
+type SMSConfig struct {
+	// "console" logs codes instead of delivering them; "twilio" sends real SMS
+	Provider string
+	Twilio   TwilioConfig
+
+	// Format OTP SMS for Android's SMS Retriever API: a "<#> " prefix and the
+	// app's 11-character hash on the last line, so the app can read the code
+	RetrieverFormat bool
+	AppHash         string
+}
+
+type TwilioConfig struct {
+	AccountSID string
+	AuthToken  string
+	FromNumber string
+	BaseURL    string
+
+	// text/template for the OTP SMS body, rendered with {{.Code}}
+	MessageTemplate string
+
+	// Per-request timeout; connection failures and 429 responses are retried
+	// MaxRetries times, waiting RetryBackoff * 2^n before retry n. 5xx
+	// responses are not, since Twilio may already have sent the message.
+	Timeout      time.Duration
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+type EmailConfig struct {
+	// "console" logs codes instead of delivering them; "smtp" sends real email;
+	// "none" turns off email sign-in
+	Provider string
+	SMTP     SMTPConfig
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+
+	// Subject line, and the text/template for the body rendered with {{.Code}}
+	Subject         string
+	MessageTemplate string
 }
 
+// Load reads the configuration. Each setting comes from its environment
+// variable if set, else from the optional CONFIG_FILE, else its default.
 func Load() *Config {
-	return &Config{
+	malformed = nil
+	fileValues = nil
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			malformed = append(malformed, fmt.Sprintf("CONFIG_FILE=%q could not be read: %v", path, err))
+		}
+		fileValues = values
+	}
+
+	cfg := &Config{
+		Env: getEnv("ENV", EnvDev),
+
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "localhost"),
-			Port: getEnv("SERVER_PORT", "8080"),
+			Host:            getEnv("SERVER_HOST", "localhost"),
+			Port:            getEnv("SERVER_PORT", "8080"),
+			MaintenanceMode: getEnvAsBool("MAINTENANCE_MODE", false),
+
+			StrictVersionCheck: getEnvAsBool("STRICT_VERSION_CHECK", false),
+
+			StatsEnabled: getEnvAsBool("ADMIN_STATS_ENABLED", true),
+
+			AccessLogFormat: getEnv("SERVER_ACCESS_LOG_FORMAT", "json"),
+
+			LogConfigSummary: getEnvAsBool("SERVER_LOG_CONFIG_SUMMARY", true),
+
+			RateLimitMax:    getEnvAsInt("SERVER_RATE_LIMIT_MAX", 100),
+			RateLimitWindow: time.Duration(getEnvAsInt("SERVER_RATE_LIMIT_WINDOW_SECONDS", 60)) * time.Second,
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -61,24 +358,170 @@ func Load() *Config {
 			Password: getEnv("DB_PASSWORD", "postgres"),
 			DBName:   getEnv("DB_NAME", "otp_service"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			MinVersion: getEnv("DB_MIN_VERSION", "13"),
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
 			Port:     getEnv("REDIS_PORT", "6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
+
+			MinVersion: getEnv("REDIS_MIN_VERSION", "6.2"),
 		},
 		JWT: JWTConfig{
-			SecretKey:   getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-			ExpiryHours: getEnvAsInt("JWT_EXPIRY_HOURS", 24),
+			SecretKey:          getEnv("JWT_SECRET", DefaultJWTSecret),
+			ExpiryHours:        getEnvAsInt("JWT_EXPIRY_HOURS", 24),
+			RefreshExpiryHours: getEnvAsInt("JWT_REFRESH_EXPIRY_HOURS", 720),
+
+			Issuer:   getEnv("JWT_ISSUER", ""),
+			Audience: getEnv("JWT_AUDIENCE", ""),
+
+			Keys: getEnvAsSlice("JWT_KEYS", nil),
+
+			Algorithm:      getEnv("JWT_ALGORITHM", "HS256"),
+			PrivateKeyFile: getEnv("JWT_PRIVATE_KEY_FILE", ""),
+			PublicKeyFile:  getEnv("JWT_PUBLIC_KEY_FILE", ""),
+
+			PreviousPublicKeyFiles: getEnvAsSlice("JWT_PREVIOUS_PUBLIC_KEY_FILES", nil),
+
+			PhoneClaim: getEnv("JWT_PHONE_CLAIM", "full"),
+
+			MinIssuedAt:        getEnv("JWT_MIN_ISSUED_AT", ""),
+			MinIssuedAtRefresh: time.Duration(getEnvAsInt("JWT_MIN_ISSUED_AT_REFRESH_SECONDS", 10)) * time.Second,
+		},
+		Auth: AuthConfig{
+			UserCacheTTL:      time.Duration(getEnvAsInt("AUTH_USER_CACHE_SECONDS", 30)) * time.Second,
+			AdminPhoneNumbers: getEnvAsSlice("ADMIN_PHONE_NUMBERS", nil),
+
+			BreakGlassTokenHash: strings.ToLower(getEnv("BREAK_GLASS_TOKEN_HASH", "")),
 		},
 		OTP: OTPConfig{
 			Length:          getEnvAsInt("OTP_LENGTH", 6),
 			ExpiryMinutes:   getEnvAsInt("OTP_EXPIRY_MINUTES", 2),
 			MaxAttempts:     getEnvAsInt("OTP_MAX_ATTEMPTS", 3),
 			RateLimitWindow: time.Duration(getEnvAsInt("OTP_RATE_LIMIT_MINUTES", 10)) * time.Minute,
+			ExtractDigits:   getEnvAsBool("OTP_EXTRACT_DIGITS", false),
+			BindDevice:      getEnvAsBool("OTP_BIND_DEVICE", false),
+			DefaultRegion:   getEnv("OTP_DEFAULT_REGION", ""),
+			RequireE164:     getEnvAsBool("OTP_REQUIRE_E164", false),
+			DebugLog:        getEnvAsBool("OTP_DEBUG_LOG", false),
+			ResendCooldown:  time.Duration(getEnvAsInt("OTP_RESEND_COOLDOWN_SECONDS", 0)) * time.Second,
+			Alphabet:        getEnv("OTP_ALPHABET", "0123456789"),
+			CheckDigit:      getEnvAsBool("OTP_CHECK_DIGIT", false),
+			FormToken:       getEnvAsBool("OTP_FORM_TOKEN", false),
+			HashKeys:        getEnvAsSlice("OTP_HASH_KEYS", nil),
+
+			Mode:       getEnv("OTP_MODE", OTPModeSMS),
+			TOTPIssuer: getEnv("OTP_TOTP_ISSUER", "OTP Service"),
+			TOTPPeriod: time.Duration(getEnvAsInt("OTP_TOTP_PERIOD_SECONDS", 30)) * time.Second,
+			TOTPSkew:   getEnvAsInt("OTP_TOTP_SKEW_STEPS", 1),
+
+			ResendCooldownPerFailure: time.Duration(getEnvAsInt("OTP_RESEND_COOLDOWN_PER_FAILURE_SECONDS", 0)) * time.Second,
+			ResendCooldownMax:        time.Duration(getEnvAsInt("OTP_RESEND_COOLDOWN_MAX_SECONDS", 300)) * time.Second,
+
+			DisplayMessageTemplate: getEnv("OTP_DISPLAY_MESSAGE_TEMPLATE", ""),
+
+			VerifyBackoffBase: time.Duration(getEnvAsInt("OTP_VERIFY_BACKOFF_BASE_SECONDS", 0)) * time.Second,
+			VerifyBackoffMax:  time.Duration(getEnvAsInt("OTP_VERIFY_BACKOFF_MAX_SECONDS", 300)) * time.Second,
+
+			SendLockTTL: time.Duration(getEnvAsInt("OTP_SEND_LOCK_SECONDS", 5)) * time.Second,
+
+			EvictionUnavailable: getEnvAsBool("OTP_EVICTION_UNAVAILABLE", true),
+
+			CumulativeVerifyBudget: getEnvAsInt("OTP_CUMULATIVE_VERIFY_BUDGET", 0),
+
+			SenderIDs:       getEnvAsSlice("OTP_SENDER_IDS", nil),
+			DefaultSenderID: getEnv("OTP_DEFAULT_SENDER_ID", ""),
+
+			VoiceFallbackAfterResends: getEnvAsInt("OTP_VOICE_FALLBACK_AFTER_RESENDS", 0),
+
+			EscalationOrder: getEnvAsSlice("OTP_ESCALATION_ORDER", nil),
+
+			QuietHours:                getEnv("OTP_QUIET_HOURS", ""),
+			QuietHoursTimezones:       getEnvAsSlice("OTP_QUIET_HOURS_TIMEZONES", nil),
+			QuietHoursDefaultTimezone: getEnv("OTP_QUIET_HOURS_DEFAULT_TIMEZONE", ""),
+
+			FreeResendOnFailure: getEnvAsBool("OTP_FREE_RESEND_ON_FAILURE", false),
+
+			RateLimitBackoff:              getEnvAsBool("OTP_RATE_LIMIT_BACKOFF", false),
+			RateLimitBackoffMaxMultiplier: getEnvAsInt("OTP_RATE_LIMIT_BACKOFF_MAX_MULTIPLIER", 8),
+			RateLimitBackoffDecay:         time.Duration(getEnvAsInt("OTP_RATE_LIMIT_BACKOFF_DECAY_MINUTES", 60)) * time.Minute,
+		},
+		User: UserConfig{
+			PurgeAfter:     time.Duration(getEnvAsInt("USER_PURGE_AFTER_DAYS", 0)) * 24 * time.Hour,
+			PurgeInterval:  time.Duration(getEnvAsInt("USER_PURGE_INTERVAL_MINUTES", 60)) * time.Minute,
+			PurgeBatchSize: getEnvAsInt("USER_PURGE_BATCH_SIZE", 500),
+			PurgeDryRun:    getEnvAsBool("USER_PURGE_DRY_RUN", false),
+			HardDelete:     getEnvAsBool("USER_HARD_DELETE", false),
+
+			SearchMinLength: getEnvAsInt("USER_SEARCH_MIN_LENGTH", 3),
+			SearchMaxLength: getEnvAsInt("USER_SEARCH_MAX_LENGTH", 16),
+
+			SearchNotFound404: getEnvAsBool("USER_SEARCH_NOT_FOUND_404", false),
+
+			PhoneHMACKey:       getEnv("USER_PHONE_HMAC_KEY", ""),
+			PhoneEncryptionKey: getEnv("USER_PHONE_ENCRYPTION_KEY", ""),
+
+			PhoneDefaultRegion: getEnv("USER_PHONE_DEFAULT_REGION", ""),
+
+			ProfileCacheTTL: time.Duration(getEnvAsInt("USER_PROFILE_CACHE_SECONDS", 0)) * time.Second,
+
+			WelcomeSMSEnabled:  getEnvAsBool("WELCOME_SMS_ENABLED", false),
+			WelcomeSMSTemplate: getEnv("WELCOME_SMS_TEMPLATE", "Welcome! Your account for {{.PhoneNumber}} is ready."),
+		},
+		SMS: SMSConfig{
+			Provider: getEnv("SMS_PROVIDER", "console"),
+
+			RetrieverFormat: getEnvAsBool("SMS_RETRIEVER_FORMAT", false),
+			AppHash:         getEnv("SMS_APP_HASH", ""),
+
+			Twilio: TwilioConfig{
+				AccountSID: getEnv("TWILIO_ACCOUNT_SID", ""),
+				AuthToken:  getEnv("TWILIO_AUTH_TOKEN", ""),
+				FromNumber: getEnv("TWILIO_FROM_NUMBER", ""),
+				BaseURL:    getEnv("TWILIO_BASE_URL", "https://api.twilio.com"),
+
+				MessageTemplate: getEnv("TWILIO_MESSAGE_TEMPLATE", "Your code is {{.Code}}"),
+
+				Timeout:      time.Duration(getEnvAsInt("TWILIO_TIMEOUT_SECONDS", 10)) * time.Second,
+				MaxRetries:   getEnvAsInt("TWILIO_MAX_RETRIES", 2),
+				RetryBackoff: time.Duration(getEnvAsInt("TWILIO_RETRY_BACKOFF_MS", 500)) * time.Millisecond,
+			},
 		},
+		Email: EmailConfig{
+			Provider: getEnv("EMAIL_PROVIDER", "console"),
+
+			SMTP: SMTPConfig{
+				Host:     getEnv("SMTP_HOST", ""),
+				Port:     getEnvAsInt("SMTP_PORT", 587),
+				Username: getEnv("SMTP_USERNAME", ""),
+				Password: getEnv("SMTP_PASSWORD", ""),
+				From:     getEnv("SMTP_FROM", ""),
+
+				Subject:         getEnv("SMTP_SUBJECT", "Your verification code"),
+				MessageTemplate: getEnv("SMTP_MESSAGE_TEMPLATE", "Your code is {{.Code}}"),
+			},
+		},
+	}
+	cfg.malformed = malformed
+	return cfg
+}
+
+// JWTMinIssuedAt parses JWT_MIN_ISSUED_AT; the zero time means no cutoff
+func (c *Config) JWTMinIssuedAt() (time.Time, error) {
+	value := strings.TrimSpace(c.JWT.MinIssuedAt)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("JWT_MIN_ISSUED_AT must be RFC 3339 or Unix seconds: %w", err)
 	}
+	return t, nil
 }
 
 func (c *Config) DatabaseDSN() string {
@@ -98,13 +541,49 @@ func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
+	if value, exists := fileValues[key]; exists {
+		return value
+	}
 	return defaultValue
 }
 
+// malformed collects the variables Load could not parse; Load runs once at
+// startup, before anything else reads the configuration
+var malformed []string
+
 func getEnvAsInt(key string, defaultValue int) int {
 	valueStr := getEnv(key, "")
 	if value, err := strconv.Atoi(valueStr); err == nil {
 		return value
 	}
+	if valueStr != "" {
+		malformed = append(malformed, fmt.Sprintf("%s=%q is not a whole number", key, valueStr))
+	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	if valueStr != "" {
+		malformed = append(malformed, fmt.Sprintf("%s=%q is not true or false", key, valueStr))
+	}
+	return defaultValue
+}
+
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	var values []string
+	for _, value := range strings.Split(valueStr, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileValues holds the settings read from CONFIG_FILE, keyed by environment
+// variable name. getEnv consults them after the environment and before the
+// built-in defaults, so the precedence is: environment, then CONFIG_FILE, then
+// defaults.
+var fileValues map[string]string
+
+// readConfigFile loads a YAML (or JSON) file whose keys are the environment
+// variable names, in any case. Nested maps join their keys with "_", so
+//
+//	otp:
+//	  length: 8
+//
+// sets OTP_LENGTH, and lists become the comma-separated form the variables
+// take. Values are taken as written, so +14155550100 keeps its plus sign.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	if len(doc.Content) == 0 {
+		return values, nil
+	}
+	if err := flattenConfig("", doc.Content[0], values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func flattenConfig(name string, node *yaml.Node, values map[string]string) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := strings.ToUpper(node.Content[i].Value)
+			if name != "" {
+				key = name + "_" + key
+			}
+			if err := flattenConfig(key, node.Content[i+1], values); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		items := make([]string, len(node.Content))
+		for i, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("%s: list items must be plain values", name)
+			}
+			items[i] = item.Value
+		}
+		values[name] = strings.Join(items, ",")
+	case yaml.ScalarNode:
+		if name == "" {
+			return fmt.Errorf("line %d: expected a map of settings", node.Line)
+		}
+		if node.Tag == "!!null" {
+			values[name] = ""
+		} else {
+			values[name] = node.Value
+		}
+	}
+	return nil
+}
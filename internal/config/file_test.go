@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoad_ConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  port: 9090
+otp:
+  length: 8
+  expiry_minutes: 5
+  rate_limit_minutes: 30
+admin_phone_numbers:
+  - +14155550100
+  - +14155550101
+JWT_ISSUER: https://auth.example.com
+redis_password: ~
+`)
+	t.Setenv("CONFIG_FILE", path)
+	// The environment wins over the file
+	t.Setenv("OTP_EXPIRY_MINUTES", "3")
+
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error = %v", err)
+	}
+
+	if cfg.Server.Port != "9090" {
+		t.Errorf("Server.Port = %q, want 9090 from the file", cfg.Server.Port)
+	}
+	if cfg.OTP.Length != 8 {
+		t.Errorf("OTP.Length = %d, want 8 from the file", cfg.OTP.Length)
+	}
+	if cfg.OTP.ExpiryMinutes != 3 {
+		t.Errorf("OTP.ExpiryMinutes = %d, want 3 from the environment", cfg.OTP.ExpiryMinutes)
+	}
+	if cfg.OTP.RateLimitWindow != 30*time.Minute {
+		t.Errorf("OTP.RateLimitWindow = %v, want 30m from the file", cfg.OTP.RateLimitWindow)
+	}
+	if want := []string{"+14155550100", "+14155550101"}; !slices.Equal(cfg.Auth.AdminPhoneNumbers, want) {
+		t.Errorf("Auth.AdminPhoneNumbers = %v, want %v", cfg.Auth.AdminPhoneNumbers, want)
+	}
+	if cfg.JWT.Issuer != "https://auth.example.com" {
+		t.Errorf("JWT.Issuer = %q, want the file value", cfg.JWT.Issuer)
+	}
+	if cfg.Redis.Password != "" {
+		t.Errorf("Redis.Password = %q, want empty", cfg.Redis.Password)
+	}
+	// Untouched settings keep their defaults
+	if cfg.Server.Host != "localhost" || cfg.OTP.MaxAttempts != 3 {
+		t.Errorf("Server.Host = %q, OTP.MaxAttempts = %d, want the defaults", cfg.Server.Host, cfg.OTP.MaxAttempts)
+	}
+	if got := cfg.DatabaseDSN(); !strings.Contains(got, "port=5432") {
+		t.Errorf("DatabaseDSN() = %q, want the default port", got)
+	}
+	if got := cfg.ServerAddr(); got != "localhost:9090" {
+		t.Errorf("ServerAddr() = %q, want localhost:9090", got)
+	}
+}
+
+func TestLoad_ConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"Not YAML", "otp: [length"},
+		{"Not a map", "just a string"},
+		{"Nested list items", "admin_phone_numbers:\n  - number: +14155550100\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", writeConfigFile(t, tt.contents))
+
+			err := Load().Validate()
+			if err == nil || !strings.Contains(err.Error(), "CONFIG_FILE") {
+				t.Errorf("Validate() error = %v, want one about CONFIG_FILE", err)
+			}
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+		if err := Load().Validate(); err == nil || !strings.Contains(err.Error(), "CONFIG_FILE") {
+			t.Errorf("Validate() error = %v, want one about CONFIG_FILE", err)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Redacted stands in for a secret that is set; an unset one shows as ""
+const Redacted = "[redacted]"
+
+// Summary is the effective configuration for the startup log, keyed by
+// section.setting. Secrets only show whether they are set, and admin phone
+// numbers only how many there are.
+func (c *Config) Summary() map[string]interface{} {
+	return map[string]interface{}{
+		"env": c.Env,
+
+		"server.addr":              c.ServerAddr(),
+		"server.maintenance_mode":  c.Server.MaintenanceMode,
+		"server.access_log_format": c.Server.AccessLogFormat,
+		"server.stats_enabled":     c.Server.StatsEnabled,
+		"server.rate_limit_max":    c.Server.RateLimitMax,
+		"server.rate_limit_window": c.Server.RateLimitWindow.String(),
+
+		"database.target":   fmt.Sprintf("%s@%s:%s/%s", c.Database.User, c.Database.Host, c.Database.Port, c.Database.DBName),
+		"database.sslmode":  c.Database.SSLMode,
+		"database.password": redact(c.Database.Password),
+
+		"redis.target":   fmt.Sprintf("%s/%d", c.RedisAddr(), c.Redis.DB),
+		"redis.password": redact(c.Redis.Password),
+
+		"jwt.algorithm":            c.JWT.Algorithm,
+		"jwt.secret":               redact(c.JWT.SecretKey),
+		"jwt.key_ids":              keyIDs(c.JWT.Keys),
+		"jwt.expiry_hours":         c.JWT.ExpiryHours,
+		"jwt.refresh_expiry_hours": c.JWT.RefreshExpiryHours,
+		"jwt.issuer":               c.JWT.Issuer,
+		"jwt.audience":             c.JWT.Audience,
+		"jwt.phone_claim":          c.JWT.PhoneClaim,
+		"jwt.min_issued_at":        c.JWT.MinIssuedAt,
+
+		"auth.admin_phone_numbers": len(c.Auth.AdminPhoneNumbers),
+		"auth.break_glass_token":   redact(c.Auth.BreakGlassTokenHash),
+
+		"otp.mode":              c.OTP.Mode,
+		"otp.debug_log":         c.OTP.DebugLog,
+		"otp.length":            c.OTP.Length,
+		"otp.expiry_minutes":    c.OTP.ExpiryMinutes,
+		"otp.max_attempts":      c.OTP.MaxAttempts,
+		"otp.rate_limit_window": c.OTP.RateLimitWindow.String(),
+		"otp.resend_cooldown":   c.OTP.ResendCooldown.String(),
+		"otp.escalation_order":  strings.Join(c.OTP.EscalationOrder, ","),
+		"otp.default_region":    c.OTP.DefaultRegion,
+		"otp.quiet_hours":       c.OTP.QuietHours,
+		"otp.hash_keys":         redact(strings.Join(c.OTP.HashKeys, ",")),
+
+		"user.purge_after":          c.User.PurgeAfter.String(),
+		"user.hard_delete":          c.User.HardDelete,
+		"user.phone_hmac_key":       redact(c.User.PhoneHMACKey),
+		"user.phone_encryption_key": redact(c.User.PhoneEncryptionKey),
+		"user.profile_cache_ttl":    c.User.ProfileCacheTTL.String(),
+
+		"sms.provider":           c.SMS.Provider,
+		"sms.twilio.account_sid": redact(c.SMS.Twilio.AccountSID),
+		"sms.twilio.auth_token":  redact(c.SMS.Twilio.AuthToken),
+		"sms.twilio.from_number": c.SMS.Twilio.FromNumber,
+
+		"email.provider":      c.Email.Provider,
+		"email.smtp.target":   fmt.Sprintf("%s:%d", c.Email.SMTP.Host, c.Email.SMTP.Port),
+		"email.smtp.from":     c.Email.SMTP.From,
+		"email.smtp.password": redact(c.Email.SMTP.Password),
+	}
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// keyIDs lists the kids of JWT_KEYS entries ("kid:secret") without their secrets
+func keyIDs(keys []string) string {
+	kids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		kid, _, _ := strings.Cut(key, ":")
+		kids = append(kids, kid)
+	}
+	return strings.Join(kids, ",")
+}
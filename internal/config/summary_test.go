@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Summary(t *testing.T) {
+	cfg := &Config{
+		Server:   ServerConfig{Host: "0.0.0.0", Port: "8080"},
+		Database: DatabaseConfig{Host: "db", Port: "5432", User: "otp", Password: "db-password", DBName: "otp_service"},
+		Redis:    RedisConfig{Host: "cache", Port: "6379", Password: "redis-password"},
+		JWT:      JWTConfig{SecretKey: "jwt-secret", Keys: []string{"2024:rotated-secret"}, ExpiryHours: 24},
+		Auth:     AuthConfig{AdminPhoneNumbers: []string{"+14155550100"}},
+		OTP:      OTPConfig{Length: 6, ExpiryMinutes: 2, RateLimitWindow: 10 * time.Minute, HashKeys: []string{"otp-hash-key"}},
+		SMS:      SMSConfig{Provider: "twilio", Twilio: TwilioConfig{AuthToken: "twilio-token"}},
+	}
+
+	summary := cfg.Summary()
+
+	want := map[string]interface{}{
+		"server.addr":              "0.0.0.0:8080",
+		"database.target":          "otp@db:5432/otp_service",
+		"redis.target":             "cache:6379/0",
+		"jwt.key_ids":              "2024",
+		"jwt.expiry_hours":         24,
+		"otp.length":               6,
+		"otp.rate_limit_window":    "10m0s",
+		"sms.provider":             "twilio",
+		"auth.admin_phone_numbers": 1,
+		"jwt.secret":               Redacted,
+		"redis.password":           Redacted,
+		"database.password":        Redacted,
+		"email.smtp.password":      "",
+	}
+	for key, value := range want {
+		if summary[key] != value {
+			t.Errorf("Summary()[%q] = %v, want %v", key, summary[key], value)
+		}
+	}
+
+	encoded, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("Failed to encode summary: %v", err)
+	}
+	for _, secret := range []string{"jwt-secret", "rotated-secret", "redis-password", "db-password", "otp-hash-key", "twilio-token", "+14155550100"} {
+		if strings.Contains(string(encoded), secret) {
+			t.Errorf("Summary leaks %q: %s", secret, encoded)
+		}
+	}
+}
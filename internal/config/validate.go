@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Validate reports every setting the service cannot safely start with, so one
+// restart fixes them all. Values that failed to parse are included, since Load
+// quietly falls back to their defaults.
+func (c *Config) Validate() error {
+	var errs []error
+	for _, problem := range c.malformed {
+		errs = append(errs, errors.New(problem))
+	}
+
+	switch c.Env {
+	case EnvDev, EnvProd:
+	default:
+		errs = append(errs, fmt.Errorf("ENV=%q must be %s or %s", c.Env, EnvDev, EnvProd))
+	}
+
+	for name, port := range map[string]string{
+		"SERVER_PORT": c.Server.Port,
+		"DB_PORT":     c.Database.Port,
+		"REDIS_PORT":  c.Redis.Port,
+	} {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			errs = append(errs, fmt.Errorf("%s=%q must be a port between 1 and 65535", name, port))
+		}
+	}
+
+	if c.OTP.Length < 4 || c.OTP.Length > 10 {
+		errs = append(errs, fmt.Errorf("OTP_LENGTH=%d must be between 4 and 10", c.OTP.Length))
+	}
+	if c.OTP.ExpiryMinutes <= 0 {
+		errs = append(errs, fmt.Errorf("OTP_EXPIRY_MINUTES=%d must be positive", c.OTP.ExpiryMinutes))
+	}
+	if c.OTP.MaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("OTP_MAX_ATTEMPTS=%d must be positive", c.OTP.MaxAttempts))
+	}
+
+	if c.Env == EnvProd && c.UsesDefaultJWTSecret() {
+		errs = append(errs, errors.New("JWT_SECRET must be set to a real secret when ENV=prod"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// placeholderJWTSecrets are the secrets shipped in the code and .env.example
+var placeholderJWTSecrets = []string{DefaultJWTSecret, "your-super-secret-jwt-key-change-in-production"}
+
+// UsesDefaultJWTSecret reports whether HS256 tokens would be signed or verified
+// with a placeholder secret anyone can read in the repository. RS256 never
+// uses JWT_SECRET.
+func (c *Config) UsesDefaultJWTSecret() bool {
+	return c.JWT.Algorithm != "RS256" && slices.Contains(placeholderJWTSecrets, c.JWT.SecretKey)
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func validConfig() *Config {
+	return &Config{
+		Env:      EnvDev,
+		Server:   ServerConfig{Port: "8080"},
+		Database: DatabaseConfig{Port: "5432"},
+		Redis:    RedisConfig{Port: "6379"},
+		JWT:      JWTConfig{SecretKey: DefaultJWTSecret, Algorithm: "HS256"},
+		OTP:      OTPConfig{Length: 6, ExpiryMinutes: 2, MaxAttempts: 3},
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{name: "Defaults in dev", modify: func(c *Config) {}},
+		{name: "Real secret in prod", modify: func(c *Config) { c.Env, c.JWT.SecretKey = EnvProd, "a-real-secret" }},
+		{name: "RS256 ignores the secret in prod", modify: func(c *Config) { c.Env, c.JWT.Algorithm = EnvProd, "RS256" }},
+		{name: "Default secret in prod", modify: func(c *Config) { c.Env = EnvProd }, wantErr: "JWT_SECRET"},
+		{name: "Example secret in prod", modify: func(c *Config) {
+			c.Env, c.JWT.SecretKey = EnvProd, "your-super-secret-jwt-key-change-in-production"
+		}, wantErr: "JWT_SECRET"},
+		{name: "Unknown env", modify: func(c *Config) { c.Env = "staging" }, wantErr: "ENV"},
+		{name: "OTP too short", modify: func(c *Config) { c.OTP.Length = 3 }, wantErr: "OTP_LENGTH"},
+		{name: "OTP too long", modify: func(c *Config) { c.OTP.Length = 11 }, wantErr: "OTP_LENGTH"},
+		{name: "No expiry", modify: func(c *Config) { c.OTP.ExpiryMinutes = 0 }, wantErr: "OTP_EXPIRY_MINUTES"},
+		{name: "No attempts", modify: func(c *Config) { c.OTP.MaxAttempts = 0 }, wantErr: "OTP_MAX_ATTEMPTS"},
+		{name: "Port out of range", modify: func(c *Config) { c.Server.Port = "70000" }, wantErr: "SERVER_PORT"},
+		{name: "Port not a number", modify: func(c *Config) { c.Redis.Port = "redis" }, wantErr: "REDIS_PORT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want one mentioning %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_MalformedEnv(t *testing.T) {
+	t.Setenv("OTP_LENGTH", "abc")
+	t.Setenv("OTP_BIND_DEVICE", "maybe")
+
+	cfg := Load()
+	if cfg.OTP.Length != 6 {
+		t.Errorf("OTP.Length = %d, want the default 6", cfg.OTP.Length)
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() accepted malformed variables")
+	}
+	for _, want := range []string{`OTP_LENGTH="abc"`, `OTP_BIND_DEVICE="maybe"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want it to mention %s", err, want)
+		}
+	}
+}
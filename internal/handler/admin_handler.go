@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/service"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/stats"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	maintenanceService service.MaintenanceService
+	userService        service.UserService
+	tokenCutoff        service.TokenCutoffService
+	counters           *stats.Counters
+}
+
+// NewAdminHandler takes nil counters when in-memory stats are disabled
+func NewAdminHandler(maintenanceService service.MaintenanceService, userService service.UserService, tokenCutoff service.TokenCutoffService, counters *stats.Counters) *AdminHandler {
+	return &AdminHandler{
+		maintenanceService: maintenanceService,
+		userService:        userService,
+		tokenCutoff:        tokenCutoff,
+		counters:           counters,
+	}
+}
+
+// GetMaintenance godoc
+// @Summary Get maintenance mode status
+// @Description Report whether write endpoints are currently rejected for maintenance
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} model.MaintenanceStatusResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/maintenance [get]
+func (h *AdminHandler) GetMaintenance(c *fiber.Ctx) error {
+	status, err := h.maintenanceService.Status(c.UserContext())
+	if err != nil {
+		return utils.InternalError(c, utils.Message(c, "error.get_maintenance_failed"))
+	}
+
+	return c.JSON(status)
+}
+
+// GetTokenCutoff godoc
+// @Summary Get the token cutoff
+// @Description Report the time before which every issued token is rejected, if any
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} model.TokenCutoffResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/token-cutoff [get]
+func (h *AdminHandler) GetTokenCutoff(c *fiber.Ctx) error {
+	status, err := h.tokenCutoff.Status(c.UserContext())
+	if err != nil {
+		return utils.InternalError(c, utils.Message(c, "error.get_token_cutoff_failed"))
+	}
+
+	return c.JSON(status)
+}
+
+// SetTokenCutoff godoc
+// @Summary Reject all issued tokens
+// @Description Enabled rejects every access and refresh token issued until now, the caller's included; every user has to sign in again. Disabled lifts the runtime cutoff, leaving JWT_MIN_ISSUED_AT in force. Other instances apply the change within JWT_MIN_ISSUED_AT_REFRESH_SECONDS.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.SetTokenCutoffRequest true "Token cutoff settings"
+// @Success 200 {object} model.TokenCutoffResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/token-cutoff [put]
+func (h *AdminHandler) SetTokenCutoff(c *fiber.Ctx) error {
+	var req model.SetTokenCutoffRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_request_body"))
+	}
+
+	var (
+		status *model.TokenCutoffResponse
+		err    error
+	)
+	if req.Enabled {
+		status, err = h.tokenCutoff.Enable(c.UserContext())
+	} else {
+		status, err = h.tokenCutoff.Disable(c.UserContext())
+	}
+	if err != nil {
+		return utils.InternalError(c, utils.Message(c, "error.update_token_cutoff_failed"))
+	}
+
+	return c.JSON(status)
+}
+
+// SetMaintenance godoc
+// @Summary Toggle maintenance mode
+// @Description Enable maintenance mode (optionally for a limited duration) or disable it
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.SetMaintenanceRequest true "Maintenance settings"
+// @Success 200 {object} model.MaintenanceStatusResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/maintenance [put]
+func (h *AdminHandler) SetMaintenance(c *fiber.Ctx) error {
+	var req model.SetMaintenanceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_request_body"))
+	}
+
+	if req.DurationMinutes < 0 {
+		return utils.BadRequest(c, utils.Message(c, "error.negative_duration"))
+	}
+
+	var (
+		status *model.MaintenanceStatusResponse
+		err    error
+	)
+	if req.Enabled {
+		status, err = h.maintenanceService.Enable(c.UserContext(), time.Duration(req.DurationMinutes)*time.Minute)
+	} else {
+		status, err = h.maintenanceService.Disable(c.UserContext())
+	}
+	if err != nil {
+		return utils.InternalError(c, utils.Message(c, "error.update_maintenance_failed"))
+	}
+
+	return c.JSON(status)
+}
+
+// SetUserStatus godoc
+// @Summary Change a user's account status
+// @Description Move a user between active, suspended, pending and deactivated; only active users can sign in
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body model.SetUserStatusRequest true "New status"
+// @Success 200 {object} model.UserResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/users/{id}/status [put]
+func (h *AdminHandler) SetUserStatus(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_user_id"))
+	}
+
+	var req model.SetUserStatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_request_body"))
+	}
+	if err := req.Validate(); err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_user_status"))
+	}
+
+	user, err := h.userService.SetUserStatus(c.UserContext(), uint(id), req.Status)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
+		}
+		return utils.InternalError(c, utils.Message(c, "error.update_user_status_failed"))
+	}
+
+	return c.JSON(user)
+}
+
+// GetStats godoc
+// @Summary Get in-memory auth stats
+// @Description Cumulative send and verify counts and today's active users since this instance started; counts reset on restart
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} model.StatsResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /admin/stats [get]
+func (h *AdminHandler) GetStats(c *fiber.Ctx) error {
+	if h.counters == nil {
+		return utils.NotFound(c, utils.Message(c, "error.stats_disabled"))
+	}
+
+	snapshot := h.counters.Snapshot()
+	return c.JSON(model.StatsResponse{
+		Sends:            snapshot.Sends,
+		SendFailures:     snapshot.SendFailures,
+		Verifies:         snapshot.Verifies,
+		VerifyFailures:   snapshot.VerifyFailures,
+		ActiveUsersToday: snapshot.ActiveUsersToday,
+		Since:            snapshot.Since,
+	})
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/middleware"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/stats"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdminHandler_SetUserStatus(t *testing.T) {
+	userService := &mockUserService{
+		users: map[uint]*model.User{
+			42: {ID: 42, PhoneNumber: "+1234567890", Status: model.UserStatusActive},
+		},
+	}
+
+	app := fiber.New()
+	app.Put("/admin/users/:id/status", NewAdminHandler(nil, userService, nil, nil).SetUserStatus)
+
+	tests := []struct {
+		name           string
+		userID         string
+		body           string
+		expectedStatus int
+		wantStatus     model.UserStatus
+	}{
+		{"Suspend user", "42", `{"status":"suspended"}`, fiber.StatusOK, model.UserStatusSuspended},
+		{"Reactivate user", "42", `{"status":"active"}`, fiber.StatusOK, model.UserStatusActive},
+		{"Unknown status", "42", `{"status":"banned"}`, fiber.StatusBadRequest, ""},
+		{"Missing status", "42", `{}`, fiber.StatusBadRequest, ""},
+		{"Invalid user ID", "abc", `{"status":"suspended"}`, fiber.StatusBadRequest, ""},
+		{"Unknown user", "7", `{"status":"suspended"}`, fiber.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/admin/users/"+tt.userID+"/status", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if tt.wantStatus != "" {
+				var user model.UserResponse
+				if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if user.Status != tt.wantStatus {
+					t.Errorf("Status = %q, want %q", user.Status, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminHandler_SetUserStatus_Messages(t *testing.T) {
+	userService := &mockUserService{users: map[uint]*model.User{}}
+
+	app := fiber.New()
+	app.Use(middleware.Locale())
+	app.Put("/admin/users/:id/status", NewAdminHandler(nil, userService, nil, nil).SetUserStatus)
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		userID         string
+		body           string
+		wantMessage    string
+	}{
+		{"Malformed body", "", "42", `{"status":`, "Request body is malformed"},
+		{"Unknown status", "", "42", `{"status":"banned"}`, "status must be one of active, suspended, pending, deactivated"},
+		{"Spanish invalid user ID", "es", "abc", `{"status":"suspended"}`, "Formato de ID de usuario no válido"},
+		{"Spanish unknown user", "es", "7", `{"status":"suspended"}`, "Usuario no encontrado"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/admin/users/"+tt.userID+"/status", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(fiber.HeaderAcceptLanguage, tt.acceptLanguage)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+
+			var response model.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", response.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_GetStats(t *testing.T) {
+	counters := stats.NewCounters()
+	counters.RecordSend(nil)
+	counters.RecordSend(errors.New("send failed"))
+	counters.RecordVerify(42, nil)
+
+	tests := []struct {
+		name           string
+		counters       *stats.Counters
+		expectedStatus int
+	}{
+		{"Enabled", counters, fiber.StatusOK},
+		{"Disabled", nil, fiber.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/admin/stats", NewAdminHandler(nil, nil, nil, tt.counters).GetStats)
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/admin/stats", nil))
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.counters == nil {
+				return
+			}
+
+			var response model.StatsResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Sends != 2 || response.SendFailures != 1 || response.Verifies != 1 || response.VerifyFailures != 0 || response.ActiveUsersToday != 1 {
+				t.Errorf("Response = %+v, want 2 sends, 1 send failure, 1 verify and 1 active user", response)
+			}
+		})
+	}
+}
@@ -2,43 +2,60 @@ package handler
 
 import (
 	"errors"
+	"log"
+	"time"
 
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
 	"github.com/ehsanshojaei/go-otp-auth/internal/service"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
 	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	authService service.AuthService
+	authService    service.AuthService
+	tokenService   service.TokenService
+	sessionService service.SessionService
 }
 
-func NewAuthHandler(authService service.AuthService) *AuthHandler {
+func NewAuthHandler(authService service.AuthService, tokenService service.TokenService, sessionService service.SessionService) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
+		authService:    authService,
+		tokenService:   tokenService,
+		sessionService: sessionService,
 	}
 }
 
 // SendOTP godoc
-// @Summary Send OTP to phone number
-// @Description Generate and send OTP to the provided phone number
+// @Summary Send OTP to phone number or email
+// @Description Generate and send OTP to the provided phone number by SMS, or to the provided email address
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param request body model.SendOTPRequest true "Phone number"
-// @Success 200 {object} model.SuccessResponse
+// @Param request body model.SendOTPRequest true "Phone number or email"
+// @Success 200 {object} model.SuccessResponse{data=model.SendOTPResponse}
 // @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 409 {object} model.ErrorResponse
+// @Failure 415 {object} model.ErrorResponse
+// @Failure 423 {object} model.ErrorResponse
 // @Failure 429 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
+// @Failure 503 {object} model.ErrorResponse
 // @Router /auth/send-otp [post]
 func (h *AuthHandler) SendOTP(c *fiber.Ctx) error {
 	var req model.SendOTPRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.BadRequest(c, err.Error())
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_request_body"))
+	}
+
+	sendResponse, err := h.authService.SendOTP(c.UserContext(), &req)
+	if err != nil {
+		return h.handleAuthError(c, err, "")
 	}
 
-	err := h.authService.SendOTP(req.PhoneNumber)
-	return h.handleAuthError(c, err, "OTP sent successfully")
+	return utils.SuccessResponse(c, utils.Message(c, "otp.sent"), sendResponse)
 }
 
 // VerifyOTP godoc
@@ -47,26 +64,315 @@ func (h *AuthHandler) SendOTP(c *fiber.Ctx) error {
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param request body model.VerifyOTPRequest true "Phone number and OTP"
+// @Param request body model.VerifyOTPRequest true "Phone number or email, and OTP"
 // @Success 200 {object} model.AuthResponse
 // @Failure 400 {object} model.ErrorResponse
 // @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 415 {object} model.ErrorResponse
+// @Failure 423 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
+// @Failure 503 {object} model.ErrorResponse
 // @Router /auth/verify-otp [post]
 func (h *AuthHandler) VerifyOTP(c *fiber.Ctx) error {
 	var req model.VerifyOTPRequest
 	if err := c.BodyParser(&req); err != nil {
-		return utils.BadRequest(c, err.Error())
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_request_body"))
+	}
+	req.ClientIP = c.IP()
+	req.UserAgent = c.Get(fiber.HeaderUserAgent)
+
+	authResponse, err := h.authService.VerifyOTP(c.UserContext(), &req)
+	if err != nil {
+		return h.handleAuthError(c, err, "")
+	}
+
+	return c.JSON(authResponse)
+}
+
+// RefreshToken godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token from verify-otp for a new access token carrying the account's current role and phone number
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body model.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} model.RefreshTokenResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 415 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /auth/refresh [post]
+func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
+	var req model.RefreshTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_request_body"))
+	}
+	if req.RefreshToken == "" {
+		return utils.BadRequest(c, utils.Message(c, "error.refresh_token_required"))
+	}
+
+	refreshResponse, err := h.authService.RefreshToken(c.UserContext(), &req)
+	if err != nil {
+		return h.handleAuthError(c, err, "")
+	}
+
+	return c.JSON(refreshResponse)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revoke the access token used for this request so it is rejected until it would have expired, and end its session along with the session's refresh token and every other access token it issued
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	// Break-glass tokens and tokens issued before jti existed have nothing to revoke
+	tokenID, _ := c.Locals("token_id").(string)
+	expiresAt, _ := c.Locals("token_expires_at").(time.Time)
+	if tokenID == "" || expiresAt.IsZero() {
+		return utils.BadRequest(c, utils.Message(c, "error.token_not_revocable"))
+	}
+
+	if err := h.endSession(c, tokenID, expiresAt); err != nil {
+		return utils.InternalError(c, utils.Message(c, "error.revoke_token_failed"))
+	}
+
+	return utils.SuccessResponse(c, utils.Message(c, "auth.logged_out"))
+}
+
+// GetSessions godoc
+// @Summary List your sessions
+// @Description List the devices you are signed in on, newest first. The session of the token used for this request is marked current.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} model.SessionsResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/sessions [get]
+func (h *AuthHandler) GetSessions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return utils.Unauthorized(c, utils.Message(c, "error.user_id_missing"))
+	}
+	tokenID, _ := c.Locals("token_id").(string)
+
+	sessions, err := h.sessionService.List(c.UserContext(), userID, tokenID)
+	if err != nil {
+		return utils.InternalError(c, utils.Message(c, "error.get_sessions_failed"))
+	}
+
+	return c.JSON(sessions)
+}
+
+// RevokeSession godoc
+// @Summary Revoke one of your sessions
+// @Description Sign a device out by revoking its session's refresh token and every access token it issued
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param jti path string true "Session ID, the jti from the sessions list"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/sessions/{jti} [delete]
+func (h *AuthHandler) RevokeSession(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return utils.Unauthorized(c, utils.Message(c, "error.user_id_missing"))
+	}
+
+	err := h.sessionService.Revoke(c.UserContext(), userID, c.Params("jti"))
+	if errors.Is(err, service.ErrSessionNotFound) {
+		return utils.NotFound(c, utils.Message(c, "error.session_not_found"))
+	}
+	if err != nil {
+		return utils.InternalError(c, utils.Message(c, "error.revoke_session_failed"))
+	}
+
+	return utils.SuccessResponse(c, utils.Message(c, "session.revoked"))
+}
+
+// GetOTPStatus godoc
+// @Summary Get pending OTP status
+// @Description Report whether an OTP is pending for a phone number and how many verify attempts remain
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param phone_number query string true "Phone number"
+// @Success 200 {object} model.OTPStatusResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /auth/otp-status [get]
+func (h *AuthHandler) GetOTPStatus(c *fiber.Ctx) error {
+	status, err := h.authService.OTPStatus(c.UserContext(), c.Query("phone_number"))
+	if err != nil {
+		return h.handleAuthError(c, err, "")
+	}
+
+	return c.JSON(status)
+}
+
+// GetLimits godoc
+// @Summary Get my OTP limits
+// @Description Report the send and verify limits in effect for the authenticated user's own phone number and the remaining budget. Phone users get 501 in write-only privacy mode, where their number cannot be read back.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} model.LimitsResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Failure 501 {object} model.ErrorResponse
+// @Router /users/limits [get]
+func (h *AuthHandler) GetLimits(c *fiber.Ctx) error {
+	// Always the caller's own account from the token; no parameter can name another phone
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return utils.Unauthorized(c, utils.Message(c, "error.user_id_missing"))
+	}
+
+	limits, err := h.authService.Limits(c.UserContext(), userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
+	}
+	if err != nil {
+		return h.handleAuthError(c, err, "")
+	}
+
+	return c.JSON(limits)
+}
+
+// UpdateProfile godoc
+// @Summary Change my phone number
+// @Description Move the authenticated user to a new phone number. Without otp_code a code is sent to the new number (202); with the code the number is switched, the session of the token used for this request is ended, refresh token included, and new tokens are returned in a new session.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.UpdatePhoneRequest true "New phone number, and the code sent to it"
+// @Success 200 {object} model.AuthResponse
+// @Success 202 {object} model.SuccessResponse{data=model.SendOTPResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 409 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Failure 503 {object} model.ErrorResponse
+// @Router /users/profile [patch]
+func (h *AuthHandler) UpdateProfile(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return utils.Unauthorized(c, utils.Message(c, "error.user_id_missing"))
+	}
+
+	var req model.UpdatePhoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_request_body"))
+	}
+	req.ClientIP = c.IP()
+	req.UserAgent = c.Get(fiber.HeaderUserAgent)
+	if req.PhoneNumber == "" {
+		return utils.BadRequest(c, utils.Message(c, "error.phone_number_required"))
 	}
 
-	authResponse, err := h.authService.VerifyOTP(req.PhoneNumber, req.OTPCode)
+	if req.OTPCode == "" {
+		sendResponse, err := h.authService.SendPhoneChangeOTP(c.UserContext(), userID, &req)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
+		}
+		if err != nil {
+			return h.handleAuthError(c, err, "")
+		}
+		c.Status(fiber.StatusAccepted)
+		return utils.SuccessResponse(c, utils.Message(c, "otp.sent_to_new_phone"), sendResponse)
+	}
+
+	authResponse, err := h.authService.ChangePhoneNumber(c.UserContext(), userID, &req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
+	}
 	if err != nil {
 		return h.handleAuthError(c, err, "")
 	}
 
+	// The old token, and any token its refresh token mints, names the old
+	// number, which admin checks trust
+	h.revokeCurrentToken(c)
+
 	return c.JSON(authResponse)
 }
 
+// DeleteProfile godoc
+// @Summary Delete my account
+// @Description Delete the authenticated user's account, soft-deleted or, with USER_HARD_DELETE, erased at once. The token used for this request is revoked and any pending OTP or rate-limit state for the account is dropped.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} model.SuccessResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/profile [delete]
+func (h *AuthHandler) DeleteProfile(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return utils.Unauthorized(c, utils.Message(c, "error.user_id_missing"))
+	}
+
+	err := h.authService.DeleteAccount(c.UserContext(), userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
+	}
+	if err != nil {
+		return utils.InternalError(c, utils.Message(c, "error.delete_account_failed"))
+	}
+
+	h.revokeCurrentToken(c)
+	return utils.SuccessResponse(c, utils.Message(c, "account.deleted"))
+}
+
+// revokeCurrentToken ends the session of the request once the account it names
+// has changed, so neither its access nor its refresh token carries the old
+// details on; the change already happened, so a failure is only logged
+func (h *AuthHandler) revokeCurrentToken(c *fiber.Ctx) {
+	tokenID, _ := c.Locals("token_id").(string)
+	expiresAt, _ := c.Locals("token_expires_at").(time.Time)
+	if tokenID == "" || expiresAt.IsZero() {
+		return
+	}
+	if err := h.endSession(c, tokenID, expiresAt); err != nil {
+		log.Printf("Failed to revoke token: %v", err)
+	}
+}
+
+// endSession revokes the access token and the session that issued it, its
+// refresh token and every other access token included. Session recording is
+// best effort, so a token may have none; revoking the token is then enough.
+func (h *AuthHandler) endSession(c *fiber.Ctx, tokenID string, expiresAt time.Time) error {
+	if err := h.tokenService.Revoke(c.UserContext(), tokenID, expiresAt); err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("user_id").(uint)
+	if err := h.sessionService.Revoke(c.UserContext(), userID, tokenID); err != nil && !errors.Is(err, service.ErrSessionNotFound) {
+		return err
+	}
+	return nil
+}
+
 // Helper method for consistent auth error handling
 func (h *AuthHandler) handleAuthError(c *fiber.Ctx, err error, successMessage string) error {
 	if err == nil {
@@ -75,16 +381,78 @@ func (h *AuthHandler) handleAuthError(c *fiber.Ctx, err error, successMessage st
 
 	switch {
 	case errors.Is(err, service.ErrRateLimitExceeded):
-		return utils.TooManyRequests(c, "Too many OTP requests. Please try again later.")
+		if wait := retryAfter(err); wait > 0 {
+			return utils.RetryLater(c, "rate_limit_exceeded", model.LimitTypeWindow, utils.Message(c, "error.rate_limit_exceeded"), wait)
+		}
+		return utils.LimitExceeded(c, fiber.StatusTooManyRequests, "rate_limit_exceeded", model.LimitTypeWindow, utils.Message(c, "error.rate_limit_exceeded"))
 	case errors.Is(err, service.ErrInvalidPhoneNumber):
-		return utils.BadRequest(c, "Phone number must be in international format (e.g., +1234567890)")
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_phone_number"))
+	case errors.Is(err, service.ErrInvalidEmail):
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_email"))
+	case errors.Is(err, service.ErrIdentifierConflict):
+		return utils.BadRequest(c, utils.Message(c, "error.identifier_conflict"))
+	case errors.Is(err, service.ErrPhoneNumberTaken):
+		return utils.ErrorResponse(c, fiber.StatusConflict, "phone_number_taken", utils.Message(c, "error.phone_number_taken"))
+	case errors.Is(err, service.ErrAccountDeleted):
+		return utils.ErrorResponse(c, fiber.StatusConflict, "account_deleted", utils.Message(c, "error.account_deleted"))
+	case errors.Is(err, service.ErrSamePhoneNumber):
+		return utils.BadRequest(c, utils.Message(c, "error.same_phone_number"))
+	case errors.Is(err, service.ErrEmailDisabled):
+		return utils.BadRequest(c, utils.Message(c, "error.email_disabled"))
 	case errors.Is(err, service.ErrInvalidOTP):
-		return utils.Unauthorized(c, "Invalid OTP code")
+		var attemptsErr *apperrors.AttemptsRemainingError
+		if errors.As(err, &attemptsErr) {
+			return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
+				Error:             "unauthorized",
+				Message:           utils.Message(c, "error.invalid_otp"),
+				AttemptsRemaining: attemptsErr.Remaining,
+			})
+		}
+		return utils.Unauthorized(c, utils.Message(c, "error.invalid_otp"))
+	case errors.Is(err, service.ErrOTPMistyped):
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "otp_mistyped", utils.Message(c, "error.otp_mistyped"))
 	case errors.Is(err, service.ErrOTPExpired):
-		return utils.Unauthorized(c, "OTP has expired. Please request a new one.")
+		return utils.Unauthorized(c, utils.Message(c, "error.otp_expired"))
 	case errors.Is(err, service.ErrTooManyAttempts):
-		return utils.Unauthorized(c, "Too many failed attempts. Please request a new OTP.")
+		return utils.Unauthorized(c, utils.Message(c, "error.too_many_attempts"))
+	case errors.Is(err, service.ErrDeviceMismatch):
+		return utils.Unauthorized(c, utils.Message(c, "error.device_mismatch"))
+	case errors.Is(err, service.ErrVerifyTooSoon):
+		return utils.RetryLater(c, "verify_too_soon", model.LimitTypeBackoff, utils.Message(c, "error.verify_too_soon"), retryAfter(err))
+	case errors.Is(err, service.ErrResendTooSoon):
+		return utils.RetryLater(c, "resend_too_soon", model.LimitTypeCooldown, utils.Message(c, "error.resend_too_soon"), retryAfter(err))
+	case errors.Is(err, service.ErrServiceUnavailable):
+		return utils.ErrorResponse(c, fiber.StatusServiceUnavailable, "service_unavailable", utils.Message(c, "error.service_unavailable"))
+	case errors.Is(err, service.ErrAccountLocked):
+		return utils.Locked(c, "account_locked", model.LimitTypeLockout, utils.Message(c, "error.account_locked"), retryAfter(err))
+	case errors.Is(err, service.ErrInvalidFormToken):
+		return utils.ErrorResponse(c, fiber.StatusForbidden, "invalid_form_token", utils.Message(c, "error.invalid_form_token"))
+	case errors.Is(err, service.ErrInvalidRefresh):
+		return utils.Unauthorized(c, utils.Message(c, "error.invalid_refresh"))
+	case errors.Is(err, service.ErrAccountSuspended):
+		return utils.ErrorResponse(c, fiber.StatusForbidden, "account_suspended", utils.Message(c, "error.account_suspended"))
+	case errors.Is(err, service.ErrAccountDeactivated):
+		return utils.ErrorResponse(c, fiber.StatusForbidden, "account_deactivated", utils.Message(c, "error.account_deactivated"))
+	case errors.Is(err, service.ErrAccountPending):
+		return utils.ErrorResponse(c, fiber.StatusForbidden, "account_pending", utils.Message(c, "error.account_pending"))
+	case errors.Is(err, service.ErrTOTPEnrolled):
+		return utils.ErrorResponse(c, fiber.StatusConflict, "totp_enrolled", utils.Message(c, "error.totp_enrolled"))
+	case errors.Is(err, service.ErrQuietHours):
+		return utils.ErrorResponse(c, fiber.StatusServiceUnavailable, "quiet_hours", utils.Message(c, "error.quiet_hours"))
+	case errors.Is(err, service.ErrPhonesHashed):
+		return utils.ErrorResponse(c, fiber.StatusNotImplemented, "privacy_mode", utils.Message(c, "error.privacy_mode"))
+	case errors.Is(err, service.ErrTokenIssuance):
+		return utils.ErrorResponse(c, fiber.StatusServiceUnavailable, "token_issuance_failed", utils.Message(c, "error.token_issuance_failed"))
 	default:
-		return utils.InternalError(c, "Operation failed")
+		return utils.InternalError(c, utils.Message(c, "error.operation_failed"))
+	}
+}
+
+// retryAfter extracts the wait carried by a RetryAfterError, or 0
+func retryAfter(err error) time.Duration {
+	var retryErr *apperrors.RetryAfterError
+	if errors.As(err, &retryErr) {
+		return retryErr.RetryAfter
 	}
+	return 0
 }
@@ -2,60 +2,173 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/middleware"
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
 	"github.com/ehsanshojaei/go-otp-auth/internal/service"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/metrics"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // Mock auth service for testing
 type mockAuthService struct {
-	sendOTPFunc   func(string) error
-	verifyOTPFunc func(string, string) (*model.AuthResponse, error)
+	sendOTPFunc   func(*model.SendOTPRequest) (*model.SendOTPResponse, error)
+	verifyOTPFunc func(*model.VerifyOTPRequest) (*model.AuthResponse, error)
+	refreshFunc   func(*model.RefreshTokenRequest) (*model.RefreshTokenResponse, error)
+	limitsFunc    func(userID uint) (*model.LimitsResponse, error)
+
+	sendPhoneChangeFunc func(userID uint, req *model.UpdatePhoneRequest) (*model.SendOTPResponse, error)
+	changePhoneFunc     func(userID uint, req *model.UpdatePhoneRequest) (*model.AuthResponse, error)
+	deleteAccountFunc   func(userID uint) error
 }
 
-func (m *mockAuthService) SendOTP(phoneNumber string) error {
+func (m *mockAuthService) SendOTP(ctx context.Context, req *model.SendOTPRequest) (*model.SendOTPResponse, error) {
 	if m.sendOTPFunc != nil {
-		return m.sendOTPFunc(phoneNumber)
+		return m.sendOTPFunc(req)
 	}
-	return nil
+	return &model.SendOTPResponse{}, nil
 }
 
-func (m *mockAuthService) VerifyOTP(phoneNumber, otpCode string) (*model.AuthResponse, error) {
+func (m *mockAuthService) VerifyOTP(ctx context.Context, req *model.VerifyOTPRequest) (*model.AuthResponse, error) {
 	if m.verifyOTPFunc != nil {
-		return m.verifyOTPFunc(phoneNumber, otpCode)
+		return m.verifyOTPFunc(req)
 	}
 	return &model.AuthResponse{
 		Token: "test-token",
 		User: model.UserResponse{
 			ID:          1,
-			PhoneNumber: phoneNumber,
+			PhoneNumber: req.PhoneNumber,
 		},
 	}, nil
 }
 
+func (m *mockAuthService) OTPStatus(ctx context.Context, phoneNumber string) (*model.OTPStatusResponse, error) {
+	return &model.OTPStatusResponse{}, nil
+}
+
+func (m *mockAuthService) Limits(ctx context.Context, userID uint) (*model.LimitsResponse, error) {
+	if m.limitsFunc != nil {
+		return m.limitsFunc(userID)
+	}
+	return &model.LimitsResponse{}, nil
+}
+
+func (m *mockAuthService) RefreshToken(ctx context.Context, req *model.RefreshTokenRequest) (*model.RefreshTokenResponse, error) {
+	if m.refreshFunc != nil {
+		return m.refreshFunc(req)
+	}
+	return &model.RefreshTokenResponse{Token: "new-access-token"}, nil
+}
+
+func (m *mockAuthService) SendPhoneChangeOTP(ctx context.Context, userID uint, req *model.UpdatePhoneRequest) (*model.SendOTPResponse, error) {
+	if m.sendPhoneChangeFunc != nil {
+		return m.sendPhoneChangeFunc(userID, req)
+	}
+	return &model.SendOTPResponse{Channel: "sms"}, nil
+}
+
+func (m *mockAuthService) ChangePhoneNumber(ctx context.Context, userID uint, req *model.UpdatePhoneRequest) (*model.AuthResponse, error) {
+	if m.changePhoneFunc != nil {
+		return m.changePhoneFunc(userID, req)
+	}
+	return &model.AuthResponse{
+		Token: "new-token",
+		User:  model.UserResponse{ID: userID, PhoneNumber: req.PhoneNumber},
+	}, nil
+}
+
+func (m *mockAuthService) DeleteAccount(ctx context.Context, userID uint) error {
+	if m.deleteAccountFunc != nil {
+		return m.deleteAccountFunc(userID)
+	}
+	return nil
+}
+
 func setupTestApp() (*fiber.App, *mockAuthService) {
 	mockService := &mockAuthService{}
-	handler := NewAuthHandler(mockService)
+	handler := NewAuthHandler(mockService, newMockTokenService(), newMockSessionService(newMockTokenService()))
 
 	app := fiber.New()
 	app.Post("/auth/send-otp", handler.SendOTP)
 	app.Post("/auth/verify-otp", handler.VerifyOTP)
+	app.Post("/auth/refresh", handler.RefreshToken)
 
 	return app, mockService
 }
 
+// Mock token service for testing
+type mockTokenService struct {
+	revoked map[string]time.Time
+}
+
+func newMockTokenService() *mockTokenService {
+	return &mockTokenService{revoked: make(map[string]time.Time)}
+}
+
+func (m *mockTokenService) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	m.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (m *mockTokenService) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	_, revoked := m.revoked[tokenID]
+	return revoked, nil
+}
+
+// Mock session service for testing; revoking a session revokes both of its tokens
+type mockSessionService struct {
+	sessions     map[string]model.Session
+	tokenService *mockTokenService
+}
+
+func newMockSessionService(tokenService *mockTokenService) *mockSessionService {
+	return &mockSessionService{sessions: make(map[string]model.Session), tokenService: tokenService}
+}
+
+func (m *mockSessionService) List(ctx context.Context, userID uint, currentTokenID string) (*model.SessionsResponse, error) {
+	response := &model.SessionsResponse{Sessions: []model.SessionResponse{}}
+	for _, session := range m.sessions {
+		if session.UserID == userID {
+			sessionResponse := session.ToResponse()
+			sessionResponse.Current = session.TokenID == currentTokenID
+			response.Sessions = append(response.Sessions, sessionResponse)
+		}
+	}
+	return response, nil
+}
+
+func (m *mockSessionService) Revoke(ctx context.Context, userID uint, tokenID string) error {
+	session, ok := m.sessions[tokenID]
+	if !ok || session.UserID != userID {
+		return service.ErrSessionNotFound
+	}
+	m.tokenService.Revoke(ctx, session.TokenID, session.ExpiresAt)
+	m.tokenService.Revoke(ctx, session.RefreshTokenID, session.ExpiresAt)
+	delete(m.sessions, tokenID)
+	return nil
+}
+
 func TestAuthHandler_SendOTP(t *testing.T) {
 	app, mockService := setupTestApp()
 
 	tests := []struct {
 		name           string
 		requestBody    interface{}
-		mockFunc       func(string) error
+		mockFunc       func(*model.SendOTPRequest) (*model.SendOTPResponse, error)
 		expectedStatus int
 		checkResponse  bool
 	}{
@@ -64,14 +177,14 @@ func TestAuthHandler_SendOTP(t *testing.T) {
 			requestBody: model.SendOTPRequest{
 				PhoneNumber: "+1234567890",
 			},
-			mockFunc:       func(string) error { return nil },
+			mockFunc:       func(*model.SendOTPRequest) (*model.SendOTPResponse, error) { return &model.SendOTPResponse{}, nil },
 			expectedStatus: fiber.StatusOK,
 			checkResponse:  true,
 		},
 		{
 			name:           "Invalid JSON",
 			requestBody:    "invalid json",
-			mockFunc:       func(string) error { return nil },
+			mockFunc:       func(*model.SendOTPRequest) (*model.SendOTPResponse, error) { return &model.SendOTPResponse{}, nil },
 			expectedStatus: fiber.StatusBadRequest,
 			checkResponse:  false,
 		},
@@ -80,7 +193,7 @@ func TestAuthHandler_SendOTP(t *testing.T) {
 			requestBody: model.SendOTPRequest{
 				PhoneNumber: "+1234567890",
 			},
-			mockFunc:       func(string) error { return service.ErrRateLimitExceeded },
+			mockFunc:       func(*model.SendOTPRequest) (*model.SendOTPResponse, error) { return nil, service.ErrRateLimitExceeded },
 			expectedStatus: fiber.StatusTooManyRequests,
 			checkResponse:  false,
 		},
@@ -89,7 +202,44 @@ func TestAuthHandler_SendOTP(t *testing.T) {
 			requestBody: model.SendOTPRequest{
 				PhoneNumber: "+1234567890",
 			},
-			mockFunc:       func(string) error { return service.ErrInvalidPhoneNumber },
+			mockFunc:       func(*model.SendOTPRequest) (*model.SendOTPResponse, error) { return nil, service.ErrInvalidPhoneNumber },
+			expectedStatus: fiber.StatusBadRequest,
+			checkResponse:  false,
+		},
+		{
+			name: "Enrolled in TOTP",
+			requestBody: model.SendOTPRequest{
+				PhoneNumber: "+1234567890",
+			},
+			mockFunc:       func(*model.SendOTPRequest) (*model.SendOTPResponse, error) { return nil, service.ErrTOTPEnrolled },
+			expectedStatus: fiber.StatusConflict,
+			checkResponse:  false,
+		},
+		{
+			name: "Valid email request",
+			requestBody: model.SendOTPRequest{
+				Email: "user@example.com",
+			},
+			mockFunc:       func(*model.SendOTPRequest) (*model.SendOTPResponse, error) { return &model.SendOTPResponse{}, nil },
+			expectedStatus: fiber.StatusOK,
+			checkResponse:  true,
+		},
+		{
+			name: "Invalid email",
+			requestBody: model.SendOTPRequest{
+				Email: "not-an-email",
+			},
+			mockFunc:       func(*model.SendOTPRequest) (*model.SendOTPResponse, error) { return nil, service.ErrInvalidEmail },
+			expectedStatus: fiber.StatusBadRequest,
+			checkResponse:  false,
+		},
+		{
+			name: "Phone number and email",
+			requestBody: model.SendOTPRequest{
+				PhoneNumber: "+1234567890",
+				Email:       "user@example.com",
+			},
+			mockFunc:       func(*model.SendOTPRequest) (*model.SendOTPResponse, error) { return nil, service.ErrIdentifierConflict },
 			expectedStatus: fiber.StatusBadRequest,
 			checkResponse:  false,
 		},
@@ -148,7 +298,7 @@ func TestAuthHandler_VerifyOTP(t *testing.T) {
 	tests := []struct {
 		name           string
 		requestBody    interface{}
-		mockFunc       func(string, string) (*model.AuthResponse, error)
+		mockFunc       func(*model.VerifyOTPRequest) (*model.AuthResponse, error)
 		expectedStatus int
 		checkToken     bool
 	}{
@@ -158,7 +308,7 @@ func TestAuthHandler_VerifyOTP(t *testing.T) {
 				PhoneNumber: "+1234567890",
 				OTPCode:     "123456",
 			},
-			mockFunc: func(string, string) (*model.AuthResponse, error) {
+			mockFunc: func(*model.VerifyOTPRequest) (*model.AuthResponse, error) {
 				return &model.AuthResponse{
 					Token: "valid-token",
 					User: model.UserResponse{
@@ -173,7 +323,7 @@ func TestAuthHandler_VerifyOTP(t *testing.T) {
 		{
 			name:           "Invalid JSON",
 			requestBody:    "invalid json",
-			mockFunc:       func(string, string) (*model.AuthResponse, error) { return nil, nil },
+			mockFunc:       func(*model.VerifyOTPRequest) (*model.AuthResponse, error) { return nil, nil },
 			expectedStatus: fiber.StatusBadRequest,
 			checkToken:     false,
 		},
@@ -183,7 +333,7 @@ func TestAuthHandler_VerifyOTP(t *testing.T) {
 				PhoneNumber: "+1234567890",
 				OTPCode:     "123456",
 			},
-			mockFunc:       func(string, string) (*model.AuthResponse, error) { return nil, service.ErrInvalidOTP },
+			mockFunc:       func(*model.VerifyOTPRequest) (*model.AuthResponse, error) { return nil, service.ErrInvalidOTP },
 			expectedStatus: fiber.StatusUnauthorized,
 			checkToken:     false,
 		},
@@ -193,10 +343,20 @@ func TestAuthHandler_VerifyOTP(t *testing.T) {
 				PhoneNumber: "+1234567890",
 				OTPCode:     "123456",
 			},
-			mockFunc:       func(string, string) (*model.AuthResponse, error) { return nil, service.ErrOTPExpired },
+			mockFunc:       func(*model.VerifyOTPRequest) (*model.AuthResponse, error) { return nil, service.ErrOTPExpired },
 			expectedStatus: fiber.StatusUnauthorized,
 			checkToken:     false,
 		},
+		{
+			name: "Token issuance failed",
+			requestBody: model.VerifyOTPRequest{
+				PhoneNumber: "+1234567890",
+				OTPCode:     "123456",
+			},
+			mockFunc:       func(*model.VerifyOTPRequest) (*model.AuthResponse, error) { return nil, service.ErrTokenIssuance },
+			expectedStatus: fiber.StatusServiceUnavailable,
+			checkToken:     false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -249,3 +409,631 @@ func TestAuthHandler_VerifyOTP(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthHandler_VerifyOTP_RetryAfter(t *testing.T) {
+	app, mockService := setupTestApp()
+	mockService.verifyOTPFunc = func(*model.VerifyOTPRequest) (*model.AuthResponse, error) {
+		return nil, &apperrors.RetryAfterError{Err: service.ErrVerifyTooSoon, RetryAfter: 3500 * time.Millisecond}
+	}
+
+	requestBody, _ := json.Marshal(model.VerifyOTPRequest{PhoneNumber: "+1234567890", OTPCode: "123456"})
+	req := httptest.NewRequest("POST", "/auth/verify-otp", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", fiber.StatusTooManyRequests, resp.StatusCode)
+	}
+	if retryAfter := resp.Header.Get(fiber.HeaderRetryAfter); retryAfter != "4" {
+		t.Errorf("Retry-After = %q, want %q", retryAfter, "4")
+	}
+}
+
+func TestAuthHandler_LimitType(t *testing.T) {
+	app, mockService := setupTestApp()
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		wantLimitType  string
+	}{
+		{"Send window", service.ErrRateLimitExceeded, fiber.StatusTooManyRequests, model.LimitTypeWindow},
+		{"Verify backoff", &apperrors.RetryAfterError{Err: service.ErrVerifyTooSoon, RetryAfter: time.Second}, fiber.StatusTooManyRequests, model.LimitTypeBackoff},
+		{"Cumulative lockout", service.ErrAccountLocked, fiber.StatusLocked, model.LimitTypeLockout},
+		{"Not a limit", service.ErrInvalidOTP, fiber.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService.verifyOTPFunc = func(*model.VerifyOTPRequest) (*model.AuthResponse, error) { return nil, tt.err }
+
+			requestBody, _ := json.Marshal(model.VerifyOTPRequest{PhoneNumber: "+1234567890", OTPCode: "123456"})
+			req := httptest.NewRequest("POST", "/auth/verify-otp", bytes.NewBuffer(requestBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			var response model.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.LimitType != tt.wantLimitType {
+				t.Errorf("limit_type = %q, want %q", response.LimitType, tt.wantLimitType)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_RefreshToken(t *testing.T) {
+	app, mockService := setupTestApp()
+
+	tests := []struct {
+		name           string
+		body           string
+		serviceErr     error
+		expectedStatus int
+	}{
+		{"Valid refresh token", `{"refresh_token":"refresh"}`, nil, fiber.StatusOK},
+		{"Missing refresh token", `{}`, nil, fiber.StatusBadRequest},
+		{"Rejected refresh token", `{"refresh_token":"access"}`, service.ErrInvalidRefresh, fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService.refreshFunc = func(req *model.RefreshTokenRequest) (*model.RefreshTokenResponse, error) {
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &model.RefreshTokenResponse{Token: "new-access-token"}, nil
+			}
+
+			req := httptest.NewRequest("POST", "/auth/refresh", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_VerifyOTP_AttemptsRemaining(t *testing.T) {
+	app, mockService := setupTestApp()
+	mockService.verifyOTPFunc = func(*model.VerifyOTPRequest) (*model.AuthResponse, error) {
+		return nil, &apperrors.AttemptsRemainingError{Err: service.ErrInvalidOTP, Remaining: 2}
+	}
+
+	requestBody, _ := json.Marshal(model.VerifyOTPRequest{PhoneNumber: "+1234567890", OTPCode: "123456"})
+	req := httptest.NewRequest("POST", "/auth/verify-otp", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", fiber.StatusUnauthorized, resp.StatusCode)
+	}
+
+	var response model.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Error != "unauthorized" || response.AttemptsRemaining != 2 {
+		t.Errorf("Response = %+v, want unauthorized with attempts_remaining 2", response)
+	}
+}
+
+func TestAuthHandler_SendOTP_ResendTooSoon(t *testing.T) {
+	app, mockService := setupTestApp()
+	mockService.sendOTPFunc = func(*model.SendOTPRequest) (*model.SendOTPResponse, error) {
+		return nil, &apperrors.RetryAfterError{Err: service.ErrResendTooSoon, RetryAfter: 29200 * time.Millisecond}
+	}
+
+	requestBody, _ := json.Marshal(model.SendOTPRequest{PhoneNumber: "+1234567890"})
+	req := httptest.NewRequest("POST", "/auth/send-otp", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", fiber.StatusTooManyRequests, resp.StatusCode)
+	}
+	if retryAfter := resp.Header.Get(fiber.HeaderRetryAfter); retryAfter != "30" {
+		t.Errorf("Retry-After = %q, want %q", retryAfter, "30")
+	}
+
+	var response model.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Error != "resend_too_soon" || response.RetryAfter != 30 || response.LimitType != model.LimitTypeCooldown {
+		t.Errorf("Response = %+v, want resend_too_soon with retry_after 30 and limit_type %q", response, model.LimitTypeCooldown)
+	}
+}
+
+func TestAuthHandler_SendOTP_RateLimitRetryAfter(t *testing.T) {
+	app, mockService := setupTestApp()
+	mockService.sendOTPFunc = func(*model.SendOTPRequest) (*model.SendOTPResponse, error) {
+		return nil, &apperrors.RetryAfterError{Err: service.ErrRateLimitExceeded, RetryAfter: 8*time.Minute + 400*time.Millisecond}
+	}
+
+	requestBody, _ := json.Marshal(model.SendOTPRequest{PhoneNumber: "+1234567890"})
+	req := httptest.NewRequest("POST", "/auth/send-otp", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", fiber.StatusTooManyRequests, resp.StatusCode)
+	}
+	if retryAfter := resp.Header.Get(fiber.HeaderRetryAfter); retryAfter != "481" {
+		t.Errorf("Retry-After = %q, want %q", retryAfter, "481")
+	}
+
+	var response model.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Error != "rate_limit_exceeded" || response.RetryAfter != 481 || response.LimitType != model.LimitTypeWindow {
+		t.Errorf("Response = %+v, want rate_limit_exceeded with retry_after 481 and limit_type %q", response, model.LimitTypeWindow)
+	}
+}
+
+func TestAuthHandler_GetLimits(t *testing.T) {
+	mockService := &mockAuthService{}
+	handler := NewAuthHandler(mockService, newMockTokenService(), newMockSessionService(newMockTokenService()))
+
+	app := fiber.New()
+	app.Get("/users/limits", func(c *fiber.Ctx) error {
+		if userID, err := strconv.ParseUint(c.Get("X-Test-User"), 10, 32); err == nil {
+			c.Locals("user_id", uint(userID))
+		}
+		return c.Next()
+	}, handler.GetLimits)
+
+	var queried []uint
+	mockService.limitsFunc = func(userID uint) (*model.LimitsResponse, error) {
+		queried = append(queried, userID)
+		if userID == 9 {
+			return nil, fmt.Errorf("%w; the limits of user 9 cannot be looked up", service.ErrPhonesHashed)
+		}
+		if userID != 42 {
+			return nil, fmt.Errorf("failed to get user: %w", gorm.ErrRecordNotFound)
+		}
+		return &model.LimitsResponse{SendLimit: 3, SendsRemaining: 2}, nil
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		userID         string
+		expectedStatus int
+		wantQueried    uint
+	}{
+		{"Own limits", "/users/limits", "42", fiber.StatusOK, 42},
+		{"Another phone in the query is ignored", "/users/limits?phone_number=%2B1987654321&user_id=7", "42", fiber.StatusOK, 42},
+		{"User gone", "/users/limits", "7", fiber.StatusNotFound, 7},
+		{"Write-only privacy mode", "/users/limits", "9", fiber.StatusNotImplemented, 9},
+		{"No user in token", "/users/limits", "", fiber.StatusUnauthorized, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queried = nil
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.userID != "" {
+				req.Header.Set("X-Test-User", tt.userID)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.wantQueried == 0 {
+				if len(queried) != 0 {
+					t.Errorf("Limits() called with %v, want no call", queried)
+				}
+				return
+			}
+			if len(queried) != 1 || queried[0] != tt.wantQueried {
+				t.Errorf("Limits() called with %v, want [%d]", queried, tt.wantQueried)
+			}
+			if tt.expectedStatus != fiber.StatusOK {
+				return
+			}
+
+			var response model.LimitsResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.SendsRemaining != 2 {
+				t.Errorf("SendsRemaining = %d, want 2", response.SendsRemaining)
+			}
+		})
+	}
+}
+
+// signedInUsers backs the auth middleware with the users tokens are issued to
+func signedInUsers(ids ...uint) *mockUserService {
+	users := make(map[uint]*model.User)
+	for _, id := range ids {
+		users[id] = &model.User{ID: id, PhoneNumber: "+1234567890", Status: model.UserStatusActive}
+	}
+	return &mockUserService{users: users}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	tokenService := newMockTokenService()
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager, signedInUsers(42), tokenService, &config.Config{}, metrics.New())
+	handler := NewAuthHandler(&mockAuthService{}, tokenService, newMockSessionService(tokenService))
+
+	app := fiber.New()
+	app.Post("/auth/logout", authMiddleware.RequireAuth(), handler.Logout)
+	app.Get("/protected", authMiddleware.RequireAuth(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	token, err := jwtManager.GenerateToken(42, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	otherToken, err := jwtManager.GenerateToken(42, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	request := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to perform request: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := request("POST", "/auth/logout", token); status != fiber.StatusOK {
+		t.Fatalf("Logout status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	claims, _ := jwtManager.ValidateToken(token)
+	expiresAt, ok := tokenService.revoked[claims.ID]
+	if !ok {
+		t.Fatalf("Logout did not revoke token ID %q", claims.ID)
+	}
+	if !expiresAt.Equal(claims.ExpiresAt.Time) {
+		t.Errorf("Revoked until %v, want the token expiry %v", expiresAt, claims.ExpiresAt.Time)
+	}
+
+	if status := request("GET", "/protected", token); status != fiber.StatusUnauthorized {
+		t.Errorf("Revoked token status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	if status := request("POST", "/auth/logout", token); status != fiber.StatusUnauthorized {
+		t.Errorf("Second logout status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	// Other sessions of the same user stay signed in
+	if status := request("GET", "/protected", otherToken); status != fiber.StatusOK {
+		t.Errorf("Other token status = %d, want %d", status, fiber.StatusOK)
+	}
+}
+
+func TestAuthHandler_Sessions(t *testing.T) {
+	tokenService := newMockTokenService()
+	sessionService := newMockSessionService(tokenService)
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager, signedInUsers(42), tokenService, &config.Config{}, metrics.New())
+	handler := NewAuthHandler(&mockAuthService{}, tokenService, sessionService)
+
+	app := fiber.New()
+	app.Post("/auth/logout", authMiddleware.RequireAuth(), handler.Logout)
+	app.Get("/users/sessions", authMiddleware.RequireAuth(), handler.GetSessions)
+	app.Delete("/users/sessions/:jti", authMiddleware.RequireAuth(), handler.RevokeSession)
+
+	signIn := func(userID uint, deviceName string) (string, model.Session) {
+		token, err := jwtManager.GenerateToken(userID, "+1234567890")
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		claims, _ := jwtManager.ValidateToken(token)
+		session := model.Session{TokenID: claims.ID, RefreshTokenID: claims.ID + "-refresh", UserID: userID, DeviceName: deviceName, ExpiresAt: time.Now().Add(time.Hour)}
+		sessionService.sessions[claims.ID] = session
+		return token, session
+	}
+	laptopToken, laptop := signIn(42, "Laptop")
+	phoneToken, phone := signIn(42, "Phone")
+	_, stranger := signIn(7, "Stranger")
+
+	request := func(method, path, token string) *http.Response {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to perform request: %v", err)
+		}
+		return resp
+	}
+
+	resp := request("GET", "/users/sessions", laptopToken)
+	var sessions model.SessionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(sessions.Sessions) != 2 {
+		t.Fatalf("GET /users/sessions returned %d sessions, want 2", len(sessions.Sessions))
+	}
+	for _, session := range sessions.Sessions {
+		if session.Current != (session.TokenID == laptop.TokenID) {
+			t.Errorf("session %q current = %v, want only the laptop current", session.DeviceName, session.Current)
+		}
+	}
+
+	if resp := request("DELETE", "/users/sessions/"+stranger.TokenID, laptopToken); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("Revoking another user's session status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+	if resp := request("DELETE", "/users/sessions/"+phone.TokenID, laptopToken); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Revoking own session status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if resp := request("GET", "/users/sessions", phoneToken); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Revoked session token status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+
+	// Logging out ends the session, refresh token included
+	if resp := request("POST", "/auth/logout", laptopToken); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Logout status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if _, ok := sessionService.sessions[laptop.TokenID]; ok {
+		t.Error("Logout left the session listed")
+	}
+	if _, ok := tokenService.revoked[laptop.RefreshTokenID]; !ok {
+		t.Error("Logout did not revoke the session's refresh token")
+	}
+}
+
+func TestAuthHandler_LocalizedMessages(t *testing.T) {
+	mockService := &mockAuthService{}
+	handler := NewAuthHandler(mockService, newMockTokenService(), newMockSessionService(newMockTokenService()))
+
+	app := fiber.New()
+	app.Use(middleware.Locale())
+	app.Post("/auth/send-otp", handler.SendOTP)
+	app.Post("/auth/verify-otp", handler.VerifyOTP)
+
+	mockService.sendOTPFunc = func(*model.SendOTPRequest) (*model.SendOTPResponse, error) {
+		return &model.SendOTPResponse{Channel: "sms"}, nil
+	}
+	mockService.verifyOTPFunc = func(*model.VerifyOTPRequest) (*model.AuthResponse, error) {
+		return nil, &apperrors.AttemptsRemainingError{Err: service.ErrInvalidOTP, Remaining: 2}
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptLanguage string
+		wantMessage    string
+	}{
+		{"spanish error", "/auth/verify-otp", "es-ES,es;q=0.9,en;q=0.8", "Código OTP no válido"},
+		{"spanish success", "/auth/send-otp", "es", "Código OTP enviado correctamente"},
+		{"unknown locale falls back to english", "/auth/verify-otp", "de-DE", "Invalid OTP code"},
+		{"no header", "/auth/verify-otp", "", "Invalid OTP code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestBody, _ := json.Marshal(model.VerifyOTPRequest{PhoneNumber: "+1234567890", OTPCode: "123456"})
+			req := httptest.NewRequest("POST", tt.path, bytes.NewBuffer(requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(fiber.HeaderAcceptLanguage, tt.acceptLanguage)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+
+			var response struct {
+				Message string `json:"message"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", response.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_VerifyOTP_LockedUntil(t *testing.T) {
+	app, mockService := setupTestApp()
+	mockService.verifyOTPFunc = func(*model.VerifyOTPRequest) (*model.AuthResponse, error) {
+		return nil, &apperrors.RetryAfterError{Err: service.ErrAccountLocked, RetryAfter: 10 * time.Minute}
+	}
+
+	requestBody, _ := json.Marshal(model.VerifyOTPRequest{PhoneNumber: "+1234567890", OTPCode: "123456"})
+	req := httptest.NewRequest("POST", "/auth/verify-otp", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	before := time.Now().Truncate(time.Second)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusLocked {
+		t.Errorf("Expected status %d, got %d", fiber.StatusLocked, resp.StatusCode)
+	}
+	if retryAfter := resp.Header.Get(fiber.HeaderRetryAfter); retryAfter != "600" {
+		t.Errorf("Retry-After = %q, want %q", retryAfter, "600")
+	}
+
+	var response model.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.RetryAfter != 600 {
+		t.Errorf("retry_after = %d, want 600", response.RetryAfter)
+	}
+	if response.LockedUntil == nil {
+		t.Fatal("locked_until missing")
+	}
+	if unlock := response.LockedUntil.Sub(before); unlock < 10*time.Minute || unlock > 10*time.Minute+2*time.Second {
+		t.Errorf("locked_until = %v, want about 10 minutes from now", response.LockedUntil)
+	}
+}
+
+func TestAuthHandler_UpdateProfile(t *testing.T) {
+	tokenService := newMockTokenService()
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager, signedInUsers(42), tokenService, &config.Config{}, metrics.New())
+	mockService := &mockAuthService{}
+	sessionService := newMockSessionService(tokenService)
+	handler := NewAuthHandler(mockService, tokenService, sessionService)
+
+	app := fiber.New()
+	app.Patch("/users/profile", authMiddleware.RequireAuth(), handler.UpdateProfile)
+
+	mockService.changePhoneFunc = func(userID uint, req *model.UpdatePhoneRequest) (*model.AuthResponse, error) {
+		if req.OTPCode != "123456" {
+			return nil, &apperrors.AttemptsRemainingError{Err: service.ErrInvalidOTP, Remaining: 2}
+		}
+		return &model.AuthResponse{Token: "new-token", User: model.UserResponse{ID: userID, PhoneNumber: req.PhoneNumber}}, nil
+	}
+	mockService.sendPhoneChangeFunc = func(userID uint, req *model.UpdatePhoneRequest) (*model.SendOTPResponse, error) {
+		switch req.PhoneNumber {
+		case "+14155550103":
+			return nil, service.ErrPhoneNumberTaken
+		case "+14155550100":
+			return nil, service.ErrSamePhoneNumber
+		}
+		return &model.SendOTPResponse{Channel: "sms"}, nil
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		wantRevoked    bool
+	}{
+		{"Send code to the new number", `{"phone_number": "+14155550101"}`, fiber.StatusAccepted, false},
+		{"Number taken", `{"phone_number": "+14155550103"}`, fiber.StatusConflict, false},
+		{"Same number", `{"phone_number": "+14155550100"}`, fiber.StatusBadRequest, false},
+		{"Missing number", `{"otp_code": "123456"}`, fiber.StatusBadRequest, false},
+		{"Wrong code", `{"phone_number": "+14155550101", "otp_code": "000000"}`, fiber.StatusUnauthorized, false},
+		{"Confirm with the code", `{"phone_number": "+14155550101", "otp_code": "123456"}`, fiber.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwtManager.GenerateToken(42, "+14155550100")
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+			claims, _ := jwtManager.ValidateToken(token)
+			refreshTokenID := claims.ID + "-refresh"
+			sessionService.sessions[claims.ID] = model.Session{TokenID: claims.ID, RefreshTokenID: refreshTokenID, UserID: 42, ExpiresAt: time.Now().Add(time.Hour)}
+
+			req := httptest.NewRequest("PATCH", "/users/profile", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			// The session naming the old number ends once the change goes through,
+			// so its refresh token cannot mint tokens with the old number either
+			if _, revoked := tokenService.revoked[claims.ID]; revoked != tt.wantRevoked {
+				t.Errorf("Token revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+			if _, revoked := tokenService.revoked[refreshTokenID]; revoked != tt.wantRevoked {
+				t.Errorf("Refresh token revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+			if _, listed := sessionService.sessions[claims.ID]; listed == tt.wantRevoked {
+				t.Errorf("Session still listed = %v, want %v", listed, !tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_DeleteProfile(t *testing.T) {
+	tokenService := newMockTokenService()
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager, signedInUsers(42), tokenService, &config.Config{}, metrics.New())
+	mockService := &mockAuthService{}
+	handler := NewAuthHandler(mockService, tokenService, newMockSessionService(tokenService))
+
+	app := fiber.New()
+	app.Delete("/users/profile", authMiddleware.RequireAuth(), handler.DeleteProfile)
+
+	tests := []struct {
+		name           string
+		deleteErr      error
+		expectedStatus int
+		wantRevoked    bool
+	}{
+		{"Deleted", nil, fiber.StatusOK, true},
+		{"Already gone", gorm.ErrRecordNotFound, fiber.StatusNotFound, false},
+		{"Database failure", errors.New("connection refused"), fiber.StatusInternalServerError, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deletedID uint
+			mockService.deleteAccountFunc = func(userID uint) error {
+				deletedID = userID
+				return tt.deleteErr
+			}
+
+			token, err := jwtManager.GenerateToken(42, "+14155550100")
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+			claims, _ := jwtManager.ValidateToken(token)
+
+			req := httptest.NewRequest("DELETE", "/users/profile", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if deletedID != 42 {
+				t.Errorf("DeleteAccount() called for user %d, want 42", deletedID)
+			}
+			if _, revoked := tokenService.revoked[claims.ID]; revoked != tt.wantRevoked {
+				t.Errorf("Token revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
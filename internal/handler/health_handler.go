@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// HealthCheck pings a single external dependency
+type HealthCheck func(ctx context.Context) error
+
+// HealthCheckResult is the outcome of one dependency check
+type HealthCheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Healthy reports whether the check passed
+func (r HealthCheckResult) Healthy() bool {
+	return r.Status == "healthy"
+}
+
+// RunHealthChecks runs every check concurrently, each bounded by timeout, so it
+// takes roughly as long as the slowest check rather than the sum of all of
+// them. healthy is false when any check failed.
+func RunHealthChecks(checks map[string]HealthCheck, timeout time.Duration) (results map[string]HealthCheckResult, healthy bool) {
+	var (
+		mu sync.Mutex
+		g  errgroup.Group
+	)
+	results = make(map[string]HealthCheckResult, len(checks))
+	healthy = true
+
+	for name, check := range checks {
+		g.Go(func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			start := time.Now()
+			result := HealthCheckResult{Status: "healthy"}
+			if err := check(ctx); err != nil {
+				result.Status = "unhealthy"
+			}
+			result.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+			if !result.Healthy() {
+				healthy = false
+			}
+			// Failures are reported per dependency, not through the group
+			return nil
+		})
+	}
+	g.Wait()
+
+	return results, healthy
+}
+
+type HealthHandler struct {
+	checks  map[string]HealthCheck
+	timeout time.Duration
+}
+
+func NewHealthHandler(checks map[string]HealthCheck, timeout time.Duration) *HealthHandler {
+	return &HealthHandler{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Check reports each dependency as healthy or unhealthy, and 503 when any is down
+func (h *HealthHandler) Check(c *fiber.Ctx) error {
+	results, healthy := RunHealthChecks(h.checks, h.timeout)
+
+	checks := fiber.Map{}
+	for name, result := range results {
+		checks[name] = result.Status
+	}
+	status := fiber.Map{
+		"status":  "healthy",
+		"service": "OTP Service",
+		"version": "1.0",
+		"checks":  checks,
+	}
+
+	statusCode := fiber.StatusOK
+	if !healthy {
+		status["status"] = "unhealthy"
+		statusCode = fiber.StatusServiceUnavailable
+	}
+
+	return c.Status(statusCode).JSON(status)
+}
+
+// Live is the liveness probe: it answers 200 whenever the process can serve a
+// request, without touching any dependency, so an outage does not get the
+// pod restarted
+func (h *HealthHandler) Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "alive"})
+}
+
+// Ready is the readiness probe: like Check, with each dependency's status and
+// latency, so a pod whose dependencies are down is taken out of rotation
+func (h *HealthHandler) Ready(c *fiber.Ctx) error {
+	results, healthy := RunHealthChecks(h.checks, h.timeout)
+
+	status := fiber.Map{
+		"status": "ready",
+		"checks": results,
+	}
+
+	statusCode := fiber.StatusOK
+	if !healthy {
+		status["status"] = "not_ready"
+		statusCode = fiber.StatusServiceUnavailable
+	}
+
+	return c.Status(statusCode).JSON(status)
+}
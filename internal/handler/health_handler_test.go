@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func performHealthCheck(t *testing.T, checks map[string]HealthCheck, timeout time.Duration) (int, map[string]interface{}, time.Duration) {
+	app := fiber.New()
+	app.Get("/health", NewHealthHandler(checks, timeout).Check)
+
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest("GET", "/health", nil), -1)
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.StatusCode, body, elapsed
+}
+
+func slowCheck(delay time.Duration) HealthCheck {
+	return func(ctx context.Context) error {
+		select {
+		case <-time.After(delay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestHealthHandler_ChecksRunConcurrently(t *testing.T) {
+	checks := map[string]HealthCheck{
+		"database": slowCheck(200 * time.Millisecond),
+		"redis":    slowCheck(200 * time.Millisecond),
+	}
+
+	status, body, elapsed := performHealthCheck(t, checks, time.Second)
+
+	if status != fiber.StatusOK {
+		t.Errorf("Expected status %d, got %d", fiber.StatusOK, status)
+	}
+	// Sequential checks would take at least 400ms
+	if elapsed >= 350*time.Millisecond {
+		t.Errorf("Health check took %v, want roughly the slowest single check", elapsed)
+	}
+
+	results := body["checks"].(map[string]interface{})
+	for _, name := range []string{"database", "redis"} {
+		if results[name] != "healthy" {
+			t.Errorf("checks[%s] = %v, want healthy", name, results[name])
+		}
+	}
+}
+
+func TestHealthHandler_Unhealthy(t *testing.T) {
+	tests := []struct {
+		name  string
+		check HealthCheck
+	}{
+		{"Failing dependency", func(ctx context.Context) error { return errors.New("connection refused") }},
+		{"Dependency exceeds timeout", slowCheck(time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checks := map[string]HealthCheck{
+				"database": slowCheck(0),
+				"redis":    tt.check,
+			}
+
+			status, body, _ := performHealthCheck(t, checks, 50*time.Millisecond)
+
+			if status != fiber.StatusServiceUnavailable {
+				t.Errorf("Expected status %d, got %d", fiber.StatusServiceUnavailable, status)
+			}
+			if body["status"] != "unhealthy" {
+				t.Errorf("status = %v, want unhealthy", body["status"])
+			}
+
+			results := body["checks"].(map[string]interface{})
+			if results["database"] != "healthy" || results["redis"] != "unhealthy" {
+				t.Errorf("checks = %v, want database healthy and redis unhealthy", results)
+			}
+		})
+	}
+}
+
+func TestRunHealthChecks(t *testing.T) {
+	checks := map[string]HealthCheck{
+		"database": slowCheck(20 * time.Millisecond),
+		"redis":    func(ctx context.Context) error { return errors.New("connection refused") },
+	}
+
+	results, healthy := RunHealthChecks(checks, time.Second)
+
+	if healthy {
+		t.Error("RunHealthChecks() healthy = true with a failing check")
+	}
+	if !results["database"].Healthy() || results["redis"].Healthy() {
+		t.Errorf("results = %+v, want database healthy and redis unhealthy", results)
+	}
+	if latency := results["database"].LatencyMS; latency < 20 {
+		t.Errorf("database latency = %vms, want at least 20ms", latency)
+	}
+}
+
+func TestHealthHandler_Probes(t *testing.T) {
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name       string
+		path       string
+		check      HealthCheck
+		wantStatus int
+		wantBody   string
+	}{
+		{"Live with dependencies up", "/healthz", slowCheck(0), fiber.StatusOK, "alive"},
+		{"Live with dependencies down", "/healthz", failing, fiber.StatusOK, "alive"},
+		{"Ready with dependencies up", "/readyz", slowCheck(0), fiber.StatusOK, "ready"},
+		{"Ready with dependencies down", "/readyz", failing, fiber.StatusServiceUnavailable, "not_ready"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthHandler(map[string]HealthCheck{"redis": tt.check}, time.Second)
+			app := fiber.New()
+			app.Get("/healthz", h.Live)
+			app.Get("/readyz", h.Ready)
+
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil), -1)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+
+			var body struct {
+				Status string                       `json:"status"`
+				Checks map[string]HealthCheckResult `json:"checks"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if body.Status != tt.wantBody {
+				t.Errorf("status = %q, want %q", body.Status, tt.wantBody)
+			}
+			if tt.path == "/readyz" && body.Checks["redis"].Status == "" {
+				t.Errorf("checks = %+v, want the redis result", body.Checks)
+			}
+		})
+	}
+}
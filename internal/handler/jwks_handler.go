@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+type JWKSHandler struct {
+	jwtManager *jwt.JWTManager
+}
+
+func NewJWKSHandler(jwtManager *jwt.JWTManager) *JWKSHandler {
+	return &JWKSHandler{jwtManager: jwtManager}
+}
+
+// GetJWKS serves the RS256 public keys downstream services verify tokens with.
+// Verifiers cache it, so a previous key should stay configured for at least
+// the access token lifetime after a rotation.
+func (h *JWKSHandler) GetJWKS(c *fiber.Ctx) error {
+	jwks := h.jwtManager.JWKS()
+	if len(jwks.Keys) == 0 {
+		return utils.NotFound(c, utils.Message(c, "error.no_public_keys"))
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(jwks)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestJWKSHandler_GetJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	rsManager, err := jwt.NewRS256Manager(privPEM, pubPEM, 1, 720)
+	if err != nil {
+		t.Fatalf("NewRS256Manager() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		manager        *jwt.JWTManager
+		expectedStatus int
+		wantKeys       int
+	}{
+		{"RS256 publishes its key", rsManager, fiber.StatusOK, 1},
+		{"HS256 has nothing to publish", jwt.NewJWTManager("test-secret", 1, 720), fiber.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/.well-known/jwks.json", NewJWKSHandler(tt.manager).GetJWKS)
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.expectedStatus != fiber.StatusOK {
+				return
+			}
+
+			var jwks jwt.JWKS
+			if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(jwks.Keys) != tt.wantKeys {
+				t.Errorf("Got %d keys, want %d", len(jwks.Keys), tt.wantKeys)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"errors"
 	"strconv"
 
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
 	"github.com/ehsanshojaei/go-otp-auth/internal/service"
 	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
@@ -12,17 +14,19 @@ import (
 
 type UserHandler struct {
 	userService service.UserService
+	config      *config.Config
 }
 
-func NewUserHandler(userService service.UserService) *UserHandler {
+func NewUserHandler(userService service.UserService, config *config.Config) *UserHandler {
 	return &UserHandler{
 		userService: userService,
+		config:      config,
 	}
 }
 
 // GetUser godoc
 // @Summary Get user by ID
-// @Description Retrieve a single user by their ID
+// @Description Retrieve a single user by their ID. Requires the admin role.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -31,21 +35,57 @@ func NewUserHandler(userService service.UserService) *UserHandler {
 // @Success 200 {object} model.UserResponse
 // @Failure 400 {object} model.ErrorResponse
 // @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
 // @Failure 404 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
 // @Router /users/{id} [get]
 func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
-		return utils.BadRequest(c, "Invalid user ID format")
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_user_id"))
 	}
 
-	user, err := h.userService.GetUserByID(uint(id))
+	user, err := h.userService.GetUserByID(c.UserContext(), uint(id))
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.NotFound(c, "User not found")
+			return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
 		}
-		return utils.InternalError(c, "Failed to retrieve user")
+		return utils.InternalError(c, utils.Message(c, "error.get_user_failed"))
+	}
+
+	return c.JSON(user)
+}
+
+// GetUserByPhoneNumber godoc
+// @Summary Get user by phone number
+// @Description Look up a single user by phone number, normalized to E.164 before the lookup. Requires the admin role.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param phone query string true "Phone number"
+// @Success 200 {object} model.UserResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/by-phone [get]
+func (h *UserHandler) GetUserByPhoneNumber(c *fiber.Ctx) error {
+	phoneNumber := c.Query("phone")
+	if phoneNumber == "" {
+		return utils.BadRequest(c, utils.Message(c, "error.phone_required"))
+	}
+
+	user, err := h.userService.GetUserByPhoneNumber(c.UserContext(), phoneNumber)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPhoneNumber):
+			return utils.BadRequest(c, utils.Message(c, "error.invalid_phone_number"))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
+		}
+		return utils.InternalError(c, utils.Message(c, "error.get_user_failed"))
 	}
 
 	return c.JSON(user)
@@ -53,7 +93,7 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 
 // GetUsers godoc
 // @Summary Get list of users
-// @Description Retrieve paginated list of users with optional search
+// @Description Retrieve paginated list of users with optional search. Requires the admin role.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -61,29 +101,85 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 // @Param page query int false "Page number" default(1)
 // @Param page_size query int false "Page size" default(10)
 // @Param phone_number query string false "Phone number search"
+// @Param sort query string false "Sort order, descending with a leading -" Enums(registered_at, -registered_at, phone_number, -phone_number) default(-registered_at)
+// @Param not_found_404 query bool false "Respond 404 when the phone number search matches nothing"
 // @Success 200 {object} model.PaginatedUsersResponse
 // @Failure 400 {object} model.ErrorResponse
 // @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
 // @Router /users [get]
 func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
 	var req model.GetUsersRequest
 	if err := c.QueryParser(&req); err != nil {
-		return utils.BadRequest(c, err.Error())
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_query"))
 	}
 
 	if err := req.Validate(); err != nil {
-		return utils.BadRequest(c, err.Error())
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_pagination"))
 	}
 
-	users, err := h.userService.GetUsers(&req)
+	users, err := h.userService.GetUsers(c.UserContext(), &req)
 	if err != nil {
-		return utils.InternalError(c, "Failed to retrieve users")
+		if errors.Is(err, service.ErrInvalidSearchQuery) {
+			return utils.BadRequest(c, utils.Message(c, "error.invalid_phone_search"))
+		}
+		if errors.Is(err, service.ErrInvalidSort) {
+			return utils.BadRequest(c, utils.Message(c, "error.invalid_sort"))
+		}
+		return utils.InternalError(c, utils.Message(c, "error.get_users_failed"))
+	}
+
+	if req.PhoneNumber != "" && users.Total == 0 && c.QueryBool("not_found_404", h.config.User.SearchNotFound404) {
+		return utils.NotFound(c, utils.Message(c, "error.no_users_match_phone"))
 	}
 
 	return c.JSON(users)
 }
 
+// GetOTPAttempts godoc
+// @Summary Get a user's OTP verification attempts
+// @Description Page through every OTP verification made for the user, newest first, with the client IP and user agent. Requires the admin role.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} model.PaginatedOTPAttemptsResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/{id}/otp-attempts [get]
+func (h *UserHandler) GetOTPAttempts(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_user_id"))
+	}
+
+	var req model.GetOTPAttemptsRequest
+	if err := c.QueryParser(&req); err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_query"))
+	}
+	if err := req.Validate(); err != nil {
+		return utils.BadRequest(c, utils.Message(c, "error.invalid_pagination"))
+	}
+
+	attempts, err := h.userService.GetOTPAttempts(c.UserContext(), uint(id), &req)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
+		}
+		return utils.InternalError(c, utils.Message(c, "error.get_otp_attempts_failed"))
+	}
+
+	return c.JSON(attempts)
+}
+
 // GetProfile godoc
 // @Summary Get current user profile
 // @Description Retrieve current authenticated user's profile
@@ -102,22 +198,51 @@ func (h *UserHandler) GetProfile(c *fiber.Ctx) error {
 		return err
 	}
 
-	user, err := h.userService.GetUserByID(userID)
+	user, err := h.userService.GetUserByID(c.UserContext(), userID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return utils.NotFound(c, "User not found")
+			return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
 		}
-		return utils.InternalError(c, "Failed to retrieve profile")
+		return utils.InternalError(c, utils.Message(c, "error.get_profile_failed"))
 	}
 
 	return c.JSON(user)
 }
 
+// GetUserInfo godoc
+// @Summary Get OIDC userinfo claims
+// @Description Return OIDC-style claims for the authenticated user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} model.UserInfoResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /auth/userinfo [get]
+func (h *UserHandler) GetUserInfo(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	userInfo, err := h.userService.GetUserInfo(c.UserContext(), userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.NotFound(c, utils.Message(c, "error.user_not_found"))
+		}
+		return utils.InternalError(c, utils.Message(c, "error.get_user_info_failed"))
+	}
+
+	return c.JSON(userInfo)
+}
+
 // Helper method to extract user ID from JWT claims
 func (h *UserHandler) getUserID(c *fiber.Ctx) (uint, error) {
 	userID := c.Locals("user_id")
 	if userID == nil {
-		return 0, utils.Unauthorized(c, "User ID not found in token")
+		return 0, utils.Unauthorized(c, utils.Message(c, "error.user_id_missing"))
 	}
 	return userID.(uint), nil
 }
@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/middleware"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/service"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Mock user service for testing
+type mockUserService struct {
+	users    map[uint]*model.User
+	attempts map[uint][]model.OTPAttempt
+}
+
+func (m *mockUserService) getUser(id uint) (*model.User, error) {
+	user, exists := m.users[id]
+	if !exists {
+		return nil, fmt.Errorf("failed to get user: %w", gorm.ErrRecordNotFound)
+	}
+	return user, nil
+}
+
+func (m *mockUserService) GetUserByID(ctx context.Context, id uint) (*model.UserResponse, error) {
+	user, err := m.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+	response := user.ToResponse()
+	return &response, nil
+}
+
+func (m *mockUserService) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*model.UserResponse, error) {
+	if !strings.HasPrefix(phoneNumber, "+") {
+		return nil, service.ErrInvalidPhoneNumber
+	}
+	for _, user := range m.users {
+		if user.PhoneNumber == phoneNumber {
+			response := user.ToResponse()
+			return &response, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get user: %w", gorm.ErrRecordNotFound)
+}
+
+func (m *mockUserService) GetUserInfo(ctx context.Context, id uint) (*model.UserInfoResponse, error) {
+	user, err := m.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+	userInfo := user.ToUserInfo()
+	return &userInfo, nil
+}
+
+func (m *mockUserService) GetUsers(ctx context.Context, req *model.GetUsersRequest) (*model.PaginatedUsersResponse, error) {
+	switch strings.TrimPrefix(req.Sort, "-") {
+	case "", "registered_at", "phone_number":
+	default:
+		return nil, fmt.Errorf("failed to get users: %w", fmt.Errorf("%w: %q", service.ErrInvalidSort, req.Sort))
+	}
+
+	response := &model.PaginatedUsersResponse{Users: []model.UserResponse{}, Page: req.Page, PageSize: req.PageSize}
+	for _, user := range m.users {
+		if strings.Contains(user.PhoneNumber, req.PhoneNumber) {
+			response.Users = append(response.Users, user.ToResponse())
+		}
+	}
+	response.Total = int64(len(response.Users))
+	return response, nil
+}
+
+func (m *mockUserService) GetOTPAttempts(ctx context.Context, userID uint, req *model.GetOTPAttemptsRequest) (*model.PaginatedOTPAttemptsResponse, error) {
+	if _, err := m.getUser(userID); err != nil {
+		return nil, err
+	}
+	req.SetDefaults()
+
+	response := &model.PaginatedOTPAttemptsResponse{Attempts: []model.OTPAttemptResponse{}, Page: req.Page, PageSize: req.PageSize}
+	for _, attempt := range m.attempts[userID] {
+		response.Attempts = append(response.Attempts, attempt.ToResponse())
+	}
+	response.Total = int64(len(response.Attempts))
+	return response, nil
+}
+
+func (m *mockUserService) SetUserStatus(ctx context.Context, id uint, status model.UserStatus) (*model.UserResponse, error) {
+	user, err := m.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+	user.Status = status
+	response := user.ToResponse()
+	return &response, nil
+}
+
+func TestUserHandler_GetUserInfo(t *testing.T) {
+	updatedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	userService := &mockUserService{
+		users: map[uint]*model.User{
+			42: {ID: 42, PhoneNumber: "+1234567890", UpdatedAt: updatedAt},
+		},
+	}
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager, userService, newMockTokenService(), &config.Config{}, metrics.New())
+
+	app := fiber.New()
+	app.Get("/auth/userinfo", authMiddleware.RequireAuth(), NewUserHandler(userService, &config.Config{}).GetUserInfo)
+
+	validToken, err := jwtManager.GenerateToken(42, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	deletedUserToken, err := jwtManager.GenerateToken(7, "+1987654321")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+		checkClaims    bool
+	}{
+		{"Valid token", validToken, fiber.StatusOK, true},
+		{"Invalid token", "invalid.token.format", fiber.StatusUnauthorized, false},
+		{"Unknown user", deletedUserToken, fiber.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/auth/userinfo", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if tt.checkClaims {
+				var claims map[string]interface{}
+				if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+
+				expected := map[string]interface{}{
+					"sub":                   "42",
+					"phone_number":          "+1234567890",
+					"phone_number_verified": true,
+					"updated_at":            float64(updatedAt.Unix()),
+				}
+				if len(claims) != len(expected) {
+					t.Errorf("Claims = %v, want %v", claims, expected)
+				}
+				for key, want := range expected {
+					if claims[key] != want {
+						t.Errorf("claims[%s] = %v, want %v", key, claims[key], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUserHandler_GetUsers_NoMatch(t *testing.T) {
+	userService := &mockUserService{
+		users: map[uint]*model.User{
+			1: {ID: 1, PhoneNumber: "+1234567890"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		notFound404    bool
+		query          string
+		expectedStatus int
+	}{
+		{"Default - no match returns empty list", false, "?phone_number=%2B1999", fiber.StatusOK},
+		{"Config 404 - no match", true, "?phone_number=%2B1999", fiber.StatusNotFound},
+		{"Config 404 - match", true, "?phone_number=%2B1234", fiber.StatusOK},
+		{"Config 404 - no search term", true, "", fiber.StatusOK},
+		{"Query flag enables 404", false, "?phone_number=%2B1999&not_found_404=true", fiber.StatusNotFound},
+		{"Query flag overrides config", true, "?phone_number=%2B1999&not_found_404=false", fiber.StatusOK},
+		{"Valid sort", false, "?sort=-phone_number", fiber.StatusOK},
+		{"Unknown sort field", false, "?sort=password", fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{User: config.UserConfig{SearchNotFound404: tt.notFound404}}
+			app := fiber.New()
+			app.Get("/users", NewUserHandler(userService, cfg).GetUsers)
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/users"+tt.query, nil))
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if resp.StatusCode == fiber.StatusOK {
+				var users model.PaginatedUsersResponse
+				if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if users.Users == nil {
+					t.Error("Users = null, want a JSON array")
+				}
+			}
+		})
+	}
+}
+
+func TestUserHandler_GetUserByPhoneNumber(t *testing.T) {
+	userService := &mockUserService{
+		users: map[uint]*model.User{
+			1: {ID: 1, PhoneNumber: "+14155552671"},
+		},
+	}
+	app := fiber.New()
+	app.Get("/users/by-phone", NewUserHandler(userService, &config.Config{}).GetUserByPhoneNumber)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"Found", "?phone=%2B14155552671", fiber.StatusOK},
+		{"Not found", "?phone=%2B14155550100", fiber.StatusNotFound},
+		{"Invalid number", "?phone=4155552671", fiber.StatusBadRequest},
+		{"Missing phone", "", fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", "/users/by-phone"+tt.query, nil))
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if resp.StatusCode == fiber.StatusOK {
+				var user model.UserResponse
+				if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if user.ID != 1 {
+					t.Errorf("User ID = %d, want 1", user.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestUserHandler_GetOTPAttempts(t *testing.T) {
+	userService := &mockUserService{
+		users: map[uint]*model.User{
+			1: {ID: 1, PhoneNumber: "+14155552671"},
+		},
+		attempts: map[uint][]model.OTPAttempt{
+			1: {
+				{ID: 2, Success: true, IP: "203.0.113.7", UserAgent: "curl/8.0"},
+				{ID: 1, Success: false, IP: "203.0.113.7", UserAgent: "curl/8.0"},
+			},
+		},
+	}
+	app := fiber.New()
+	app.Get("/users/:id/otp-attempts", NewUserHandler(userService, &config.Config{}).GetOTPAttempts)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedTotal  int64
+	}{
+		{"Attempts", "/users/1/otp-attempts", fiber.StatusOK, 2},
+		{"Paged", "/users/1/otp-attempts?page=1&page_size=50", fiber.StatusOK, 2},
+		{"Page size too large", "/users/1/otp-attempts?page_size=500", fiber.StatusBadRequest, 0},
+		{"Unknown user", "/users/999/otp-attempts", fiber.StatusNotFound, 0},
+		{"Invalid ID", "/users/abc/otp-attempts", fiber.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if resp.StatusCode == fiber.StatusOK {
+				var page model.PaginatedOTPAttemptsResponse
+				if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if page.Total != tt.expectedTotal || len(page.Attempts) != int(tt.expectedTotal) {
+					t.Errorf("Got %d of %d attempts, want %d", len(page.Attempts), page.Total, tt.expectedTotal)
+				}
+				if !page.Attempts[0].Success || page.Attempts[0].IP != "203.0.113.7" {
+					t.Errorf("First attempt = %+v, want the successful one with its IP", page.Attempts[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+)
+
+func TestAccessLog_JSON(t *testing.T) {
+	var output bytes.Buffer
+	app := fiber.New()
+	app.Use(requestid.New())
+	app.Use(AccessLog(AccessLogJSON, &output))
+	app.Get("/users/profile", func(c *fiber.Ctx) error {
+		c.Locals("user_id", uint(42))
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Post("/auth/send-otp", func(c *fiber.Ctx) error {
+		return utils.BadRequest(c, "Phone number must be in international format")
+	})
+	app.Get("/boom", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "down")
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		wantStatus    int
+		wantUserID    uint
+		wantErrorCode string
+	}{
+		{"Authenticated request", "GET", "/users/profile", fiber.StatusOK, 42, ""},
+		{"Error response", "POST", "/auth/send-otp", fiber.StatusBadRequest, 0, "bad_request"},
+		{"Error returned by the handler", "GET", "/boom", fiber.StatusServiceUnavailable, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output.Reset()
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(fiber.HeaderXRequestID, "req-123")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+				t.Fatalf("Access log is not a JSON line: %q", output.String())
+			}
+			for _, field := range []string{"time", "method", "path", "status", "latency_ms", "ip", "request_id"} {
+				if _, ok := entry[field]; !ok {
+					t.Errorf("Access log missing %q: %v", field, entry)
+				}
+			}
+			if entry["method"] != tt.method || entry["path"] != tt.path || entry["status"] != float64(tt.wantStatus) {
+				t.Errorf("Access log = %v, want %s %s %d", entry, tt.method, tt.path, tt.wantStatus)
+			}
+			if entry["request_id"] != "req-123" {
+				t.Errorf("request_id = %v, want req-123", entry["request_id"])
+			}
+			if userID, _ := entry["user_id"].(float64); uint(userID) != tt.wantUserID {
+				t.Errorf("user_id = %v, want %d", entry["user_id"], tt.wantUserID)
+			}
+			if errorCode, _ := entry["error_code"].(string); errorCode != tt.wantErrorCode {
+				t.Errorf("error_code = %q, want %q", errorCode, tt.wantErrorCode)
+			}
+		})
+	}
+}
+
+func TestAccessLog_Text(t *testing.T) {
+	var output bytes.Buffer
+	app := fiber.New()
+	app.Use(AccessLog(AccessLogText, &output))
+	app.Get("/health", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/health", nil)); err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+	if line := output.String(); !strings.Contains(line, "200 - GET /health") || strings.HasPrefix(line, "{") {
+		t.Errorf("Text access log = %q, want the plain format", line)
+	}
+}
@@ -1,20 +1,53 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/service"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/i18n"
 	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/metrics"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type AuthMiddleware struct {
-	jwtManager *jwt.JWTManager
+	jwtManager   *jwt.JWTManager
+	userService  service.UserService
+	tokenService service.TokenService
+	config       *config.Config
+	metrics      *metrics.Metrics
+
+	// Cache of users confirmed to exist, with their status at lookup time
+	mu         sync.Mutex
+	knownUsers map[uint]knownUser
+}
+
+type knownUser struct {
+	status    model.UserStatus
+	expiresAt time.Time
 }
 
-func NewAuthMiddleware(jwtManager *jwt.JWTManager) *AuthMiddleware {
+func NewAuthMiddleware(jwtManager *jwt.JWTManager, userService service.UserService, tokenService service.TokenService, config *config.Config, appMetrics *metrics.Metrics) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwtManager: jwtManager,
+		jwtManager:   jwtManager,
+		userService:  userService,
+		tokenService: tokenService,
+		config:       config,
+		metrics:      appMetrics,
+		knownUsers:   make(map[uint]knownUser),
 	}
 }
 
@@ -22,26 +55,182 @@ func (m *AuthMiddleware) RequireAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
-				Error:   "unauthorized",
-				Message: "Authorization header is required",
-			})
+			return unauthorized(c, "", "error.authorization_required")
 		}
 
 		// Extract token (remove "Bearer " if present)
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		tokenString = strings.TrimSpace(tokenString)
 
+		if m.isBreakGlassToken(tokenString) {
+			log.Printf("AUDIT: break-glass token used: method=%s path=%s ip=%s", c.Method(), c.OriginalURL(), c.IP())
+			m.metrics.ObserveBreakGlassUse()
+			c.Locals("break_glass", true)
+			return c.Next()
+		}
+
+		// The parser's error names the failed check; clients only learn that the token was refused
 		claims, err := m.jwtManager.ValidateToken(tokenString)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
-				Error:   "unauthorized",
-				Message: err.Error(),
+			return unauthorized(c, "invalid_token", "error.invalid_token")
+		}
+
+		revoked, err := m.tokenService.IsRevoked(c.UserContext(), claims.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+				Error:   "internal_error",
+				Message: utils.Message(c, "error.check_token_failed"),
+			})
+		}
+		if revoked {
+			return unauthorized(c, "invalid_token", "error.token_revoked")
+		}
+
+		// Only existing, active users authenticate, whatever their token says
+		status, exists, err := m.userStatus(c.UserContext(), claims.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+				Error:   "internal_error",
+				Message: utils.Message(c, "error.verify_user_failed"),
+			})
+		}
+		if !exists {
+			return unauthorized(c, "invalid_token", "error.user_no_longer_exists")
+		}
+		if err := service.CheckAccountStatus(status); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+				Error:   "account_inactive",
+				Message: utils.Message(c, accountStatusMessages[status]),
 			})
 		}
 
+		// phone_number is whatever the token carries, masked or hashed in JWT_PHONE_CLAIM privacy modes
 		c.Locals("user_id", claims.UserID)
 		c.Locals("phone_number", claims.PhoneNumber)
+		c.Locals("role", claims.Role)
+		// token_id and token_expires_at let logout revoke exactly this token
+		c.Locals("token_id", claims.ID)
+		if claims.ExpiresAt != nil {
+			c.Locals("token_expires_at", claims.ExpiresAt.Time)
+		}
 		return c.Next()
 	}
 }
+
+// accountStatusMessages holds the message keys for the statuses CheckAccountStatus refuses
+var accountStatusMessages = map[model.UserStatus]string{
+	model.UserStatusSuspended:   "error.account_suspended",
+	model.UserStatusDeactivated: "error.account_deactivated",
+	model.UserStatusPending:     "error.account_pending",
+}
+
+// unauthorized answers 401 with an RFC 6750 WWW-Authenticate challenge. A
+// request without credentials gets a bare challenge with no error code (§3.1).
+// The body is localized; error_description stays English, as the RFC limits it
+// to ASCII.
+func unauthorized(c *fiber.Ctx, errorCode, messageKey string) error {
+	challenge := "Bearer"
+	if errorCode != "" {
+		description := i18n.T(i18n.DefaultLocale, messageKey)
+		challenge += fmt.Sprintf(` error="%s", error_description="%s"`, errorCode, challengeQuoter.Replace(description))
+	}
+	c.Set(fiber.HeaderWWWAuthenticate, challenge)
+
+	return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
+		Error:   "unauthorized",
+		Message: utils.Message(c, messageKey),
+	})
+}
+
+// challengeQuoter keeps a description inside its quoted-string
+var challengeQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// RequireRole must run after RequireAuth and admits tokens carrying the role.
+// For the admin role the configured ADMIN_PHONE_NUMBERS are admitted too, so
+// tokens minted before roles existed keep working.
+func (m *AuthMiddleware) RequireRole(role model.UserRole) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if breakGlass, _ := c.Locals("break_glass").(bool); breakGlass {
+			return c.Next()
+		}
+
+		if tokenRole, _ := c.Locals("role").(string); tokenRole == string(role) {
+			return c.Next()
+		}
+		if role == model.RoleAdmin {
+			userID, _ := c.Locals("user_id").(uint)
+			phoneClaim, _ := c.Locals("phone_number").(string)
+			if m.isAdmin(c.UserContext(), userID, phoneClaim) {
+				return c.Next()
+			}
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+			Error:   "forbidden",
+			Message: fmt.Sprintf(utils.Message(c, "error.role_required"), role),
+		})
+	}
+}
+
+// RequireAdmin is RequireRole for the admin role
+func (m *AuthMiddleware) RequireAdmin() fiber.Handler {
+	return m.RequireRole(model.RoleAdmin)
+}
+
+// isAdmin matches the token against ADMIN_PHONE_NUMBERS. Hashed claims compare
+// against the admins' hashes; a masked claim is ambiguous, so the real number
+// is looked up by user ID instead.
+func (m *AuthMiddleware) isAdmin(ctx context.Context, userID uint, phoneClaim string) bool {
+	mode := m.config.JWT.PhoneClaim
+	if mode == utils.PhoneClaimMasked {
+		user, err := m.userService.GetUserByID(ctx, userID)
+		if err != nil {
+			return false
+		}
+		mode, phoneClaim = utils.PhoneClaimFull, user.PhoneNumber
+	}
+
+	for _, adminPhone := range m.config.Auth.AdminPhoneNumbers {
+		if phoneClaim != "" && phoneClaim == utils.PhoneClaim(mode, m.config.JWT.SecretKey, adminPhone) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBreakGlassToken compares the token's hash with BREAK_GLASS_TOKEN_HASH in constant time
+func (m *AuthMiddleware) isBreakGlassToken(token string) bool {
+	if m.config.Auth.BreakGlassTokenHash == "" || token == "" {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(m.config.Auth.BreakGlassTokenHash)) == 1
+}
+
+// userStatus looks the user up, caching found users for the configured TTL,
+// so a status change can take up to AUTH_USER_CACHE_SECONDS to apply
+func (m *AuthMiddleware) userStatus(ctx context.Context, userID uint) (model.UserStatus, bool, error) {
+	m.mu.Lock()
+	known, cached := m.knownUsers[userID]
+	m.mu.Unlock()
+	if cached && time.Now().Before(known.expiresAt) {
+		return known.status, true, nil
+	}
+
+	user, err := m.userService.GetUserByID(ctx, userID)
+	if err != nil {
+		m.mu.Lock()
+		delete(m.knownUsers, userID)
+		m.mu.Unlock()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	m.mu.Lock()
+	m.knownUsers[userID] = knownUser{status: user.Status, expiresAt: time.Now().Add(m.config.Auth.UserCacheTTL)}
+	m.mu.Unlock()
+	return user.Status, true, nil
+}
@@ -0,0 +1,573 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/metrics"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/gorm"
+)
+
+// Mock user service for testing
+type mockUserService struct {
+	users   map[uint]*model.UserResponse
+	lookups int
+}
+
+func newMockUserService() *mockUserService {
+	return &mockUserService{
+		users: make(map[uint]*model.UserResponse),
+	}
+}
+
+func (m *mockUserService) GetUserByID(ctx context.Context, id uint) (*model.UserResponse, error) {
+	m.lookups++
+	user, exists := m.users[id]
+	if !exists {
+		return nil, fmt.Errorf("failed to get user: %w", gorm.ErrRecordNotFound)
+	}
+	return user, nil
+}
+
+func (m *mockUserService) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*model.UserResponse, error) {
+	for _, user := range m.users {
+		if user.PhoneNumber == phoneNumber {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get user: %w", gorm.ErrRecordNotFound)
+}
+
+func (m *mockUserService) GetUserInfo(ctx context.Context, id uint) (*model.UserInfoResponse, error) {
+	return &model.UserInfoResponse{}, nil
+}
+
+func (m *mockUserService) GetUsers(ctx context.Context, req *model.GetUsersRequest) (*model.PaginatedUsersResponse, error) {
+	return &model.PaginatedUsersResponse{}, nil
+}
+
+func (m *mockUserService) GetOTPAttempts(ctx context.Context, userID uint, req *model.GetOTPAttemptsRequest) (*model.PaginatedOTPAttemptsResponse, error) {
+	return &model.PaginatedOTPAttemptsResponse{}, nil
+}
+
+func (m *mockUserService) SetUserStatus(ctx context.Context, id uint, status model.UserStatus) (*model.UserResponse, error) {
+	return m.users[id], nil
+}
+
+// Mock token service for testing
+type mockTokenService struct {
+	revoked map[string]time.Time
+}
+
+func newMockTokenService() *mockTokenService {
+	return &mockTokenService{revoked: make(map[string]time.Time)}
+}
+
+func (m *mockTokenService) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	m.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (m *mockTokenService) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	_, revoked := m.revoked[tokenID]
+	return revoked, nil
+}
+
+func setupTestApp() (*fiber.App, *jwt.JWTManager, *mockUserService) {
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	userService := newMockUserService()
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			UserCacheTTL: time.Minute,
+		},
+	}
+
+	authMiddleware := NewAuthMiddleware(jwtManager, userService, newMockTokenService(), cfg, metrics.New())
+
+	app := fiber.New()
+	app.Get("/protected", authMiddleware.RequireAuth(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	return app, jwtManager, userService
+}
+
+func performRequest(t *testing.T, app *fiber.App, token string) int {
+	req := httptest.NewRequest("GET", "/protected", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestAuthMiddleware_RequireAuth(t *testing.T) {
+	app, jwtManager, userService := setupTestApp()
+	userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: "+1234567890"}
+
+	validToken, err := jwtManager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{"Valid token", validToken, fiber.StatusOK},
+		{"Missing token", "", fiber.StatusUnauthorized},
+		{"Invalid token", "invalid.token.format", fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := performRequest(t, app, tt.token); status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_UserExists(t *testing.T) {
+	tests := []struct {
+		name           string
+		userExists     bool
+		expectedStatus int
+	}{
+		{"Existing user", true, fiber.StatusOK},
+		{"Deleted user", false, fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, jwtManager, userService := setupTestApp()
+			if tt.userExists {
+				userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: "+1234567890"}
+			}
+
+			token, err := jwtManager.GenerateToken(1, "+1234567890")
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+
+			if status := performRequest(t, app, token); status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_UserStatus(t *testing.T) {
+	tests := []struct {
+		status         model.UserStatus
+		expectedStatus int
+	}{
+		{model.UserStatusActive, fiber.StatusOK},
+		{model.UserStatusSuspended, fiber.StatusForbidden},
+		{model.UserStatusPending, fiber.StatusForbidden},
+		{model.UserStatusDeactivated, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			app, jwtManager, userService := setupTestApp()
+			userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: "+1234567890", Status: tt.status}
+
+			token, err := jwtManager.GenerateToken(1, "+1234567890")
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+
+			if status := performRequest(t, app, token); status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+		})
+	}
+}
+
+// The status check needs no configuration
+func TestAuthMiddleware_UserStatus_DefaultConfig(t *testing.T) {
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	userService := newMockUserService()
+	userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: "+1234567890", Status: model.UserStatusSuspended}
+	authMiddleware := NewAuthMiddleware(jwtManager, userService, newMockTokenService(), &config.Config{}, metrics.New())
+
+	app := fiber.New()
+	app.Get("/protected", authMiddleware.RequireAuth(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	token, err := jwtManager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if status := performRequest(t, app, token); status != fiber.StatusForbidden {
+		t.Errorf("Suspended user status = %d, want %d", status, fiber.StatusForbidden)
+	}
+}
+
+func TestAuthMiddleware_UserExists_Cached(t *testing.T) {
+	app, jwtManager, userService := setupTestApp()
+	userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: "+1234567890"}
+
+	token, err := jwtManager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if status := performRequest(t, app, token); status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusOK, status)
+		}
+	}
+
+	if userService.lookups != 1 {
+		t.Errorf("User lookups = %v, want 1", userService.lookups)
+	}
+}
+
+func TestAuthMiddleware_RequireAdmin(t *testing.T) {
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			AdminPhoneNumbers: []string{"+1000000000"},
+		},
+	}
+	userService := newMockUserService()
+	userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: "+1234567890"}
+	authMiddleware := NewAuthMiddleware(jwtManager, userService, newMockTokenService(), cfg, metrics.New())
+
+	app := fiber.New()
+	app.Get("/protected", authMiddleware.RequireAuth(), authMiddleware.RequireAdmin(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		phoneNumber    string
+		expectedStatus int
+	}{
+		{"Admin phone number", "+1000000000", fiber.StatusOK},
+		{"Regular phone number", "+1234567890", fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwtManager.GenerateToken(1, tt.phoneNumber)
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+
+			if status := performRequest(t, app, token); status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_RequireRole(t *testing.T) {
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			AdminPhoneNumbers: []string{"+1000000000"},
+		},
+	}
+	userService := newMockUserService()
+	userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: "+1234567890"}
+	authMiddleware := NewAuthMiddleware(jwtManager, userService, newMockTokenService(), cfg, metrics.New())
+
+	app := fiber.New()
+	app.Get("/protected", authMiddleware.RequireAuth(), authMiddleware.RequireRole(model.RoleAdmin), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		phoneNumber    string
+		role           string
+		expectedStatus int
+	}{
+		{"Admin role", "+1234567890", "admin", fiber.StatusOK},
+		{"User role", "+1234567890", "user", fiber.StatusForbidden},
+		{"No role claim", "+1234567890", "", fiber.StatusForbidden},
+		{"Configured admin phone without the role", "+1000000000", "user", fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := jwtManager.GenerateTokenPair(1, tt.phoneNumber, tt.role)
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+
+			if status := performRequest(t, app, token); status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_BreakGlassToken(t *testing.T) {
+	const breakGlassToken = "emergency-token"
+	sum := sha256.Sum256([]byte(breakGlassToken))
+
+	tests := []struct {
+		name           string
+		tokenHash      string
+		expectedStatus int
+		wantAudit      bool
+	}{
+		{"Configured token grants admin", hex.EncodeToString(sum[:]), fiber.StatusOK, true},
+		{"Rejected when unset", "", fiber.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var auditLog bytes.Buffer
+			log.SetOutput(&auditLog)
+			defer log.SetOutput(os.Stderr)
+
+			appMetrics := metrics.New()
+			cfg := &config.Config{
+				Auth: config.AuthConfig{
+					AdminPhoneNumbers:   []string{"+1000000000"},
+					BreakGlassTokenHash: tt.tokenHash,
+				},
+			}
+			authMiddleware := NewAuthMiddleware(jwt.NewJWTManager("test-secret", 1, 720), newMockUserService(), newMockTokenService(), cfg, appMetrics)
+
+			app := fiber.New()
+			app.Get("/protected", authMiddleware.RequireAuth(), authMiddleware.RequireAdmin(), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			if status := performRequest(t, app, breakGlassToken); status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+
+			if got := strings.Contains(auditLog.String(), "AUDIT: break-glass token used"); got != tt.wantAudit {
+				t.Errorf("Audit record written = %v, want %v", got, tt.wantAudit)
+			}
+
+			uses := 0
+			if tt.wantAudit {
+				uses = 1
+			}
+			expected := fmt.Sprintf(`
+# HELP break_glass_token_uses_total Total number of requests authenticated with the break-glass token; alert on any increase.
+# TYPE break_glass_token_uses_total counter
+break_glass_token_uses_total %d
+`, uses)
+			if err := testutil.GatherAndCompare(appMetrics.Registry(), strings.NewReader(expected), "break_glass_token_uses_total"); err != nil {
+				t.Errorf("Unexpected break-glass metric: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_RequireAdmin_PhoneClaimPrivacy(t *testing.T) {
+	const adminPhone = "+1000000000"
+
+	tests := []struct {
+		mode string
+	}{
+		{utils.PhoneClaimMasked},
+		{utils.PhoneClaimHashed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+			userService := newMockUserService()
+			userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: adminPhone}
+			// Same mask as the admin number, but a different person
+			userService.users[2] = &model.UserResponse{ID: 2, PhoneNumber: "+1000990000"}
+			cfg := &config.Config{
+				JWT:  config.JWTConfig{SecretKey: "test-secret", PhoneClaim: tt.mode},
+				Auth: config.AuthConfig{AdminPhoneNumbers: []string{adminPhone}},
+			}
+			authMiddleware := NewAuthMiddleware(jwtManager, userService, newMockTokenService(), cfg, metrics.New())
+
+			app := fiber.New()
+			app.Get("/protected", authMiddleware.RequireAuth(), authMiddleware.RequireAdmin(), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			for id, expectedStatus := range map[uint]int{1: fiber.StatusOK, 2: fiber.StatusForbidden} {
+				claim := utils.PhoneClaim(tt.mode, "test-secret", userService.users[id].PhoneNumber)
+				token, err := jwtManager.GenerateToken(id, claim)
+				if err != nil {
+					t.Fatalf("Failed to generate token: %v", err)
+				}
+
+				if status := performRequest(t, app, token); status != expectedStatus {
+					t.Errorf("User %d: expected status %d, got %d", id, expectedStatus, status)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_RevokedToken(t *testing.T) {
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	tokenService := newMockTokenService()
+	userService := newMockUserService()
+	userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: "+1234567890"}
+	authMiddleware := NewAuthMiddleware(jwtManager, userService, tokenService, &config.Config{}, metrics.New())
+
+	var tokenID string
+	app := fiber.New()
+	app.Get("/protected", authMiddleware.RequireAuth(), func(c *fiber.Ctx) error {
+		tokenID, _ = c.Locals("token_id").(string)
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	token, err := jwtManager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	if status := performRequest(t, app, token); status != fiber.StatusOK {
+		t.Fatalf("Expected status %d, got %d", fiber.StatusOK, status)
+	}
+	if tokenID == "" {
+		t.Fatal("token_id local not set")
+	}
+
+	tokenService.Revoke(context.Background(), tokenID, time.Now().Add(time.Hour))
+	if status := performRequest(t, app, token); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected status %d for a revoked token, got %d", fiber.StatusUnauthorized, status)
+	}
+}
+
+func TestAuthMiddleware_WWWAuthenticate(t *testing.T) {
+	app, jwtManager, _ := setupTestApp()
+
+	// Same secret, but already past its expiry
+	expiredToken, err := jwt.NewJWTManager("test-secret", -1, 720).GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	_, refreshToken, err := jwtManager.GenerateTokenPair(1, "+1234567890", "user")
+	if err != nil {
+		t.Fatalf("Failed to generate token pair: %v", err)
+	}
+	deletedUserToken, err := jwtManager.GenerateToken(99, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		challenge string
+	}{
+		{"Missing token", "", "Bearer"},
+		// The parser's reason stays server-side
+		{"Malformed token", "invalid.token.format", `Bearer error="invalid_token", error_description="Token is invalid or expired"`},
+		{"Expired token", expiredToken, `Bearer error="invalid_token", error_description="Token is invalid or expired"`},
+		{"Refresh token", refreshToken, `Bearer error="invalid_token", error_description="Token is invalid or expired"`},
+		{"Deleted user", deletedUserToken, `Bearer error="invalid_token", error_description="User no longer exists"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/protected", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusUnauthorized {
+				t.Fatalf("Expected status %d, got %d", fiber.StatusUnauthorized, resp.StatusCode)
+			}
+			if challenge := resp.Header.Get(fiber.HeaderWWWAuthenticate); challenge != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, tt.challenge)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_LocalizedMessages(t *testing.T) {
+	jwtManager := jwt.NewJWTManager("test-secret", 1, 720)
+	userService := newMockUserService()
+	userService.users[1] = &model.UserResponse{ID: 1, PhoneNumber: "+1234567890"}
+	authMiddleware := NewAuthMiddleware(jwtManager, userService, newMockTokenService(), &config.Config{}, metrics.New())
+
+	app := fiber.New()
+	app.Use(Locale())
+	app.Get("/protected", authMiddleware.RequireAuth(), authMiddleware.RequireAdmin(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	userToken, err := jwtManager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	deletedUserToken, err := jwtManager.GenerateToken(99, "+1234567890")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+		wantMessage    string
+		wantChallenge  string
+	}{
+		// error_description must stay ASCII, so only the body is translated
+		{"Deleted user", deletedUserToken, fiber.StatusUnauthorized, "El usuario ya no existe", `Bearer error="invalid_token", error_description="User no longer exists"`},
+		{"Missing role", userToken, fiber.StatusForbidden, "Se requiere el rol admin", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/protected", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			req.Header.Set(fiber.HeaderAcceptLanguage, "es")
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			var response model.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", response.Message, tt.wantMessage)
+			}
+			if challenge := resp.Header.Get(fiber.HeaderWWWAuthenticate); challenge != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, tt.wantChallenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireJSON rejects POST requests that are empty or not sent as application/json,
+// so BodyParser never falls back to decoding form or XML bodies
+func RequireJSON() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost {
+			return c.Next()
+		}
+
+		if !c.Is("json") {
+			return utils.ErrorResponse(c, fiber.StatusUnsupportedMediaType, "unsupported_media_type", utils.Message(c, "error.content_type_json"))
+		}
+
+		if len(c.Body()) == 0 {
+			return utils.BadRequest(c, utils.Message(c, "error.request_body_required"))
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequireJSON(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequireJSON())
+	app.Post("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{"json body", "POST", "application/json", `{"phone_number":"+1234567890"}`, fiber.StatusOK},
+		{"json with charset", "POST", "application/json; charset=utf-8", `{"phone_number":"+1234567890"}`, fiber.StatusOK},
+		{"form encoded body", "POST", "application/x-www-form-urlencoded", "phone_number=%2B1234567890", fiber.StatusUnsupportedMediaType},
+		{"xml body", "POST", "application/xml", "<phone_number>+1234567890</phone_number>", fiber.StatusUnsupportedMediaType},
+		{"missing content type", "POST", "", `{"phone_number":"+1234567890"}`, fiber.StatusUnsupportedMediaType},
+		{"empty body", "POST", "application/json", "", fiber.StatusBadRequest},
+		{"get is not checked", "GET", "", "", fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
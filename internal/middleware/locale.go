@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/ehsanshojaei/go-otp-auth/pkg/i18n"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Locale resolves the Accept-Language header to a bundled locale and stores it
+// in the "locale" local, where utils.Message finds it
+func Locale() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals("locale", i18n.Match(c.Get(fiber.HeaderAcceptLanguage)))
+		c.Vary(fiber.HeaderAcceptLanguage)
+		return c.Next()
+	}
+}
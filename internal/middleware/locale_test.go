@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLocale(t *testing.T) {
+	app := fiber.New()
+	app.Use(Locale())
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(utils.Message(c, "error.user_not_found"))
+	})
+
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"es-ES,es;q=0.9", "Usuario no encontrado"},
+		{"fr-FR", "User not found"},
+		{"", "User not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(fiber.HeaderAcceptLanguage, tt.acceptLanguage)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.want {
+				t.Errorf("Message = %q, want %q", body, tt.want)
+			}
+			if vary := resp.Header.Get(fiber.HeaderVary); vary != fiber.HeaderAcceptLanguage {
+				t.Errorf("Vary = %q, want %q", vary, fiber.HeaderAcceptLanguage)
+			}
+		})
+	}
+}
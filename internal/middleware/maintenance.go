@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/service"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+type MaintenanceMiddleware struct {
+	maintenanceService service.MaintenanceService
+}
+
+func NewMaintenanceMiddleware(maintenanceService service.MaintenanceService) *MaintenanceMiddleware {
+	return &MaintenanceMiddleware{
+		maintenanceService: maintenanceService,
+	}
+}
+
+// RejectWrites returns 503 for non-read requests while maintenance mode is on
+func (m *MaintenanceMiddleware) RejectWrites() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+
+		status, err := m.maintenanceService.Status(c.UserContext())
+		if err != nil {
+			// Fail open so a Redis outage doesn't take down writes on its own
+			log.Printf("Failed to check maintenance mode: %v", err)
+			return c.Next()
+		}
+
+		if status.Enabled {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(model.ErrorResponse{
+				Error:   "maintenance_mode",
+				Message: utils.Message(c, "error.maintenance_mode"),
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Mock maintenance service for testing
+type mockMaintenanceService struct {
+	enabled   bool
+	statusErr error
+}
+
+func (m *mockMaintenanceService) Status(ctx context.Context) (*model.MaintenanceStatusResponse, error) {
+	if m.statusErr != nil {
+		return nil, m.statusErr
+	}
+	return &model.MaintenanceStatusResponse{Enabled: m.enabled}, nil
+}
+
+func (m *mockMaintenanceService) Enable(ctx context.Context, duration time.Duration) (*model.MaintenanceStatusResponse, error) {
+	m.enabled = true
+	return m.Status(ctx)
+}
+
+func (m *mockMaintenanceService) Disable(ctx context.Context) (*model.MaintenanceStatusResponse, error) {
+	m.enabled = false
+	return m.Status(ctx)
+}
+
+func TestMaintenanceMiddleware_RejectWrites(t *testing.T) {
+	maintenanceService := &mockMaintenanceService{}
+	maintenanceMiddleware := NewMaintenanceMiddleware(maintenanceService)
+
+	app := fiber.New()
+	app.Use(maintenanceMiddleware.RejectWrites())
+	app.Get("/resource", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	app.Post("/resource", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	tests := []struct {
+		name           string
+		enabled        bool
+		statusErr      error
+		method         string
+		expectedStatus int
+	}{
+		{"Maintenance off - read", false, nil, "GET", fiber.StatusOK},
+		{"Maintenance off - write", false, nil, "POST", fiber.StatusOK},
+		{"Maintenance on - read allowed", true, nil, "GET", fiber.StatusOK},
+		{"Maintenance on - write blocked", true, nil, "POST", fiber.StatusServiceUnavailable},
+		{"Status check fails - write allowed", false, errors.New("redis down"), "POST", fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maintenanceService.enabled = tt.enabled
+			maintenanceService.statusErr = tt.statusErr
+
+			req := httptest.NewRequest(tt.method, "/resource", nil)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to perform request: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
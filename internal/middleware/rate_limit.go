@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"slices"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// NewIPRateLimiter allows max requests per client IP within each expiration
+// window. A shared storage makes the limit hold across instances; nil keeps
+// counts in memory. Requests to skipPaths, such as health probes, are never
+// limited, so they keep answering while the storage is unreachable.
+func NewIPRateLimiter(max int, expiration time.Duration, storage fiber.Storage, skipPaths ...string) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: expiration,
+		Storage:    storage,
+		Next: func(c *fiber.Ctx) bool {
+			return slices.Contains(skipPaths, c.Path())
+		},
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return utils.LimitExceeded(c, fiber.StatusTooManyRequests, "rate_limit_exceeded", model.LimitTypeIP, utils.Message(c, "error.ip_rate_limit_exceeded"))
+		},
+	})
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIPRateLimiter_LimitType(t *testing.T) {
+	app := fiber.New()
+	app.Use(NewIPRateLimiter(1, time.Minute, nil))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	if resp, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("First request = %v, %v, want 200", resp.StatusCode, err)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", fiber.StatusTooManyRequests, resp.StatusCode)
+	}
+
+	var response model.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Error != "rate_limit_exceeded" || response.LimitType != model.LimitTypeIP {
+		t.Errorf("Response = %+v, want rate_limit_exceeded with limit_type %q", response, model.LimitTypeIP)
+	}
+}
+
+// mapStorage is a fiber.Storage two limiters can share, standing in for Redis;
+// with failing set it errors like an unreachable one
+type mapStorage struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	calls   int
+	failing bool
+}
+
+func (s *mapStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.failing {
+		return nil, errors.New("storage unavailable")
+	}
+	return s.entries[key], nil
+}
+
+func (s *mapStorage) Set(key string, value []byte, exp time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.failing {
+		return errors.New("storage unavailable")
+	}
+	s.entries[key] = value
+	return nil
+}
+
+func (s *mapStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *mapStorage) Reset() error { return nil }
+func (s *mapStorage) Close() error { return nil }
+
+func newLimitedApp(storage fiber.Storage) *fiber.App {
+	app := fiber.New()
+	app.Use(NewIPRateLimiter(1, time.Minute, storage, "/health"))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Get("/health", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func TestIPRateLimiter_SharedStorage(t *testing.T) {
+	storage := &mapStorage{entries: make(map[string][]byte)}
+	instanceA, instanceB := newLimitedApp(storage), newLimitedApp(storage)
+
+	if resp, err := instanceA.Test(httptest.NewRequest("GET", "/", nil)); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("First request = %v, %v, want 200", resp.StatusCode, err)
+	}
+
+	resp, err := instanceB.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("Request to the other instance = %d, want %d", resp.StatusCode, fiber.StatusTooManyRequests)
+	}
+}
+
+func TestIPRateLimiter_SkipPaths(t *testing.T) {
+	storage := &mapStorage{entries: make(map[string][]byte), failing: true}
+	app := newLimitedApp(storage)
+
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/health", nil))
+		if err != nil || resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Health request %d = %v, %v, want 200", i+1, resp.StatusCode, err)
+		}
+	}
+	if storage.calls != 0 {
+		t.Errorf("Health requests touched the limiter storage %d times, want 0", storage.calls)
+	}
+}
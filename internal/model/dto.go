@@ -1,35 +1,134 @@
 package model
 
-import "github.com/go-playground/validator/v10"
+import (
+	"time"
 
+	"github.com/go-playground/validator/v10"
+)
+
+// SendOTPRequest carries exactly one of phone_number and email
 type SendOTPRequest struct {
-	PhoneNumber string `json:"phone_number" binding:"required" validate:"required,e164" example:"+1234567890"`
+	PhoneNumber string `json:"phone_number,omitempty" validate:"required_without=Email,excluded_with=Email,omitempty" example:"+14155552671"`
+	Email       string `json:"email,omitempty" validate:"required_without=PhoneNumber,omitempty,email" example:"user@example.com"`
+	DeviceID    string `json:"device_id,omitempty" example:"3f2b9c4e-device"`
 }
 
+// VerifyOTPRequest names the same phone_number or email the code was sent to
 type VerifyOTPRequest struct {
-	PhoneNumber string `json:"phone_number" binding:"required" validate:"required,e164" example:"+1234567890"`
-	OTPCode     string `json:"otp_code" binding:"required,len=6" validate:"required,len=6" example:"123456"`
+	PhoneNumber string `json:"phone_number,omitempty" validate:"required_without=Email,excluded_with=Email,omitempty" example:"+14155552671"`
+	Email       string `json:"email,omitempty" validate:"required_without=PhoneNumber,omitempty,email" example:"user@example.com"`
+	OTPCode     string `json:"otp_code" binding:"required" validate:"required" example:"123456"`
+	DeviceID    string `json:"device_id,omitempty" example:"3f2b9c4e-device"`
+	FormToken   string `json:"form_token,omitempty"`
+	// Label shown in the sessions list, e.g. the device model
+	DeviceName string `json:"device_name,omitempty" example:"Pixel 8"`
+	// Echo of the send response's correlation_id, to stitch the two calls together in logs
+	CorrelationID string `json:"correlation_id,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015"`
+
+	// Set by the handler for the attempt history and sessions, never read from the body
+	ClientIP  string `json:"-" form:"-"`
+	UserAgent string `json:"-" form:"-"`
+}
+
+// UpdatePhoneRequest moves the signed-in user to a new number in two calls:
+// without otp_code a code is sent to the number, with it the number is switched
+type UpdatePhoneRequest struct {
+	PhoneNumber string `json:"phone_number" validate:"required" example:"+14155552671"`
+	OTPCode     string `json:"otp_code,omitempty" example:"123456"`
+	DeviceID    string `json:"device_id,omitempty" example:"3f2b9c4e-device"`
+	FormToken   string `json:"form_token,omitempty"`
+	// Label for the session the new tokens start, e.g. the device model
+	DeviceName string `json:"device_name,omitempty" example:"Pixel 8"`
+
+	// Set by the handler for the session, never read from the body
+	ClientIP  string `json:"-" form:"-"`
+	UserAgent string `json:"-" form:"-"`
+}
+
+type SendOTPResponse struct {
+	// The channel this code went out on; resends may escalate past the one requested
+	Channel                string `json:"channel,omitempty" enums:"sms,voice,email"`
+	VoiceFallbackAvailable bool   `json:"voice_fallback_available"`
+	DisplayMessage         string `json:"display_message,omitempty"`
+	FormToken              string `json:"form_token,omitempty"`
+	CorrelationID          string `json:"correlation_id,omitempty"`
+}
+
+type OTPStatusResponse struct {
+	Pending           bool `json:"pending"`
+	AttemptsRemaining int  `json:"attempts_remaining"`
+}
+
+// LimitsResponse reports the OTP limits in effect for a phone and what is left of them
+type LimitsResponse struct {
+	SendLimit      int `json:"send_limit"`
+	SendsRemaining int `json:"sends_remaining"`
+	WindowSeconds  int `json:"window_seconds"`
+
+	VerifyAttemptsPerOTP int `json:"verify_attempts_per_otp"`
+	// Failed verifies allowed across resends; 0 means no cumulative budget
+	VerifyBudget          int `json:"verify_budget"`
+	VerifyBudgetRemaining int `json:"verify_budget_remaining"`
+
+	// Current resend cooldown, including any stretch from recent failed verifies
+	ResendCooldownSeconds int `json:"resend_cooldown_seconds"`
 }
 
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  UserResponse `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token"`
+	User         UserResponse `json:"user"`
+	// Set once, on the sign-in that enrolls the user in TOTP mode
+	TOTP *TOTPEnrollment `json:"totp,omitempty"`
+}
+
+// TOTPEnrollment is what an authenticator app needs to start generating codes
+type TOTPEnrollment struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/OTP%20Service:+14155552671?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type RefreshTokenResponse struct {
+	Token string `json:"token"`
 }
 
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message,omitempty"`
+	// Set on 429/423 responses to say which limit tripped
+	LimitType string `json:"limit_type,omitempty" enums:"window,backoff,ip,lockout,cooldown"`
+	// Seconds to wait before retrying, mirroring the Retry-After header
+	RetryAfter int `json:"retry_after,omitempty"`
+	// When a 423 lockout lifts
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	// Verify attempts the pending OTP has left after a wrong code
+	AttemptsRemaining int `json:"attempts_remaining,omitempty"`
 }
 
+// Limit types reported in ErrorResponse.LimitType
+const (
+	LimitTypeWindow   = "window"   // per-phone send limit within OTP_RATE_LIMIT_MINUTES
+	LimitTypeBackoff  = "backoff"  // wait between failed verifies on one OTP
+	LimitTypeIP       = "ip"       // per-IP request limit
+	LimitTypeLockout  = "lockout"  // cumulative verify budget exhausted
+	LimitTypeCooldown = "cooldown" // wait between sends to one number
+)
+
 type SuccessResponse struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 }
 
 type GetUsersRequest struct {
-	Page        int    `form:"page" binding:"min=1" example:"1"`
-	PageSize    int    `form:"page_size" binding:"min=1,max=100" example:"10"`
-	PhoneNumber string `form:"phone_number" example:"+1234567890"`
+	Page        int    `query:"page" form:"page" binding:"min=1" example:"1"`
+	PageSize    int    `query:"page_size" form:"page_size" binding:"min=1,max=100" example:"10"`
+	PhoneNumber string `query:"phone_number" form:"phone_number" example:"+14155552671"`
+	// A column name, descending with a leading "-"; empty is -registered_at
+	Sort string `query:"sort" form:"sort" example:"-registered_at"`
 }
 
 func (r *GetUsersRequest) SetDefaults() {
@@ -45,3 +144,66 @@ func (r *GetUsersRequest) Validate() error {
 	validate := validator.New()
 	return validate.Struct(r)
 }
+
+type GetOTPAttemptsRequest struct {
+	Page     int `query:"page" form:"page" validate:"min=0" example:"1"`
+	PageSize int `query:"page_size" form:"page_size" validate:"min=0,max=100" example:"20"`
+}
+
+func (r *GetOTPAttemptsRequest) SetDefaults() {
+	if r.Page == 0 {
+		r.Page = 1
+	}
+	if r.PageSize == 0 {
+		r.PageSize = 20
+	}
+}
+
+func (r *GetOTPAttemptsRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+type SetMaintenanceRequest struct {
+	Enabled         bool `json:"enabled" example:"true"`
+	DurationMinutes int  `json:"duration_minutes" example:"30"`
+}
+
+// SetTokenCutoffRequest rejects every token issued so far when enabled, and
+// lifts the runtime cutoff when not
+type SetTokenCutoffRequest struct {
+	Enabled bool `json:"enabled" example:"true"`
+}
+
+type SetUserStatusRequest struct {
+	Status UserStatus `json:"status" validate:"required,oneof=active suspended pending deactivated" example:"suspended"`
+}
+
+func (r *SetUserStatusRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// StatsResponse holds in-memory counts since the instance started
+type StatsResponse struct {
+	Sends            int64     `json:"sends"`
+	SendFailures     int64     `json:"send_failures"`
+	Verifies         int64     `json:"verifies"`
+	VerifyFailures   int64     `json:"verify_failures"`
+	ActiveUsersToday int       `json:"active_users_today"`
+	Since            time.Time `json:"since"`
+}
+
+type MaintenanceStatusResponse struct {
+	Enabled bool       `json:"enabled"`
+	Source  string     `json:"source,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+// TokenCutoffResponse is the time before which tokens are rejected, set by
+// JWT_MIN_ISSUED_AT ("config") or the admin API ("runtime"), whichever is later
+type TokenCutoffResponse struct {
+	Enabled     bool       `json:"enabled"`
+	Source      string     `json:"source,omitempty" enums:"config,runtime"`
+	MinIssuedAt *time.Time `json:"min_issued_at,omitempty"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestVerifyOTPRequest_CodeLength(t *testing.T) {
+	// OTP_LENGTH and OTP_ALPHABET are configurable, so the tags only require a code
+	tests := []struct {
+		name    string
+		otpCode string
+		wantErr bool
+	}{
+		{"Six digits", "123456", false},
+		{"Eight alphanumeric", "K7M2QX9D", false},
+		{"Four digits", "1234", false},
+		{"Missing", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := VerifyOTPRequest{PhoneNumber: "+14155552671", OTPCode: tt.otpCode}
+			err := validator.New().Struct(&req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var snakeCaseRegex = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+
+// Every type serialized as JSON by the API; new response types must be added here
+var jsonTypes = []interface{}{
+	User{},
+	OTP{},
+	UserResponse{},
+	UserInfoResponse{},
+	PaginatedUsersResponse{},
+	OTPAttemptResponse{},
+	PaginatedOTPAttemptsResponse{},
+	SessionResponse{},
+	SessionsResponse{},
+	SendOTPRequest{},
+	SendOTPResponse{},
+	VerifyOTPRequest{},
+	OTPStatusResponse{},
+	LimitsResponse{},
+	AuthResponse{},
+	TOTPEnrollment{},
+	RefreshTokenRequest{},
+	RefreshTokenResponse{},
+	ErrorResponse{},
+	SuccessResponse{},
+	SetMaintenanceRequest{},
+	SetUserStatusRequest{},
+	MaintenanceStatusResponse{},
+	SetTokenCutoffRequest{},
+	TokenCutoffResponse{},
+	StatsResponse{},
+}
+
+func TestJSONKeysAreSnakeCase(t *testing.T) {
+	for _, v := range jsonTypes {
+		typ := reflect.TypeOf(v)
+		t.Run(typ.Name(), func(t *testing.T) {
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if !field.IsExported() {
+					continue
+				}
+
+				// Without a tag encoding/json falls back to the Go field name
+				name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if name == "-" {
+					continue
+				}
+				if name == "" {
+					name = field.Name
+				}
+
+				if !snakeCaseRegex.MatchString(name) {
+					t.Errorf("%s.%s serializes as %q, want snake_case", typ.Name(), field.Name, name)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONTypesCoverResponses(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, v := range jsonTypes {
+		covered[reflect.TypeOf(v).Name()] = true
+	}
+
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatalf("Failed to list model files: %v", err)
+	}
+
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", path, err)
+		}
+
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				name := spec.(*ast.TypeSpec).Name.Name
+				if strings.HasSuffix(name, "Response") && !covered[name] {
+					t.Errorf("%s is not listed in jsonTypes", name)
+				}
+			}
+		}
+	}
+}
@@ -1,30 +1,122 @@
 package model
 
 import (
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// UserStatus controls whether a user may sign in; deletion is still a soft delete
+type UserStatus string
+
+const (
+	UserStatusActive      UserStatus = "active"
+	UserStatusSuspended   UserStatus = "suspended"
+	UserStatusPending     UserStatus = "pending"
+	UserStatusDeactivated UserStatus = "deactivated"
+)
+
+// UserRole decides what a user may reach beyond their own account
+type UserRole string
+
+const (
+	RoleUser  UserRole = "user"
+	RoleAdmin UserRole = "admin"
+)
+
+// User signs up with a phone number or an email address. The one not used is
+// stored as NULL, which the unique indexes allow any number of.
 type User struct {
 	ID           uint           `json:"id" gorm:"primaryKey"`
-	PhoneNumber  string         `json:"phone_number" gorm:"uniqueIndex;not null"`
+	PhoneNumber  string         `json:"phone_number" gorm:"uniqueIndex;default:null"`
+	Email        string         `json:"email,omitempty" gorm:"uniqueIndex;default:null"`
 	RegisteredAt time.Time      `json:"registered_at" gorm:"autoCreateTime"`
 	UpdatedAt    time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	LastLoginAt  *time.Time     `json:"last_login_at,omitempty"`
+	Status       UserStatus     `json:"status" gorm:"not null;default:active;index"`
+	Role         UserRole       `json:"role" gorm:"not null;default:user"`
 	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// In privacy mode PhoneNumber holds an HMAC and this the encrypted number
+	PhoneEncrypted string `json:"-"`
+
+	// Authenticator app secret (base32) and the last TOTP step accepted, so a
+	// code cannot be replayed within its window
+	TOTPSecret   string `json:"-" gorm:"column:totp_secret"`
+	TOTPLastStep int64  `json:"-" gorm:"column:totp_last_step;not null;default:0"`
 }
 
 type OTP struct {
+	// The phone number, or utils.EmailIdentifier of the address on the email channel
 	PhoneNumber string    `json:"phone_number"`
 	Code        string    `json:"code"`
 	ExpiresAt   time.Time `json:"expires_at"`
 	Attempts    int       `json:"attempts"`
+	DeviceHash  string    `json:"device_hash,omitempty"`
+	FormHash    string    `json:"form_hash,omitempty"`
+	Resends     int       `json:"resends"`
+
+	// Links the send and verify audit entries without logging the phone
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// OTPAttempt is one OTP verification, kept as the user's sign-in history
+type OTPAttempt struct {
+	ID uint `gorm:"primaryKey"`
+	// Nil when no user held the number or address at the time
+	UserID *uint `gorm:"index"`
+	// As OTP.PhoneNumber; an HMAC in privacy mode, like User.PhoneNumber
+	PhoneNumber string `gorm:"index"`
+	Success     bool   `gorm:"not null"`
+	IP          string
+	UserAgent   string
+	CreatedAt   time.Time `gorm:"autoCreateTime;index"`
+}
+
+// Session is a sign-in from one device, identified by the jti of its latest
+// access token; a refresh moves it to the new token. Tokens keeps every access
+// token issued for it, so ending the session can revoke those still live.
+type Session struct {
+	ID             uint   `gorm:"primaryKey"`
+	TokenID        string `gorm:"uniqueIndex;not null"`
+	RefreshTokenID string `gorm:"uniqueIndex;not null"`
+	UserID         uint   `gorm:"index;not null"`
+	DeviceName     string
+	IP             string
+	UserAgent      string
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	// When the refresh token expires and the session can no longer be renewed
+	ExpiresAt time.Time      `gorm:"index;not null"`
+	Tokens    []SessionToken `gorm:"foreignKey:SessionID"`
+}
+
+// SessionToken is an access token issued for a session
+type SessionToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	SessionID uint      `gorm:"index;not null"`
+	TokenID   string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
 }
 
 type UserResponse struct {
-	ID           uint      `json:"id"`
-	PhoneNumber  string    `json:"phone_number"`
-	RegisteredAt time.Time `json:"registered_at"`
+	ID           uint       `json:"id"`
+	PhoneNumber  string     `json:"phone_number"`
+	Email        string     `json:"email,omitempty"`
+	RegisteredAt time.Time  `json:"registered_at"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	Status       UserStatus `json:"status" enums:"active,suspended,pending,deactivated"`
+	Role         UserRole   `json:"role" enums:"user,admin"`
+}
+
+// UserInfoResponse follows the OIDC userinfo claim names
+type UserInfoResponse struct {
+	Sub                 string `json:"sub"`
+	PhoneNumber         string `json:"phone_number"`
+	PhoneNumberVerified bool   `json:"phone_number_verified"`
+	Email               string `json:"email,omitempty"`
+	EmailVerified       bool   `json:"email_verified,omitempty"`
+	UpdatedAt           int64  `json:"updated_at"`
 }
 
 type PaginatedUsersResponse struct {
@@ -35,10 +127,79 @@ type PaginatedUsersResponse struct {
 	TotalPages int            `json:"total_pages"`
 }
 
+type OTPAttemptResponse struct {
+	ID        uint      `json:"id"`
+	Success   bool      `json:"success"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PaginatedOTPAttemptsResponse struct {
+	Attempts   []OTPAttemptResponse `json:"attempts"`
+	Total      int64                `json:"total"`
+	Page       int                  `json:"page"`
+	PageSize   int                  `json:"page_size"`
+	TotalPages int                  `json:"total_pages"`
+}
+
+type SessionResponse struct {
+	TokenID    string    `json:"jti"`
+	DeviceName string    `json:"device_name,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Set on the session the listing request was made with
+	Current bool `json:"current"`
+}
+
+type SessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
 		ID:           u.ID,
 		PhoneNumber:  u.PhoneNumber,
+		Email:        u.Email,
 		RegisteredAt: u.RegisteredAt,
+		LastLoginAt:  u.LastLoginAt,
+		Status:       u.Status,
+		Role:         u.Role,
+	}
+}
+
+// ToUserInfo maps the user to OIDC claims; numbers and addresses are only ever
+// stored after OTP verification
+func (u *User) ToUserInfo() UserInfoResponse {
+	return UserInfoResponse{
+		Sub:                 strconv.FormatUint(uint64(u.ID), 10),
+		PhoneNumber:         u.PhoneNumber,
+		PhoneNumberVerified: u.PhoneNumber != "",
+		Email:               u.Email,
+		EmailVerified:       u.Email != "",
+		UpdatedAt:           u.UpdatedAt.Unix(),
+	}
+}
+
+func (a *OTPAttempt) ToResponse() OTPAttemptResponse {
+	return OTPAttemptResponse{
+		ID:        a.ID,
+		Success:   a.Success,
+		IP:        a.IP,
+		UserAgent: a.UserAgent,
+		CreatedAt: a.CreatedAt,
+	}
+}
+
+func (s *Session) ToResponse() SessionResponse {
+	return SessionResponse{
+		TokenID:    s.TokenID,
+		DeviceName: s.DeviceName,
+		IP:         s.IP,
+		UserAgent:  s.UserAgent,
+		CreatedAt:  s.CreatedAt,
+		ExpiresAt:  s.ExpiresAt,
 	}
 }
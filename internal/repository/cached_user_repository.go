@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+)
+
+// minCacheSweep is the entry count below which expired users are left for
+// reads to drop
+const minCacheSweep = 1024
+
+// cachedUserRepository keeps users looked up at sign-in for a short TTL, so the
+// profile fetch that usually follows a login is answered without a query. Any
+// write to a user drops their entry; other instances only see the change once
+// the TTL runs out. It must wrap the store directly, beneath the privacy
+// repository, which fills in the number a user was looked up by.
+type cachedUserRepository struct {
+	UserRepository
+	ttl time.Duration
+
+	mu        sync.Mutex
+	users     map[uint]cachedUser
+	nextSweep int
+}
+
+type cachedUser struct {
+	user      model.User
+	expiresAt time.Time
+}
+
+func NewCachedUserRepository(repo UserRepository, ttl time.Duration) UserRepository {
+	return &cachedUserRepository{
+		UserRepository: repo,
+		ttl:            ttl,
+		users:          make(map[uint]cachedUser),
+		nextSweep:      minCacheSweep,
+	}
+}
+
+func (r *cachedUserRepository) Create(ctx context.Context, user *model.User) error {
+	if err := r.UserRepository.Create(ctx, user); err != nil {
+		return err
+	}
+	r.store(user)
+	return nil
+}
+
+func (r *cachedUserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*model.User, error) {
+	user, err := r.UserRepository.GetByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	r.store(user)
+	return user, nil
+}
+
+func (r *cachedUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, err := r.UserRepository.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	r.store(user)
+	return user, nil
+}
+
+func (r *cachedUserRepository) GetByID(ctx context.Context, id uint) (*model.User, error) {
+	r.mu.Lock()
+	cached, ok := r.users[id]
+	if ok && !time.Now().Before(cached.expiresAt) {
+		delete(r.users, id)
+		ok = false
+	}
+	r.mu.Unlock()
+	if ok {
+		user := cached.user
+		return &user, nil
+	}
+	return r.UserRepository.GetByID(ctx, id)
+}
+
+// TouchLastLogin keeps the cached copy in step, since sign-in stamps it right
+// after the lookup that cached the user
+func (r *cachedUserRepository) TouchLastLogin(ctx context.Context, id uint) error {
+	if err := r.UserRepository.TouchLastLogin(ctx, id); err != nil {
+		r.forget(id)
+		return err
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	if cached, ok := r.users[id]; ok {
+		cached.user.LastLoginAt = &now
+		r.users[id] = cached
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *cachedUserRepository) UpdateStatus(ctx context.Context, id uint, status model.UserStatus) error {
+	defer r.forget(id)
+	return r.UserRepository.UpdateStatus(ctx, id, status)
+}
+
+func (r *cachedUserRepository) SetTOTPSecret(ctx context.Context, id uint, secret string) error {
+	defer r.forget(id)
+	return r.UserRepository.SetTOTPSecret(ctx, id, secret)
+}
+
+func (r *cachedUserRepository) ConsumeTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	defer r.forget(id)
+	return r.UserRepository.ConsumeTOTPStep(ctx, id, step)
+}
+
+func (r *cachedUserRepository) UpdatePhoneNumber(ctx context.Context, id uint, phoneNumber string) error {
+	defer r.forget(id)
+	return r.UserRepository.UpdatePhoneNumber(ctx, id, phoneNumber)
+}
+
+func (r *cachedUserRepository) UpdatePhoneColumns(ctx context.Context, id uint, phoneNumber, phoneEncrypted string) error {
+	defer r.forget(id)
+	return r.UserRepository.UpdatePhoneColumns(ctx, id, phoneNumber, phoneEncrypted)
+}
+
+func (r *cachedUserRepository) Delete(ctx context.Context, id uint) error {
+	defer r.forget(id)
+	return r.UserRepository.Delete(ctx, id)
+}
+
+// PurgeDeletedBefore does not say which users went, so the whole cache goes
+func (r *cachedUserRepository) PurgeDeletedBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	defer func() {
+		r.mu.Lock()
+		r.users = make(map[uint]cachedUser)
+		r.mu.Unlock()
+	}()
+	return r.UserRepository.PurgeDeletedBefore(ctx, before, batchSize)
+}
+
+// store keeps a copy, so callers changing the returned user leave the cache alone
+func (r *cachedUserRepository) store(user *model.User) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.users) >= r.nextSweep {
+		for id, cached := range r.users {
+			if !now.Before(cached.expiresAt) {
+				delete(r.users, id)
+			}
+		}
+		r.nextSweep = max(2*len(r.users), minCacheSweep)
+	}
+	r.users[user.ID] = cachedUser{user: *user, expiresAt: now.Add(r.ttl)}
+}
+
+func (r *cachedUserRepository) forget(id uint) {
+	r.mu.Lock()
+	delete(r.users, id)
+	r.mu.Unlock()
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/metrics"
+)
+
+// instrumentedOTPRepository counts OTPs that Redis evicted before their expiry
+type instrumentedOTPRepository struct {
+	OTPRepository
+	metrics *metrics.Metrics
+}
+
+func NewInstrumentedOTPRepository(repo OTPRepository, m *metrics.Metrics) OTPRepository {
+	return &instrumentedOTPRepository{
+		OTPRepository: repo,
+		metrics:       m,
+	}
+}
+
+func (r *instrumentedOTPRepository) GetOTP(ctx context.Context, phoneNumber string) (*model.OTP, error) {
+	otp, err := r.OTPRepository.GetOTP(ctx, phoneNumber)
+	if errors.Is(err, apperrors.ErrOTPEvicted) {
+		r.metrics.ObserveOTPEviction()
+	}
+	return otp, err
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// LimiterStorage is a fiber.Storage whose operations also take a context.
+// fiber's limiter only calls the context-free methods, which run under
+// context.Background().
+type LimiterStorage interface {
+	fiber.Storage
+	GetWithContext(ctx context.Context, key string) ([]byte, error)
+	SetWithContext(ctx context.Context, key string, value []byte, exp time.Duration) error
+	DeleteWithContext(ctx context.Context, key string) error
+	ResetWithContext(ctx context.Context) error
+}
+
+// limiterStorage keeps the global IP limiter's counts in Redis, so every
+// instance enforces one shared limit per client IP
+type limiterStorage struct {
+	client *redis.Client
+}
+
+func NewLimiterStorage(client *redis.Client) LimiterStorage {
+	return &limiterStorage{client: client}
+}
+
+func (s *limiterStorage) Get(key string) ([]byte, error) {
+	return s.GetWithContext(context.Background(), key)
+}
+
+func (s *limiterStorage) GetWithContext(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	value, err := s.client.Get(ctx, utils.IPRateLimitKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rate limit entry: %w", err)
+	}
+	return value, nil
+}
+
+func (s *limiterStorage) Set(key string, value []byte, exp time.Duration) error {
+	return s.SetWithContext(context.Background(), key, value, exp)
+}
+
+func (s *limiterStorage) SetWithContext(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	if err := s.client.Set(ctx, utils.IPRateLimitKey(key), value, exp).Err(); err != nil {
+		return fmt.Errorf("failed to set rate limit entry: %w", err)
+	}
+	return nil
+}
+
+func (s *limiterStorage) Delete(key string) error {
+	return s.DeleteWithContext(context.Background(), key)
+}
+
+func (s *limiterStorage) DeleteWithContext(ctx context.Context, key string) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	if err := s.client.Del(ctx, utils.IPRateLimitKey(key)).Err(); err != nil {
+		return fmt.Errorf("failed to delete rate limit entry: %w", err)
+	}
+	return nil
+}
+
+func (s *limiterStorage) Reset() error {
+	return s.ResetWithContext(context.Background())
+}
+
+// ResetWithContext drops every IP's counts, leaving the rest of Redis alone
+func (s *limiterStorage) ResetWithContext(ctx context.Context) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	iter := s.client.Scan(ctx, 0, utils.IPRateLimitKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		if err := s.client.Del(ctx, iter.Val()).Err(); err != nil {
+			return fmt.Errorf("failed to reset rate limits: %w", err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to reset rate limits: %w", err)
+	}
+	return nil
+}
+
+// Close leaves the client open; it is shared with the rest of the service
+func (s *limiterStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLimiterStorage(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	storage := NewLimiterStorage(client)
+
+	if value, err := storage.Get("203.0.113.7"); err != nil || value != nil {
+		t.Fatalf("Get() of a missing entry = %q, %v, want nil", value, err)
+	}
+
+	if err := storage.Set("203.0.113.7", []byte("hits"), time.Minute); err != nil {
+		t.Fatalf("Set() unexpected error = %v", err)
+	}
+	if value, err := storage.Get("203.0.113.7"); err != nil || string(value) != "hits" {
+		t.Errorf("Get() = %q, %v, want %q", value, err, "hits")
+	}
+	if ttl := mr.TTL(utils.IPRateLimitKey("203.0.113.7")); ttl != time.Minute {
+		t.Errorf("Entry TTL = %v, want %v", ttl, time.Minute)
+	}
+
+	if err := storage.Delete("203.0.113.7"); err != nil {
+		t.Fatalf("Delete() unexpected error = %v", err)
+	}
+	if mr.Exists(utils.IPRateLimitKey("203.0.113.7")) {
+		t.Error("Entry left after Delete()")
+	}
+
+	storage.Set("203.0.113.8", []byte("hits"), time.Minute)
+	mr.Set(utils.RateLimitKey("+14155550100"), "1")
+	if err := storage.Reset(); err != nil {
+		t.Fatalf("Reset() unexpected error = %v", err)
+	}
+	if mr.Exists(utils.IPRateLimitKey("203.0.113.8")) {
+		t.Error("Entry left after Reset()")
+	}
+	if !mr.Exists(utils.RateLimitKey("+14155550100")) {
+		t.Error("Reset() removed a key it does not own")
+	}
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+type MaintenanceRepository interface {
+	// GetMaintenance reports whether the runtime flag is set and its remaining TTL (0 when open-ended)
+	GetMaintenance(ctx context.Context) (bool, time.Duration, error)
+	SetMaintenance(ctx context.Context, duration time.Duration) error
+	ClearMaintenance(ctx context.Context) error
+}
+
+type maintenanceRepository struct {
+	client *redis.Client
+}
+
+func NewMaintenanceRepository(client *redis.Client) MaintenanceRepository {
+	return &maintenanceRepository{client: client}
+}
+
+func (r *maintenanceRepository) GetMaintenance(ctx context.Context) (bool, time.Duration, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	key := utils.MaintenanceKey()
+
+	ttl, err := r.client.TTL(ctx, key).Result()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get maintenance flag: %w", err)
+	}
+
+	// -2 means the key does not exist, -1 means it has no expiry
+	switch {
+	case ttl == -2:
+		return false, 0, nil
+	case ttl < 0:
+		return true, 0, nil
+	default:
+		return true, ttl, nil
+	}
+}
+
+func (r *maintenanceRepository) SetMaintenance(ctx context.Context, duration time.Duration) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	key := utils.MaintenanceKey()
+	return r.client.Set(ctx, key, "1", duration).Err()
+}
+
+func (r *maintenanceRepository) ClearMaintenance(ctx context.Context) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	key := utils.MaintenanceKey()
+	return r.client.Del(ctx, key).Err()
+}
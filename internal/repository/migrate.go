@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// MigrationError identifies the model whose schema migration failed
+type MigrationError struct {
+	Model string
+	Table string
+	Err   error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("failed to migrate model %s (table %s): %v", e.Model, e.Table, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// Migrate auto-migrates each model on its own so a failure names the model at fault
+func Migrate(db *gorm.DB, models ...interface{}) error {
+	for _, m := range models {
+		name := reflect.Indirect(reflect.ValueOf(m)).Type().Name()
+
+		table := ""
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err == nil {
+			table = stmt.Schema.Table
+		}
+
+		if err := db.AutoMigrate(m); err != nil {
+			log.Printf("Migration failed for model %s (table %s): %v", name, table, err)
+			return &MigrationError{Model: name, Table: table, Err: err}
+		}
+	}
+	return nil
+}
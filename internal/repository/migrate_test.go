@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// widget adds a unique index that existing duplicate rows violate
+type widget struct {
+	ID   uint
+	Code string `gorm:"uniqueIndex"`
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	if err := Migrate(db, &model.User{}); err != nil {
+		t.Fatalf("Migrate() unexpected error = %v", err)
+	}
+
+	db.Exec("CREATE TABLE widgets (id integer PRIMARY KEY, code text)")
+	db.Exec("INSERT INTO widgets (code) VALUES ('dup'), ('dup')")
+
+	err = Migrate(db, &model.User{}, &widget{})
+
+	var migrationErr *MigrationError
+	if !errors.As(err, &migrationErr) {
+		t.Fatalf("Migrate() error = %v, want *MigrationError", err)
+	}
+	if migrationErr.Model != "widget" || migrationErr.Table != "widgets" {
+		t.Errorf("MigrationError model/table = %s/%s, want widget/widgets", migrationErr.Model, migrationErr.Table)
+	}
+	if !strings.Contains(err.Error(), "UNIQUE") {
+		t.Errorf("Migrate() error = %v, want the underlying SQL error", err)
+	}
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// OTPAttemptRepository keeps every OTP verification in Postgres, so admins
+// can review a user's sign-in history after the Redis OTP state is gone
+type OTPAttemptRepository interface {
+	Create(ctx context.Context, attempt *model.OTPAttempt) error
+	// ListByUser returns a page of the user's attempts, newest first, and the total
+	ListByUser(ctx context.Context, userID uint, page, pageSize int) ([]model.OTPAttempt, int64, error)
+}
+
+type otpAttemptRepository struct {
+	db        *gorm.DB
+	protector *utils.PhoneProtector
+}
+
+// NewOTPAttemptRepository stores phone numbers as an HMAC when protector is
+// set, the same as the users table in privacy mode
+func NewOTPAttemptRepository(db *gorm.DB, protector *utils.PhoneProtector) OTPAttemptRepository {
+	return &otpAttemptRepository{db: db, protector: protector}
+}
+
+func (r *otpAttemptRepository) Create(ctx context.Context, attempt *model.OTPAttempt) error {
+	ctx, cancel := utils.WithDBTimeout(ctx)
+	defer cancel()
+	db := r.db.WithContext(ctx)
+
+	if r.protector == nil || strings.HasPrefix(attempt.PhoneNumber, utils.EmailIdentifier("")) {
+		return db.Create(attempt).Error
+	}
+
+	phoneNumber := attempt.PhoneNumber
+	attempt.PhoneNumber = r.protector.Hash(phoneNumber)
+	err := db.Create(attempt).Error
+	attempt.PhoneNumber = phoneNumber
+	return err
+}
+
+func (r *otpAttemptRepository) ListByUser(ctx context.Context, userID uint, page, pageSize int) ([]model.OTPAttempt, int64, error) {
+	ctx, cancel := utils.WithDBTimeout(ctx)
+	defer cancel()
+
+	var attempts []model.OTPAttempt
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&model.OTPAttempt{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC, id DESC").Find(&attempts).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return attempts, total, nil
+}
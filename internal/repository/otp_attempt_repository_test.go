@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func createTestOTPAttemptDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.OTPAttempt{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestOTPAttemptRepository_ListByUser(t *testing.T) {
+	db := createTestOTPAttemptDB(t)
+	attemptRepo := NewOTPAttemptRepository(db, nil)
+	userID, otherID := uint(1), uint(2)
+	start := time.Now().Add(-time.Hour)
+
+	for i := 0; i < 5; i++ {
+		attempt := &model.OTPAttempt{UserID: &userID, PhoneNumber: "+14155550100", Success: i == 4, IP: "203.0.113.7", CreatedAt: start.Add(time.Duration(i) * time.Minute)}
+		if err := attemptRepo.Create(context.Background(), attempt); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+	}
+	for _, attempt := range []*model.OTPAttempt{
+		{UserID: &otherID, PhoneNumber: "+14155550101"},
+		{PhoneNumber: "+14155550102"},
+	} {
+		if err := attemptRepo.Create(context.Background(), attempt); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+	}
+
+	attempts, total, err := attemptRepo.ListByUser(context.Background(), userID, 1, 2)
+	if err != nil {
+		t.Fatalf("ListByUser() unexpected error = %v", err)
+	}
+	if total != 5 {
+		t.Errorf("ListByUser() total = %d, want 5", total)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("ListByUser() returned %d attempts, want 2", len(attempts))
+	}
+	if !attempts[0].Success || attempts[1].Success {
+		t.Errorf("ListByUser() first page = %+v, want the newest (successful) attempt first", attempts)
+	}
+
+	attempts, _, err = attemptRepo.ListByUser(context.Background(), userID, 3, 2)
+	if err != nil {
+		t.Fatalf("ListByUser() unexpected error = %v", err)
+	}
+	if len(attempts) != 1 || !attempts[0].CreatedAt.Equal(start) {
+		t.Errorf("ListByUser() last page = %+v, want only the oldest attempt", attempts)
+	}
+}
+
+func TestOTPAttemptRepository_CreateProtected(t *testing.T) {
+	db := createTestOTPAttemptDB(t)
+	protector, err := utils.NewPhoneProtector("test-hmac-key", "")
+	if err != nil {
+		t.Fatalf("NewPhoneProtector() unexpected error = %v", err)
+	}
+	attemptRepo := NewOTPAttemptRepository(db, protector)
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{name: "phone is hashed", target: "+14155550100", want: protector.Hash("+14155550100")},
+		{name: "email is kept", target: utils.EmailIdentifier("user@example.com"), want: utils.EmailIdentifier("user@example.com")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempt := &model.OTPAttempt{PhoneNumber: tt.target}
+			if err := attemptRepo.Create(context.Background(), attempt); err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			if attempt.PhoneNumber != tt.target {
+				t.Errorf("Create() left PhoneNumber = %q, want the caller's %q", attempt.PhoneNumber, tt.target)
+			}
+
+			var stored model.OTPAttempt
+			if err := db.First(&stored, attempt.ID).Error; err != nil {
+				t.Fatalf("Failed to load attempt: %v", err)
+			}
+			if stored.PhoneNumber != tt.want {
+				t.Errorf("stored phone_number = %q, want %q", stored.PhoneNumber, tt.want)
+			}
+		})
+	}
+}
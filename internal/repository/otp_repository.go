@@ -1,22 +1,43 @@
 package repository
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
+	"strconv"
 	"time"
 
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
 	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
 	"github.com/redis/go-redis/v9"
 )
 
 type OTPRepository interface {
-	StoreOTP(phoneNumber, code string, expiryMinutes int) error
-	GetOTP(phoneNumber string) (*model.OTP, error)
-	DeleteOTP(phoneNumber string) error
-	IncrementAttempts(phoneNumber string) error
-	GetRateLimitCount(phoneNumber string) (int, error)
-	IncrementRateLimit(phoneNumber string, windowMinutes int) error
+	StoreOTP(ctx context.Context, otp *model.OTP, expiryMinutes int) error
+	GetOTP(ctx context.Context, phoneNumber string) (*model.OTP, error)
+	Exists(ctx context.Context, phoneNumber string) (bool, error)
+	DeleteOTP(ctx context.Context, phoneNumber string) error
+	Purge(ctx context.Context, phoneNumber string) error
+	// IncrementAttempts returns the attempts counter after the increment
+	IncrementAttempts(ctx context.Context, phoneNumber string) (int, error)
+	GetAttempts(ctx context.Context, phoneNumber string) (int, error)
+	IncrementVerifyFailures(ctx context.Context, phoneNumber string, window time.Duration) (int, error)
+	GetVerifyFailures(ctx context.Context, phoneNumber string) (int, error)
+	GetVerifyFailuresTTL(ctx context.Context, phoneNumber string) (time.Duration, error)
+	SetVerifyNotBefore(ctx context.Context, phoneNumber string, notBefore time.Time) error
+	GetVerifyNotBefore(ctx context.Context, phoneNumber string) (time.Time, error)
+	AcquireSendLock(ctx context.Context, phoneNumber string, ttl time.Duration) (string, error)
+	ReleaseSendLock(ctx context.Context, phoneNumber, token string) error
+	GetRateLimitCount(ctx context.Context, phoneNumber string) (int, error)
+	GetRateLimitTTL(ctx context.Context, phoneNumber string) (time.Duration, error)
+	ReserveRateLimit(ctx context.Context, phoneNumber string, limit int, window time.Duration) (int, bool, error)
+	RefundRateLimit(ctx context.Context, phoneNumber string) error
+	IncrementRateLimitPenalty(ctx context.Context, phoneNumber string) (int, error)
+	ExtendRateLimit(ctx context.Context, phoneNumber string, window, penaltyTTL time.Duration) error
 }
 
 type otpRepository struct {
@@ -27,82 +48,268 @@ func NewOTPRepository(client *redis.Client) OTPRepository {
 	return &otpRepository{client: client}
 }
 
-func (r *otpRepository) StoreOTP(phoneNumber, code string, expiryMinutes int) error {
-	ctx, cancel := utils.RedisContext()
+func (r *otpRepository) StoreOTP(ctx context.Context, otp *model.OTP, expiryMinutes int) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
 	defer cancel()
 
-	otp := model.OTP{
-		PhoneNumber: phoneNumber,
-		Code:        code,
-		ExpiresAt:   time.Now().Add(time.Duration(expiryMinutes) * time.Minute),
-		Attempts:    0,
-	}
+	otp.ExpiresAt = time.Now().Add(time.Duration(expiryMinutes) * time.Minute)
 
 	data, err := json.Marshal(otp)
 	if err != nil {
 		return fmt.Errorf("failed to marshal OTP: %w", err)
 	}
 
-	key := utils.OTPKey(phoneNumber)
-	return r.client.Set(ctx, key, data, time.Duration(expiryMinutes)*time.Minute).Err()
+	// A fresh OTP starts with a fresh attempts counter. The sent marker shares
+	// the OTP's TTL so GetOTP can tell an early eviction from a normal expiry.
+	expiry := time.Duration(expiryMinutes) * time.Minute
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, utils.OTPKey(otp.PhoneNumber), data, expiry)
+	pipe.Set(ctx, utils.OTPSentKey(otp.PhoneNumber), otp.ExpiresAt.Unix(), expiry)
+	pipe.Del(ctx, utils.OTPAttemptsKey(otp.PhoneNumber), utils.VerifyNotBeforeKey(otp.PhoneNumber))
+
+	_, err = pipe.Exec(ctx)
+	return err
 }
 
-func (r *otpRepository) GetOTP(phoneNumber string) (*model.OTP, error) {
-	ctx, cancel := utils.RedisContext()
+func (r *otpRepository) GetOTP(ctx context.Context, phoneNumber string) (*model.OTP, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
 	defer cancel()
-	key := utils.OTPKey(phoneNumber)
 
-	data, err := r.client.Get(ctx, key).Result()
+	values, err := r.client.MGet(ctx, utils.OTPKey(phoneNumber), utils.OTPAttemptsKey(phoneNumber), utils.OTPSentKey(phoneNumber)).Result()
 	if err != nil {
-		if err == redis.Nil {
-			return nil, nil
-		}
 		return nil, fmt.Errorf("failed to get OTP: %w", err)
 	}
 
+	data, ok := values[0].(string)
+	if !ok {
+		// The marker expires with the OTP, so if it is still here the OTP
+		// was evicted under memory pressure rather than expired
+		if _, sent := values[2].(string); sent {
+			log.Printf("OTP for %s is missing before its expiry; Redis likely evicted it", utils.MaskPhoneNumber(phoneNumber))
+			return nil, apperrors.ErrOTPEvicted
+		}
+		return nil, nil
+	}
+
 	var otp model.OTP
 	if err := json.Unmarshal([]byte(data), &otp); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal OTP: %w", err)
 	}
 
+	// The live counter is authoritative; a missing counter means no attempts yet
+	otp.Attempts = 0
+	if attempts, ok := values[1].(string); ok {
+		if otp.Attempts, err = strconv.Atoi(attempts); err != nil {
+			return nil, fmt.Errorf("failed to parse OTP attempts: %w", err)
+		}
+	}
+
 	if time.Now().After(otp.ExpiresAt) {
-		r.DeleteOTP(phoneNumber)
+		r.DeleteOTP(ctx, phoneNumber)
 		return nil, nil
 	}
 
 	return &otp, nil
 }
 
-func (r *otpRepository) DeleteOTP(phoneNumber string) error {
-	ctx, cancel := utils.RedisContext()
+// Exists reports whether an OTP is pending without reading it back
+func (r *otpRepository) Exists(ctx context.Context, phoneNumber string) (bool, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
 	defer cancel()
 	key := utils.OTPKey(phoneNumber)
-	return r.client.Del(ctx, key).Err()
+
+	count, err := r.client.Exists(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check OTP: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (r *otpRepository) DeleteOTP(ctx context.Context, phoneNumber string) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	return r.client.Del(ctx, utils.OTPKey(phoneNumber), utils.OTPAttemptsKey(phoneNumber), utils.OTPSentKey(phoneNumber), utils.VerifyNotBeforeKey(phoneNumber)).Err()
+}
+
+// Purge drops every key held for the number: the pending OTP, its limits and any
+// send lock, for a number that no longer belongs to an account
+func (r *otpRepository) Purge(ctx context.Context, phoneNumber string) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	return r.client.Del(ctx,
+		utils.OTPKey(phoneNumber), utils.OTPAttemptsKey(phoneNumber), utils.OTPSentKey(phoneNumber),
+		utils.VerifyNotBeforeKey(phoneNumber), utils.VerifyFailuresKey(phoneNumber), utils.SendLockKey(phoneNumber),
+		utils.RateLimitKey(phoneNumber), utils.RateLimitPenaltyKey(phoneNumber),
+	).Err()
 }
 
-func (r *otpRepository) IncrementAttempts(phoneNumber string) error {
-	ctx, cancel := utils.RedisContext()
+// incrementAttemptsScript counts an attempt only while the OTP exists, so a
+// verify that consumed it in between cannot restart the counter at 1. It
+// returns -1 when the OTP is gone.
+var incrementAttemptsScript = redis.NewScript(`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl <= 0 then
+	return -1
+end
+local count = redis.call("INCR", KEYS[2])
+redis.call("PEXPIRE", KEYS[2], ttl)
+return count
+`)
+
+// IncrementAttempts bumps the atomic attempts counter, which expires with the
+// OTP, and returns its new value so concurrent verifies each see their own
+// count. An OTP that is already gone is apperrors.ErrOTPExpired.
+func (r *otpRepository) IncrementAttempts(ctx context.Context, phoneNumber string) (int, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
 	defer cancel()
 
-	otp, err := r.GetOTP(phoneNumber)
-	if err != nil || otp == nil {
-		return fmt.Errorf("OTP not found")
+	keys := []string{utils.OTPKey(phoneNumber), utils.OTPAttemptsKey(phoneNumber)}
+	attempts, err := incrementAttemptsScript.Run(ctx, r.client, keys).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment OTP attempts: %w", err)
 	}
+	if attempts < 0 {
+		return 0, apperrors.ErrOTPExpired
+	}
+	return attempts, nil
+}
 
-	otp.Attempts++
+// GetAttempts reads the live attempts counter; a missing counter counts as zero
+func (r *otpRepository) GetAttempts(ctx context.Context, phoneNumber string) (int, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
 
-	data, err := json.Marshal(otp)
+	attempts, err := r.client.Get(ctx, utils.OTPAttemptsKey(phoneNumber)).Int()
 	if err != nil {
-		return fmt.Errorf("failed to marshal OTP: %w", err)
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get OTP attempts: %w", err)
 	}
+	return attempts, nil
+}
 
-	key := utils.OTPKey(phoneNumber)
-	ttl := r.client.TTL(ctx, key).Val()
-	return r.client.Set(ctx, key, data, ttl).Err()
+// IncrementVerifyFailures counts failed verifies across resends in a fixed window
+// that starts with the first failure
+func (r *otpRepository) IncrementVerifyFailures(ctx context.Context, phoneNumber string, window time.Duration) (int, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	key := utils.VerifyFailuresKey(phoneNumber)
+
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to increment verify failures: %w", err)
+	}
+	return int(incr.Val()), nil
+}
+
+func (r *otpRepository) GetVerifyFailures(ctx context.Context, phoneNumber string) (int, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	failures, err := r.client.Get(ctx, utils.VerifyFailuresKey(phoneNumber)).Int()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get verify failures: %w", err)
+	}
+	return failures, nil
+}
+
+// GetVerifyFailuresTTL is how long until the phone's failure window resets, or 0
+// when no failures are counted
+func (r *otpRepository) GetVerifyFailuresTTL(ctx context.Context, phoneNumber string) (time.Duration, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	ttl, err := r.client.TTL(ctx, utils.VerifyFailuresKey(phoneNumber)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get verify failures TTL: %w", err)
+	}
+	// -2 means the key does not exist, -1 means it has no expiry
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
 }
 
-func (r *otpRepository) GetRateLimitCount(phoneNumber string) (int, error) {
-	ctx, cancel := utils.RedisContext()
+// SetVerifyNotBefore blocks verifies for the phone until notBefore; the key expires then
+func (r *otpRepository) SetVerifyNotBefore(ctx context.Context, phoneNumber string, notBefore time.Time) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	ttl := time.Until(notBefore)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := r.client.Set(ctx, utils.VerifyNotBeforeKey(phoneNumber), notBefore.UnixMilli(), ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set verify backoff: %w", err)
+	}
+	return nil
+}
+
+// GetVerifyNotBefore returns the earliest time the next verify is allowed; zero means now
+func (r *otpRepository) GetVerifyNotBefore(ctx context.Context, phoneNumber string) (time.Time, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	millis, err := r.client.Get(ctx, utils.VerifyNotBeforeKey(phoneNumber)).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to get verify backoff: %w", err)
+	}
+	return time.UnixMilli(millis), nil
+}
+
+// releaseSendLockScript deletes the lock only if it still holds our token, so an
+// instance whose lock already expired cannot release another instance's lock
+var releaseSendLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireSendLock takes the cluster-wide send lock for the phone. It returns the
+// token needed to release it, or an empty token when another instance holds it.
+func (r *otpRepository) AcquireSendLock(ctx context.Context, phoneNumber string, ttl time.Duration) (string, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate send lock token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	acquired, err := r.client.SetNX(ctx, utils.SendLockKey(phoneNumber), token, ttl).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to acquire send lock: %w", err)
+	}
+	if !acquired {
+		return "", nil
+	}
+	return token, nil
+}
+
+func (r *otpRepository) ReleaseSendLock(ctx context.Context, phoneNumber, token string) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	if err := releaseSendLockScript.Run(ctx, r.client, []string{utils.SendLockKey(phoneNumber)}, token).Err(); err != nil {
+		return fmt.Errorf("failed to release send lock: %w", err)
+	}
+	return nil
+}
+
+func (r *otpRepository) GetRateLimitCount(ctx context.Context, phoneNumber string) (int, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
 	defer cancel()
 	key := utils.RateLimitKey(phoneNumber)
 
@@ -117,14 +324,91 @@ func (r *otpRepository) GetRateLimitCount(phoneNumber string) (int, error) {
 	return count, nil
 }
 
-func (r *otpRepository) IncrementRateLimit(phoneNumber string, windowMinutes int) error {
-	ctx, cancel := utils.RedisContext()
+// GetRateLimitTTL is how long until the phone's send window resets, or 0
+// when it has no window
+func (r *otpRepository) GetRateLimitTTL(ctx context.Context, phoneNumber string) (time.Duration, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	ttl, err := r.client.PTTL(ctx, utils.RateLimitKey(phoneNumber)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rate limit TTL: %w", err)
+	}
+	// -2 means the key does not exist, -1 means it has no expiry
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// reserveRateLimitScript takes one send from the window only while it has
+// some left, so concurrent sends cannot all pass a separate check. Every
+// reservation restarts the window; a refused one leaves it alone.
+var reserveRateLimitScript = redis.NewScript(`
+local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+if count >= tonumber(ARGV[1]) then
+	return {count, 0}
+end
+count = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+return {count, 1}
+`)
+
+// refundRateLimitScript hands a reservation back without creating the key
+// or taking it below zero once the window has expired
+var refundRateLimitScript = redis.NewScript(`
+if tonumber(redis.call("GET", KEYS[1]) or "0") > 0 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0
+`)
+
+// ReserveRateLimit atomically counts a send against the phone's limit. It
+// returns the count in the window and false, without counting, once the
+// limit is reached.
+func (r *otpRepository) ReserveRateLimit(ctx context.Context, phoneNumber string, limit int, window time.Duration) (int, bool, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	result, err := reserveRateLimitScript.Run(ctx, r.client, []string{utils.RateLimitKey(phoneNumber)}, limit, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to reserve rate limit: %w", err)
+	}
+	return int(result[0]), result[1] == 1, nil
+}
+
+// RefundRateLimit gives back a reservation for a send that never went out
+func (r *otpRepository) RefundRateLimit(ctx context.Context, phoneNumber string) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+
+	if err := refundRateLimitScript.Run(ctx, r.client, []string{utils.RateLimitKey(phoneNumber)}).Err(); err != nil {
+		return fmt.Errorf("failed to refund rate limit: %w", err)
+	}
+	return nil
+}
+
+// IncrementRateLimitPenalty counts how often the phone hit its limit while the penalty is still live
+func (r *otpRepository) IncrementRateLimitPenalty(ctx context.Context, phoneNumber string) (int, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	key := utils.RateLimitPenaltyKey(phoneNumber)
+
+	hits, err := r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment rate limit penalty: %w", err)
+	}
+	return int(hits), nil
+}
+
+// ExtendRateLimit stretches the current window and keeps the penalty alive until it decays
+func (r *otpRepository) ExtendRateLimit(ctx context.Context, phoneNumber string, window, penaltyTTL time.Duration) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
 	defer cancel()
-	key := utils.RateLimitKey(phoneNumber)
 
 	pipe := r.client.TxPipeline()
-	pipe.Incr(ctx, key)
-	pipe.Expire(ctx, key, time.Duration(windowMinutes)*time.Minute)
+	pipe.Expire(ctx, utils.RateLimitKey(phoneNumber), window)
+	pipe.Expire(ctx, utils.RateLimitPenaltyKey(phoneNumber), penaltyTTL)
 
 	_, err := pipe.Exec(ctx)
 	return err
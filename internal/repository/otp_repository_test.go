@@ -0,0 +1,407 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/metrics"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+)
+
+func createTestOTPRepository(t *testing.T) (OTPRepository, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewOTPRepository(client), mr
+}
+
+func TestOTPRepository_ReserveRateLimit(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	phoneNumber := "+1234567890"
+
+	for want := 1; want <= 3; want++ {
+		count, ok, err := otpRepo.ReserveRateLimit(context.Background(), phoneNumber, 3, 10*time.Minute)
+		if err != nil || !ok {
+			t.Fatalf("ReserveRateLimit() = %v, %v, want a reservation", ok, err)
+		}
+		if count != want {
+			t.Errorf("ReserveRateLimit() count = %v, want %v", count, want)
+		}
+	}
+
+	if ttl := mr.TTL(utils.RateLimitKey(phoneNumber)); ttl != 10*time.Minute {
+		t.Errorf("Rate limit TTL = %v, want %v", ttl, 10*time.Minute)
+	}
+
+	mr.FastForward(time.Minute)
+	count, ok, err := otpRepo.ReserveRateLimit(context.Background(), phoneNumber, 3, 10*time.Minute)
+	if err != nil || ok || count != 3 {
+		t.Fatalf("ReserveRateLimit() at the limit = %v, %v, %v, want 3, false", count, ok, err)
+	}
+	if ttl := mr.TTL(utils.RateLimitKey(phoneNumber)); ttl != 9*time.Minute {
+		t.Errorf("Rate limit TTL after a refused reservation = %v, want %v", ttl, 9*time.Minute)
+	}
+	if ttl, err := otpRepo.GetRateLimitTTL(context.Background(), phoneNumber); err != nil || ttl != 9*time.Minute {
+		t.Errorf("GetRateLimitTTL() = %v, %v, want %v", ttl, err, 9*time.Minute)
+	}
+	if ttl, err := otpRepo.GetRateLimitTTL(context.Background(), "+1987654321"); err != nil || ttl != 0 {
+		t.Errorf("GetRateLimitTTL() without a window = %v, %v, want 0", ttl, err)
+	}
+
+	if err := otpRepo.RefundRateLimit(context.Background(), phoneNumber); err != nil {
+		t.Fatalf("RefundRateLimit() unexpected error = %v", err)
+	}
+	if _, ok, _ := otpRepo.ReserveRateLimit(context.Background(), phoneNumber, 3, 10*time.Minute); !ok {
+		t.Error("ReserveRateLimit() after a refund was refused")
+	}
+}
+
+func TestOTPRepository_RefundRateLimit_NoWindow(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	phoneNumber := "+1234567890"
+
+	if err := otpRepo.RefundRateLimit(context.Background(), phoneNumber); err != nil {
+		t.Fatalf("RefundRateLimit() unexpected error = %v", err)
+	}
+	if mr.Exists(utils.RateLimitKey(phoneNumber)) {
+		t.Error("RefundRateLimit() created a rate limit key")
+	}
+}
+
+func TestOTPRepository_ReserveRateLimit_Concurrent(t *testing.T) {
+	otpRepo, _ := createTestOTPRepository(t)
+	phoneNumber := "+1234567890"
+	const limit, callers = 3, 20
+
+	var wg sync.WaitGroup
+	var reserved atomic.Int32
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok, err := otpRepo.ReserveRateLimit(context.Background(), phoneNumber, limit, 10*time.Minute); err == nil && ok {
+				reserved.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := reserved.Load(); got != limit {
+		t.Errorf("Concurrent reservations = %d, want %d", got, limit)
+	}
+}
+
+func TestOTPRepository_ExtendRateLimit(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	phoneNumber := "+1234567890"
+
+	if _, _, err := otpRepo.ReserveRateLimit(context.Background(), phoneNumber, 3, 10*time.Minute); err != nil {
+		t.Fatalf("ReserveRateLimit() unexpected error = %v", err)
+	}
+
+	hits, err := otpRepo.IncrementRateLimitPenalty(context.Background(), phoneNumber)
+	if err != nil || hits != 1 {
+		t.Fatalf("IncrementRateLimitPenalty() = %v, %v, want 1", hits, err)
+	}
+
+	if err := otpRepo.ExtendRateLimit(context.Background(), phoneNumber, 20*time.Minute, 80*time.Minute); err != nil {
+		t.Fatalf("ExtendRateLimit() unexpected error = %v", err)
+	}
+
+	if ttl := mr.TTL(utils.RateLimitKey(phoneNumber)); ttl != 20*time.Minute {
+		t.Errorf("Rate limit TTL = %v, want %v", ttl, 20*time.Minute)
+	}
+
+	// A second hit while the penalty is live escalates
+	hits, err = otpRepo.IncrementRateLimitPenalty(context.Background(), phoneNumber)
+	if err != nil || hits != 2 {
+		t.Fatalf("IncrementRateLimitPenalty() = %v, %v, want 2", hits, err)
+	}
+	if err := otpRepo.ExtendRateLimit(context.Background(), phoneNumber, 20*time.Minute, 80*time.Minute); err != nil {
+		t.Fatalf("ExtendRateLimit() unexpected error = %v", err)
+	}
+
+	// After a quiet period the penalty decays back to the first level
+	mr.FastForward(81 * time.Minute)
+
+	hits, err = otpRepo.IncrementRateLimitPenalty(context.Background(), phoneNumber)
+	if err != nil || hits != 1 {
+		t.Errorf("IncrementRateLimitPenalty() after decay = %v, %v, want 1", hits, err)
+	}
+}
+
+func TestOTPRepository_Exists(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	phoneNumber := "+1234567890"
+
+	assertExists := func(want bool) {
+		t.Helper()
+		exists, err := otpRepo.Exists(context.Background(), phoneNumber)
+		if err != nil {
+			t.Fatalf("Exists() unexpected error = %v", err)
+		}
+		if exists != want {
+			t.Errorf("Exists() = %v, want %v", exists, want)
+		}
+	}
+
+	assertExists(false)
+
+	if err := otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2); err != nil {
+		t.Fatalf("StoreOTP() unexpected error = %v", err)
+	}
+	assertExists(true)
+
+	if err := otpRepo.DeleteOTP(context.Background(), phoneNumber); err != nil {
+		t.Fatalf("DeleteOTP() unexpected error = %v", err)
+	}
+	assertExists(false)
+
+	// Expiry is enforced by the key TTL
+	if err := otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2); err != nil {
+		t.Fatalf("StoreOTP() unexpected error = %v", err)
+	}
+	mr.FastForward(3 * time.Minute)
+	assertExists(false)
+}
+
+func TestOTPRepository_AttemptsCounter(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	phoneNumber := "+1234567890"
+
+	if _, err := otpRepo.IncrementAttempts(context.Background(), phoneNumber); err == nil {
+		t.Error("IncrementAttempts() without an OTP expected error but got none")
+	}
+
+	if err := otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2); err != nil {
+		t.Fatalf("StoreOTP() unexpected error = %v", err)
+	}
+
+	// The OTP exists but its counter key does not yet
+	if attempts, err := otpRepo.GetAttempts(context.Background(), phoneNumber); err != nil || attempts != 0 {
+		t.Errorf("GetAttempts() = %v, %v, want 0", attempts, err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		attempts, err := otpRepo.IncrementAttempts(context.Background(), phoneNumber)
+		if err != nil {
+			t.Fatalf("IncrementAttempts() unexpected error = %v", err)
+		}
+		if attempts != i {
+			t.Errorf("IncrementAttempts() = %d, want %d", attempts, i)
+		}
+	}
+
+	if attempts, err := otpRepo.GetAttempts(context.Background(), phoneNumber); err != nil || attempts != 2 {
+		t.Errorf("GetAttempts() = %v, %v, want 2", attempts, err)
+	}
+	if otp, err := otpRepo.GetOTP(context.Background(), phoneNumber); err != nil || otp.Attempts != 2 {
+		t.Errorf("GetOTP() attempts = %v, %v, want 2", otp, err)
+	}
+	if ttl := mr.TTL(utils.OTPAttemptsKey(phoneNumber)); ttl != 2*time.Minute {
+		t.Errorf("Attempts TTL = %v, want %v", ttl, 2*time.Minute)
+	}
+
+	// A new OTP resets the counter
+	if err := otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "654321"}, 2); err != nil {
+		t.Fatalf("StoreOTP() unexpected error = %v", err)
+	}
+	if attempts, err := otpRepo.GetAttempts(context.Background(), phoneNumber); err != nil || attempts != 0 {
+		t.Errorf("GetAttempts() after new OTP = %v, %v, want 0", attempts, err)
+	}
+}
+
+func TestOTPRepository_VerifyFailures(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	phoneNumber := "+1234567890"
+
+	for want := 1; want <= 3; want++ {
+		count, err := otpRepo.IncrementVerifyFailures(context.Background(), phoneNumber, 10*time.Minute)
+		if err != nil {
+			t.Fatalf("IncrementVerifyFailures() unexpected error = %v", err)
+		}
+		if count != want {
+			t.Errorf("IncrementVerifyFailures() count = %v, want %v", count, want)
+		}
+
+		// The window is fixed from the first failure, later failures don't extend it
+		mr.FastForward(time.Minute)
+	}
+
+	if ttl := mr.TTL(utils.VerifyFailuresKey(phoneNumber)); ttl != 7*time.Minute {
+		t.Errorf("Verify failures TTL = %v, want %v", ttl, 7*time.Minute)
+	}
+
+	failures, err := otpRepo.GetVerifyFailures(context.Background(), phoneNumber)
+	if err != nil || failures != 3 {
+		t.Errorf("GetVerifyFailures() = %v, %v, want 3", failures, err)
+	}
+	if ttl, err := otpRepo.GetVerifyFailuresTTL(context.Background(), phoneNumber); err != nil || ttl != 7*time.Minute {
+		t.Errorf("GetVerifyFailuresTTL() = %v, %v, want %v", ttl, err, 7*time.Minute)
+	}
+	if ttl, err := otpRepo.GetVerifyFailuresTTL(context.Background(), "+1987654321"); err != nil || ttl != 0 {
+		t.Errorf("GetVerifyFailuresTTL() without failures = %v, %v, want 0", ttl, err)
+	}
+
+	// Clearing the OTP must leave the cumulative count in place
+	if err := otpRepo.DeleteOTP(context.Background(), phoneNumber); err != nil {
+		t.Fatalf("DeleteOTP() unexpected error = %v", err)
+	}
+	if failures, _ := otpRepo.GetVerifyFailures(context.Background(), phoneNumber); failures != 3 {
+		t.Errorf("GetVerifyFailures() after DeleteOTP = %v, want 3", failures)
+	}
+}
+
+func TestOTPRepository_Eviction(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	m := metrics.New()
+	instrumented := NewInstrumentedOTPRepository(otpRepo, m)
+	phoneNumber := "+1234567890"
+
+	if err := otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2); err != nil {
+		t.Fatalf("StoreOTP() unexpected error = %v", err)
+	}
+
+	// Redis drops the OTP under memory pressure while the marker survives
+	mr.Del(utils.OTPKey(phoneNumber))
+
+	otp, err := instrumented.GetOTP(context.Background(), phoneNumber)
+	if !errors.Is(err, apperrors.ErrOTPEvicted) {
+		t.Fatalf("GetOTP() error = %v, want %v", err, apperrors.ErrOTPEvicted)
+	}
+	if otp != nil {
+		t.Errorf("GetOTP() = %+v, want nil", otp)
+	}
+	expected := `
+# HELP otp_unexpected_eviction_total Total number of OTPs found missing from Redis before their expiry.
+# TYPE otp_unexpected_eviction_total counter
+otp_unexpected_eviction_total 1
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected), "otp_unexpected_eviction_total"); err != nil {
+		t.Errorf("Unexpected eviction metric: %v", err)
+	}
+
+	// Once the marker expires too, a missing OTP is an ordinary expiry
+	mr.FastForward(2 * time.Minute)
+	otp, err = otpRepo.GetOTP(context.Background(), phoneNumber)
+	if err != nil || otp != nil {
+		t.Errorf("GetOTP() after expiry = %+v, %v, want nil, nil", otp, err)
+	}
+
+	// A used OTP is deleted together with its marker
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2)
+	if err := otpRepo.DeleteOTP(context.Background(), phoneNumber); err != nil {
+		t.Fatalf("DeleteOTP() unexpected error = %v", err)
+	}
+	otp, err = otpRepo.GetOTP(context.Background(), phoneNumber)
+	if err != nil || otp != nil {
+		t.Errorf("GetOTP() after delete = %+v, %v, want nil, nil", otp, err)
+	}
+}
+
+func TestOTPRepository_SendLock(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	phoneNumber := "+1234567890"
+
+	token, err := otpRepo.AcquireSendLock(context.Background(), phoneNumber, 5*time.Second)
+	if err != nil || token == "" {
+		t.Fatalf("AcquireSendLock() = %q, %v, want a token", token, err)
+	}
+
+	if other, err := otpRepo.AcquireSendLock(context.Background(), phoneNumber, 5*time.Second); err != nil || other != "" {
+		t.Errorf("AcquireSendLock() while held = %q, %v, want empty token", other, err)
+	}
+
+	// A stale token must not release a lock that was taken over
+	if err := otpRepo.ReleaseSendLock(context.Background(), phoneNumber, "stale"); err != nil {
+		t.Fatalf("ReleaseSendLock() unexpected error = %v", err)
+	}
+	if !mr.Exists(utils.SendLockKey(phoneNumber)) {
+		t.Error("Send lock released with a stale token")
+	}
+
+	if err := otpRepo.ReleaseSendLock(context.Background(), phoneNumber, token); err != nil {
+		t.Fatalf("ReleaseSendLock() unexpected error = %v", err)
+	}
+	if mr.Exists(utils.SendLockKey(phoneNumber)) {
+		t.Error("Send lock still held after release")
+	}
+}
+
+func TestOTPRepository_VerifyNotBefore(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	phoneNumber := "+1234567890"
+
+	notBefore := time.Now().Add(4 * time.Second).Truncate(time.Millisecond)
+	if err := otpRepo.SetVerifyNotBefore(context.Background(), phoneNumber, notBefore); err != nil {
+		t.Fatalf("SetVerifyNotBefore() unexpected error = %v", err)
+	}
+
+	got, err := otpRepo.GetVerifyNotBefore(context.Background(), phoneNumber)
+	if err != nil || !got.Equal(notBefore) {
+		t.Errorf("GetVerifyNotBefore() = %v, %v, want %v", got, err, notBefore)
+	}
+
+	// A new OTP starts without a backoff
+	if err := otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2); err != nil {
+		t.Fatalf("StoreOTP() unexpected error = %v", err)
+	}
+	if mr.Exists(utils.VerifyNotBeforeKey(phoneNumber)) {
+		t.Error("Verify backoff survived a new OTP")
+	}
+}
+
+func TestOTPRepository_Purge(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	phoneNumber, other := "+14155550100", "+14155550101"
+
+	for _, number := range []string{phoneNumber, other} {
+		if err := otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: number, Code: "123456"}, 2); err != nil {
+			t.Fatalf("StoreOTP() unexpected error = %v", err)
+		}
+		otpRepo.IncrementAttempts(context.Background(), number)
+		otpRepo.ReserveRateLimit(context.Background(), number, 3, 10*time.Minute)
+		otpRepo.IncrementRateLimitPenalty(context.Background(), number)
+		otpRepo.IncrementVerifyFailures(context.Background(), number, time.Hour)
+		otpRepo.SetVerifyNotBefore(context.Background(), number, time.Now().Add(time.Minute))
+		otpRepo.AcquireSendLock(context.Background(), number, time.Minute)
+	}
+
+	if err := otpRepo.Purge(context.Background(), phoneNumber); err != nil {
+		t.Fatalf("Purge() unexpected error = %v", err)
+	}
+
+	for _, key := range mr.Keys() {
+		if strings.HasSuffix(key, ":"+phoneNumber) {
+			t.Errorf("Key %q left after Purge()", key)
+		}
+	}
+	if count, _ := otpRepo.GetRateLimitCount(context.Background(), other); count != 1 {
+		t.Errorf("Other number's rate limit = %d, want 1", count)
+	}
+}
+
+func TestOTPRepository_CancelledContext(t *testing.T) {
+	otpRepo, mr := createTestOTPRepository(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := otpRepo.StoreOTP(ctx, &model.OTP{PhoneNumber: "+1234567890", Code: "123456"}, 5)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("StoreOTP() error = %v, want context.Canceled", err)
+	}
+	if mr.Exists(utils.OTPKey("+1234567890")) {
+		t.Error("StoreOTP() stored the OTP for a cancelled request")
+	}
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// privateUserRepository stores users with an HMAC in phone_number and the
+// reversible value, if any, encrypted in phone_encrypted. Callers keep
+// working with raw phone numbers.
+type privateUserRepository struct {
+	UserRepository
+	protector *utils.PhoneProtector
+}
+
+func NewPrivateUserRepository(repo UserRepository, protector *utils.PhoneProtector) UserRepository {
+	return &privateUserRepository{
+		UserRepository: repo,
+		protector:      protector,
+	}
+}
+
+func (r *privateUserRepository) Create(ctx context.Context, user *model.User) error {
+	// Email sign-ups have no number to protect
+	if user.PhoneNumber == "" {
+		return r.UserRepository.Create(ctx, user)
+	}
+	phoneNumber := user.PhoneNumber
+
+	encrypted, err := r.protector.Encrypt(phoneNumber)
+	if err != nil {
+		return err
+	}
+	user.PhoneNumber = r.protector.Hash(phoneNumber)
+	user.PhoneEncrypted = encrypted
+
+	err = r.UserRepository.Create(ctx, user)
+	user.PhoneNumber = phoneNumber
+	return err
+}
+
+func (r *privateUserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*model.User, error) {
+	user, err := r.UserRepository.GetByPhoneNumber(ctx, r.protector.Hash(phoneNumber))
+	if err != nil {
+		return nil, err
+	}
+	// The caller already knows the number, so this works in write-only mode too
+	user.PhoneNumber = phoneNumber
+	return user, nil
+}
+
+func (r *privateUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, err := r.UserRepository.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	r.reveal(user)
+	return user, nil
+}
+
+func (r *privateUserRepository) GetByID(ctx context.Context, id uint) (*model.User, error) {
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.reveal(user)
+	return user, nil
+}
+
+// UpdatePhoneNumber stores the new number the way Create does
+func (r *privateUserRepository) UpdatePhoneNumber(ctx context.Context, id uint, phoneNumber string) error {
+	encrypted, err := r.protector.Encrypt(phoneNumber)
+	if err != nil {
+		return err
+	}
+	return r.UserRepository.UpdatePhoneColumns(ctx, id, r.protector.Hash(phoneNumber), encrypted)
+}
+
+// GetUsers can only match a search exactly, since substrings of an HMAC mean
+// nothing, and cannot sort by number, since HMACs do not keep the order
+func (r *privateUserRepository) GetUsers(ctx context.Context, page, pageSize int, phoneNumber, sort string) ([]model.User, int64, error) {
+	if strings.TrimPrefix(sort, "-") == "phone_number" {
+		return nil, 0, fmt.Errorf("%w: privacy mode cannot sort by phone number", apperrors.ErrInvalidSort)
+	}
+
+	if phoneNumber != "" {
+		phoneNumber, err := utils.ValidateAndNormalizePhone(phoneNumber)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: privacy mode only supports full phone numbers", apperrors.ErrInvalidSearchQuery)
+		}
+		user, err := r.GetByPhoneNumber(ctx, phoneNumber)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return []model.User{}, 0, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if page > 1 {
+			return []model.User{}, 1, nil
+		}
+		return []model.User{*user}, 1, nil
+	}
+
+	users, total, err := r.UserRepository.GetUsers(ctx, page, pageSize, "", sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range users {
+		r.reveal(&users[i])
+	}
+	return users, total, nil
+}
+
+// ListPhoneNumbers refuses, since the stored values are HMACs and legacy
+// formats cannot be recovered from them
+func (r *privateUserRepository) ListPhoneNumbers(ctx context.Context, afterID uint, limit int) ([]model.User, error) {
+	return nil, apperrors.ErrPhonesHashed
+}
+
+// reveal swaps the stored HMAC for the decrypted number, or blanks it in write-only mode
+func (r *privateUserRepository) reveal(user *model.User) {
+	phoneNumber, err := r.protector.Decrypt(user.PhoneEncrypted)
+	if err != nil {
+		log.Printf("Failed to decrypt phone number for user %d: %v", user.ID, err)
+	}
+	user.PhoneNumber = phoneNumber
+}
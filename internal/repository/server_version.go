@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// RedisVersion reads redis_version from INFO server
+func RedisVersion(ctx context.Context, client *redis.Client) (string, error) {
+	info, err := client.Info(ctx, "server").Result()
+	if err != nil {
+		return "", err
+	}
+	return parseRedisVersion(info)
+}
+
+// PostgresVersion reads server_version, e.g. "16.2 (Debian 16.2-1.pgdg120+2)"
+func PostgresVersion(ctx context.Context, db *gorm.DB) (string, error) {
+	var version string
+	if err := db.WithContext(ctx).Raw("SHOW server_version").Scan(&version).Error; err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+func parseRedisVersion(info string) (string, error) {
+	for _, line := range strings.Split(info, "\n") {
+		if version, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); ok {
+			return version, nil
+		}
+	}
+	return "", errors.New("redis_version missing from INFO server")
+}
@@ -0,0 +1,19 @@
+package repository
+
+import "testing"
+
+func TestParseRedisVersion(t *testing.T) {
+	info := "# Server\r\nredis_version:7.2.4\r\nredis_git_sha1:00000000\r\nredis_mode:standalone\r\n"
+
+	version, err := parseRedisVersion(info)
+	if err != nil {
+		t.Fatalf("parseRedisVersion() unexpected error = %v", err)
+	}
+	if version != "7.2.4" {
+		t.Errorf("parseRedisVersion() = %q, want %q", version, "7.2.4")
+	}
+
+	if _, err := parseRedisVersion("# Server\r\nredis_mode:standalone\r\n"); err == nil {
+		t.Error("parseRedisVersion() expected error when redis_version is missing")
+	}
+}
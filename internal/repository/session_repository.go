@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// SessionRepository keeps a row per sign-in, keyed by the jti of the
+// session's current access token, and a row per access token it issued
+type SessionRepository interface {
+	// Create stores the session along with its Tokens
+	Create(ctx context.Context, session *model.Session) error
+	// ListActive returns the user's sessions that can still be renewed, newest first
+	ListActive(ctx context.Context, userID uint) ([]model.Session, error)
+	// GetByTokenID finds the session by any access token it issued, with its
+	// Tokens loaded; an unknown jti is gorm.ErrRecordNotFound
+	GetByTokenID(ctx context.Context, tokenID string) (*model.Session, error)
+	// Rotate moves the session holding refreshTokenID to a newly issued access
+	// token, keeping the old ones; it reports false when no session holds the
+	// refresh token
+	Rotate(ctx context.Context, refreshTokenID, tokenID string, expiresAt time.Time) (bool, error)
+	// Delete removes the session and its Tokens
+	Delete(ctx context.Context, id uint) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *model.Session) error {
+	ctx, cancel := utils.WithDBTimeout(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *sessionRepository) ListActive(ctx context.Context, userID uint) ([]model.Session, error) {
+	ctx, cancel := utils.WithDBTimeout(ctx)
+	defer cancel()
+
+	var sessions []model.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC, id DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *sessionRepository) GetByTokenID(ctx context.Context, tokenID string) (*model.Session, error) {
+	ctx, cancel := utils.WithDBTimeout(ctx)
+	defer cancel()
+
+	db := r.db.WithContext(ctx)
+	issued := db.Model(&model.SessionToken{}).Select("session_id").Where("token_id = ?", tokenID)
+
+	var session model.Session
+	err := db.Preload("Tokens").
+		Where("token_id = ? OR id IN (?)", tokenID, issued).
+		First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) Rotate(ctx context.Context, refreshTokenID, tokenID string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := utils.WithDBTimeout(ctx)
+	defer cancel()
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var session model.Session
+		if err := tx.Where("refresh_token_id = ?", refreshTokenID).First(&session).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&model.SessionToken{SessionID: session.ID, TokenID: tokenID, ExpiresAt: expiresAt}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&session).Update("token_id", tokenID).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *sessionRepository) Delete(ctx context.Context, id uint) error {
+	ctx, cancel := utils.WithDBTimeout(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", id).Delete(&model.SessionToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Session{}, id).Error
+	})
+}
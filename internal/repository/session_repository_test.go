@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func createTestSessionDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Session{}, &model.SessionToken{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestSessionRepository_ListActive(t *testing.T) {
+	sessionRepo := NewSessionRepository(createTestSessionDB(t))
+	now := time.Now()
+
+	for _, session := range []*model.Session{
+		{TokenID: "a1", RefreshTokenID: "r1", UserID: 1, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Hour)},
+		{TokenID: "a2", RefreshTokenID: "r2", UserID: 1, CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+		{TokenID: "a3", RefreshTokenID: "r3", UserID: 1, CreatedAt: now.Add(-3 * time.Hour), ExpiresAt: now.Add(-time.Minute)},
+		{TokenID: "a4", RefreshTokenID: "r4", UserID: 2, ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := sessionRepo.Create(context.Background(), session); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+	}
+
+	sessions, err := sessionRepo.ListActive(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("ListActive() unexpected error = %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].TokenID != "a2" || sessions[1].TokenID != "a1" {
+		t.Errorf("ListActive() = %+v, want the unexpired sessions a2, a1", sessions)
+	}
+}
+
+func TestSessionRepository_RotateAndDelete(t *testing.T) {
+	db := createTestSessionDB(t)
+	sessionRepo := NewSessionRepository(db)
+	expiresAt := time.Now().Add(time.Hour)
+	session := &model.Session{
+		TokenID: "a1", RefreshTokenID: "r1", UserID: 1, ExpiresAt: expiresAt,
+		Tokens: []model.SessionToken{{TokenID: "a1", ExpiresAt: expiresAt}},
+	}
+	if err := sessionRepo.Create(context.Background(), session); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+
+	rotated, err := sessionRepo.Rotate(context.Background(), "r1", "a2", expiresAt)
+	if err != nil || !rotated {
+		t.Fatalf("Rotate() = %v, %v, want true", rotated, err)
+	}
+
+	// Every access token the session issued still finds it
+	for _, tokenID := range []string{"a1", "a2"} {
+		got, err := sessionRepo.GetByTokenID(context.Background(), tokenID)
+		if err != nil || got.ID != session.ID {
+			t.Fatalf("GetByTokenID(%q) = %+v, %v, want session %d", tokenID, got, err, session.ID)
+		}
+		if got.TokenID != "a2" || len(got.Tokens) != 2 {
+			t.Errorf("GetByTokenID(%q) = latest %q with %d tokens, want a2 with 2", tokenID, got.TokenID, len(got.Tokens))
+		}
+	}
+
+	if rotated, err := sessionRepo.Rotate(context.Background(), "unknown", "a3", expiresAt); err != nil || rotated {
+		t.Errorf("Rotate(unknown) = %v, %v, want false", rotated, err)
+	}
+
+	if err := sessionRepo.Delete(context.Background(), session.ID); err != nil {
+		t.Fatalf("Delete() unexpected error = %v", err)
+	}
+	if _, err := sessionRepo.GetByTokenID(context.Background(), "a1"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetByTokenID() after Delete error = %v, want gorm.ErrRecordNotFound", err)
+	}
+	var left int64
+	db.Model(&model.SessionToken{}).Count(&left)
+	if left != 0 {
+		t.Errorf("Delete() left %d session tokens, want 0", left)
+	}
+}
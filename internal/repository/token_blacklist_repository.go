@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenBlacklist holds the IDs of tokens revoked before they expire. Entries
+// carry the token's remaining lifetime as their TTL, so Redis drops them once
+// the token could no longer be used anyway.
+type TokenBlacklist interface {
+	Revoke(ctx context.Context, tokenID string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+
+	// The cutoff before which every token is rejected; the zero time when unset
+	GetMinIssuedAt(ctx context.Context) (time.Time, error)
+	SetMinIssuedAt(ctx context.Context, t time.Time) error
+}
+
+type tokenBlacklist struct {
+	client *redis.Client
+}
+
+func NewTokenBlacklist(client *redis.Client) TokenBlacklist {
+	return &tokenBlacklist{client: client}
+}
+
+func (r *tokenBlacklist) Revoke(ctx context.Context, tokenID string, ttl time.Duration) error {
+	// An already expired token needs no entry
+	if ttl <= 0 {
+		return nil
+	}
+
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	if err := r.client.Set(ctx, utils.RevokedTokenKey(tokenID), "1", ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+func (r *tokenBlacklist) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	count, err := r.client.Exists(ctx, utils.RevokedTokenKey(tokenID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (r *tokenBlacklist) GetMinIssuedAt(ctx context.Context) (time.Time, error) {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	value, err := r.client.Get(ctx, utils.TokenMinIssuedAtKey()).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get token cutoff: %w", err)
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid token cutoff %q: %w", value, err)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// SetMinIssuedAt keeps the cutoff without expiry; the zero time removes it
+func (r *tokenBlacklist) SetMinIssuedAt(ctx context.Context, t time.Time) error {
+	ctx, cancel := utils.WithRedisTimeout(ctx)
+	defer cancel()
+	key := utils.TokenMinIssuedAtKey()
+
+	var err error
+	if t.IsZero() {
+		err = r.client.Del(ctx, key).Err()
+	} else {
+		err = r.client.Set(ctx, key, strconv.FormatInt(t.Unix(), 10), 0).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set token cutoff: %w", err)
+	}
+	return nil
+}
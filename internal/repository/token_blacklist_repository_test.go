@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestTokenBlacklist_Revoke(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	blacklist := NewTokenBlacklist(client)
+
+	if err := blacklist.Revoke(context.Background(), "token-1", 10*time.Minute); err != nil {
+		t.Fatalf("Revoke() unexpected error = %v", err)
+	}
+	if ttl := mr.TTL(utils.RevokedTokenKey("token-1")); ttl != 10*time.Minute {
+		t.Errorf("Revoked token TTL = %v, want %v", ttl, 10*time.Minute)
+	}
+
+	for tokenID, want := range map[string]bool{"token-1": true, "token-2": false} {
+		revoked, err := blacklist.IsRevoked(context.Background(), tokenID)
+		if err != nil {
+			t.Fatalf("IsRevoked() unexpected error = %v", err)
+		}
+		if revoked != want {
+			t.Errorf("IsRevoked(%q) = %v, want %v", tokenID, revoked, want)
+		}
+	}
+
+	// The entry cleans itself up once the token would have expired
+	mr.FastForward(10 * time.Minute)
+	if revoked, _ := blacklist.IsRevoked(context.Background(), "token-1"); revoked {
+		t.Error("IsRevoked() = true after the token's lifetime")
+	}
+
+	if err := blacklist.Revoke(context.Background(), "token-3", 0); err != nil {
+		t.Fatalf("Revoke() unexpected error = %v", err)
+	}
+	if mr.Exists(utils.RevokedTokenKey("token-3")) {
+		t.Error("Revoke() stored an entry for an already expired token")
+	}
+}
+
+func TestTokenBlacklist_MinIssuedAt(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	blacklist := NewTokenBlacklist(client)
+
+	if cutoff, err := blacklist.GetMinIssuedAt(context.Background()); err != nil || !cutoff.IsZero() {
+		t.Fatalf("GetMinIssuedAt() unset = %v, %v, want the zero time", cutoff, err)
+	}
+
+	want := time.Unix(1767225600, 0)
+	if err := blacklist.SetMinIssuedAt(context.Background(), want); err != nil {
+		t.Fatalf("SetMinIssuedAt() unexpected error = %v", err)
+	}
+	if cutoff, err := blacklist.GetMinIssuedAt(context.Background()); err != nil || !cutoff.Equal(want) {
+		t.Errorf("GetMinIssuedAt() = %v, %v, want %v", cutoff, err, want)
+	}
+	if ttl := mr.TTL(utils.TokenMinIssuedAtKey()); ttl != 0 {
+		t.Errorf("Cutoff TTL = %v, want none", ttl)
+	}
+
+	if err := blacklist.SetMinIssuedAt(context.Background(), time.Time{}); err != nil {
+		t.Fatalf("SetMinIssuedAt(zero) unexpected error = %v", err)
+	}
+	if mr.Exists(utils.TokenMinIssuedAtKey()) {
+		t.Error("Cutoff still stored after clearing it")
+	}
+}
+
+func TestTokenBlacklist_CancelledContext(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	blacklist := NewTokenBlacklist(client)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := blacklist.Revoke(ctx, "token-1", time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("Revoke() error = %v, want context.Canceled", err)
+	}
+	if mr.Exists(utils.RevokedTokenKey("token-1")) {
+		t.Error("Revoke() stored an entry for a cancelled request")
+	}
+}
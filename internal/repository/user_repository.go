@@ -1,55 +1,231 @@
 package repository
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
-	Create(user *model.User) error
-	GetByPhoneNumber(phoneNumber string) (*model.User, error)
-	GetByID(id uint) (*model.User, error)
-	GetUsers(page, pageSize int, phoneNumber string) ([]model.User, int64, error)
+	Create(ctx context.Context, user *model.User) error
+	GetByPhoneNumber(ctx context.Context, phoneNumber string) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	GetByID(ctx context.Context, id uint) (*model.User, error)
+	TouchLastLogin(ctx context.Context, id uint) error
+	UpdateStatus(ctx context.Context, id uint, status model.UserStatus) error
+	SetTOTPSecret(ctx context.Context, id uint, secret string) error
+	ConsumeTOTPStep(ctx context.Context, id uint, step int64) (bool, error)
+	GetUsers(ctx context.Context, page, pageSize int, phoneNumber, sort string) ([]model.User, int64, error)
+	CountDeletedBefore(ctx context.Context, before time.Time) (int64, error)
+	PurgeDeletedBefore(ctx context.Context, before time.Time, batchSize int) (int64, error)
+	ListPhoneNumbers(ctx context.Context, afterID uint, limit int) ([]model.User, error)
+	UpdatePhoneNumber(ctx context.Context, id uint, phoneNumber string) error
+	UpdatePhoneColumns(ctx context.Context, id uint, phoneNumber, phoneEncrypted string) error
+	Delete(ctx context.Context, id uint) error
 }
 
 type userRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	config *config.Config
+}
+
+func NewUserRepository(db *gorm.DB, config *config.Config) UserRepository {
+	return &userRepository{db: db, config: config}
+}
+
+// conn scopes queries to ctx under the database timeout; call cancel once they are done
+func (r *userRepository) conn(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := utils.WithDBTimeout(ctx)
+	return r.db.WithContext(ctx), cancel
+}
+
+// likeEscaper makes LIKE wildcards in user input match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Create reports a phone number or email still held by a soft-deleted user as
+// apperrors.ErrAccountDeleted; it is released once the row is purged
+func (r *userRepository) Create(ctx context.Context, user *model.User) error {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	err := db.Create(user).Error
+	if err == nil {
+		return nil
+	}
+
+	query := db.Unscoped().Model(&model.User{}).Where("deleted_at IS NOT NULL")
+	switch {
+	case user.PhoneNumber != "":
+		query = query.Where("phone_number = ?", user.PhoneNumber)
+	case user.Email != "":
+		query = query.Where("email = ?", user.Email)
+	default:
+		return err
+	}
+	var deleted int64
+	if query.Count(&deleted).Error == nil && deleted > 0 {
+		return apperrors.ErrAccountDeleted
+	}
+	return err
 }
 
-func NewUserRepository(db *gorm.DB) UserRepository {
-	return &userRepository{db: db}
+// Delete soft-deletes the user, or with USER_HARD_DELETE erases the row. It
+// returns gorm.ErrRecordNotFound when no live user has the ID.
+func (r *userRepository) Delete(ctx context.Context, id uint) error {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	if r.config.User.HardDelete {
+		db = db.Unscoped()
+	}
+	result := db.Where("deleted_at IS NULL").Delete(&model.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
 
-func (r *userRepository) Create(user *model.User) error {
-	return r.db.Create(user).Error
+func (r *userRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*model.User, error) {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	var user model.User
+	err := db.Where("phone_number = ?", phoneNumber).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-func (r *userRepository) GetByPhoneNumber(phoneNumber string) (*model.User, error) {
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
 	var user model.User
-	err := r.db.Where("phone_number = ?", phoneNumber).First(&user).Error
+	err := db.Where("email = ?", email).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *userRepository) GetByID(id uint) (*model.User, error) {
+func (r *userRepository) GetByID(ctx context.Context, id uint) (*model.User, error) {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
 	var user model.User
-	err := r.db.First(&user, id).Error
+	err := db.First(&user, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *userRepository) GetUsers(page, pageSize int, phoneNumber string) ([]model.User, int64, error) {
+// TouchLastLogin stamps last_login_at with a single UPDATE, leaving updated_at alone
+func (r *userRepository) TouchLastLogin(ctx context.Context, id uint) error {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	return db.Model(&model.User{ID: id}).UpdateColumn("last_login_at", time.Now()).Error
+}
+
+// UpdateStatus returns gorm.ErrRecordNotFound when no live user has the ID
+func (r *userRepository) UpdateStatus(ctx context.Context, id uint, status model.UserStatus) error {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	result := db.Model(&model.User{}).Where("id = ?", id).Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) SetTOTPSecret(ctx context.Context, id uint, secret string) error {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	return db.Model(&model.User{ID: id}).UpdateColumns(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error
+}
+
+// ConsumeTOTPStep records step as used and reports false if it, or a later
+// step, was already accepted; the conditional UPDATE makes this race-free
+func (r *userRepository) ConsumeTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	result := db.Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		UpdateColumn("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// userSortColumns is the allowlist for GetUsers sorting; a sort outside it
+// never reaches the query
+var userSortColumns = map[string]string{
+	"registered_at": "registered_at",
+	"phone_number":  "phone_number",
+}
+
+// userSortOptions are the sort values GetUsers accepts, a leading "-" for descending
+const userSortOptions = "registered_at, -registered_at, phone_number, -phone_number"
+
+// userOrder maps a sort value to its columns; empty keeps newest first. Ties
+// are broken by ID so pages never overlap.
+func userOrder(sort string) ([]clause.OrderByColumn, error) {
+	if sort == "" {
+		sort = "-registered_at"
+	}
+	field, desc := strings.CutPrefix(sort, "-")
+	column, ok := userSortColumns[field]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, must be one of %s", apperrors.ErrInvalidSort, sort, userSortOptions)
+	}
+	return []clause.OrderByColumn{
+		{Column: clause.Column{Name: column}, Desc: desc},
+		{Column: clause.Column{Name: "id"}, Desc: desc},
+	}, nil
+}
+
+func (r *userRepository) GetUsers(ctx context.Context, page, pageSize int, phoneNumber, sort string) ([]model.User, int64, error) {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
 	var users []model.User
 	var total int64
 
-	query := r.db.Model(&model.User{})
-	
+	order, err := userOrder(sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := db.Model(&model.User{})
+
 	if phoneNumber != "" {
-		query = query.Where("phone_number LIKE ?", "%"+phoneNumber+"%")
+		if length := len(phoneNumber); length < r.config.User.SearchMinLength || length > r.config.User.SearchMaxLength {
+			return nil, 0, fmt.Errorf("%w: must be %d to %d characters", apperrors.ErrInvalidSearchQuery, r.config.User.SearchMinLength, r.config.User.SearchMaxLength)
+		}
+		query = query.Where(`phone_number LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(phoneNumber)+"%")
 	}
 
 	if err := query.Count(&total).Error; err != nil {
@@ -57,9 +233,115 @@ func (r *userRepository) GetUsers(page, pageSize int, phoneNumber string) ([]mod
 	}
 
 	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Order("registered_at DESC").Find(&users).Error; err != nil {
+	if err := query.Offset(offset).Limit(pageSize).Order(clause.OrderBy{Columns: order}).Find(&users).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return users, total, nil
 }
+
+// CountDeletedBefore counts soft-deleted users whose deletion predates before
+func (r *userRepository) CountDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	var count int64
+	err := db.Unscoped().Model(&model.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Count(&count).Error
+	return count, err
+}
+
+// PurgeDeletedBefore hard-deletes soft-deleted users in batches of batchSize
+func (r *userRepository) PurgeDeletedBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	var purged int64
+	for {
+		deleted, err := r.purgeBatch(ctx, before, batchSize)
+		if err != nil {
+			return purged, err
+		}
+		purged += deleted
+
+		if deleted < int64(batchSize) {
+			return purged, nil
+		}
+	}
+}
+
+// purgeBatch hard-deletes up to batchSize users; each batch gets its own
+// timeout, so a long purge is only bounded by ctx
+func (r *userRepository) purgeBatch(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	var ids []uint
+	err := db.Unscoped().Model(&model.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Limit(batchSize).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	result := db.Unscoped().Delete(&model.User{}, ids)
+	return result.RowsAffected, result.Error
+}
+
+// ListPhoneNumbers pages through every user, soft-deleted ones included, by
+// ascending ID; only the ID and phone number are loaded
+func (r *userRepository) ListPhoneNumbers(ctx context.Context, afterID uint, limit int) ([]model.User, error) {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	var users []model.User
+	err := db.Unscoped().
+		Select("id", "phone_number").
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+// UpdatePhoneNumber rewrites a stored number in place without touching updated_at.
+// A number another user holds, soft-deleted ones included, is apperrors.ErrPhoneNumberTaken.
+func (r *userRepository) UpdatePhoneNumber(ctx context.Context, id uint, phoneNumber string) error {
+	return r.UpdatePhoneColumns(ctx, id, phoneNumber, "")
+}
+
+// UpdatePhoneColumns writes phone_number and phone_encrypted together; privacy
+// mode passes the HMAC and the ciphertext, everything else an empty ciphertext
+func (r *userRepository) UpdatePhoneColumns(ctx context.Context, id uint, phoneNumber, phoneEncrypted string) error {
+	db, cancel := r.conn(ctx)
+	defer cancel()
+
+	if taken, err := phoneTaken(db, id, phoneNumber); err != nil || taken {
+		if taken {
+			return apperrors.ErrPhoneNumberTaken
+		}
+		return err
+	}
+
+	result := db.Unscoped().Model(&model.User{ID: id}).UpdateColumns(map[string]interface{}{
+		"phone_number":    phoneNumber,
+		"phone_encrypted": phoneEncrypted,
+	})
+	if result.Error != nil {
+		// A concurrent change can get past the check above; the unique index stops it
+		if taken, _ := phoneTaken(db, id, phoneNumber); taken {
+			return apperrors.ErrPhoneNumberTaken
+		}
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// phoneTaken reports whether a user other than id holds the number
+func phoneTaken(db *gorm.DB, id uint, phoneNumber string) (bool, error) {
+	var count int64
+	err := db.Unscoped().Model(&model.User{}).Where("phone_number = ? AND id <> ?", phoneNumber, id).Count(&count).Error
+	return count > 0, err
+}
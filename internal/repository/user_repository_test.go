@@ -0,0 +1,639 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func createTestUserRepository(t *testing.T) (UserRepository, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.User{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	cfg := &config.Config{
+		User: config.UserConfig{
+			SearchMinLength: 3,
+			SearchMaxLength: 16,
+		},
+	}
+	return NewUserRepository(db, cfg), db
+}
+
+func TestUserRepository_PurgeDeletedBefore(t *testing.T) {
+	userRepo, db := createTestUserRepository(t)
+	now := time.Now()
+
+	users := []struct {
+		phoneNumber string
+		deletedAt   *time.Time
+		wantKept    bool
+	}{
+		{"+1000000001", nil, true},
+		{"+1000000002", ptr(now.Add(-24 * time.Hour)), true},
+		{"+1000000003", ptr(now.Add(-40 * 24 * time.Hour)), false},
+		{"+1000000004", ptr(now.Add(-90 * 24 * time.Hour)), false},
+	}
+
+	for _, u := range users {
+		user := &model.User{PhoneNumber: u.phoneNumber}
+		if err := userRepo.Create(context.Background(), user); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+		if u.deletedAt != nil {
+			if err := db.Unscoped().Model(user).Update("deleted_at", *u.deletedAt).Error; err != nil {
+				t.Fatalf("Failed to soft-delete user: %v", err)
+			}
+		}
+	}
+
+	cutoff := now.Add(-30 * 24 * time.Hour)
+
+	count, err := userRepo.CountDeletedBefore(context.Background(), cutoff)
+	if err != nil || count != 2 {
+		t.Fatalf("CountDeletedBefore() = %v, %v, want 2", count, err)
+	}
+
+	// A batch size of one forces several batches
+	purged, err := userRepo.PurgeDeletedBefore(context.Background(), cutoff, 1)
+	if err != nil {
+		t.Fatalf("PurgeDeletedBefore() unexpected error = %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("PurgeDeletedBefore() = %v, want 2", purged)
+	}
+
+	for _, u := range users {
+		var found int64
+		db.Unscoped().Model(&model.User{}).Where("phone_number = ?", u.phoneNumber).Count(&found)
+		if (found == 1) != u.wantKept {
+			t.Errorf("User %s kept = %v, want %v", u.phoneNumber, found == 1, u.wantKept)
+		}
+	}
+}
+
+func TestUserRepository_GetUsersSearch(t *testing.T) {
+	userRepo, _ := createTestUserRepository(t)
+
+	for _, phoneNumber := range []string{"+1234567890", "+12%34567890", "+12_4567890"} {
+		if err := userRepo.Create(context.Background(), &model.User{PhoneNumber: phoneNumber}); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		search    string
+		wantPhone []string
+		wantErr   error
+	}{
+		{"Literal percent", "2%3", []string{"+12%34567890"}, nil},
+		{"Literal underscore", "2_4", []string{"+12_4567890"}, nil},
+		{"Plain digits", "4567890", []string{"+1234567890", "+12%34567890", "+12_4567890"}, nil},
+		{"Too short", "12", nil, apperrors.ErrInvalidSearchQuery},
+		{"Too long", "+1234567890123456", nil, apperrors.ErrInvalidSearchQuery},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, total, err := userRepo.GetUsers(context.Background(), 1, 10, tt.search, "")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetUsers() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUsers() unexpected error = %v", err)
+			}
+
+			if int(total) != len(tt.wantPhone) {
+				t.Errorf("GetUsers() total = %v, want %v", total, len(tt.wantPhone))
+			}
+			found := make(map[string]bool)
+			for _, user := range users {
+				found[user.PhoneNumber] = true
+			}
+			for _, phoneNumber := range tt.wantPhone {
+				if !found[phoneNumber] {
+					t.Errorf("GetUsers() missing %s", phoneNumber)
+				}
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestUserRepository_GetUsersSort(t *testing.T) {
+	userRepo, db := createTestUserRepository(t)
+
+	registered := time.Now().Add(-time.Hour)
+	for i, phoneNumber := range []string{"+14155550102", "+14155550100", "+14155550101"} {
+		user := &model.User{PhoneNumber: phoneNumber}
+		if err := userRepo.Create(context.Background(), user); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+		db.Model(user).Update("registered_at", registered.Add(time.Duration(i)*time.Minute))
+	}
+
+	tests := []struct {
+		sort      string
+		wantPhone []string
+		wantErr   error
+	}{
+		{"", []string{"+14155550101", "+14155550100", "+14155550102"}, nil},
+		{"registered_at", []string{"+14155550102", "+14155550100", "+14155550101"}, nil},
+		{"-registered_at", []string{"+14155550101", "+14155550100", "+14155550102"}, nil},
+		{"phone_number", []string{"+14155550100", "+14155550101", "+14155550102"}, nil},
+		{"-phone_number", []string{"+14155550102", "+14155550101", "+14155550100"}, nil},
+		{"id", nil, apperrors.ErrInvalidSort},
+		{"registered_at DESC", nil, apperrors.ErrInvalidSort},
+		{"phone_number; DROP TABLE users", nil, apperrors.ErrInvalidSort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			users, _, err := userRepo.GetUsers(context.Background(), 1, 10, "", tt.sort)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetUsers() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUsers() unexpected error = %v", err)
+			}
+
+			var got []string
+			for _, user := range users {
+				got = append(got, user.PhoneNumber)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantPhone, ",") {
+				t.Errorf("GetUsers() order = %v, want %v", got, tt.wantPhone)
+			}
+		})
+	}
+}
+
+func TestUserRepository_TouchLastLogin(t *testing.T) {
+	userRepo, _ := createTestUserRepository(t)
+
+	user := &model.User{PhoneNumber: "+1234567890"}
+	if err := userRepo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+
+	var previous time.Time
+	for i := 0; i < 2; i++ {
+		if err := userRepo.TouchLastLogin(context.Background(), user.ID); err != nil {
+			t.Fatalf("TouchLastLogin() unexpected error = %v", err)
+		}
+
+		stored, err := userRepo.GetByID(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("GetByID() unexpected error = %v", err)
+		}
+		if stored.LastLoginAt == nil || !stored.LastLoginAt.After(previous) {
+			t.Fatalf("LastLoginAt = %v, want after %v", stored.LastLoginAt, previous)
+		}
+		if !stored.UpdatedAt.Equal(user.UpdatedAt) {
+			t.Errorf("UpdatedAt changed to %v, want %v", stored.UpdatedAt, user.UpdatedAt)
+		}
+		previous = *stored.LastLoginAt
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUserRepository_UpdateStatus(t *testing.T) {
+	userRepo, _ := createTestUserRepository(t)
+
+	user := &model.User{PhoneNumber: "+1234567890"}
+	if err := userRepo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+
+	stored, err := userRepo.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error = %v", err)
+	}
+	if stored.Status != model.UserStatusActive {
+		t.Errorf("Default status = %q, want %q", stored.Status, model.UserStatusActive)
+	}
+
+	if err := userRepo.UpdateStatus(context.Background(), user.ID, model.UserStatusSuspended); err != nil {
+		t.Fatalf("UpdateStatus() unexpected error = %v", err)
+	}
+	stored, err = userRepo.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error = %v", err)
+	}
+	if stored.Status != model.UserStatusSuspended {
+		t.Errorf("Status = %q, want %q", stored.Status, model.UserStatusSuspended)
+	}
+
+	if err := userRepo.UpdateStatus(context.Background(), user.ID+1, model.UserStatusSuspended); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("UpdateStatus() unknown user error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+func TestUserRepository_TOTP(t *testing.T) {
+	userRepo, _ := createTestUserRepository(t)
+
+	user := &model.User{PhoneNumber: "+1234567890"}
+	if err := userRepo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+	if err := userRepo.SetTOTPSecret(context.Background(), user.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("SetTOTPSecret() unexpected error = %v", err)
+	}
+
+	stored, err := userRepo.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error = %v", err)
+	}
+	if stored.TOTPSecret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("TOTPSecret = %q, want %q", stored.TOTPSecret, "JBSWY3DPEHPK3PXP")
+	}
+
+	// Each step is accepted once; the same or an older step is a replay
+	for _, tt := range []struct {
+		step int64
+		want bool
+	}{{100, true}, {100, false}, {99, false}, {101, true}} {
+		consumed, err := userRepo.ConsumeTOTPStep(context.Background(), user.ID, tt.step)
+		if err != nil {
+			t.Fatalf("ConsumeTOTPStep(%d) unexpected error = %v", tt.step, err)
+		}
+		if consumed != tt.want {
+			t.Errorf("ConsumeTOTPStep(%d) = %v, want %v", tt.step, consumed, tt.want)
+		}
+	}
+}
+
+func TestUserRepository_UpdatePhoneNumber(t *testing.T) {
+	userRepo, db := createTestUserRepository(t)
+
+	user := &model.User{PhoneNumber: "+14155550100"}
+	holder := &model.User{PhoneNumber: "+14155550103"}
+	departed := &model.User{PhoneNumber: "+14155550104"}
+	for _, u := range []*model.User{user, holder, departed} {
+		if err := userRepo.Create(context.Background(), u); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+	}
+	db.Delete(departed)
+
+	tests := []struct {
+		name        string
+		id          uint
+		phoneNumber string
+		wantErr     error
+	}{
+		{"Free number", user.ID, "+14155550101", nil},
+		{"Held by another user", user.ID, "+14155550103", apperrors.ErrPhoneNumberTaken},
+		{"Held by a soft-deleted user", user.ID, "+14155550104", apperrors.ErrPhoneNumberTaken},
+		{"Unknown user", 999, "+14155550102", gorm.ErrRecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := userRepo.UpdatePhoneNumber(context.Background(), tt.id, tt.phoneNumber); !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdatePhoneNumber() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	found, err := userRepo.GetByID(context.Background(), user.ID)
+	if err != nil || found.PhoneNumber != "+14155550101" {
+		t.Errorf("GetByID() = %v, %v, want the free number", found, err)
+	}
+}
+
+func TestUserRepository_Delete(t *testing.T) {
+	userRepo, db := createTestUserRepository(t)
+	hardRepo := NewUserRepository(db, &config.Config{User: config.UserConfig{HardDelete: true}})
+
+	soft := &model.User{PhoneNumber: "+14155550100"}
+	hard := &model.User{PhoneNumber: "+14155550101"}
+	for _, u := range []*model.User{soft, hard} {
+		if err := userRepo.Create(context.Background(), u); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+	}
+
+	if err := userRepo.Delete(context.Background(), soft.ID); err != nil {
+		t.Fatalf("Delete() unexpected error = %v", err)
+	}
+	if _, err := userRepo.GetByID(context.Background(), soft.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetByID() after soft delete error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	var kept model.User
+	if err := db.Unscoped().First(&kept, soft.ID).Error; err != nil || !kept.DeletedAt.Valid {
+		t.Errorf("Soft-deleted row = %+v, %v, want it kept with deleted_at set", kept, err)
+	}
+
+	// The number stays held until the row is purged
+	if err := userRepo.Create(context.Background(), &model.User{PhoneNumber: soft.PhoneNumber}); !errors.Is(err, apperrors.ErrAccountDeleted) {
+		t.Errorf("Create() with a soft-deleted number error = %v, want %v", err, apperrors.ErrAccountDeleted)
+	}
+
+	if err := hardRepo.Delete(context.Background(), hard.ID); err != nil {
+		t.Fatalf("Delete() hard unexpected error = %v", err)
+	}
+	var found int64
+	db.Unscoped().Model(&model.User{}).Where("id = ?", hard.ID).Count(&found)
+	if found != 0 {
+		t.Errorf("Hard-deleted rows = %d, want 0", found)
+	}
+	if err := userRepo.Create(context.Background(), &model.User{PhoneNumber: hard.PhoneNumber}); err != nil {
+		t.Errorf("Create() with a hard-deleted number unexpected error = %v", err)
+	}
+
+	for _, id := range []uint{soft.ID, 999} {
+		if err := userRepo.Delete(context.Background(), id); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("Delete(%d) error = %v, want %v", id, err, gorm.ErrRecordNotFound)
+		}
+	}
+}
+
+func TestUserRepository_Email(t *testing.T) {
+	userRepo, db := createTestUserRepository(t)
+
+	// Several email users and several phone users, each leaving the other column NULL
+	users := []*model.User{
+		{Email: "a@example.com"},
+		{Email: "b@example.com"},
+		{PhoneNumber: "+1234567890"},
+		{PhoneNumber: "+1234567891"},
+	}
+	for _, user := range users {
+		if err := userRepo.Create(context.Background(), user); err != nil {
+			t.Fatalf("Create() unexpected error = %v", err)
+		}
+	}
+	if err := userRepo.Create(context.Background(), &model.User{Email: "a@example.com"}); err == nil {
+		t.Error("Create() expected a unique violation for a duplicate email")
+	}
+
+	var nullPhones int64
+	db.Model(&model.User{}).Where("phone_number IS NULL").Count(&nullPhones)
+	if nullPhones != 2 {
+		t.Errorf("Users with a NULL phone_number = %d, want 2", nullPhones)
+	}
+
+	user, err := userRepo.GetByEmail(context.Background(), "b@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail() unexpected error = %v", err)
+	}
+	if user.ID != users[1].ID || user.PhoneNumber != "" {
+		t.Errorf("GetByEmail() = %+v, want user %d without a phone number", user, users[1].ID)
+	}
+	if _, err := userRepo.GetByEmail(context.Background(), "missing@example.com"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetByEmail() missing error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+func TestPrivateUserRepository(t *testing.T) {
+	const encryptionKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+	tests := []struct {
+		name          string
+		encryptionKey string
+		wantByID      string
+	}{
+		{"Encrypted", encryptionKey, "+14155550100"},
+		{"Write-only", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseRepo, db := createTestUserRepository(t)
+			protector, err := utils.NewPhoneProtector("test-hmac-key", tt.encryptionKey)
+			if err != nil {
+				t.Fatalf("NewPhoneProtector() unexpected error = %v", err)
+			}
+			userRepo := NewPrivateUserRepository(baseRepo, protector)
+			phoneNumber := "+14155550100"
+
+			user := &model.User{PhoneNumber: phoneNumber}
+			if err := userRepo.Create(context.Background(), user); err != nil {
+				t.Fatalf("Create() unexpected error = %v", err)
+			}
+			if user.PhoneNumber != phoneNumber {
+				t.Errorf("Create() left PhoneNumber = %q, want %q", user.PhoneNumber, phoneNumber)
+			}
+
+			// Nothing at rest may contain the raw number
+			var stored model.User
+			if err := db.First(&stored, user.ID).Error; err != nil {
+				t.Fatalf("Failed to load stored user: %v", err)
+			}
+			if stored.PhoneNumber != protector.Hash(phoneNumber) {
+				t.Errorf("Stored phone_number = %q, want the HMAC", stored.PhoneNumber)
+			}
+			if strings.Contains(stored.PhoneNumber+stored.PhoneEncrypted, "4155550100") {
+				t.Error("Raw phone number stored in plaintext")
+			}
+
+			found, err := userRepo.GetByPhoneNumber(context.Background(), phoneNumber)
+			if err != nil {
+				t.Fatalf("GetByPhoneNumber() unexpected error = %v", err)
+			}
+			if found.ID != user.ID || found.PhoneNumber != phoneNumber {
+				t.Errorf("GetByPhoneNumber() = %d %q, want %d %q", found.ID, found.PhoneNumber, user.ID, phoneNumber)
+			}
+
+			if _, err := userRepo.GetByPhoneNumber(context.Background(), "+14155550103"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("GetByPhoneNumber() unknown number error = %v, want %v", err, gorm.ErrRecordNotFound)
+			}
+
+			byID, err := userRepo.GetByID(context.Background(), user.ID)
+			if err != nil {
+				t.Fatalf("GetByID() unexpected error = %v", err)
+			}
+			if byID.PhoneNumber != tt.wantByID {
+				t.Errorf("GetByID() PhoneNumber = %q, want %q", byID.PhoneNumber, tt.wantByID)
+			}
+
+			users, total, err := userRepo.GetUsers(context.Background(), 1, 10, phoneNumber, "")
+			if err != nil || total != 1 || len(users) != 1 || users[0].ID != user.ID {
+				t.Errorf("GetUsers() exact search = %v, %d, %v, want the user", users, total, err)
+			}
+			if _, _, err := userRepo.GetUsers(context.Background(), 1, 10, "12345", ""); !errors.Is(err, apperrors.ErrInvalidSearchQuery) {
+				t.Errorf("GetUsers() partial search error = %v, want %v", err, apperrors.ErrInvalidSearchQuery)
+			}
+			if _, _, err := userRepo.GetUsers(context.Background(), 1, 10, "", "-phone_number"); !errors.Is(err, apperrors.ErrInvalidSort) {
+				t.Errorf("GetUsers() phone number sort error = %v, want %v", err, apperrors.ErrInvalidSort)
+			}
+
+			// A changed number is protected the same way
+			if err := userRepo.UpdatePhoneNumber(context.Background(), user.ID, "+14155550101"); err != nil {
+				t.Fatalf("UpdatePhoneNumber() unexpected error = %v", err)
+			}
+			db.First(&stored, user.ID)
+			if stored.PhoneNumber != protector.Hash("+14155550101") || strings.Contains(stored.PhoneEncrypted, "4155550101") {
+				t.Errorf("Stored phone_number after change = %q, want the HMAC of the new number", stored.PhoneNumber)
+			}
+			if found, err := userRepo.GetByPhoneNumber(context.Background(), "+14155550101"); err != nil || found.ID != user.ID {
+				t.Errorf("GetByPhoneNumber() after change = %v, %v, want user %d", found, err, user.ID)
+			}
+
+			// HMACs cannot be normalized, so the migration listing is refused
+			if _, err := userRepo.ListPhoneNumbers(context.Background(), 0, 10); !errors.Is(err, apperrors.ErrPhonesHashed) {
+				t.Errorf("ListPhoneNumbers() error = %v, want %v", err, apperrors.ErrPhonesHashed)
+			}
+
+			// Email sign-ups store no phone number, not an HMAC of an empty one
+			for _, email := range []string{"a@example.com", "b@example.com"} {
+				if err := userRepo.Create(context.Background(), &model.User{Email: email}); err != nil {
+					t.Fatalf("Create() email user unexpected error = %v", err)
+				}
+			}
+			byEmail, err := userRepo.GetByEmail(context.Background(), "b@example.com")
+			if err != nil {
+				t.Fatalf("GetByEmail() unexpected error = %v", err)
+			}
+			if byEmail.PhoneNumber != "" {
+				t.Errorf("GetByEmail() PhoneNumber = %q, want empty", byEmail.PhoneNumber)
+			}
+		})
+	}
+}
+
+// countingUserRepository counts the lookups by ID that reach the wrapped repository
+type countingUserRepository struct {
+	UserRepository
+	getByIDCalls int
+}
+
+func (r *countingUserRepository) GetByID(ctx context.Context, id uint) (*model.User, error) {
+	r.getByIDCalls++
+	return r.UserRepository.GetByID(ctx, id)
+}
+
+func TestCachedUserRepository(t *testing.T) {
+	baseRepo, _ := createTestUserRepository(t)
+	counting := &countingUserRepository{UserRepository: baseRepo}
+	userRepo := NewCachedUserRepository(counting, time.Minute)
+
+	user := &model.User{PhoneNumber: "+14155550100", Status: model.UserStatusActive}
+	if err := baseRepo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+
+	// Sign-in looks the user up by number and stamps the login
+	if _, err := userRepo.GetByPhoneNumber(context.Background(), user.PhoneNumber); err != nil {
+		t.Fatalf("GetByPhoneNumber() unexpected error = %v", err)
+	}
+	if err := userRepo.TouchLastLogin(context.Background(), user.ID); err != nil {
+		t.Fatalf("TouchLastLogin() unexpected error = %v", err)
+	}
+
+	profile, err := userRepo.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error = %v", err)
+	}
+	if counting.getByIDCalls != 0 {
+		t.Errorf("Base GetByID() calls = %d, want 0 right after sign-in", counting.getByIDCalls)
+	}
+	if profile.PhoneNumber != user.PhoneNumber || profile.LastLoginAt == nil {
+		t.Errorf("Cached profile = %+v, want the number and last login", profile)
+	}
+
+	// Callers changing what they got back leave the cache alone
+	profile.Status = model.UserStatusSuspended
+	if again, _ := userRepo.GetByID(context.Background(), user.ID); again.Status != model.UserStatusActive {
+		t.Errorf("Cached status = %q after a caller changed its copy, want %q", again.Status, model.UserStatusActive)
+	}
+
+	// A profile update drops the entry
+	if err := userRepo.UpdatePhoneNumber(context.Background(), user.ID, "+14155550101"); err != nil {
+		t.Fatalf("UpdatePhoneNumber() unexpected error = %v", err)
+	}
+	updated, err := userRepo.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error = %v", err)
+	}
+	if counting.getByIDCalls != 1 || updated.PhoneNumber != "+14155550101" {
+		t.Errorf("After update: base calls = %d, phone = %q, want 1 and the new number", counting.getByIDCalls, updated.PhoneNumber)
+	}
+
+	// Entries expire after the TTL
+	shortRepo := NewCachedUserRepository(counting, 10*time.Millisecond)
+	if _, err := shortRepo.GetByPhoneNumber(context.Background(), "+14155550101"); err != nil {
+		t.Fatalf("GetByPhoneNumber() unexpected error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := shortRepo.GetByID(context.Background(), user.ID); err != nil || counting.getByIDCalls != 2 {
+		t.Errorf("GetByID() after expiry: err = %v, base calls = %d, want 2", err, counting.getByIDCalls)
+	}
+}
+
+func TestCachedUserRepository_WriteOnlyPrivacy(t *testing.T) {
+	const phoneNumber = "+14155550100"
+
+	baseRepo, _ := createTestUserRepository(t)
+	counting := &countingUserRepository{UserRepository: baseRepo}
+	protector, err := utils.NewPhoneProtector("test-hmac-key", "")
+	if err != nil {
+		t.Fatalf("NewPhoneProtector() unexpected error = %v", err)
+	}
+	// Stacked as cmd/main.go does: the cache holds rows as stored
+	userRepo := NewPrivateUserRepository(NewCachedUserRepository(counting, time.Minute), protector)
+
+	user := &model.User{PhoneNumber: phoneNumber, Status: model.UserStatusActive}
+	if err := userRepo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+	found, err := userRepo.GetByPhoneNumber(context.Background(), phoneNumber)
+	if err != nil {
+		t.Fatalf("GetByPhoneNumber() unexpected error = %v", err)
+	}
+	if found.PhoneNumber != phoneNumber {
+		t.Errorf("GetByPhoneNumber() phone = %q, want the number looked up", found.PhoneNumber)
+	}
+
+	// The number a caller looked the user up by is never served from the cache
+	profile, err := userRepo.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error = %v", err)
+	}
+	if counting.getByIDCalls != 0 {
+		t.Errorf("Base GetByID() calls = %d, want 0 right after the lookup", counting.getByIDCalls)
+	}
+	if profile.PhoneNumber != "" {
+		t.Errorf("Cached profile phone = %q, want it blank in write-only mode", profile.PhoneNumber)
+	}
+}
+
+func TestUserRepository_CancelledContext(t *testing.T) {
+	userRepo, _ := createTestUserRepository(t)
+	user := &model.User{PhoneNumber: "+14155550100"}
+	if err := userRepo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := userRepo.GetByID(ctx, user.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetByID() error = %v, want context.Canceled", err)
+	}
+}
@@ -1,16 +1,24 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/subtle"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/ehsanshojaei/go-otp-auth/internal/config"
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
 	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
 	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
 	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/totp"
 	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
 	"gorm.io/gorm"
 )
@@ -18,129 +26,1233 @@ import (
 // Re-export errors for backward compatibility
 var (
 	ErrInvalidOTP         = apperrors.ErrInvalidOTP
-	ErrOTPExpired        = apperrors.ErrOTPExpired
-	ErrTooManyAttempts   = apperrors.ErrTooManyAttempts
-	ErrRateLimitExceeded = apperrors.ErrRateLimitExceeded
+	ErrOTPExpired         = apperrors.ErrOTPExpired
+	ErrTooManyAttempts    = apperrors.ErrTooManyAttempts
+	ErrRateLimitExceeded  = apperrors.ErrRateLimitExceeded
 	ErrInvalidPhoneNumber = apperrors.ErrInvalidPhoneNumber
+	ErrDeviceMismatch     = apperrors.ErrDeviceMismatch
+	ErrTokenIssuance      = apperrors.ErrTokenIssuance
+	ErrQuietHours         = apperrors.ErrQuietHours
+	ErrInvalidFormToken   = apperrors.ErrInvalidFormToken
+	ErrInvalidSearchQuery = apperrors.ErrInvalidSearchQuery
+	ErrInvalidSort        = apperrors.ErrInvalidSort
+	ErrAccountLocked      = apperrors.ErrAccountLocked
+	ErrServiceUnavailable = apperrors.ErrServiceUnavailable
+	ErrVerifyTooSoon      = apperrors.ErrVerifyTooSoon
+	ErrOTPMistyped        = apperrors.ErrOTPMistyped
+	ErrAccountSuspended   = apperrors.ErrAccountSuspended
+	ErrAccountDeactivated = apperrors.ErrAccountDeactivated
+	ErrAccountPending     = apperrors.ErrAccountPending
+	ErrInvalidRefresh     = apperrors.ErrInvalidRefresh
+	ErrResendTooSoon      = apperrors.ErrResendTooSoon
+	ErrTOTPEnrolled       = apperrors.ErrTOTPEnrolled
+	ErrInvalidEmail       = apperrors.ErrInvalidEmail
+	ErrIdentifierConflict = apperrors.ErrIdentifierConflict
+	ErrEmailDisabled      = apperrors.ErrEmailDisabled
+	ErrPhoneNumberTaken   = apperrors.ErrPhoneNumberTaken
+	ErrSamePhoneNumber    = apperrors.ErrSamePhoneNumber
+	ErrAccountDeleted     = apperrors.ErrAccountDeleted
+	ErrSessionNotFound    = apperrors.ErrSessionNotFound
+	ErrPhonesHashed       = apperrors.ErrPhonesHashed
 )
 
 type AuthService interface {
-	SendOTP(phoneNumber string) error
-	VerifyOTP(phoneNumber, otpCode string) (*model.AuthResponse, error)
+	SendOTP(ctx context.Context, req *model.SendOTPRequest) (*model.SendOTPResponse, error)
+	VerifyOTP(ctx context.Context, req *model.VerifyOTPRequest) (*model.AuthResponse, error)
+	OTPStatus(ctx context.Context, phoneNumber string) (*model.OTPStatusResponse, error)
+	Limits(ctx context.Context, userID uint) (*model.LimitsResponse, error)
+	SendPhoneChangeOTP(ctx context.Context, userID uint, req *model.UpdatePhoneRequest) (*model.SendOTPResponse, error)
+	ChangePhoneNumber(ctx context.Context, userID uint, req *model.UpdatePhoneRequest) (*model.AuthResponse, error)
+	DeleteAccount(ctx context.Context, userID uint) error
+	RefreshToken(ctx context.Context, req *model.RefreshTokenRequest) (*model.RefreshTokenResponse, error)
+}
+
+// TokenGenerator issues and refreshes tokens for verified users
+type TokenGenerator interface {
+	GenerateTokenPair(userID uint, phoneNumber, role string) (accessToken, refreshToken string, err error)
+	GenerateAccessToken(userID uint, phoneNumber, role string) (string, error)
+	ValidateRefreshToken(refreshToken string) (*jwt.Claims, error)
 }
 
 type authService struct {
-	userRepo     repository.UserRepository
-	otpRepo      repository.OTPRepository
-	jwtManager   *jwt.JWTManager
-	config       *config.Config
+	userRepo   repository.UserRepository
+	otpRepo    repository.OTPRepository
+	sender     OTPSender
+	jwtManager TokenGenerator
+	config     *config.Config
+	quietHours *utils.QuietHours
+	senderIDs  *utils.SenderIDs
+
+	// emailSender is nil when email sign-in is turned off
+	emailSender EmailSender
+
+	// attemptRepo keeps the verification history; nil records nothing
+	attemptRepo repository.OTPAttemptRepository
+
+	// voice is the SMS provider's calling side, nil when it cannot place calls
+	voice      VoiceCaller
+	escalation []string
+
+	displayMessage *template.Template
+	welcomeMessage *template.Template
+
+	// alphabet codes are drawn from; the Luhn check digit only applies to digits
+	alphabet   string
+	checkDigit bool
+
+	// entropy feeds OTP generation; tests swap it for a deterministic reader
+	entropy io.Reader
+	// background runs work off the request path; tests swap it to run inline
+	background func(func())
+}
+
+// welcomeMessageData is exposed to the WELCOME_SMS_TEMPLATE template
+type welcomeMessageData struct {
+	PhoneNumber string
 }
 
-func NewAuthService(userRepo repository.UserRepository, otpRepo repository.OTPRepository, jwtManager *jwt.JWTManager, config *config.Config) AuthService {
+// displayMessageData is exposed to the OTP_DISPLAY_MESSAGE_TEMPLATE template
+type displayMessageData struct {
+	Destination   string
+	Length        int
+	ExpiryMinutes int
+}
+
+func NewAuthService(userRepo repository.UserRepository, otpRepo repository.OTPRepository, attemptRepo repository.OTPAttemptRepository, sender OTPSender, emailSender EmailSender, jwtManager TokenGenerator, config *config.Config) AuthService {
+	quietHours, err := utils.ParseQuietHours(config.OTP.QuietHours, config.OTP.QuietHoursTimezones, config.OTP.QuietHoursDefaultTimezone)
+	if err != nil {
+		log.Printf("Quiet hours disabled: %v", err)
+	}
+
+	senderIDs, err := utils.ParseSenderIDs(config.OTP.SenderIDs, config.OTP.DefaultSenderID)
+	if err != nil {
+		log.Printf("Regional sender IDs disabled: %v", err)
+		senderIDs, _ = utils.ParseSenderIDs(nil, config.OTP.DefaultSenderID)
+	}
+
+	var displayMessage *template.Template
+	if config.OTP.DisplayMessageTemplate != "" {
+		displayMessage, err = template.New("display_message").Option("missingkey=error").Parse(config.OTP.DisplayMessageTemplate)
+		if err != nil {
+			log.Printf("Display message disabled: %v", err)
+		}
+	}
+
+	alphabet := utils.DigitAlphabet
+	if config.OTP.Alphabet != "" {
+		if err := utils.ValidateOTPAlphabet(config.OTP.Alphabet); err != nil {
+			log.Printf("OTP alphabet ignored, using digits: %v", err)
+		} else {
+			alphabet = config.OTP.Alphabet
+		}
+	}
+	checkDigit := config.OTP.CheckDigit
+	if checkDigit && alphabet != utils.DigitAlphabet {
+		log.Printf("OTP check digit disabled: it needs the digit alphabet")
+		checkDigit = false
+	}
+
+	var welcomeMessage *template.Template
+	if config.User.WelcomeSMSEnabled {
+		welcomeMessage, err = template.New("welcome_message").Option("missingkey=error").Parse(config.User.WelcomeSMSTemplate)
+		if err != nil {
+			log.Printf("Welcome SMS disabled: %v", err)
+		}
+	}
+
+	voice, _ := sender.(VoiceCaller)
+	escalation := parseEscalationOrder(config.OTP.EscalationOrder, sender, voice != nil)
+
 	return &authService{
-		userRepo:   userRepo,
-		otpRepo:    otpRepo,
-		jwtManager: jwtManager,
-		config:     config,
+		userRepo:       userRepo,
+		otpRepo:        otpRepo,
+		sender:         sender,
+		emailSender:    emailSender,
+		attemptRepo:    attemptRepo,
+		voice:          voice,
+		escalation:     escalation,
+		jwtManager:     jwtManager,
+		config:         config,
+		quietHours:     quietHours,
+		senderIDs:      senderIDs,
+		displayMessage: displayMessage,
+		welcomeMessage: welcomeMessage,
+		alphabet:       alphabet,
+		checkDigit:     checkDigit,
+		entropy:        rand.Reader,
+		background:     func(f func()) { go f() },
 	}
 }
 
-func (s *authService) SendOTP(phoneNumber string) error {
-	phoneNumber, err := utils.ValidateAndNormalizePhone(phoneNumber)
+func (s *authService) SendOTP(ctx context.Context, req *model.SendOTPRequest) (*model.SendOTPResponse, error) {
+	target, err := s.resolveTarget(req.PhoneNumber, req.Email)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Unknown numbers and addresses may still register; existing accounts must be active
+	user, err := s.findUser(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		if err := CheckAccountStatus(user.Status); err != nil {
+			return nil, err
+		}
+		// Enrolled users read their codes from an authenticator app instead
+		if s.config.OTP.Mode == config.OTPModeTOTP && user.TOTPSecret != "" {
+			return nil, ErrTOTPEnrolled
+		}
+	}
+
+	return s.send(ctx, target, user, req)
+}
+
+// send runs the delivery pipeline for a target: quiet hours, limits, cooldown,
+// code generation and escalation. user is the account signed in with the
+// target, or nil when there is none.
+func (s *authService) send(ctx context.Context, target otpTarget, user *model.User, req *model.SendOTPRequest) (*model.SendOTPResponse, error) {
+	key := target.key()
+
+	// Quiet hours hold back SMS only
+	if target.phoneNumber != "" && s.quietHours.Active(target.phoneNumber, time.Now()) {
+		return nil, ErrQuietHours
 	}
 
-	// Check rate limiting
-	count, err := s.otpRepo.GetRateLimitCount(phoneNumber)
+	if err := s.checkVerifyBudget(ctx, key); err != nil {
+		return nil, err
+	}
+
+	// Check and take the rate limit in one step, so concurrent requests cannot
+	// all pass the check; a send that ends up not counting hands it back
+	count, err := s.reserveRateLimit(ctx, key)
 	if err != nil {
-		return fmt.Errorf("failed to check rate limit: %w", err)
+		return nil, err
 	}
-	if count >= s.config.OTP.MaxAttempts {
-		return ErrRateLimitExceeded
+	charged := false
+	defer func() {
+		if !charged {
+			s.refundRateLimit(ctx, key)
+		}
+	}()
+
+	// Only one instance in the cluster sends to a phone at a time; a concurrent
+	// request reports the same success as the send already in flight
+	if s.config.OTP.SendLockTTL > 0 {
+		lockToken, err := s.otpRepo.AcquireSendLock(ctx, key, s.config.OTP.SendLockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if lockToken == "" {
+			return &model.SendOTPResponse{DisplayMessage: s.renderDisplayMessage(target)}, nil
+		}
+		defer func() {
+			if err := s.otpRepo.ReleaseSendLock(context.WithoutCancel(ctx), key, lockToken); err != nil {
+				log.Printf("Failed to release send lock: %v", err)
+			}
+		}()
 	}
 
 	// Generate and store OTP
-	otpCode, err := utils.GenerateOTP(s.config.OTP.Length)
+	otpCode, err := utils.GenerateOTPWithAlphabetFrom(s.entropy, s.config.OTP.Length, s.alphabet)
 	if err != nil {
-		return fmt.Errorf("failed to generate OTP: %w", err)
+		return nil, fmt.Errorf("failed to generate OTP: %w", err)
+	}
+	if s.checkDigit {
+		otpCode += string(utils.LuhnCheckDigit(otpCode))
 	}
 
-	if err := s.otpRepo.StoreOTP(phoneNumber, otpCode, s.config.OTP.ExpiryMinutes); err != nil {
-		return fmt.Errorf("failed to store OTP: %w", err)
+	// A pending OTP means this is a resend within the same session
+	// An evicted OTP cannot be resent, so the new one starts a fresh session
+	existingOTP, err := s.otpRepo.GetOTP(ctx, key)
+	if err != nil && !errors.Is(err, apperrors.ErrOTPEvicted) {
+		return nil, fmt.Errorf("failed to get OTP: %w", err)
 	}
 
-	if err := s.otpRepo.IncrementRateLimit(phoneNumber, int(s.config.OTP.RateLimitWindow.Minutes())); err != nil {
-		return fmt.Errorf("failed to increment rate limit: %w", err)
+	// The cooldown runs from when the pending OTP was sent, which its expiry
+	// gives away; once that OTP is consumed or expires the next send is free
+	if existingOTP != nil {
+		cooldown, err := s.resendCooldown(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		sentAt := existingOTP.ExpiresAt.Add(-time.Duration(s.config.OTP.ExpiryMinutes) * time.Minute)
+		if wait := time.Until(sentAt.Add(cooldown)); cooldown > 0 && wait > 0 {
+			return nil, &apperrors.RetryAfterError{Err: ErrResendTooSoon, RetryAfter: wait}
+		}
 	}
 
-	utils.LogOTP(phoneNumber, otpCode)
-	return nil
+	correlationID, err := utils.GenerateCorrelationID()
+	if err != nil {
+		return nil, err
+	}
+
+	otp := &model.OTP{
+		PhoneNumber:   key,
+		Code:          otpCode,
+		CorrelationID: correlationID,
+	}
+	if len(s.config.OTP.HashKeys) > 0 {
+		otp.Code = utils.HashOTPCode(s.config.OTP.HashKeys[0], key, otpCode)
+	}
+	if existingOTP != nil {
+		otp.Resends = existingOTP.Resends + 1
+	}
+	if s.config.OTP.BindDevice {
+		otp.DeviceHash = utils.HashDeviceID(req.DeviceID)
+	}
+
+	var formToken string
+	if s.config.OTP.FormToken {
+		formToken, err = utils.GenerateFormToken()
+		if err != nil {
+			return nil, err
+		}
+		otp.FormHash = utils.HashFormToken(formToken)
+	}
+
+	// Invalidate the pending OTP, and its attempts counter with it, rather than
+	// relying on the new one landing on the same key
+	if existingOTP != nil {
+		if err := s.otpRepo.DeleteOTP(ctx, key); err != nil {
+			return nil, fmt.Errorf("failed to invalidate OTP: %w", err)
+		}
+	}
+	if err := s.otpRepo.StoreOTP(ctx, otp, s.config.OTP.ExpiryMinutes); err != nil {
+		return nil, fmt.Errorf("failed to store OTP: %w", err)
+	}
+
+	// By default every attempt counts; with OTP_FREE_RESEND_ON_FAILURE only a
+	// successful handoff to the provider does, so retrying a failed send is free
+	if !s.config.OTP.FreeResendOnFailure {
+		charged = true
+		s.chargeRateLimit(ctx, key, count)
+	}
+
+	destination, channel := s.escalate(target, user, otp.Resends)
+	if err := s.deliver(ctx, destination, channel, otpCode); err != nil {
+		return nil, fmt.Errorf("failed to send OTP: %w", err)
+	}
+
+	if s.config.OTP.FreeResendOnFailure {
+		charged = true
+		s.chargeRateLimit(ctx, key, count)
+	}
+	log.Printf("AUDIT: otp sent: correlation_id=%s resends=%d channel=%s", correlationID, otp.Resends, channel)
+
+	return &model.SendOTPResponse{
+		Channel:                channel,
+		VoiceFallbackAvailable: s.config.OTP.VoiceFallbackAfterResends > 0 && otp.Resends >= s.config.OTP.VoiceFallbackAfterResends,
+		DisplayMessage:         s.renderDisplayMessage(destination),
+		FormToken:              formToken,
+		CorrelationID:          correlationID,
+	}, nil
 }
 
-func (s *authService) VerifyOTP(phoneNumber, otpCode string) (*model.AuthResponse, error) {
+// codeLength is the number of characters the user receives, check digit included
+func (s *authService) codeLength() int {
+	if s.checkDigit {
+		return s.config.OTP.Length + 1
+	}
+	return s.config.OTP.Length
+}
+
+// otpTarget is where a code goes: a phone number, or an address on the email channel
+type otpTarget struct {
+	phoneNumber string
+	email       string
+}
+
+// key stands in for the phone number in OTP and rate-limit state, so the two
+// channels never share a code or a limit
+func (t otpTarget) key() string {
+	if t.email != "" {
+		return utils.EmailIdentifier(t.email)
+	}
+	return t.phoneNumber
+}
+
+// String is the identifier as the user entered it, once normalized
+func (t otpTarget) String() string {
+	if t.email != "" {
+		return t.email
+	}
+	return t.phoneNumber
+}
+
+func (t otpTarget) masked() string {
+	if t.email != "" {
+		return utils.MaskEmail(t.email)
+	}
+	return utils.MaskPhoneNumber(t.phoneNumber)
+}
+
+// resolveTarget validates whichever of phone number and email the request
+// carries. Exactly one is allowed; without an email it is a phone request.
+func (s *authService) resolveTarget(phoneNumber, email string) (otpTarget, error) {
+	if email == "" {
+		phoneNumber, err := s.normalizePhone(phoneNumber)
+		if err != nil {
+			return otpTarget{}, err
+		}
+		return otpTarget{phoneNumber: phoneNumber}, nil
+	}
+
+	if phoneNumber != "" {
+		return otpTarget{}, ErrIdentifierConflict
+	}
+	if s.emailSender == nil {
+		return otpTarget{}, ErrEmailDisabled
+	}
+	email, err := utils.ValidateAndNormalizeEmail(email)
+	if err != nil {
+		return otpTarget{}, err
+	}
+	return otpTarget{email: email}, nil
+}
+
+// normalizePhone is the single path every phone number a client sends takes, so
+// send, verify and status always agree on the key. With OTP_REQUIRE_E164 only
+// input that is already canonical is accepted.
+func (s *authService) normalizePhone(phoneNumber string) (string, error) {
+	normalized, err := utils.ValidateAndNormalizePhone(phoneNumber)
+	if err != nil {
+		return "", err
+	}
+	if s.config.OTP.RequireE164 && normalized != phoneNumber {
+		return "", ErrInvalidPhoneNumber
+	}
+	return normalized, nil
+}
+
+// findUser returns the user signed up with the target, or nil if there is none yet
+func (s *authService) findUser(ctx context.Context, target otpTarget) (*model.User, error) {
+	var user *model.User
 	var err error
-	phoneNumber, err = utils.ValidateAndNormalizePhone(phoneNumber)
+	if target.email != "" {
+		user, err = s.userRepo.GetByEmail(ctx, target.email)
+	} else {
+		user, err = s.userRepo.GetByPhoneNumber(ctx, target.phoneNumber)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// channel is the one a target signs in on
+func (t otpTarget) channel() string {
+	if t.email != "" {
+		return config.ChannelEmail
+	}
+	return config.ChannelSMS
+}
+
+// parseEscalationOrder keeps the known channels of OTP_ESCALATION_ORDER, once
+// each, dropping voice when the SMS provider cannot place calls
+func parseEscalationOrder(order []string, sender OTPSender, canCall bool) []string {
+	var escalation []string
+	for _, channel := range order {
+		channel = strings.ToLower(channel)
+		switch {
+		case channel != config.ChannelSMS && channel != config.ChannelVoice && channel != config.ChannelEmail:
+			log.Printf("OTP escalation channel %q ignored", channel)
+		case channel == config.ChannelVoice && !canCall:
+			log.Printf("OTP escalation skips voice: SMS provider %s cannot place calls", sender.Name())
+		case !slices.Contains(escalation, channel):
+			escalation = append(escalation, channel)
+		}
+	}
+	return escalation
+}
+
+// escalate picks where a send goes: the target's own channel first, then one
+// step further along the escalation order with each resend. Steps the user
+// cannot be reached on are skipped; once the order runs out the last one repeats.
+func (s *authService) escalate(target otpTarget, user *model.User, resends int) (otpTarget, string) {
+	start := slices.Index(s.escalation, target.channel())
+	if start < 0 || resends == 0 {
+		return target, target.channel()
+	}
+
+	// The account may hold the other identifier, e.g. an address for a phone sign-in
+	phoneNumber, email := target.phoneNumber, target.email
+	if user != nil {
+		if phoneNumber == "" {
+			phoneNumber, _ = utils.ValidateAndNormalizePhone(user.PhoneNumber)
+		}
+		if email == "" && s.emailSender != nil {
+			email, _ = utils.ValidateAndNormalizeEmail(user.Email)
+		}
+	}
+	// Quiet hours hold back calls as well as SMS
+	if phoneNumber != "" && s.quietHours.Active(phoneNumber, time.Now()) {
+		phoneNumber = ""
+	}
+
+	destination, channel := target, target.channel()
+	for _, next := range s.escalation[start+1:] {
+		if resends == 0 {
+			break
+		}
+		switch {
+		case next == config.ChannelEmail && email != "":
+			destination = otpTarget{email: email}
+		case next != config.ChannelEmail && phoneNumber != "":
+			destination = otpTarget{phoneNumber: phoneNumber}
+		default:
+			continue
+		}
+		channel = next
+		resends--
+	}
+	return destination, channel
+}
+
+// deliver sends the code to the target over the given channel
+func (s *authService) deliver(ctx context.Context, target otpTarget, channel, code string) error {
+	switch channel {
+	case config.ChannelEmail:
+		return s.emailSender.Send(target.email, code)
+	case config.ChannelVoice:
+		return s.voice.Call(ctx, target.phoneNumber, code)
+	default:
+		return s.sender.Send(ctx, s.senderIDs.For(target.phoneNumber), target.phoneNumber, code)
+	}
+}
+
+// sendWelcomeMessage greets a newly registered user without delaying the auth response
+func (s *authService) sendWelcomeMessage(ctx context.Context, phoneNumber string) {
+	if s.welcomeMessage == nil {
+		return
+	}
+
+	var message strings.Builder
+	if err := s.welcomeMessage.Execute(&message, welcomeMessageData{PhoneNumber: phoneNumber}); err != nil {
+		log.Printf("Failed to render welcome SMS: %v", err)
+		return
+	}
+
+	// The SMS goes out after the response, so it must not inherit the request's cancellation
+	ctx = context.WithoutCancel(ctx)
+	s.background(func() {
+		if err := s.sender.SendMessage(ctx, s.senderIDs.For(phoneNumber), phoneNumber, message.String()); err != nil {
+			log.Printf("Failed to send welcome SMS: %v", err)
+		}
+	})
+}
+
+// renderDisplayMessage builds the ready-to-show confirmation for the send response
+func (s *authService) renderDisplayMessage(target otpTarget) string {
+	if s.displayMessage == nil {
+		return ""
+	}
+
+	var message strings.Builder
+	err := s.displayMessage.Execute(&message, displayMessageData{
+		Destination:   target.masked(),
+		Length:        s.codeLength(),
+		ExpiryMinutes: s.config.OTP.ExpiryMinutes,
+	})
+	if err != nil {
+		log.Printf("Failed to render display message: %v", err)
+		return ""
+	}
+	return message.String()
+}
+
+// reserveRateLimit takes one send from the phone's window, or fails with
+// ErrRateLimitExceeded when none are left
+func (s *authService) reserveRateLimit(ctx context.Context, phoneNumber string) (int, error) {
+	count, ok, err := s.otpRepo.ReserveRateLimit(ctx, phoneNumber, s.config.OTP.MaxAttempts, s.config.OTP.RateLimitWindow)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if !ok {
+		// The window restarts with every send, so its TTL is when sending works again
+		wait, err := s.otpRepo.GetRateLimitTTL(ctx, phoneNumber)
+		if err != nil {
+			log.Printf("Failed to get rate limit remaining: %v", err)
+			return 0, ErrRateLimitExceeded
+		}
+		return 0, &apperrors.RetryAfterError{Err: ErrRateLimitExceeded, RetryAfter: wait}
+	}
+	return count, nil
+}
+
+// refundRateLimit gives back a reserved send that does not count, even when
+// the request was cancelled
+func (s *authService) refundRateLimit(ctx context.Context, phoneNumber string) {
+	if err := s.otpRepo.RefundRateLimit(context.WithoutCancel(ctx), phoneNumber); err != nil {
+		log.Printf("Failed to refund rate limit: %v", err)
+	}
+}
+
+// chargeRateLimit keeps a reserved send; the one that reaches the limit starts
+// the backoff
+func (s *authService) chargeRateLimit(ctx context.Context, phoneNumber string, count int) {
+	if s.config.OTP.RateLimitBackoff && count >= s.config.OTP.MaxAttempts {
+		if err := s.applyRateLimitBackoff(ctx, phoneNumber); err != nil {
+			log.Printf("Failed to apply rate limit backoff: %v", err)
+		}
+	}
+}
+
+// applyRateLimitBackoff doubles the rate-limit window for every limit hit within the decay period
+func (s *authService) applyRateLimitBackoff(ctx context.Context, phoneNumber string) error {
+	hits, err := s.otpRepo.IncrementRateLimitPenalty(ctx, phoneNumber)
+	if err != nil {
+		return err
+	}
+
+	multiplier := 1
+	for i := 1; i < hits && multiplier*2 <= s.config.OTP.RateLimitBackoffMaxMultiplier; i++ {
+		multiplier *= 2
+	}
+
+	window := s.config.OTP.RateLimitWindow * time.Duration(multiplier)
+	return s.otpRepo.ExtendRateLimit(ctx, phoneNumber, window, window+s.config.OTP.RateLimitBackoffDecay)
+}
+
+func (s *authService) VerifyOTP(ctx context.Context, req *model.VerifyOTPRequest) (response *model.AuthResponse, err error) {
+	target, err := s.resolveTarget(req.PhoneNumber, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	key := target.key()
+	if s.attemptRepo != nil {
+		defer func() { s.recordAttempt(ctx, target, req, response, err) }()
+	}
+
+	// Enrolled users verify authenticator codes; everyone else uses the SMS flow
+	if s.config.OTP.Mode == config.OTPModeTOTP {
+		user, err := s.findUser(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil && user.TOTPSecret != "" {
+			return s.verifyTOTP(ctx, key, user, req.OTPCode)
+		}
+	}
+
+	if err := s.checkOTP(ctx, key, req); err != nil {
+		return nil, err
+	}
+
+	// Get or create user
+	user, err := s.findUser(ctx, target)
 	if err != nil {
 		return nil, err
 	}
-	
-	otpCode, err = utils.ValidateOTPCode(otpCode, s.config.OTP.Length)
+
+	if user == nil {
+		user = &model.User{PhoneNumber: target.phoneNumber, Email: target.email, Status: model.UserStatusActive, Role: s.signUpRole(target)}
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		if target.phoneNumber != "" {
+			s.sendWelcomeMessage(ctx, target.phoneNumber)
+		}
+	} else if err := CheckAccountStatus(user.Status); err != nil {
+		return nil, err
+	}
+
+	response, err = s.issueTokens(ctx, user)
 	if err != nil {
 		return nil, err
 	}
 
+	// Enroll only once tokens are out, so a failed sign-in never leaves the
+	// user enrolled without having seen the secret
+	if s.config.OTP.Mode == config.OTPModeTOTP && user.TOTPSecret == "" {
+		response.TOTP = s.enrollTOTP(ctx, target.String(), user)
+	}
+	return response, nil
+}
+
+// recordAttempt adds a verification to the attempt history. The history is
+// best effort: failing to write it is logged and never fails the sign-in.
+func (s *authService) recordAttempt(ctx context.Context, target otpTarget, req *model.VerifyOTPRequest, response *model.AuthResponse, verifyErr error) {
+	// The attempt happened even if the client has since gone away
+	ctx = context.WithoutCancel(ctx)
+
+	attempt := &model.OTPAttempt{
+		PhoneNumber: target.key(),
+		Success:     verifyErr == nil,
+		IP:          req.ClientIP,
+		UserAgent:   truncate(req.UserAgent, maxUserAgentLength),
+	}
+	if response != nil {
+		attempt.UserID = &response.User.ID
+	} else if user, err := s.findUser(ctx, target); err == nil && user != nil {
+		attempt.UserID = &user.ID
+	}
+
+	if err := s.attemptRepo.Create(ctx, attempt); err != nil {
+		log.Printf("Failed to record OTP attempt: %v", err)
+	}
+}
+
+// Clients control these values, so cap what one attempt or session can store
+const (
+	maxUserAgentLength  = 512
+	maxDeviceNameLength = 64
+)
+
+// truncate cuts value to at most max bytes without splitting a UTF-8 sequence
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return strings.ToValidUTF8(value[:max], "")
+}
+
+// checkOTP verifies the code against the OTP stored under key and consumes it,
+// charging failures against the attempt, backoff and verify budget limits
+func (s *authService) checkOTP(ctx context.Context, key string, req *model.VerifyOTPRequest) error {
+	otpCode := req.OTPCode
+
+	if s.config.OTP.ExtractDigits && s.alphabet == utils.DigitAlphabet {
+		if extracted, ok := utils.ExtractOTPCode(otpCode, s.codeLength()); ok {
+			otpCode = extracted
+		}
+	}
+
+	otpCode, err := utils.ValidateOTPCode(otpCode, s.codeLength(), s.alphabet)
+	if err != nil {
+		return err
+	}
+
+	// A failed checksum is a typo, not a guess, so it costs no attempt
+	if s.checkDigit && !utils.ValidLuhn(otpCode) {
+		return ErrOTPMistyped
+	}
+
+	if err := s.checkVerifyBudget(ctx, key); err != nil {
+		return err
+	}
+
 	// Get stored OTP
-	storedOTP, err := s.otpRepo.GetOTP(phoneNumber)
+	storedOTP, err := s.otpRepo.GetOTP(ctx, key)
+	if errors.Is(err, apperrors.ErrOTPEvicted) {
+		if s.config.OTP.EvictionUnavailable {
+			return ErrServiceUnavailable
+		}
+		return ErrOTPExpired
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get OTP: %w", err)
+		return fmt.Errorf("failed to get OTP: %w", err)
 	}
 
 	if storedOTP == nil {
-		return nil, ErrOTPExpired
+		auditVerify(req.CorrelationID, "expired")
+		return ErrOTPExpired
+	}
+
+	// The stored ID is authoritative; the client's echo only matters once the OTP is gone
+	correlationID := storedOTP.CorrelationID
+	if correlationID == "" {
+		correlationID = req.CorrelationID
 	}
 
 	// Check if too many attempts
 	if storedOTP.Attempts >= s.config.OTP.MaxAttempts {
-		s.otpRepo.DeleteOTP(phoneNumber)
-		return nil, ErrTooManyAttempts
+		s.otpRepo.DeleteOTP(ctx, key)
+		auditVerify(correlationID, "too_many_attempts")
+		return ErrTooManyAttempts
+	}
+
+	if err := s.checkVerifyBackoff(ctx, key); err != nil {
+		return err
+	}
+
+	// A missing or wrong form token means the form was not served by us; the
+	// code is not checked and no attempt is consumed
+	if s.config.OTP.FormToken {
+		formHash := utils.HashFormToken(req.FormToken)
+		if formHash == "" || subtle.ConstantTimeCompare([]byte(storedOTP.FormHash), []byte(formHash)) != 1 {
+			auditVerify(correlationID, "invalid_form_token")
+			return ErrInvalidFormToken
+		}
+	}
+
+	// The attempt is taken before the code is compared, so concurrent guesses
+	// each get their own count and none gets past the limit
+	attempts, err := s.takeAttempt(ctx, key, storedOTP.Attempts)
+	if err != nil {
+		auditVerify(correlationID, "expired")
+		return err
+	}
+	if attempts > s.config.OTP.MaxAttempts {
+		s.otpRepo.DeleteOTP(ctx, key)
+		auditVerify(correlationID, "too_many_attempts")
+		return ErrTooManyAttempts
+	}
+
+	// A code requested from another device counts as a failed attempt
+	if s.config.OTP.BindDevice {
+		deviceHash := utils.HashDeviceID(req.DeviceID)
+		if subtle.ConstantTimeCompare([]byte(storedOTP.DeviceHash), []byte(deviceHash)) != 1 {
+			s.recordFailedAttempt(ctx, key, attempts)
+			auditVerify(correlationID, "device_mismatch")
+			return ErrDeviceMismatch
+		}
 	}
 
 	// Verify OTP using constant-time comparison to prevent timing attacks
-	if subtle.ConstantTimeCompare([]byte(storedOTP.Code), []byte(otpCode)) != 1 {
-		// Increment attempts
-		if err := s.otpRepo.IncrementAttempts(phoneNumber); err != nil {
-			log.Printf("Failed to increment OTP attempts: %v", err)
+	if !s.codeMatches(storedOTP, otpCode) {
+		s.recordFailedAttempt(ctx, key, attempts)
+		auditVerify(correlationID, "invalid_code")
+
+		// The attempt that uses up the last try ends the OTP right away
+		remaining := s.config.OTP.MaxAttempts - attempts
+		if remaining <= 0 {
+			s.otpRepo.DeleteOTP(ctx, key)
+			auditVerify(correlationID, "too_many_attempts")
+			return ErrTooManyAttempts
 		}
-		return nil, ErrInvalidOTP
+		return &apperrors.AttemptsRemainingError{Err: ErrInvalidOTP, Remaining: remaining}
 	}
 
-	// OTP is valid, delete it  
-	if err := s.otpRepo.DeleteOTP(phoneNumber); err != nil {
+	// OTP is valid, delete it
+	if err := s.otpRepo.DeleteOTP(ctx, key); err != nil {
 		log.Printf("Failed to delete OTP: %v", err)
 	}
+	auditVerify(correlationID, "verified")
+	return nil
+}
 
-	// Get or create user
-	user, err := s.userRepo.GetByPhoneNumber(phoneNumber)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+// verifyTOTP signs in an enrolled user with a code from their authenticator
+// app; wrong and replayed codes count against the cumulative verify budget
+func (s *authService) verifyTOTP(ctx context.Context, phoneNumber string, user *model.User, code string) (*model.AuthResponse, error) {
+	if err := CheckAccountStatus(user.Status); err != nil {
+		return nil, err
 	}
 
-	if user == nil {
-		user = &model.User{PhoneNumber: phoneNumber}
-		if err := s.userRepo.Create(user); err != nil {
-			return nil, fmt.Errorf("failed to create user: %w", err)
+	code, err := utils.ValidateOTPCode(code, totp.Digits, utils.DigitAlphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkVerifyBudget(ctx, phoneNumber); err != nil {
+		return nil, err
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), s.config.OTP.TOTPPeriod, s.config.OTP.TOTPSkew)
+	if ok {
+		// A code whose step, or a later one, was already accepted is a replay
+		if ok, err = s.userRepo.ConsumeTOTPStep(ctx, user.ID, step); err != nil {
+			return nil, fmt.Errorf("failed to record TOTP step: %w", err)
 		}
 	}
+	if !ok {
+		s.recordVerifyFailure(ctx, phoneNumber)
+		auditVerify("", "invalid_totp")
+		return nil, ErrInvalidOTP
+	}
+	auditVerify("", "verified_totp")
 
-	// Generate JWT token
-	token, err := s.jwtManager.GenerateToken(user.ID, user.PhoneNumber)
+	return s.issueTokens(ctx, user)
+}
+
+// enrollTOTP gives the user an authenticator secret, labelled with the phone
+// number or address they sign in with. Enrollment is retried on the next SMS
+// sign-in, so a failure is logged rather than failing this one.
+func (s *authService) enrollTOTP(ctx context.Context, account string, user *model.User) *model.TOTPEnrollment {
+	secret, err := totp.GenerateSecret(s.entropy)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		log.Printf("Failed to generate TOTP secret: %v", err)
+		return nil
+	}
+	if err := s.userRepo.SetTOTPSecret(ctx, user.ID, secret); err != nil {
+		log.Printf("Failed to store TOTP secret: %v", err)
+		return nil
+	}
+	user.TOTPSecret = secret
+
+	return &model.TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.config.OTP.TOTPIssuer, account, secret, s.config.OTP.TOTPPeriod),
+	}
+}
+
+// signUpRole bootstraps the first admins: a number listed in ADMIN_PHONE_NUMBERS
+// registers with the admin role, everyone else as a plain user
+func (s *authService) signUpRole(target otpTarget) model.UserRole {
+	if target.phoneNumber != "" && slices.Contains(s.config.Auth.AdminPhoneNumbers, target.phoneNumber) {
+		return model.RoleAdmin
+	}
+	return model.RoleUser
+}
+
+// issueTokens stamps the login and hands out the token pair for a verified user
+func (s *authService) issueTokens(ctx context.Context, user *model.User) (*model.AuthResponse, error) {
+	// Last login is informational; a failed write must not block sign-in
+	if err := s.userRepo.TouchLastLogin(ctx, user.ID); err != nil {
+		log.Printf("Failed to record last login: %v", err)
+	} else {
+		now := time.Now()
+		user.LastLoginAt = &now
+	}
+
+	// Generate JWT token. The OTP is already consumed at this point and is
+	// deliberately not restored, so a failure here asks the user to request
+	// a new code instead of leaving a matched code reusable.
+	phoneClaim, role := s.tokenClaims(user)
+	token, refreshToken, err := s.jwtManager.GenerateTokenPair(user.ID, phoneClaim, role)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenIssuance, err)
 	}
 
 	return &model.AuthResponse{
-		Token: token,
-		User:  user.ToResponse(),
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         user.ToResponse(),
 	}, nil
 }
+
+// RefreshToken trades a refresh token for a new access token without another OTP
+func (s *authService) RefreshToken(ctx context.Context, req *model.RefreshTokenRequest) (*model.RefreshTokenResponse, error) {
+	claims, err := s.jwtManager.ValidateRefreshToken(req.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefresh, err)
+	}
+
+	// The refresh token's claims are as old as the sign-in; the account as it
+	// stands now decides whether it may refresh and what the new token says
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: user no longer exists", ErrInvalidRefresh)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := CheckAccountStatus(user.Status); err != nil {
+		return nil, err
+	}
+
+	phoneClaim, role := s.tokenClaims(user)
+	token, err := s.jwtManager.GenerateAccessToken(user.ID, phoneClaim, role)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenIssuance, err)
+	}
+
+	return &model.RefreshTokenResponse{Token: token}, nil
+}
+
+// tokenClaims is the phone claim and role a token issued to user carries now
+func (s *authService) tokenClaims(user *model.User) (phoneClaim, role string) {
+	phoneClaim = utils.PhoneClaim(s.config.JWT.PhoneClaim, s.config.JWT.SecretKey, user.PhoneNumber)
+	role = string(user.Role)
+	if role == "" {
+		role = string(model.RoleUser)
+	}
+	return phoneClaim, role
+}
+
+// codeMatches compares in constant time; hashed codes are tried against every
+// configured key so codes issued before a key rotation still verify
+func (s *authService) codeMatches(storedOTP *model.OTP, otpCode string) bool {
+	if len(s.config.OTP.HashKeys) == 0 {
+		return subtle.ConstantTimeCompare([]byte(storedOTP.Code), []byte(otpCode)) == 1
+	}
+
+	matched := false
+	for _, key := range s.config.OTP.HashKeys {
+		hash := utils.HashOTPCode(key, storedOTP.PhoneNumber, otpCode)
+		if subtle.ConstantTimeCompare([]byte(storedOTP.Code), []byte(hash)) == 1 {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// auditVerify records a verify outcome under the correlation ID issued on send
+func auditVerify(correlationID, outcome string) {
+	log.Printf("AUDIT: otp verify: correlation_id=%s outcome=%s", correlationID, outcome)
+}
+
+// verifyBackoff is base * 2^attempts, capped at VerifyBackoffMax
+func (s *authService) verifyBackoff(attempts int) time.Duration {
+	delay := s.config.OTP.VerifyBackoffBase
+	for i := 0; i < attempts && delay < s.config.OTP.VerifyBackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, s.config.OTP.VerifyBackoffMax)
+}
+
+// checkVerifyBackoff rejects a verify that arrives before the last failure's backoff elapsed
+func (s *authService) checkVerifyBackoff(ctx context.Context, phoneNumber string) error {
+	if s.config.OTP.VerifyBackoffBase <= 0 {
+		return nil
+	}
+
+	notBefore, err := s.otpRepo.GetVerifyNotBefore(ctx, phoneNumber)
+	if err != nil {
+		return fmt.Errorf("failed to check verify backoff: %w", err)
+	}
+	if wait := time.Until(notBefore); wait > 0 {
+		return &apperrors.RetryAfterError{Err: ErrVerifyTooSoon, RetryAfter: wait}
+	}
+	return nil
+}
+
+// checkVerifyBudget locks the phone out of both send and verify once its failed
+// verifies across all resends reach OTP_CUMULATIVE_VERIFY_BUDGET. The lock lifts
+// when the failure window expires; the error carries the time left.
+func (s *authService) checkVerifyBudget(ctx context.Context, phoneNumber string) error {
+	if s.config.OTP.CumulativeVerifyBudget <= 0 {
+		return nil
+	}
+
+	failures, err := s.otpRepo.GetVerifyFailures(ctx, phoneNumber)
+	if err != nil {
+		return fmt.Errorf("failed to check verify budget: %w", err)
+	}
+	if failures < s.config.OTP.CumulativeVerifyBudget {
+		return nil
+	}
+
+	remaining, err := s.otpRepo.GetVerifyFailuresTTL(ctx, phoneNumber)
+	if err != nil {
+		log.Printf("Failed to get lockout remaining: %v", err)
+		return ErrAccountLocked
+	}
+	return &apperrors.RetryAfterError{Err: ErrAccountLocked, RetryAfter: remaining}
+}
+
+// resendCooldown stretches the base cooldown by the phone's recent failed
+// verifies, so guessing and then resending for a fresh code gets slower
+func (s *authService) resendCooldown(ctx context.Context, phoneNumber string) (time.Duration, error) {
+	cooldown := s.config.OTP.ResendCooldown
+	if s.config.OTP.ResendCooldownPerFailure <= 0 {
+		return cooldown, nil
+	}
+
+	failures, err := s.otpRepo.GetVerifyFailures(ctx, phoneNumber)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get verify failures: %w", err)
+	}
+	cooldown += time.Duration(failures) * s.config.OTP.ResendCooldownPerFailure
+	if limit := s.config.OTP.ResendCooldownMax; limit > 0 && cooldown > limit {
+		cooldown = limit
+	}
+	return cooldown, nil
+}
+
+// takeAttempt charges a verify to the OTP and returns its attempts after it.
+// An OTP consumed since it was read is ErrOTPExpired; when the counter cannot
+// be reached it falls back to the count already read.
+func (s *authService) takeAttempt(ctx context.Context, phoneNumber string, seen int) (int, error) {
+	attempts, err := s.otpRepo.IncrementAttempts(ctx, phoneNumber)
+	if errors.Is(err, ErrOTPExpired) {
+		return 0, err
+	}
+	if err != nil {
+		log.Printf("Failed to increment OTP attempts: %v", err)
+		return seen + 1, nil
+	}
+	return attempts, nil
+}
+
+// recordFailedAttempt charges a failed verify, already counted by takeAttempt,
+// to the per-phone failure count, and pushes back the next verify when backoff is enabled
+func (s *authService) recordFailedAttempt(ctx context.Context, phoneNumber string, attempts int) {
+	if s.config.OTP.VerifyBackoffBase > 0 {
+		if err := s.otpRepo.SetVerifyNotBefore(ctx, phoneNumber, time.Now().Add(s.verifyBackoff(attempts))); err != nil {
+			log.Printf("Failed to set verify backoff: %v", err)
+		}
+	}
+
+	s.recordVerifyFailure(ctx, phoneNumber)
+}
+
+// recordVerifyFailure counts a failed verify per phone, across resends
+func (s *authService) recordVerifyFailure(ctx context.Context, phoneNumber string) {
+	if s.config.OTP.CumulativeVerifyBudget > 0 || s.config.OTP.ResendCooldownPerFailure > 0 {
+		if _, err := s.otpRepo.IncrementVerifyFailures(ctx, phoneNumber, s.config.OTP.RateLimitWindow); err != nil {
+			log.Printf("Failed to increment verify failures: %v", err)
+		}
+	}
+}
+
+// OTPStatus reports whether a code is pending and how many verify attempts it has left
+func (s *authService) OTPStatus(ctx context.Context, phoneNumber string) (*model.OTPStatusResponse, error) {
+	phoneNumber, err := s.normalizePhone(phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := s.otpRepo.Exists(ctx, phoneNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check OTP: %w", err)
+	}
+	if !pending {
+		return &model.OTPStatusResponse{}, nil
+	}
+
+	attempts, err := s.otpRepo.GetAttempts(ctx, phoneNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OTP attempts: %w", err)
+	}
+
+	return &model.OTPStatusResponse{
+		Pending:           true,
+		AttemptsRemaining: max(s.config.OTP.MaxAttempts-attempts, 0),
+	}, nil
+}
+
+// Limits reports the send and verify limits that apply to the user's phone or
+// email right now and how much of each it has left. The number comes from the
+// user record, since the token's phone_number claim may be masked or hashed;
+// write-only privacy mode cannot read it back, so phone users get ErrPhonesHashed.
+func (s *authService) Limits(ctx context.Context, userID uint) (*model.LimitsResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	target := otpTarget{email: user.Email}
+	if user.Email == "" {
+		if user.PhoneNumber == "" {
+			return nil, fmt.Errorf("%w; the limits of user %d cannot be looked up", ErrPhonesHashed, user.ID)
+		}
+		if target.phoneNumber, err = utils.ValidateAndNormalizePhone(user.PhoneNumber); err != nil {
+			return nil, err
+		}
+	}
+	key := target.key()
+
+	sends, err := s.otpRepo.GetRateLimitCount(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	cooldown, err := s.resendCooldown(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := &model.LimitsResponse{
+		SendLimit:             s.config.OTP.MaxAttempts,
+		SendsRemaining:        max(s.config.OTP.MaxAttempts-sends, 0),
+		WindowSeconds:         int(s.config.OTP.RateLimitWindow.Seconds()),
+		VerifyAttemptsPerOTP:  s.config.OTP.MaxAttempts,
+		VerifyBudget:          s.config.OTP.CumulativeVerifyBudget,
+		ResendCooldownSeconds: int(cooldown.Seconds()),
+	}
+
+	if s.config.OTP.CumulativeVerifyBudget > 0 {
+		failures, err := s.otpRepo.GetVerifyFailures(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get verify failures: %w", err)
+		}
+		limits.VerifyBudgetRemaining = max(s.config.OTP.CumulativeVerifyBudget-failures, 0)
+	}
+	return limits, nil
+}
+
+// SendPhoneChangeOTP sends a code to the number the user wants to move to. The
+// account's other identifiers are not offered for escalation: only the new
+// number can prove it is the user's.
+func (s *authService) SendPhoneChangeOTP(ctx context.Context, userID uint, req *model.UpdatePhoneRequest) (*model.SendOTPResponse, error) {
+	target, _, err := s.phoneChangeTarget(ctx, userID, req.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(ctx, target, nil, &model.SendOTPRequest{PhoneNumber: target.phoneNumber, DeviceID: req.DeviceID})
+}
+
+// ChangePhoneNumber verifies the code sent to the new number and moves the user
+// to it. The old number's OTP and rate-limit state is dropped, and fresh tokens
+// carry the new number.
+func (s *authService) ChangePhoneNumber(ctx context.Context, userID uint, req *model.UpdatePhoneRequest) (*model.AuthResponse, error) {
+	target, user, err := s.phoneChangeTarget(ctx, userID, req.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkOTP(ctx, target.key(), &model.VerifyOTPRequest{
+		PhoneNumber: target.phoneNumber,
+		OTPCode:     req.OTPCode,
+		DeviceID:    req.DeviceID,
+		FormToken:   req.FormToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	oldPhone := user.PhoneNumber
+	if err := s.userRepo.UpdatePhoneNumber(ctx, user.ID, target.phoneNumber); err != nil {
+		return nil, err
+	}
+	log.Printf("AUDIT: phone number changed: user_id=%d", user.ID)
+
+	if oldPhone != "" {
+		if err := s.otpRepo.Purge(ctx, oldPhone); err != nil {
+			log.Printf("Failed to purge OTP state of the old number: %v", err)
+		}
+	}
+
+	user.PhoneNumber = target.phoneNumber
+	return s.issueTokens(ctx, user)
+}
+
+// phoneChangeTarget checks that an active user may move to the number and that
+// no other account holds it
+func (s *authService) phoneChangeTarget(ctx context.Context, userID uint, phoneNumber string) (otpTarget, *model.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return otpTarget{}, nil, err
+	}
+	if err := CheckAccountStatus(user.Status); err != nil {
+		return otpTarget{}, nil, err
+	}
+
+	phoneNumber, err = s.normalizePhone(phoneNumber)
+	if err != nil {
+		return otpTarget{}, nil, err
+	}
+
+	// Looked up rather than compared, since write-only privacy mode cannot reveal the current number
+	holder, err := s.findUser(ctx, otpTarget{phoneNumber: phoneNumber})
+	if err != nil {
+		return otpTarget{}, nil, err
+	}
+	if holder != nil && holder.ID == user.ID {
+		return otpTarget{}, nil, ErrSamePhoneNumber
+	}
+	if holder != nil {
+		return otpTarget{}, nil, ErrPhoneNumberTaken
+	}
+	return otpTarget{phoneNumber: phoneNumber}, user, nil
+}
+
+// DeleteAccount removes the user, soft or hard per USER_HARD_DELETE, and drops
+// the OTP and rate-limit state held for their phone number and email address.
+// In write-only privacy mode the number cannot be read back, so its state is
+// left to expire.
+func (s *authService) DeleteAccount(ctx context.Context, userID uint) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(ctx, user.ID); err != nil {
+		return err
+	}
+	log.Printf("AUDIT: account deleted: user_id=%d hard=%t", user.ID, s.config.User.HardDelete)
+
+	if user.PhoneNumber == "" && user.Email == "" {
+		log.Printf("OTP state of deleted user %d cannot be purged in write-only privacy mode and is left to expire", user.ID)
+	}
+	for _, target := range []otpTarget{{phoneNumber: user.PhoneNumber}, {email: user.Email}} {
+		if target.String() == "" {
+			continue
+		}
+		if err := s.otpRepo.Purge(ctx, target.key()); err != nil {
+			log.Printf("Failed to purge OTP state of a deleted account: %v", err)
+		}
+	}
+	return nil
+}
@@ -1,39 +1,67 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"log"
+	"os"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/ehsanshojaei/go-otp-auth/internal/config"
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
 	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/totp"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 // Mock repositories for testing
 type mockUserRepository struct {
-	users map[string]*model.User
+	users  map[string]*model.User
 	nextID uint
 }
 
 func newMockUserRepository() *mockUserRepository {
 	return &mockUserRepository{
-		users: make(map[string]*model.User),
+		users:  make(map[string]*model.User),
 		nextID: 1,
 	}
 }
 
-func (m *mockUserRepository) Create(user *model.User) error {
+func (m *mockUserRepository) Create(ctx context.Context, user *model.User) error {
 	user.ID = m.nextID
 	m.nextID++
 	user.RegisteredAt = time.Now()
+	if user.PhoneNumber == "" {
+		m.users[utils.EmailIdentifier(user.Email)] = user
+		return nil
+	}
 	m.users[user.PhoneNumber] = user
 	return nil
 }
 
-func (m *mockUserRepository) GetByPhoneNumber(phoneNumber string) (*model.User, error) {
+func (m *mockUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, exists := m.users[utils.EmailIdentifier(email)]
+	if !exists {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (m *mockUserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*model.User, error) {
 	user, exists := m.users[phoneNumber]
 	if !exists {
 		return nil, gorm.ErrRecordNotFound
@@ -41,7 +69,7 @@ func (m *mockUserRepository) GetByPhoneNumber(phoneNumber string) (*model.User,
 	return user, nil
 }
 
-func (m *mockUserRepository) GetByID(id uint) (*model.User, error) {
+func (m *mockUserRepository) GetByID(ctx context.Context, id uint) (*model.User, error) {
 	for _, user := range m.users {
 		if user.ID == id {
 			return user, nil
@@ -50,7 +78,48 @@ func (m *mockUserRepository) GetByID(id uint) (*model.User, error) {
 	return nil, gorm.ErrRecordNotFound
 }
 
-func (m *mockUserRepository) GetUsers(page, pageSize int, phoneNumber string) ([]model.User, int64, error) {
+func (m *mockUserRepository) TouchLastLogin(ctx context.Context, id uint) error {
+	user, err := m.GetByID(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user.LastLoginAt = &now
+	return nil
+}
+
+func (m *mockUserRepository) UpdateStatus(ctx context.Context, id uint, status model.UserStatus) error {
+	user, err := m.GetByID(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	user.Status = status
+	return nil
+}
+
+func (m *mockUserRepository) SetTOTPSecret(ctx context.Context, id uint, secret string) error {
+	user, err := m.GetByID(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	return nil
+}
+
+func (m *mockUserRepository) ConsumeTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	user, err := m.GetByID(context.Background(), id)
+	if err != nil {
+		return false, err
+	}
+	if user.TOTPLastStep >= step {
+		return false, nil
+	}
+	user.TOTPLastStep = step
+	return true, nil
+}
+
+func (m *mockUserRepository) GetUsers(ctx context.Context, page, pageSize int, phoneNumber, sort string) ([]model.User, int64, error) {
 	var users []model.User
 	for _, user := range m.users {
 		if phoneNumber == "" || strings.Contains(user.PhoneNumber, phoneNumber) {
@@ -60,31 +129,108 @@ func (m *mockUserRepository) GetUsers(page, pageSize int, phoneNumber string) ([
 	return users, int64(len(users)), nil
 }
 
+func (m *mockUserRepository) CountDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	var count int64
+	for _, user := range m.users {
+		if user.DeletedAt.Valid && user.DeletedAt.Time.Before(before) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockUserRepository) PurgeDeletedBefore(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	var purged int64
+	for phoneNumber, user := range m.users {
+		if user.DeletedAt.Valid && user.DeletedAt.Time.Before(before) {
+			delete(m.users, phoneNumber)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *mockUserRepository) ListPhoneNumbers(ctx context.Context, afterID uint, limit int) ([]model.User, error) {
+	var users []model.User
+	for _, user := range m.users {
+		if user.ID > afterID {
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (m *mockUserRepository) UpdatePhoneNumber(ctx context.Context, id uint, phoneNumber string) error {
+	if user, taken := m.users[phoneNumber]; taken && user.ID != id {
+		return ErrPhoneNumberTaken
+	}
+	for oldPhone, user := range m.users {
+		if user.ID == id {
+			delete(m.users, oldPhone)
+			user.PhoneNumber = phoneNumber
+			m.users[phoneNumber] = user
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *mockUserRepository) Delete(ctx context.Context, id uint) error {
+	for phoneNumber, user := range m.users {
+		if user.ID == id {
+			delete(m.users, phoneNumber)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *mockUserRepository) UpdatePhoneColumns(ctx context.Context, id uint, phoneNumber, phoneEncrypted string) error {
+	return m.UpdatePhoneNumber(context.Background(), id, phoneNumber)
+}
+
 type mockOTPRepository struct {
-	otps map[string]*model.OTP
-	rateLimits map[string]int
+	otps             map[string]*model.OTP
+	rateLimits       map[string]int
+	rateLimitWindows map[string]time.Duration
+	penalties        map[string]int
+	verifyFailures   map[string]int
+	failureWindows   map[string]time.Duration
+	evicted          map[string]bool
+	sendLocks        map[string]string
+	notBefore        map[string]time.Time
 }
 
 func newMockOTPRepository() *mockOTPRepository {
 	return &mockOTPRepository{
-		otps: make(map[string]*model.OTP),
-		rateLimits: make(map[string]int),
+		otps:             make(map[string]*model.OTP),
+		rateLimits:       make(map[string]int),
+		rateLimitWindows: make(map[string]time.Duration),
+		penalties:        make(map[string]int),
+		verifyFailures:   make(map[string]int),
+		failureWindows:   make(map[string]time.Duration),
+		evicted:          make(map[string]bool),
+		sendLocks:        make(map[string]string),
+		notBefore:        make(map[string]time.Time),
 	}
 }
 
-func (m *mockOTPRepository) StoreOTP(phoneNumber, code string, expiryMinutes int) error {
-	m.otps[phoneNumber] = &model.OTP{
-		PhoneNumber: phoneNumber,
-		Code:        code,
-		ExpiresAt:   time.Now().Add(time.Duration(expiryMinutes) * time.Minute),
-		Attempts:    0,
-	}
+func (m *mockOTPRepository) StoreOTP(ctx context.Context, otp *model.OTP, expiryMinutes int) error {
+	otp.ExpiresAt = time.Now().Add(time.Duration(expiryMinutes) * time.Minute)
+	m.otps[otp.PhoneNumber] = otp
 	return nil
 }
 
-func (m *mockOTPRepository) GetOTP(phoneNumber string) (*model.OTP, error) {
+func (m *mockOTPRepository) GetOTP(ctx context.Context, phoneNumber string) (*model.OTP, error) {
 	otp, exists := m.otps[phoneNumber]
 	if !exists {
+		if m.evicted[phoneNumber] {
+			return nil, apperrors.ErrOTPEvicted
+		}
 		return nil, nil
 	}
 	if time.Now().After(otp.ExpiresAt) {
@@ -94,21 +240,88 @@ func (m *mockOTPRepository) GetOTP(phoneNumber string) (*model.OTP, error) {
 	return otp, nil
 }
 
-func (m *mockOTPRepository) DeleteOTP(phoneNumber string) error {
+func (m *mockOTPRepository) Exists(ctx context.Context, phoneNumber string) (bool, error) {
+	otp, err := m.GetOTP(context.Background(), phoneNumber)
+	return otp != nil, err
+}
+
+func (m *mockOTPRepository) DeleteOTP(ctx context.Context, phoneNumber string) error {
+	delete(m.otps, phoneNumber)
+	return nil
+}
+
+func (m *mockOTPRepository) Purge(ctx context.Context, phoneNumber string) error {
 	delete(m.otps, phoneNumber)
+	delete(m.rateLimits, phoneNumber)
+	delete(m.rateLimitWindows, phoneNumber)
+	delete(m.penalties, phoneNumber)
+	delete(m.verifyFailures, phoneNumber)
+	delete(m.failureWindows, phoneNumber)
+	delete(m.evicted, phoneNumber)
+	delete(m.sendLocks, phoneNumber)
+	delete(m.notBefore, phoneNumber)
 	return nil
 }
 
-func (m *mockOTPRepository) IncrementAttempts(phoneNumber string) error {
+func (m *mockOTPRepository) IncrementAttempts(ctx context.Context, phoneNumber string) (int, error) {
 	otp, exists := m.otps[phoneNumber]
 	if !exists {
-		return errors.New("OTP not found")
+		return 0, ErrOTPExpired
 	}
 	otp.Attempts++
+	return otp.Attempts, nil
+}
+
+func (m *mockOTPRepository) GetAttempts(ctx context.Context, phoneNumber string) (int, error) {
+	otp, err := m.GetOTP(context.Background(), phoneNumber)
+	if err != nil || otp == nil {
+		return 0, err
+	}
+	return otp.Attempts, nil
+}
+
+func (m *mockOTPRepository) IncrementVerifyFailures(ctx context.Context, phoneNumber string, window time.Duration) (int, error) {
+	m.verifyFailures[phoneNumber]++
+	// The window starts with the first failure, like EXPIRE NX
+	if _, exists := m.failureWindows[phoneNumber]; !exists {
+		m.failureWindows[phoneNumber] = window
+	}
+	return m.verifyFailures[phoneNumber], nil
+}
+
+func (m *mockOTPRepository) GetVerifyFailures(ctx context.Context, phoneNumber string) (int, error) {
+	return m.verifyFailures[phoneNumber], nil
+}
+
+func (m *mockOTPRepository) GetVerifyFailuresTTL(ctx context.Context, phoneNumber string) (time.Duration, error) {
+	return m.failureWindows[phoneNumber], nil
+}
+
+func (m *mockOTPRepository) SetVerifyNotBefore(ctx context.Context, phoneNumber string, notBefore time.Time) error {
+	m.notBefore[phoneNumber] = notBefore
+	return nil
+}
+
+func (m *mockOTPRepository) GetVerifyNotBefore(ctx context.Context, phoneNumber string) (time.Time, error) {
+	return m.notBefore[phoneNumber], nil
+}
+
+func (m *mockOTPRepository) AcquireSendLock(ctx context.Context, phoneNumber string, ttl time.Duration) (string, error) {
+	if _, locked := m.sendLocks[phoneNumber]; locked {
+		return "", nil
+	}
+	m.sendLocks[phoneNumber] = "token"
+	return "token", nil
+}
+
+func (m *mockOTPRepository) ReleaseSendLock(ctx context.Context, phoneNumber, token string) error {
+	if m.sendLocks[phoneNumber] == token {
+		delete(m.sendLocks, phoneNumber)
+	}
 	return nil
 }
 
-func (m *mockOTPRepository) GetRateLimitCount(phoneNumber string) (int, error) {
+func (m *mockOTPRepository) GetRateLimitCount(ctx context.Context, phoneNumber string) (int, error) {
 	count, exists := m.rateLimits[phoneNumber]
 	if !exists {
 		return 0, nil
@@ -116,17 +329,74 @@ func (m *mockOTPRepository) GetRateLimitCount(phoneNumber string) (int, error) {
 	return count, nil
 }
 
-func (m *mockOTPRepository) IncrementRateLimit(phoneNumber string, windowMinutes int) error {
+func (m *mockOTPRepository) GetRateLimitTTL(ctx context.Context, phoneNumber string) (time.Duration, error) {
+	return m.rateLimitWindows[phoneNumber], nil
+}
+
+func (m *mockOTPRepository) ReserveRateLimit(ctx context.Context, phoneNumber string, limit int, window time.Duration) (int, bool, error) {
+	if m.rateLimits[phoneNumber] >= limit {
+		return m.rateLimits[phoneNumber], false, nil
+	}
 	m.rateLimits[phoneNumber]++
+	m.rateLimitWindows[phoneNumber] = window
+	return m.rateLimits[phoneNumber], true, nil
+}
+
+func (m *mockOTPRepository) RefundRateLimit(ctx context.Context, phoneNumber string) error {
+	if m.rateLimits[phoneNumber] > 0 {
+		m.rateLimits[phoneNumber]--
+	}
 	return nil
 }
 
-func createTestAuthService() (AuthService, *mockUserRepository, *mockOTPRepository) {
-	userRepo := newMockUserRepository()
-	otpRepo := newMockOTPRepository()
-	jwtManager := jwt.NewJWTManager("test-secret", 24)
-	
-	cfg := &config.Config{
+func (m *mockOTPRepository) IncrementRateLimitPenalty(ctx context.Context, phoneNumber string) (int, error) {
+	m.penalties[phoneNumber]++
+	return m.penalties[phoneNumber], nil
+}
+
+func (m *mockOTPRepository) ExtendRateLimit(ctx context.Context, phoneNumber string, window, penaltyTTL time.Duration) error {
+	m.rateLimitWindows[phoneNumber] = window
+	return nil
+}
+
+type mockOTPSender struct {
+	sent      map[string]string
+	senderIDs map[string]string
+	messages  map[string][]string
+	sendErr   error
+}
+
+func newMockOTPSender() *mockOTPSender {
+	return &mockOTPSender{
+		sent:      make(map[string]string),
+		senderIDs: make(map[string]string),
+		messages:  make(map[string][]string),
+	}
+}
+
+func (m *mockOTPSender) Name() string {
+	return "mock"
+}
+
+func (m *mockOTPSender) Send(ctx context.Context, senderID, phoneNumber, code string) error {
+	if m.sendErr != nil {
+		return m.sendErr
+	}
+	m.sent[phoneNumber] = code
+	m.senderIDs[phoneNumber] = senderID
+	return nil
+}
+
+func (m *mockOTPSender) SendMessage(ctx context.Context, senderID, phoneNumber, message string) error {
+	if m.sendErr != nil {
+		return m.sendErr
+	}
+	m.messages[phoneNumber] = append(m.messages[phoneNumber], message)
+	return nil
+}
+
+func newTestConfig() *config.Config {
+	return &config.Config{
 		OTP: config.OTPConfig{
 			Length:          6,
 			ExpiryMinutes:   2,
@@ -134,8 +404,47 @@ func createTestAuthService() (AuthService, *mockUserRepository, *mockOTPReposito
 			RateLimitWindow: 10 * time.Minute,
 		},
 	}
+}
+
+// mockOTPAttemptRepository keeps attempts in memory, or fails every write
+type mockOTPAttemptRepository struct {
+	attempts []model.OTPAttempt
+	failing  bool
+}
+
+func (m *mockOTPAttemptRepository) Create(ctx context.Context, attempt *model.OTPAttempt) error {
+	if m.failing {
+		return errors.New("database unavailable")
+	}
+	attempt.ID = uint(len(m.attempts) + 1)
+	m.attempts = append(m.attempts, *attempt)
+	return nil
+}
+
+func (m *mockOTPAttemptRepository) ListByUser(ctx context.Context, userID uint, page, pageSize int) ([]model.OTPAttempt, int64, error) {
+	var attempts []model.OTPAttempt
+	for i := len(m.attempts) - 1; i >= 0; i-- {
+		if m.attempts[i].UserID != nil && *m.attempts[i].UserID == userID {
+			attempts = append(attempts, m.attempts[i])
+		}
+	}
+	total := int64(len(attempts))
+	start := min((page-1)*pageSize, len(attempts))
+	end := min(start+pageSize, len(attempts))
+	return attempts[start:end], total, nil
+}
 
-	authService := NewAuthService(userRepo, otpRepo, jwtManager, cfg)
+func createTestAuthService() (AuthService, *mockUserRepository, *mockOTPRepository) {
+	return createTestAuthServiceWithConfig(newTestConfig())
+}
+
+func createTestAuthServiceWithConfig(cfg *config.Config) (AuthService, *mockUserRepository, *mockOTPRepository) {
+	userRepo := newMockUserRepository()
+	otpRepo := newMockOTPRepository()
+	sender := newMockOTPSender()
+	jwtManager := jwt.NewJWTManager("test-secret", 24, 720)
+
+	authService := NewAuthService(userRepo, otpRepo, nil, sender, nil, jwtManager, cfg)
 	return authService, userRepo, otpRepo
 }
 
@@ -150,7 +459,7 @@ func TestAuthService_SendOTP(t *testing.T) {
 	}{
 		{
 			name:        "Valid phone number",
-			phoneNumber: "+1234567890",
+			phoneNumber: "+14155550100",
 			setupFunc:   func() {},
 			wantErr:     nil,
 		},
@@ -162,9 +471,9 @@ func TestAuthService_SendOTP(t *testing.T) {
 		},
 		{
 			name:        "Rate limit exceeded",
-			phoneNumber: "+1111111111",
+			phoneNumber: "+14155550104",
 			setupFunc: func() {
-				otpRepo.rateLimits["+1111111111"] = 3
+				otpRepo.rateLimits["+14155550104"] = 3
 			},
 			wantErr: ErrRateLimitExceeded,
 		},
@@ -173,9 +482,9 @@ func TestAuthService_SendOTP(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupFunc()
-			
-			err := authService.SendOTP(tt.phoneNumber)
-			
+
+			_, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: tt.phoneNumber})
+
 			if tt.wantErr != nil {
 				if err == nil || !errors.Is(err, tt.wantErr) {
 					t.Errorf("SendOTP() error = %v, want %v", err, tt.wantErr)
@@ -189,7 +498,7 @@ func TestAuthService_SendOTP(t *testing.T) {
 			}
 
 			// Verify OTP was stored
-			otp, err := otpRepo.GetOTP(tt.phoneNumber)
+			otp, err := otpRepo.GetOTP(context.Background(), tt.phoneNumber)
 			if err != nil {
 				t.Errorf("Failed to get stored OTP: %v", err)
 				return
@@ -205,21 +514,37 @@ func TestAuthService_SendOTP(t *testing.T) {
 	}
 }
 
+func TestAuthService_SendOTP_RateLimitRetryAfter(t *testing.T) {
+	authService, _, otpRepo := createTestAuthService()
+	phoneNumber := "+14155550100"
+	otpRepo.rateLimits[phoneNumber] = 3
+	otpRepo.rateLimitWindows[phoneNumber] = 7 * time.Minute
+
+	_, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+	var retryErr *apperrors.RetryAfterError
+	if !errors.Is(err, ErrRateLimitExceeded) || !errors.As(err, &retryErr) {
+		t.Fatalf("SendOTP() error = %v, want ErrRateLimitExceeded with a retry time", err)
+	}
+	if retryErr.RetryAfter != 7*time.Minute {
+		t.Errorf("RetryAfter = %v, want the window's remaining %v", retryErr.RetryAfter, 7*time.Minute)
+	}
+}
+
 func TestAuthService_VerifyOTP(t *testing.T) {
 	authService, userRepo, otpRepo := createTestAuthService()
 
 	// Setup: Create a valid OTP
-	validPhone := "+1234567890"
+	validPhone := "+14155550100"
 	validOTP := "123456"
-	otpRepo.StoreOTP(validPhone, validOTP, 2)
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: validPhone, Code: validOTP}, 2)
 
 	// Setup: Create OTP for invalid code test
-	invalidCodePhone := "+1111111112"
+	invalidCodePhone := "+14155550105"
 	invalidCodeOTP := "999999"
-	otpRepo.StoreOTP(invalidCodePhone, invalidCodeOTP, 2)
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: invalidCodePhone, Code: invalidCodeOTP}, 2)
 
 	// Setup: Create an expired OTP
-	expiredPhone := "+9999999999"
+	expiredPhone := "+14155550106"
 	expiredOTP := "654321"
 	otpRepo.otps[expiredPhone] = &model.OTP{
 		PhoneNumber: expiredPhone,
@@ -229,7 +554,7 @@ func TestAuthService_VerifyOTP(t *testing.T) {
 	}
 
 	// Setup: Create OTP with max attempts
-	maxAttemptsPhone := "+8888888888"
+	maxAttemptsPhone := "+14155550107"
 	maxAttemptsOTP := "111111"
 	otpRepo.otps[maxAttemptsPhone] = &model.OTP{
 		PhoneNumber: maxAttemptsPhone,
@@ -282,7 +607,7 @@ func TestAuthService_VerifyOTP(t *testing.T) {
 		},
 		{
 			name:        "OTP not found",
-			phoneNumber: "+7777777777",
+			phoneNumber: "+14155550108",
 			otpCode:     "123456",
 			wantErr:     ErrOTPExpired,
 			checkResult: false,
@@ -291,8 +616,8 @@ func TestAuthService_VerifyOTP(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := authService.VerifyOTP(tt.phoneNumber, tt.otpCode)
-			
+			result, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: tt.phoneNumber, OTPCode: tt.otpCode})
+
 			if tt.wantErr != nil {
 				if err == nil || !errors.Is(err, tt.wantErr) {
 					t.Errorf("VerifyOTP() error = %v, want %v", err, tt.wantErr)
@@ -320,7 +645,7 @@ func TestAuthService_VerifyOTP(t *testing.T) {
 				}
 
 				// Verify user was created
-				user, err := userRepo.GetByPhoneNumber(tt.phoneNumber)
+				user, err := userRepo.GetByPhoneNumber(context.Background(), tt.phoneNumber)
 				if err != nil {
 					t.Errorf("User was not created: %v", err)
 				}
@@ -336,17 +661,17 @@ func TestAuthService_VerifyOTP_ExistingUser(t *testing.T) {
 	authService, userRepo, otpRepo := createTestAuthService()
 
 	// Create existing user
-	existingPhone := "+5555555555"
+	existingPhone := "+14155550109"
 	existingUser := &model.User{
 		PhoneNumber: existingPhone,
 	}
-	userRepo.Create(existingUser)
+	userRepo.Create(context.Background(), existingUser)
 
 	// Create valid OTP
 	validOTP := "123456"
-	otpRepo.StoreOTP(existingPhone, validOTP, 2)
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: existingPhone, Code: validOTP}, 2)
 
-	result, err := authService.VerifyOTP(existingPhone, validOTP)
+	result, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: existingPhone, OTPCode: validOTP})
 	if err != nil {
 		t.Errorf("VerifyOTP() error = %v", err)
 		return
@@ -356,3 +681,1889 @@ func TestAuthService_VerifyOTP_ExistingUser(t *testing.T) {
 		t.Errorf("Returned user ID = %v, want %v", result.User.ID, existingUser.ID)
 	}
 }
+
+func TestAuthService_VerifyOTP_RecordsAttempts(t *testing.T) {
+	userRepo := newMockUserRepository()
+	otpRepo := newMockOTPRepository()
+	attemptRepo := &mockOTPAttemptRepository{}
+	authService := NewAuthService(userRepo, otpRepo, attemptRepo, newMockOTPSender(), nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+
+	existingUser := &model.User{PhoneNumber: "+14155550109"}
+	userRepo.Create(context.Background(), existingUser)
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: "+14155550109", Code: "123456"}, 2)
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: "+14155550110", Code: "123456"}, 2)
+
+	verifies := []struct {
+		phoneNumber string
+		otpCode     string
+	}{
+		{"+14155550109", "000000"},
+		{"+14155550109", "123456"},
+		{"+14155550110", "000000"},
+		{"12345", "123456"},
+	}
+	for _, v := range verifies {
+		authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: v.phoneNumber, OTPCode: v.otpCode, ClientIP: "203.0.113.7", UserAgent: "curl/8.0"})
+	}
+
+	// The invalid number never reaches a lookup, so it leaves no attempt
+	if len(attemptRepo.attempts) != 3 {
+		t.Fatalf("recorded %d attempts, want 3: %+v", len(attemptRepo.attempts), attemptRepo.attempts)
+	}
+	want := []struct {
+		phoneNumber string
+		userID      *uint
+		success     bool
+	}{
+		{"+14155550109", &existingUser.ID, false},
+		{"+14155550109", &existingUser.ID, true},
+		{"+14155550110", nil, false},
+	}
+	for i, w := range want {
+		got := attemptRepo.attempts[i]
+		if got.PhoneNumber != w.phoneNumber || got.Success != w.success {
+			t.Errorf("attempt %d = %+v, want phone %s success %v", i, got, w.phoneNumber, w.success)
+		}
+		if (got.UserID == nil) != (w.userID == nil) || (got.UserID != nil && *got.UserID != *w.userID) {
+			t.Errorf("attempt %d user_id = %v, want %v", i, got.UserID, w.userID)
+		}
+		if got.IP != "203.0.113.7" || got.UserAgent != "curl/8.0" {
+			t.Errorf("attempt %d client = %q %q, want the request's IP and user agent", i, got.IP, got.UserAgent)
+		}
+	}
+}
+
+func TestAuthService_VerifyOTP_AttemptHistoryUnavailable(t *testing.T) {
+	otpRepo := newMockOTPRepository()
+	attemptRepo := &mockOTPAttemptRepository{failing: true}
+	authService := NewAuthService(newMockUserRepository(), otpRepo, attemptRepo, newMockOTPSender(), nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: "+14155550109", Code: "123456"}, 2)
+
+	if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: "+14155550109", OTPCode: "123456"}); err != nil {
+		t.Errorf("VerifyOTP() error = %v, want sign-in to succeed without the history", err)
+	}
+}
+
+func TestAuthService_VerifyOTP_ExtractDigits(t *testing.T) {
+	tests := []struct {
+		name          string
+		extractDigits bool
+		otpCode       string
+		wantErr       error
+	}{
+		{"Enabled - labelled code", true, "Code: 123456", nil},
+		{"Enabled - trailing punctuation", true, "123456.", nil},
+		{"Enabled - ambiguous input", true, "123456 or 654321", ErrInvalidOTP},
+		{"Disabled - labelled code", false, "Code: 123456", ErrInvalidOTP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OTP.ExtractDigits = tt.extractDigits
+			authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+
+			phoneNumber := "+14155550100"
+			otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2)
+
+			_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: tt.otpCode})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifyOTP() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("VerifyOTP() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_VerifyOTP_BindDevice(t *testing.T) {
+	tests := []struct {
+		name           string
+		bindDevice     bool
+		sendDeviceID   string
+		verifyDeviceID string
+		wantErr        error
+	}{
+		{"Binding on - matching device", true, "device-a", "device-a", nil},
+		{"Binding on - mismatching device", true, "device-a", "device-b", ErrDeviceMismatch},
+		{"Binding on - missing device on verify", true, "device-a", "", ErrDeviceMismatch},
+		{"Binding off - mismatching device", false, "device-a", "device-b", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OTP.BindDevice = tt.bindDevice
+			authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+
+			phoneNumber := "+14155550100"
+			if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber, DeviceID: tt.sendDeviceID}); err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+			storedOTP, _ := otpRepo.GetOTP(context.Background(), phoneNumber)
+
+			_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{
+				PhoneNumber: phoneNumber,
+				OTPCode:     storedOTP.Code,
+				DeviceID:    tt.verifyDeviceID,
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifyOTP() error = %v, want %v", err, tt.wantErr)
+				}
+				if storedOTP.Attempts != 1 {
+					t.Errorf("OTP attempts = %v, want 1", storedOTP.Attempts)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("VerifyOTP() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_SendOTP_RateLimitBackoff(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.RateLimitBackoff = true
+	cfg.OTP.RateLimitBackoffMaxMultiplier = 4
+	cfg.OTP.RateLimitBackoffDecay = time.Hour
+	authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+
+	phoneNumber := "+14155550100"
+	wantWindows := []time.Duration{
+		10 * time.Minute,
+		20 * time.Minute,
+		40 * time.Minute,
+		40 * time.Minute, // capped at the max multiplier
+	}
+
+	for i, wantWindow := range wantWindows {
+		// Each round starts after the previous window expired, while the penalty is still live
+		delete(otpRepo.rateLimits, phoneNumber)
+
+		for j := 0; j < cfg.OTP.MaxAttempts; j++ {
+			if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+				t.Fatalf("Round %d: SendOTP() unexpected error = %v", i+1, err)
+			}
+		}
+
+		if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); !errors.Is(err, ErrRateLimitExceeded) {
+			t.Fatalf("Round %d: SendOTP() error = %v, want %v", i+1, err, ErrRateLimitExceeded)
+		}
+
+		if got := otpRepo.rateLimitWindows[phoneNumber]; got != wantWindow {
+			t.Errorf("Round %d: rate limit window = %v, want %v", i+1, got, wantWindow)
+		}
+	}
+}
+
+func TestAuthService_SendOTP_RateLimitBackoffDisabled(t *testing.T) {
+	authService, _, otpRepo := createTestAuthService()
+
+	phoneNumber := "+14155550100"
+	for i := 0; i < 3; i++ {
+		if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+			t.Fatalf("SendOTP() unexpected error = %v", err)
+		}
+	}
+
+	if otpRepo.penalties[phoneNumber] != 0 {
+		t.Errorf("Rate limit penalty = %v, want 0", otpRepo.penalties[phoneNumber])
+	}
+	if got := otpRepo.rateLimitWindows[phoneNumber]; got != 10*time.Minute {
+		t.Errorf("Rate limit window = %v, want %v", got, 10*time.Minute)
+	}
+}
+
+func TestAuthService_SendOTP_VoiceFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		afterResends int
+		wantFlags    []bool
+	}{
+		{"Threshold of two resends", 2, []bool{false, false, true}},
+		{"Disabled", 0, []bool{false, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OTP.VoiceFallbackAfterResends = tt.afterResends
+			authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+
+			phoneNumber := "+14155550100"
+			for i, want := range tt.wantFlags {
+				resp, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+				if err != nil {
+					t.Fatalf("Send %d: SendOTP() unexpected error = %v", i+1, err)
+				}
+				if resp.VoiceFallbackAvailable != want {
+					t.Errorf("Send %d: VoiceFallbackAvailable = %v, want %v", i+1, resp.VoiceFallbackAvailable, want)
+				}
+			}
+
+			// A new session starts once the pending OTP is gone
+			otpRepo.DeleteOTP(context.Background(), phoneNumber)
+			delete(otpRepo.rateLimits, phoneNumber)
+			resp, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+			if err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+			if resp.VoiceFallbackAvailable {
+				t.Error("VoiceFallbackAvailable = true after a new session, want false")
+			}
+		})
+	}
+}
+
+// Token generator that always fails, to simulate signing errors
+type failingTokenGenerator struct{}
+
+func (failingTokenGenerator) GenerateTokenPair(userID uint, phoneNumber, role string) (string, string, error) {
+	return "", "", errors.New("signing key unavailable")
+}
+
+func (failingTokenGenerator) GenerateAccessToken(userID uint, phoneNumber, role string) (string, error) {
+	return "", errors.New("signing key unavailable")
+}
+
+func (failingTokenGenerator) ValidateRefreshToken(refreshToken string) (*jwt.Claims, error) {
+	return nil, errors.New("signing key unavailable")
+}
+
+func TestAuthService_VerifyOTP_TokenIssuanceFailure(t *testing.T) {
+	userRepo := newMockUserRepository()
+	otpRepo := newMockOTPRepository()
+	authService := NewAuthService(userRepo, otpRepo, nil, newMockOTPSender(), nil, failingTokenGenerator{}, newTestConfig())
+
+	phoneNumber := "+14155550100"
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2)
+
+	_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "123456"})
+	if !errors.Is(err, ErrTokenIssuance) {
+		t.Fatalf("VerifyOTP() error = %v, want %v", err, ErrTokenIssuance)
+	}
+
+	// The matched code stays consumed; the user must request a new one
+	if otp, _ := otpRepo.GetOTP(context.Background(), phoneNumber); otp != nil {
+		t.Error("Expected OTP to be consumed after token issuance failure")
+	}
+}
+
+func TestAuthService_SendOTP_QuietHours(t *testing.T) {
+	now := time.Now().UTC()
+	window := func(from, to time.Duration) string {
+		return now.Add(from).Format("15:04") + "-" + now.Add(to).Format("15:04")
+	}
+
+	tests := []struct {
+		name       string
+		quietHours string
+		wantErr    error
+	}{
+		{"Send during quiet hours", window(-time.Hour, time.Hour), ErrQuietHours},
+		{"Send outside quiet hours", window(time.Hour, 2*time.Hour), nil},
+		{"Quiet hours disabled", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OTP.QuietHours = tt.quietHours
+			cfg.OTP.QuietHoursDefaultTimezone = "UTC"
+			authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+
+			phoneNumber := "+14155550100"
+			_, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SendOTP() error = %v, want %v", err, tt.wantErr)
+			}
+
+			otp, _ := otpRepo.GetOTP(context.Background(), phoneNumber)
+			if (otp != nil) != (tt.wantErr == nil) {
+				t.Errorf("OTP stored = %v, want %v", otp != nil, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestAuthService_SendOTP_DisplayMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		length   int
+		expiry   int
+		want     string
+	}{
+		{
+			name:     "Default wording",
+			template: "We sent a {{.Length}}-digit code to {{.Destination}}. It expires in {{.ExpiryMinutes}} minutes.",
+			length:   6,
+			expiry:   2,
+			want:     "We sent a 6-digit code to +1******0100. It expires in 2 minutes.",
+		},
+		{
+			name:     "Custom wording and config",
+			template: "Code ({{.Length}} digits) sent to {{.Destination}}, valid {{.ExpiryMinutes}} min",
+			length:   8,
+			expiry:   5,
+			want:     "Code (8 digits) sent to +1******0100, valid 5 min",
+		},
+		{"Disabled", "", 6, 2, ""},
+		{"Unknown field", "Sent to {{.Channel}}", 6, 2, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OTP.DisplayMessageTemplate = tt.template
+			cfg.OTP.Length = tt.length
+			cfg.OTP.ExpiryMinutes = tt.expiry
+			authService, _, _ := createTestAuthServiceWithConfig(cfg)
+
+			resp, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: "+14155550100"})
+			if err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+			if resp.DisplayMessage != tt.want {
+				t.Errorf("DisplayMessage = %q, want %q", resp.DisplayMessage, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthService_FormToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		formToken     bool
+		submitToken   func(issued string) string
+		wantErr       error
+		wantRemaining bool
+	}{
+		{"Enabled - matching token", true, func(issued string) string { return issued }, nil, false},
+		{"Enabled - missing token", true, func(string) string { return "" }, ErrInvalidFormToken, true},
+		{"Enabled - wrong token", true, func(string) string { return "forged" }, ErrInvalidFormToken, true},
+		{"Disabled - no token", false, func(string) string { return "" }, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OTP.FormToken = tt.formToken
+			authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+
+			phoneNumber := "+14155550100"
+			resp, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+			if err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+			if (resp.FormToken != "") != tt.formToken {
+				t.Fatalf("FormToken issued = %v, want %v", resp.FormToken != "", tt.formToken)
+			}
+			storedOTP, _ := otpRepo.GetOTP(context.Background(), phoneNumber)
+
+			_, err = authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{
+				PhoneNumber: phoneNumber,
+				OTPCode:     storedOTP.Code,
+				FormToken:   tt.submitToken(resp.FormToken),
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyOTP() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// A rejected form leaves the OTP and its attempts untouched
+			otp, _ := otpRepo.GetOTP(context.Background(), phoneNumber)
+			if (otp != nil) != tt.wantRemaining {
+				t.Errorf("OTP remaining = %v, want %v", otp != nil, tt.wantRemaining)
+			}
+			if otp != nil && otp.Attempts != 0 {
+				t.Errorf("OTP attempts = %v, want 0", otp.Attempts)
+			}
+		})
+	}
+}
+
+func TestAuthService_VerifyOTP_LastLogin(t *testing.T) {
+	authService, userRepo, otpRepo := createTestAuthService()
+	phoneNumber := "+14155550100"
+
+	var previous time.Time
+	for i := 0; i < 2; i++ {
+		otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2)
+
+		resp, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "123456"})
+		if err != nil {
+			t.Fatalf("Login %d: VerifyOTP() unexpected error = %v", i+1, err)
+		}
+
+		stored, _ := userRepo.GetByPhoneNumber(context.Background(), phoneNumber)
+		if stored.LastLoginAt == nil || !stored.LastLoginAt.After(previous) {
+			t.Fatalf("Login %d: LastLoginAt = %v, want after %v", i+1, stored.LastLoginAt, previous)
+		}
+		if resp.User.LastLoginAt == nil {
+			t.Errorf("Login %d: response LastLoginAt is nil", i+1)
+		}
+		previous = *stored.LastLoginAt
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAuthService_OTPStatus(t *testing.T) {
+	authService, _, otpRepo := createTestAuthService()
+	phoneNumber := "+14155550100"
+
+	status, err := authService.OTPStatus(context.Background(), phoneNumber)
+	if err != nil {
+		t.Fatalf("OTPStatus() unexpected error = %v", err)
+	}
+	if status.Pending {
+		t.Error("OTPStatus() pending = true before any send")
+	}
+
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2)
+
+	for failed := 0; failed <= 2; failed++ {
+		status, err := authService.OTPStatus(context.Background(), phoneNumber)
+		if err != nil {
+			t.Fatalf("OTPStatus() unexpected error = %v", err)
+		}
+		if !status.Pending || status.AttemptsRemaining != 3-failed {
+			t.Errorf("After %d failures: status = %+v, want pending with %d remaining", failed, status, 3-failed)
+		}
+
+		authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "000000"})
+	}
+
+	if _, err := authService.OTPStatus(context.Background(), "not-a-phone"); !errors.Is(err, ErrInvalidPhoneNumber) {
+		t.Errorf("OTPStatus() error = %v, want %v", err, ErrInvalidPhoneNumber)
+	}
+}
+
+func TestAuthService_CumulativeVerifyBudget(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.CumulativeVerifyBudget = 4
+	authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+	phoneNumber := "+14155550100"
+
+	failTwice := func() {
+		storedOTP, _ := otpRepo.GetOTP(context.Background(), phoneNumber)
+		wrongCode := "000000"
+		if storedOTP.Code == wrongCode {
+			wrongCode = "111111"
+		}
+		for i := 0; i < 2; i++ {
+			_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: wrongCode})
+			if !errors.Is(err, ErrInvalidOTP) {
+				t.Fatalf("VerifyOTP() error = %v, want %v", err, ErrInvalidOTP)
+			}
+		}
+	}
+
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+	failTwice()
+
+	// Resending issues a fresh OTP but must not reset the cumulative budget
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("Resend: SendOTP() unexpected error = %v", err)
+	}
+	failTwice()
+
+	storedOTP, _ := otpRepo.GetOTP(context.Background(), phoneNumber)
+	_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: storedOTP.Code})
+	if !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("VerifyOTP() with correct code error = %v, want %v", err, ErrAccountLocked)
+	}
+
+	_, err = authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+	if !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("SendOTP() error = %v, want %v", err, ErrAccountLocked)
+	}
+
+	// The lock lifts with the failure window, which is the rate limit window
+	var retryErr *apperrors.RetryAfterError
+	if !errors.As(err, &retryErr) || retryErr.RetryAfter != cfg.OTP.RateLimitWindow {
+		t.Errorf("SendOTP() error = %v, want the lockout to last %v", err, cfg.OTP.RateLimitWindow)
+	}
+}
+
+func TestAuthService_SendOTP_DeterministicEntropy(t *testing.T) {
+	userRepo := newMockUserRepository()
+	otpRepo := newMockOTPRepository()
+	sender := newMockOTPSender()
+	svc := NewAuthService(userRepo, otpRepo, nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+	svc.(*authService).entropy = bytes.NewReader([]byte{9, 8, 7, 6, 5, 4})
+
+	phoneNumber := "+14155550100"
+	if _, err := svc.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+
+	if code := sender.sent[phoneNumber]; code != "987654" {
+		t.Errorf("Sent code = %q, want %q", code, "987654")
+	}
+	if storedOTP, _ := otpRepo.GetOTP(context.Background(), phoneNumber); storedOTP == nil || storedOTP.Code != "987654" {
+		t.Errorf("Stored OTP = %+v, want code 987654", storedOTP)
+	}
+}
+
+func TestAuthService_VerifyOTP_Evicted(t *testing.T) {
+	tests := []struct {
+		name                string
+		evictionUnavailable bool
+		wantErr             error
+	}{
+		{"Reported as unavailable", true, ErrServiceUnavailable},
+		{"Reported as expired", false, ErrOTPExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OTP.EvictionUnavailable = tt.evictionUnavailable
+			authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+			phoneNumber := "+14155550100"
+
+			if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+			storedOTP, _ := otpRepo.GetOTP(context.Background(), phoneNumber)
+
+			// Simulate Redis dropping the key before its TTL
+			delete(otpRepo.otps, phoneNumber)
+			otpRepo.evicted[phoneNumber] = true
+
+			_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: storedOTP.Code})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyOTP() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// Requesting a new code recovers from the eviction
+			if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+				t.Errorf("SendOTP() after eviction unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+// Sender that blocks until released, to hold a send in flight
+type blockingOTPSender struct {
+	started chan struct{}
+	release chan struct{}
+	sends   atomic.Int32
+}
+
+func (s *blockingOTPSender) Name() string {
+	return "blocking"
+}
+
+func (s *blockingOTPSender) Send(ctx context.Context, senderID, phoneNumber, code string) error {
+	s.sends.Add(1)
+	close(s.started)
+	<-s.release
+	return nil
+}
+
+func (s *blockingOTPSender) SendMessage(ctx context.Context, senderID, phoneNumber, message string) error {
+	return nil
+}
+
+func TestAuthService_SendOTP_ClusterSendLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := newTestConfig()
+	cfg.OTP.SendLockTTL = 5 * time.Second
+	sender := &blockingOTPSender{started: make(chan struct{}), release: make(chan struct{})}
+	jwtManager := jwt.NewJWTManager("test-secret", 24, 720)
+
+	// Two instances sharing one Redis, each with its own repository client
+	instanceA := NewAuthService(newMockUserRepository(), repository.NewOTPRepository(client), nil, sender, nil, jwtManager, cfg)
+	instanceB := NewAuthService(newMockUserRepository(), repository.NewOTPRepository(client), nil, sender, nil, jwtManager, cfg)
+
+	phoneNumber := "+14155550100"
+	errA := make(chan error, 1)
+	go func() {
+		_, err := instanceA.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+		errA <- err
+	}()
+	<-sender.started
+
+	if _, err := instanceB.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Errorf("Concurrent SendOTP() unexpected error = %v", err)
+	}
+
+	close(sender.release)
+	if err := <-errA; err != nil {
+		t.Errorf("SendOTP() unexpected error = %v", err)
+	}
+
+	if sends := sender.sends.Load(); sends != 1 {
+		t.Errorf("Sends = %v, want 1", sends)
+	}
+	if mr.Exists(utils.SendLockKey(phoneNumber)) {
+		t.Error("Send lock still held after the send finished")
+	}
+}
+
+func TestAuthService_VerifyOTP_ConcurrentAttempts(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := newTestConfig()
+	otpRepo := repository.NewOTPRepository(client)
+	authService := NewAuthService(newMockUserRepository(), otpRepo, nil, newMockOTPSender(), nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+
+	phoneNumber := "+14155550100"
+	if err := otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, cfg.OTP.ExpiryMinutes); err != nil {
+		t.Fatalf("StoreOTP() unexpected error = %v", err)
+	}
+
+	// Every guess reads the OTP before any of them is counted
+	const guesses = 10
+	errs := make(chan error, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "654321"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// Only the guesses within MaxAttempts are compared, each with its own count
+	remaining := make(map[int]bool)
+	for err := range errs {
+		var attemptsErr *apperrors.AttemptsRemainingError
+		switch {
+		case errors.As(err, &attemptsErr):
+			if remaining[attemptsErr.Remaining] {
+				t.Errorf("Two guesses reported %d attempts remaining", attemptsErr.Remaining)
+			}
+			remaining[attemptsErr.Remaining] = true
+		case errors.Is(err, ErrTooManyAttempts), errors.Is(err, ErrOTPExpired):
+		default:
+			t.Errorf("VerifyOTP() error = %v, want an invalid, expired or too many attempts error", err)
+		}
+	}
+	if len(remaining) > cfg.OTP.MaxAttempts-1 {
+		t.Errorf("Guesses answered with attempts remaining = %d, want at most %d", len(remaining), cfg.OTP.MaxAttempts-1)
+	}
+	if mr.Exists(utils.OTPKey(phoneNumber)) {
+		t.Error("OTP still stored after the attempts ran out")
+	}
+}
+
+// Sender that only counts sends, safe for concurrent use
+type countingOTPSender struct {
+	sends atomic.Int32
+}
+
+func (s *countingOTPSender) Name() string {
+	return "counting"
+}
+
+func (s *countingOTPSender) Send(ctx context.Context, senderID, phoneNumber, code string) error {
+	s.sends.Add(1)
+	return nil
+}
+
+func (s *countingOTPSender) SendMessage(ctx context.Context, senderID, phoneNumber, message string) error {
+	return nil
+}
+
+func TestAuthService_SendOTP_ConcurrentRateLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := newTestConfig()
+	sender := &countingOTPSender{}
+	authService := NewAuthService(newMockUserRepository(), repository.NewOTPRepository(client), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	var succeeded, limited atomic.Int32
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: "+14155550100"})
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.Is(err, ErrRateLimitExceeded):
+				limited.Add(1)
+			default:
+				t.Errorf("SendOTP() unexpected error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := succeeded.Load(); got != int32(cfg.OTP.MaxAttempts) {
+		t.Errorf("Successful sends = %d, want %d", got, cfg.OTP.MaxAttempts)
+	}
+	if got := sender.sends.Load(); got != int32(cfg.OTP.MaxAttempts) {
+		t.Errorf("Provider sends = %d, want %d", got, cfg.OTP.MaxAttempts)
+	}
+	if got := limited.Load(); got != callers-int32(cfg.OTP.MaxAttempts) {
+		t.Errorf("Rate-limited sends = %d, want %d", got, callers-cfg.OTP.MaxAttempts)
+	}
+}
+
+func TestAuthService_SendOTP_InvalidatesPreviousCode(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	sender := newMockOTPSender()
+	cfg := newTestConfig()
+	authService := NewAuthService(newMockUserRepository(), repository.NewOTPRepository(client), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+	phoneNumber := "+14155550100"
+
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+	oldCode := sender.sent[phoneNumber]
+	// A wrong guess against the first code must not carry over to the second
+	authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "000000"})
+
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("Resend unexpected error = %v", err)
+	}
+	newCode := sender.sent[phoneNumber]
+	if newCode == oldCode {
+		t.Skip("Resend drew the same code")
+	}
+
+	_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: oldCode})
+	var remaining *apperrors.AttemptsRemainingError
+	if !errors.Is(err, ErrInvalidOTP) || !errors.As(err, &remaining) {
+		t.Fatalf("VerifyOTP(old code) error = %v, want ErrInvalidOTP", err)
+	}
+	if remaining.Remaining != cfg.OTP.MaxAttempts-1 {
+		t.Errorf("Remaining = %d, want %d from a fresh attempts counter", remaining.Remaining, cfg.OTP.MaxAttempts-1)
+	}
+
+	if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: newCode}); err != nil {
+		t.Errorf("VerifyOTP(new code) unexpected error = %v", err)
+	}
+}
+
+func TestAuthService_CorrelationID(t *testing.T) {
+	var auditLog bytes.Buffer
+	log.SetOutput(&auditLog)
+	defer log.SetOutput(os.Stderr)
+
+	authService, _, otpRepo := createTestAuthService()
+	phoneNumber := "+14155550100"
+
+	sendResp, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+	if err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+	if sendResp.CorrelationID == "" {
+		t.Fatal("SendOTP() returned no correlation ID")
+	}
+	storedOTP, _ := otpRepo.GetOTP(context.Background(), phoneNumber)
+
+	_, err = authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{
+		PhoneNumber:   phoneNumber,
+		OTPCode:       storedOTP.Code,
+		CorrelationID: sendResp.CorrelationID,
+	})
+	if err != nil {
+		t.Fatalf("VerifyOTP() unexpected error = %v", err)
+	}
+
+	entries := map[string]bool{
+		"AUDIT: otp sent: correlation_id=" + sendResp.CorrelationID:                         false,
+		"AUDIT: otp verify: correlation_id=" + sendResp.CorrelationID + " outcome=verified": false,
+	}
+	for _, line := range strings.Split(auditLog.String(), "\n") {
+		if strings.Contains(line, phoneNumber) && strings.Contains(line, "AUDIT") {
+			t.Errorf("Audit entry exposes the phone number: %s", line)
+		}
+		for entry := range entries {
+			if strings.Contains(line, entry) {
+				entries[entry] = true
+			}
+		}
+	}
+	for entry, found := range entries {
+		if !found {
+			t.Errorf("Missing audit entry %q", entry)
+		}
+	}
+}
+
+func TestAuthService_VerifyOTP_Backoff(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.MaxAttempts = 10
+	cfg.OTP.VerifyBackoffBase = time.Second
+	cfg.OTP.VerifyBackoffMax = 10 * time.Second
+	authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+	phoneNumber := "+14155550100"
+
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2)
+	verify := func() error {
+		_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "654321"})
+		return err
+	}
+
+	// base * 2^attempts, capped at the configured maximum
+	for i, wantDelay := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		if err := verify(); !errors.Is(err, ErrInvalidOTP) {
+			t.Fatalf("Attempt %d: VerifyOTP() error = %v, want %v", i+1, err, ErrInvalidOTP)
+		}
+
+		err := verify()
+		var retryErr *apperrors.RetryAfterError
+		if !errors.Is(err, ErrVerifyTooSoon) || !errors.As(err, &retryErr) {
+			t.Fatalf("Attempt %d: early VerifyOTP() error = %v, want %v", i+1, err, ErrVerifyTooSoon)
+		}
+		if retryErr.RetryAfter > wantDelay || retryErr.RetryAfter < wantDelay-time.Second {
+			t.Errorf("Attempt %d: RetryAfter = %v, want about %v", i+1, retryErr.RetryAfter, wantDelay)
+		}
+
+		// An early verify must not consume an attempt
+		if otp, _ := otpRepo.GetOTP(context.Background(), phoneNumber); otp.Attempts != i+1 {
+			t.Errorf("Attempt %d: OTP attempts = %v, want %v", i+1, otp.Attempts, i+1)
+		}
+
+		// Let the backoff elapse
+		otpRepo.notBefore[phoneNumber] = time.Time{}
+	}
+}
+
+func TestAuthService_VerifyOTP_HashKeyRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		rotatedKeys []string
+		wantErr     error
+	}{
+		{"Previous key kept", []string{"new-key", "old-key"}, nil},
+		{"Previous key dropped", []string{"new-key"}, ErrInvalidOTP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := newMockUserRepository()
+			otpRepo := newMockOTPRepository()
+			sender := newMockOTPSender()
+			jwtManager := jwt.NewJWTManager("test-secret", 24, 720)
+			phoneNumber := "+14155550100"
+
+			cfg := newTestConfig()
+			cfg.OTP.HashKeys = []string{"old-key"}
+			before := NewAuthService(userRepo, otpRepo, nil, sender, nil, jwtManager, cfg)
+			if _, err := before.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+
+			code := sender.sent[phoneNumber]
+			if storedOTP, _ := otpRepo.GetOTP(context.Background(), phoneNumber); storedOTP.Code == code {
+				t.Fatal("OTP stored in plaintext")
+			}
+
+			rotatedCfg := newTestConfig()
+			rotatedCfg.OTP.HashKeys = tt.rotatedKeys
+			after := NewAuthService(userRepo, otpRepo, nil, sender, nil, jwtManager, rotatedCfg)
+
+			_, err := after.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: code})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyOTP() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthService_SendOTP_RegionalSenderID(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.SenderIDs = []string{"+1=12345", "+98=MyApp"}
+	cfg.OTP.DefaultSenderID = "OTPSVC"
+	sender := newMockOTPSender()
+	authService := NewAuthService(newMockUserRepository(), newMockOTPRepository(), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+
+	tests := []struct {
+		phoneNumber string
+		want        string
+	}{
+		{"+12025550123", "12345"},
+		{"+989121234567", "MyApp"},
+		{"+4915112345678", "OTPSVC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.phoneNumber, func(t *testing.T) {
+			if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: tt.phoneNumber}); err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+			if got := sender.senderIDs[tt.phoneNumber]; got != tt.want {
+				t.Errorf("Sender ID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthService_CheckDigit(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.CheckDigit = true
+	sender := newMockOTPSender()
+	otpRepo := newMockOTPRepository()
+	svc := NewAuthService(newMockUserRepository(), otpRepo, nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+	svc.(*authService).entropy = bytes.NewReader([]byte{1, 2, 3, 4, 5, 6})
+	phoneNumber := "+14155550100"
+
+	if _, err := svc.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+	if code := sender.sent[phoneNumber]; code != "1234566" {
+		t.Fatalf("Sent code = %q, want %q", code, "1234566")
+	}
+
+	// Typo in the last digit fails the checksum before any attempt is spent
+	_, err := svc.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "1234567"})
+	if !errors.Is(err, ErrOTPMistyped) {
+		t.Errorf("VerifyOTP() error = %v, want %v", err, ErrOTPMistyped)
+	}
+	if otp, _ := otpRepo.GetOTP(context.Background(), phoneNumber); otp.Attempts != 0 {
+		t.Errorf("OTP attempts = %v, want 0", otp.Attempts)
+	}
+
+	if _, err := svc.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "1234566"}); err != nil {
+		t.Errorf("VerifyOTP() unexpected error = %v", err)
+	}
+}
+
+func TestAuthService_SendOTP_FreeResendOnFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		freeResend    bool
+		wantRateLimit int
+	}{
+		{"failed send counts", false, 2},
+		{"failed send is free", true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OTP.FreeResendOnFailure = tt.freeResend
+			sender := newMockOTPSender()
+			otpRepo := newMockOTPRepository()
+			authService := NewAuthService(newMockUserRepository(), otpRepo, nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+			phoneNumber := "+14155550100"
+
+			sender.sendErr = errors.New("provider unavailable")
+			if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err == nil {
+				t.Fatal("SendOTP() expected error from provider")
+			}
+
+			sender.sendErr = nil
+			if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+
+			if got := otpRepo.rateLimits[phoneNumber]; got != tt.wantRateLimit {
+				t.Errorf("Rate limit count = %v, want %v", got, tt.wantRateLimit)
+			}
+		})
+	}
+}
+
+func TestAuthService_AccountStatus(t *testing.T) {
+	tests := []struct {
+		status  model.UserStatus
+		wantErr error
+	}{
+		{model.UserStatusActive, nil},
+		{model.UserStatusPending, ErrAccountPending},
+		{model.UserStatusSuspended, ErrAccountSuspended},
+		{model.UserStatusDeactivated, ErrAccountDeactivated},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			userRepo := newMockUserRepository()
+			sender := newMockOTPSender()
+			authService := NewAuthService(userRepo, newMockOTPRepository(), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+			phoneNumber := "+14155550100"
+			userRepo.Create(context.Background(), &model.User{PhoneNumber: phoneNumber, Status: tt.status})
+
+			_, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SendOTP() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// A code sent while the account was active must not sign in a user changed since
+			userRepo.users[phoneNumber].Status = model.UserStatusActive
+			if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+			userRepo.users[phoneNumber].Status = tt.status
+
+			response, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: sender.sent[phoneNumber]})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyOTP() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && response != nil {
+				t.Errorf("VerifyOTP() response = %+v, want nil", response)
+			}
+		})
+	}
+}
+
+func TestAuthService_WelcomeSMS(t *testing.T) {
+	tests := []struct {
+		name         string
+		enabled      bool
+		wantMessages []string
+	}{
+		{"disabled", false, nil},
+		{"enabled", true, []string{"Welcome +14155550100"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.User.WelcomeSMSEnabled = tt.enabled
+			cfg.User.WelcomeSMSTemplate = "Welcome {{.PhoneNumber}}"
+			sender := newMockOTPSender()
+			svc := NewAuthService(newMockUserRepository(), newMockOTPRepository(), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+			svc.(*authService).background = func(f func()) { f() }
+			phoneNumber := "+14155550100"
+
+			// The first sign-in registers the user; the second is a returning user
+			for i := 0; i < 2; i++ {
+				if _, err := svc.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+					t.Fatalf("SendOTP() unexpected error = %v", err)
+				}
+				if _, err := svc.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: sender.sent[phoneNumber]}); err != nil {
+					t.Fatalf("VerifyOTP() unexpected error = %v", err)
+				}
+			}
+
+			if got := sender.messages[phoneNumber]; !reflect.DeepEqual(got, tt.wantMessages) {
+				t.Errorf("Welcome messages = %q, want %q", got, tt.wantMessages)
+			}
+		})
+	}
+}
+
+func TestAuthService_RefreshToken(t *testing.T) {
+	sender := newMockOTPSender()
+	authService := NewAuthService(newMockUserRepository(), newMockOTPRepository(), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+	phoneNumber := "+14155550100"
+
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+	authResponse, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: sender.sent[phoneNumber]})
+	if err != nil {
+		t.Fatalf("VerifyOTP() unexpected error = %v", err)
+	}
+	if authResponse.RefreshToken == "" {
+		t.Fatal("VerifyOTP() returned no refresh token")
+	}
+
+	if _, err := authService.RefreshToken(context.Background(), &model.RefreshTokenRequest{RefreshToken: authResponse.Token}); !errors.Is(err, ErrInvalidRefresh) {
+		t.Errorf("RefreshToken(access token) error = %v, want %v", err, ErrInvalidRefresh)
+	}
+
+	refreshResponse, err := authService.RefreshToken(context.Background(), &model.RefreshTokenRequest{RefreshToken: authResponse.RefreshToken})
+	if err != nil {
+		t.Fatalf("RefreshToken() unexpected error = %v", err)
+	}
+	if refreshResponse.Token == "" {
+		t.Error("RefreshToken() returned an empty access token")
+	}
+}
+
+func TestAuthService_RefreshToken_CurrentUser(t *testing.T) {
+	userRepo := newMockUserRepository()
+	jwtManager := jwt.NewJWTManager("test-secret", 24, 720)
+	authService := NewAuthService(userRepo, newMockOTPRepository(), nil, newMockOTPSender(), nil, jwtManager, newTestConfig())
+
+	user := &model.User{PhoneNumber: "+14155550100", Role: model.RoleUser}
+	userRepo.Create(context.Background(), user)
+	_, refreshToken, err := jwtManager.GenerateTokenPair(user.ID, user.PhoneNumber, string(model.RoleUser))
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() unexpected error = %v", err)
+	}
+
+	// A promotion and a number change since sign-in show up in the refreshed token
+	user.Role = model.RoleAdmin
+	user.PhoneNumber = "+14155550101"
+	refreshed, err := authService.RefreshToken(context.Background(), &model.RefreshTokenRequest{RefreshToken: refreshToken})
+	if err != nil {
+		t.Fatalf("RefreshToken() unexpected error = %v", err)
+	}
+	claims, err := jwtManager.ValidateToken(refreshed.Token)
+	if err != nil {
+		t.Fatalf("ValidateToken() unexpected error = %v", err)
+	}
+	if claims.Role != string(model.RoleAdmin) || claims.PhoneNumber != "+14155550101" {
+		t.Errorf("Refreshed claims = role %q phone %q, want the user's current admin role and number", claims.Role, claims.PhoneNumber)
+	}
+
+	user.Status = model.UserStatusSuspended
+	if _, err := authService.RefreshToken(context.Background(), &model.RefreshTokenRequest{RefreshToken: refreshToken}); !errors.Is(err, ErrAccountSuspended) {
+		t.Errorf("RefreshToken() for a suspended user error = %v, want %v", err, ErrAccountSuspended)
+	}
+
+	userRepo.Delete(context.Background(), user.ID)
+	if _, err := authService.RefreshToken(context.Background(), &model.RefreshTokenRequest{RefreshToken: refreshToken}); !errors.Is(err, ErrInvalidRefresh) {
+		t.Errorf("RefreshToken() for a deleted user error = %v, want %v", err, ErrInvalidRefresh)
+	}
+}
+
+func TestAuthService_Alphabet(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.Alphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	cfg.OTP.CheckDigit = true
+	sender := newMockOTPSender()
+	authService := NewAuthService(newMockUserRepository(), newMockOTPRepository(), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+	phoneNumber := "+14155550100"
+
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+
+	// The Luhn check digit only applies to digit codes, so it is dropped here
+	code := sender.sent[phoneNumber]
+	if len(code) != cfg.OTP.Length {
+		t.Fatalf("Sent code %q has length %d, want %d", code, len(code), cfg.OTP.Length)
+	}
+	for _, char := range code {
+		if !strings.ContainsRune(cfg.OTP.Alphabet, char) {
+			t.Fatalf("Sent code %q contains %c outside the alphabet", code, char)
+		}
+	}
+
+	if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: strings.ToLower(code)}); err != nil {
+		t.Errorf("VerifyOTP() lowercase code unexpected error = %v", err)
+	}
+}
+
+func TestAuthService_SendOTP_ResendCooldown(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.ResendCooldown = 30 * time.Second
+	cfg.OTP.MaxAttempts = 10
+	sender := newMockOTPSender()
+	otpRepo := newMockOTPRepository()
+	authService := NewAuthService(newMockUserRepository(), otpRepo, nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+	phoneNumber := "+14155550100"
+	send := func() error {
+		_, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+		return err
+	}
+
+	if err := send(); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+
+	err := send()
+	var retryErr *apperrors.RetryAfterError
+	if !errors.As(err, &retryErr) || !errors.Is(err, ErrResendTooSoon) {
+		t.Fatalf("SendOTP() error = %v, want %v with retry after", err, ErrResendTooSoon)
+	}
+	if retryErr.RetryAfter <= 29*time.Second || retryErr.RetryAfter > 30*time.Second {
+		t.Errorf("RetryAfter = %v, want just under 30s", retryErr.RetryAfter)
+	}
+
+	// Once the cooldown has passed the pending OTP can be resent
+	otpRepo.otps[phoneNumber].ExpiresAt = otpRepo.otps[phoneNumber].ExpiresAt.Add(-31 * time.Second)
+	if err := send(); err != nil {
+		t.Fatalf("SendOTP() after cooldown unexpected error = %v", err)
+	}
+
+	// A consumed OTP resets the cooldown
+	if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: sender.sent[phoneNumber]}); err != nil {
+		t.Fatalf("VerifyOTP() unexpected error = %v", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("SendOTP() after verify unexpected error = %v", err)
+	}
+
+	// So does an expired one
+	delete(otpRepo.otps, phoneNumber)
+	if err := send(); err != nil {
+		t.Errorf("SendOTP() after expiry unexpected error = %v", err)
+	}
+}
+
+func TestAuthService_VerifyOTP_AttemptsRemaining(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.MaxAttempts = 3
+	authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+	phoneNumber := "+14155550100"
+
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2)
+	verify := func() error {
+		_, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "654321"})
+		return err
+	}
+
+	for _, wantRemaining := range []int{2, 1} {
+		err := verify()
+		var attemptsErr *apperrors.AttemptsRemainingError
+		if !errors.Is(err, ErrInvalidOTP) || !errors.As(err, &attemptsErr) {
+			t.Fatalf("VerifyOTP() error = %v, want %v with attempts remaining", err, ErrInvalidOTP)
+		}
+		if attemptsErr.Remaining != wantRemaining {
+			t.Errorf("Remaining = %v, want %v", attemptsErr.Remaining, wantRemaining)
+		}
+	}
+
+	// The last wrong code burns the OTP instead of reporting zero attempts left
+	if err := verify(); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("VerifyOTP() error = %v, want %v", err, ErrTooManyAttempts)
+	}
+	if _, exists := otpRepo.otps[phoneNumber]; exists {
+		t.Error("Expected OTP to be deleted after the last attempt")
+	}
+}
+
+func TestAuthService_SendOTP_ResendCooldownScalesWithFailures(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.MaxAttempts = 10
+	cfg.OTP.ResendCooldown = 30 * time.Second
+	cfg.OTP.ResendCooldownPerFailure = 20 * time.Second
+	cfg.OTP.ResendCooldownMax = 90 * time.Second
+	sender := newMockOTPSender()
+	otpRepo := newMockOTPRepository()
+	authService := NewAuthService(newMockUserRepository(), otpRepo, nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+
+	resendWait := func(phoneNumber string, failures int) time.Duration {
+		t.Helper()
+		if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+			t.Fatalf("SendOTP() unexpected error = %v", err)
+		}
+		for i := 0; i < failures; i++ {
+			if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "000000"}); !errors.Is(err, ErrInvalidOTP) {
+				t.Fatalf("VerifyOTP() error = %v, want %v", err, ErrInvalidOTP)
+			}
+		}
+
+		_, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+		var retryErr *apperrors.RetryAfterError
+		if !errors.As(err, &retryErr) || !errors.Is(err, ErrResendTooSoon) {
+			t.Fatalf("SendOTP() error = %v, want %v with retry after", err, ErrResendTooSoon)
+		}
+		return retryErr.RetryAfter
+	}
+
+	// base + per failure * failures, capped at the maximum
+	tests := []struct {
+		phoneNumber string
+		failures    int
+		want        time.Duration
+	}{
+		{"+14155550100", 0, 30 * time.Second},
+		{"+14155550101", 2, 70 * time.Second},
+		{"+14155550102", 5, 90 * time.Second},
+	}
+
+	for _, tt := range tests {
+		wait := resendWait(tt.phoneNumber, tt.failures)
+		if wait <= tt.want-time.Second || wait > tt.want {
+			t.Errorf("%d failures: RetryAfter = %v, want just under %v", tt.failures, wait, tt.want)
+		}
+	}
+}
+
+func TestAuthService_Limits(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.CumulativeVerifyBudget = 5
+	cfg.OTP.ResendCooldown = 30 * time.Second
+	cfg.OTP.ResendCooldownPerFailure = 10 * time.Second
+	authService, userRepo, otpRepo := createTestAuthServiceWithConfig(cfg)
+	phoneNumber := "+14155550100"
+
+	user := &model.User{PhoneNumber: phoneNumber, Status: model.UserStatusActive}
+	other := &model.User{PhoneNumber: "+14155550103", Status: model.UserStatusActive}
+	userRepo.Create(context.Background(), user)
+	userRepo.Create(context.Background(), other)
+
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+	otpRepo.otps[phoneNumber].Code = "123456"
+	if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "654321"}); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("VerifyOTP() error = %v, want %v", err, ErrInvalidOTP)
+	}
+
+	limits, err := authService.Limits(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Limits() unexpected error = %v", err)
+	}
+	want := model.LimitsResponse{
+		SendLimit:             3,
+		SendsRemaining:        2,
+		WindowSeconds:         600,
+		VerifyAttemptsPerOTP:  3,
+		VerifyBudget:          5,
+		VerifyBudgetRemaining: 4,
+		ResendCooldownSeconds: 40,
+	}
+	if *limits != want {
+		t.Errorf("Limits() = %+v, want %+v", *limits, want)
+	}
+
+	// Another user's usage does not leak into a fresh user's budget
+	limits, err = authService.Limits(context.Background(), other.ID)
+	if err != nil {
+		t.Fatalf("Limits() unexpected error = %v", err)
+	}
+	if limits.SendsRemaining != 3 || limits.VerifyBudgetRemaining != 5 || limits.ResendCooldownSeconds != 30 {
+		t.Errorf("Limits() for a fresh user = %+v, want the full budget", *limits)
+	}
+
+	if _, err := authService.Limits(context.Background(), 99); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Limits() error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+func TestAuthService_TOTPMode(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OTP.Mode = config.OTPModeTOTP
+	cfg.OTP.TOTPIssuer = "OTP Service"
+	cfg.OTP.TOTPPeriod = 30 * time.Second
+	cfg.OTP.TOTPSkew = 1
+	cfg.OTP.CumulativeVerifyBudget = 10
+	userRepo := newMockUserRepository()
+	otpRepo := newMockOTPRepository()
+	sender := newMockOTPSender()
+	authService := NewAuthService(userRepo, otpRepo, nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+	phoneNumber := "+14155550100"
+	verify := func(code string) (*model.AuthResponse, error) {
+		return authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: code})
+	}
+
+	// The first sign-in goes through SMS and enrolls the user
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+	response, err := verify(sender.sent[phoneNumber])
+	if err != nil {
+		t.Fatalf("VerifyOTP() with SMS code unexpected error = %v", err)
+	}
+	if response.TOTP == nil {
+		t.Fatal("Expected a TOTP enrollment on the first sign-in")
+	}
+	secret := response.TOTP.Secret
+	if userRepo.users[phoneNumber].TOTPSecret != secret {
+		t.Errorf("Stored secret = %q, want %q", userRepo.users[phoneNumber].TOTPSecret, secret)
+	}
+	if !strings.HasPrefix(response.TOTP.ProvisioningURI, "otpauth://totp/") || !strings.Contains(response.TOTP.ProvisioningURI, "secret="+secret) {
+		t.Errorf("ProvisioningURI = %q, want an otpauth URI carrying the secret", response.TOTP.ProvisioningURI)
+	}
+
+	// Enrolled users no longer get SMS codes
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); !errors.Is(err, ErrTOTPEnrolled) {
+		t.Errorf("SendOTP() after enrollment error = %v, want %v", err, ErrTOTPEnrolled)
+	}
+
+	step := totp.Step(time.Now(), cfg.OTP.TOTPPeriod)
+	code := func(step int64) string {
+		c, _ := totp.Code(secret, step)
+		return c
+	}
+
+	// One step behind is tolerated as clock skew
+	response, err = verify(code(step - 1))
+	if err != nil {
+		t.Fatalf("VerifyOTP() with TOTP code unexpected error = %v", err)
+	}
+	if response.Token == "" || response.TOTP != nil {
+		t.Errorf("VerifyOTP() = %+v, want tokens and no new enrollment", response)
+	}
+
+	// A used code cannot be replayed
+	if _, err := verify(code(step - 1)); !errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("VerifyOTP() replay error = %v, want %v", err, ErrInvalidOTP)
+	}
+
+	// One step ahead is tolerated too, two is not
+	if _, err := verify(code(step + 1)); err != nil {
+		t.Errorf("VerifyOTP() one step ahead unexpected error = %v", err)
+	}
+	if _, err := verify(code(step + 3)); !errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("VerifyOTP() three steps ahead error = %v, want %v", err, ErrInvalidOTP)
+	}
+
+	// Failed TOTP codes count against the cumulative budget
+	if failures := otpRepo.verifyFailures[phoneNumber]; failures != 2 {
+		t.Errorf("Verify failures = %d, want 2", failures)
+	}
+}
+
+func TestAuthService_VerifyOTP_PhoneClaimPrivacy(t *testing.T) {
+	phoneNumber := "+14155550100"
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{utils.PhoneClaimFull, phoneNumber},
+		{utils.PhoneClaimMasked, "+1******0100"},
+		{utils.PhoneClaimHashed, utils.PhoneClaim(utils.PhoneClaimHashed, "test-secret", phoneNumber)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.JWT.SecretKey = "test-secret"
+			cfg.JWT.PhoneClaim = tt.mode
+			authService, _, otpRepo := createTestAuthServiceWithConfig(cfg)
+			otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: phoneNumber, Code: "123456"}, 2)
+
+			resp, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: "123456"})
+			if err != nil {
+				t.Fatalf("VerifyOTP() unexpected error = %v", err)
+			}
+
+			// Refreshed access tokens carry the claim over unchanged
+			jwtManager := jwt.NewJWTManager("test-secret", 24, 720)
+			refreshed, err := jwtManager.RefreshAccessToken(resp.RefreshToken)
+			if err != nil {
+				t.Fatalf("RefreshAccessToken() unexpected error = %v", err)
+			}
+
+			for _, token := range []string{resp.Token, refreshed} {
+				claims, err := jwtManager.ValidateToken(token)
+				if err != nil {
+					t.Fatalf("ValidateToken() unexpected error = %v", err)
+				}
+				if claims.PhoneNumber != tt.want {
+					t.Errorf("phone_number claim = %q, want %q", claims.PhoneNumber, tt.want)
+				}
+				if claims.UserID != resp.User.ID {
+					t.Errorf("user_id claim = %d, want %d", claims.UserID, resp.User.ID)
+				}
+			}
+
+			// The response body still tells the client its own number
+			if resp.User.PhoneNumber != phoneNumber {
+				t.Errorf("User.PhoneNumber = %q, want %q", resp.User.PhoneNumber, phoneNumber)
+			}
+		})
+	}
+}
+
+type mockEmailSender struct {
+	sent map[string]string
+}
+
+func (m *mockEmailSender) Name() string {
+	return "mock"
+}
+
+func (m *mockEmailSender) Send(address, code string) error {
+	m.sent[address] = code
+	return nil
+}
+
+func TestAuthService_EmailChannel(t *testing.T) {
+	userRepo := newMockUserRepository()
+	otpRepo := newMockOTPRepository()
+	smsSender := newMockOTPSender()
+	emailSender := &mockEmailSender{sent: make(map[string]string)}
+	authService := NewAuthService(userRepo, otpRepo, nil, smsSender, emailSender, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{Email: " User@Example.com"}); err != nil {
+		t.Fatalf("SendOTP() unexpected error = %v", err)
+	}
+	code, sent := emailSender.sent["user@example.com"]
+	if !sent {
+		t.Fatalf("No email sent to the normalized address, sent = %v", emailSender.sent)
+	}
+	if len(smsSender.sent) != 0 {
+		t.Errorf("SMS sent for an email request: %v", smsSender.sent)
+	}
+	// Email state lives under its own keys, apart from any phone's
+	if _, ok := otpRepo.otps["email:user@example.com"]; !ok {
+		t.Errorf("OTP not stored under the email identifier, otps = %v", otpRepo.otps)
+	}
+	if otpRepo.rateLimits["email:user@example.com"] != 1 {
+		t.Errorf("Rate limit count = %d, want 1", otpRepo.rateLimits["email:user@example.com"])
+	}
+
+	response, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{Email: "user@example.com", OTPCode: code})
+	if err != nil {
+		t.Fatalf("VerifyOTP() unexpected error = %v", err)
+	}
+	if response.User.Email != "user@example.com" || response.User.PhoneNumber != "" {
+		t.Errorf("User = %+v, want an email user without a phone number", response.User)
+	}
+
+	// Signing in again finds the same user instead of creating another
+	authService.SendOTP(context.Background(), &model.SendOTPRequest{Email: "user@example.com"})
+	again, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{Email: "user@example.com", OTPCode: emailSender.sent["user@example.com"]})
+	if err != nil {
+		t.Fatalf("VerifyOTP() second sign-in unexpected error = %v", err)
+	}
+	if again.User.ID != response.User.ID {
+		t.Errorf("Second sign-in user ID = %d, want %d", again.User.ID, response.User.ID)
+	}
+
+	limits, err := authService.Limits(context.Background(), response.User.ID)
+	if err != nil {
+		t.Fatalf("Limits() unexpected error = %v", err)
+	}
+	if limits.SendsRemaining != newTestConfig().OTP.MaxAttempts-2 {
+		t.Errorf("SendsRemaining = %d, want %d", limits.SendsRemaining, newTestConfig().OTP.MaxAttempts-2)
+	}
+}
+
+func TestAuthService_EmailChannel_Identifiers(t *testing.T) {
+	emailService := NewAuthService(newMockUserRepository(), newMockOTPRepository(), nil, newMockOTPSender(), &mockEmailSender{sent: make(map[string]string)}, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+	smsOnlyService, _, _ := createTestAuthService()
+
+	tests := []struct {
+		name        string
+		authService AuthService
+		phoneNumber string
+		email       string
+		wantErr     error
+	}{
+		{"Both identifiers", emailService, "+14155550100", "user@example.com", ErrIdentifierConflict},
+		{"Neither identifier", emailService, "", "", ErrInvalidPhoneNumber},
+		{"Invalid email", emailService, "", "not-an-email", ErrInvalidEmail},
+		{"Email sign-in turned off", smsOnlyService, "", "user@example.com", ErrEmailDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: tt.phoneNumber, Email: tt.email})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SendOTP() error = %v, want %v", err, tt.wantErr)
+			}
+			_, err = tt.authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: tt.phoneNumber, Email: tt.email, OTPCode: "123456"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyOTP() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// mockVoiceSender is an SMS provider that can also place calls
+type mockVoiceSender struct {
+	*mockOTPSender
+	calls map[string]string
+}
+
+func (m *mockVoiceSender) Call(ctx context.Context, phoneNumber, code string) error {
+	m.calls[phoneNumber] = code
+	return nil
+}
+
+func TestAuthService_SendOTP_Escalation(t *testing.T) {
+	const phoneNumber = "+14155550100"
+
+	tests := []struct {
+		name      string
+		order     []string
+		canCall   bool
+		userEmail string
+		want      []string
+	}{
+		{"SMS, voice then email", []string{"sms", "voice", "email"}, true, "user@example.com", []string{"sms", "voice", "email", "email"}},
+		{"Custom order", []string{"sms", "email", "voice"}, true, "user@example.com", []string{"sms", "email", "voice", "voice"}},
+		{"Provider cannot call", []string{"sms", "voice", "email"}, false, "user@example.com", []string{"sms", "email", "email"}},
+		{"No address on file", []string{"sms", "voice", "email"}, true, "", []string{"sms", "voice", "voice"}},
+		{"Unknown channels ignored", []string{"SMS", "fax", "voice"}, true, "", []string{"sms", "voice"}},
+		{"Disabled", nil, true, "user@example.com", []string{"sms", "sms", "sms"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OTP.MaxAttempts = 10
+			cfg.OTP.EscalationOrder = tt.order
+
+			userRepo := newMockUserRepository()
+			userRepo.Create(context.Background(), &model.User{PhoneNumber: phoneNumber, Email: tt.userEmail, Status: model.UserStatusActive})
+			smsSender := newMockOTPSender()
+			var sender OTPSender = smsSender
+			voiceSender := &mockVoiceSender{mockOTPSender: smsSender, calls: make(map[string]string)}
+			if tt.canCall {
+				sender = voiceSender
+			}
+			emailSender := &mockEmailSender{sent: make(map[string]string)}
+			otpRepo := newMockOTPRepository()
+			authService := NewAuthService(userRepo, otpRepo, nil, sender, emailSender, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+
+			for i, want := range tt.want {
+				smsSender.sent = make(map[string]string)
+				voiceSender.calls = make(map[string]string)
+				emailSender.sent = make(map[string]string)
+
+				resp, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber})
+				if err != nil {
+					t.Fatalf("Send %d: SendOTP() unexpected error = %v", i+1, err)
+				}
+				if resp.Channel != want {
+					t.Errorf("Send %d: Channel = %q, want %q", i+1, resp.Channel, want)
+				}
+
+				var code string
+				switch want {
+				case "sms":
+					code = smsSender.sent[phoneNumber]
+				case "voice":
+					code = voiceSender.calls[phoneNumber]
+				case "email":
+					code = emailSender.sent[tt.userEmail]
+				}
+				if code == "" || len(smsSender.sent)+len(voiceSender.calls)+len(emailSender.sent) != 1 {
+					t.Errorf("Send %d: sms = %v, calls = %v, emails = %v, want one delivery by %s", i+1, smsSender.sent, voiceSender.calls, emailSender.sent, want)
+				}
+			}
+
+			// Whatever the channel, the code is verified against the phone number
+			code := smsSender.sent[phoneNumber] + voiceSender.calls[phoneNumber] + emailSender.sent[tt.userEmail]
+			if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: code}); err != nil {
+				t.Errorf("VerifyOTP() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_ChangePhoneNumber(t *testing.T) {
+	const oldPhone, newPhone, takenPhone = "+14155550100", "+14155550101", "+14155550103"
+
+	userRepo := newMockUserRepository()
+	otpRepo := newMockOTPRepository()
+	sender := newMockOTPSender()
+	authService := NewAuthService(userRepo, otpRepo, nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+
+	user := &model.User{PhoneNumber: oldPhone, Status: model.UserStatusActive}
+	userRepo.Create(context.Background(), user)
+	userRepo.Create(context.Background(), &model.User{PhoneNumber: takenPhone, Status: model.UserStatusActive})
+	otpRepo.rateLimits[oldPhone] = 2
+	otpRepo.otps[oldPhone] = &model.OTP{PhoneNumber: oldPhone, Code: "111111", ExpiresAt: time.Now().Add(time.Minute)}
+
+	errorTests := []struct {
+		name        string
+		phoneNumber string
+		wantErr     error
+	}{
+		{"Invalid number", "12345", ErrInvalidPhoneNumber},
+		{"Current number", oldPhone, ErrSamePhoneNumber},
+		{"Another account's number", takenPhone, ErrPhoneNumberTaken},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := authService.SendPhoneChangeOTP(context.Background(), user.ID, &model.UpdatePhoneRequest{PhoneNumber: tt.phoneNumber}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("SendPhoneChangeOTP() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := authService.ChangePhoneNumber(context.Background(), user.ID, &model.UpdatePhoneRequest{PhoneNumber: tt.phoneNumber, OTPCode: "123456"}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ChangePhoneNumber() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	resp, err := authService.SendPhoneChangeOTP(context.Background(), user.ID, &model.UpdatePhoneRequest{PhoneNumber: newPhone})
+	if err != nil {
+		t.Fatalf("SendPhoneChangeOTP() unexpected error = %v", err)
+	}
+	if resp.Channel != "sms" || sender.sent[newPhone] == "" {
+		t.Fatalf("SendPhoneChangeOTP() channel = %q, sent = %v, want an SMS to the new number", resp.Channel, sender.sent)
+	}
+
+	// A wrong code leaves the account alone
+	if _, err := authService.ChangePhoneNumber(context.Background(), user.ID, &model.UpdatePhoneRequest{PhoneNumber: newPhone, OTPCode: "000000"}); !errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("ChangePhoneNumber() wrong code error = %v, want %v", err, ErrInvalidOTP)
+	}
+	if user.PhoneNumber != oldPhone {
+		t.Fatalf("PhoneNumber after a wrong code = %q, want %q", user.PhoneNumber, oldPhone)
+	}
+
+	authResp, err := authService.ChangePhoneNumber(context.Background(), user.ID, &model.UpdatePhoneRequest{PhoneNumber: newPhone, OTPCode: sender.sent[newPhone]})
+	if err != nil {
+		t.Fatalf("ChangePhoneNumber() unexpected error = %v", err)
+	}
+	if authResp.Token == "" || authResp.User.PhoneNumber != newPhone {
+		t.Errorf("ChangePhoneNumber() = %+v, want new tokens for %s", authResp, newPhone)
+	}
+	if found, err := userRepo.GetByPhoneNumber(context.Background(), newPhone); err != nil || found.ID != user.ID {
+		t.Errorf("GetByPhoneNumber(new) = %v, %v, want user %d", found, err, user.ID)
+	}
+	if _, err := userRepo.GetByPhoneNumber(context.Background(), oldPhone); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetByPhoneNumber(old) error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+
+	// The old number's state goes with it, and the change code is spent
+	if _, pending := otpRepo.otps[oldPhone]; pending || otpRepo.rateLimits[oldPhone] != 0 {
+		t.Errorf("Old number state left behind: otp pending = %v, rate limit = %d", pending, otpRepo.rateLimits[oldPhone])
+	}
+	if _, pending := otpRepo.otps[newPhone]; pending {
+		t.Error("Change code still pending after use")
+	}
+}
+
+func TestAuthService_DeleteAccount(t *testing.T) {
+	const phoneNumber = "+14155550100"
+
+	userRepo := newMockUserRepository()
+	otpRepo := newMockOTPRepository()
+	authService := NewAuthService(userRepo, otpRepo, nil, newMockOTPSender(), nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+
+	user := &model.User{PhoneNumber: phoneNumber, Status: model.UserStatusActive}
+	userRepo.Create(context.Background(), user)
+	otpRepo.rateLimits[phoneNumber] = 2
+	otpRepo.otps[phoneNumber] = &model.OTP{PhoneNumber: phoneNumber, Code: "111111", ExpiresAt: time.Now().Add(time.Minute)}
+
+	if err := authService.DeleteAccount(context.Background(), user.ID); err != nil {
+		t.Fatalf("DeleteAccount() unexpected error = %v", err)
+	}
+	if _, err := userRepo.GetByID(context.Background(), user.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetByID() after delete error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if _, pending := otpRepo.otps[phoneNumber]; pending || otpRepo.rateLimits[phoneNumber] != 0 {
+		t.Errorf("OTP state left behind: otp pending = %v, rate limit = %d", pending, otpRepo.rateLimits[phoneNumber])
+	}
+
+	if err := authService.DeleteAccount(context.Background(), user.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("DeleteAccount() again error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+func TestAuthService_WriteOnlyPrivacyMode(t *testing.T) {
+	const phoneNumber = "+14155550100"
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.User{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	protector, err := utils.NewPhoneProtector("test-hmac-key", "")
+	if err != nil {
+		t.Fatalf("NewPhoneProtector() unexpected error = %v", err)
+	}
+
+	cfg := newTestConfig()
+	userRepo := repository.NewPrivateUserRepository(repository.NewUserRepository(db, cfg), protector)
+	authService := NewAuthService(userRepo, newMockOTPRepository(), nil, newMockOTPSender(), nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+
+	user := &model.User{PhoneNumber: phoneNumber, Status: model.UserStatusActive}
+	if err := userRepo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create() unexpected error = %v", err)
+	}
+
+	// The number cannot be read back, so its limits cannot be looked up
+	if _, err := authService.Limits(context.Background(), user.ID); !errors.Is(err, ErrPhonesHashed) {
+		t.Errorf("Limits() error = %v, want %v", err, ErrPhonesHashed)
+	}
+
+	// Deletion still succeeds; the OTP state is left to expire
+	if err := authService.DeleteAccount(context.Background(), user.ID); err != nil {
+		t.Fatalf("DeleteAccount() unexpected error = %v", err)
+	}
+	if _, err := userRepo.GetByID(context.Background(), user.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetByID() after delete error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+func TestAuthService_PhoneFormsShareOneKey(t *testing.T) {
+	const phoneNumber = "+14155550100"
+
+	t.Run("Normalized", func(t *testing.T) {
+		sender := newMockOTPSender()
+		authService := NewAuthService(newMockUserRepository(), newMockOTPRepository(), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+
+		if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: "+1 (415) 555-0100"}); err != nil {
+			t.Fatalf("SendOTP() unexpected error = %v", err)
+		}
+		status, err := authService.OTPStatus(context.Background(), " +1 415.555.0100 ")
+		if err != nil || !status.Pending {
+			t.Errorf("OTPStatus() = %+v, %v, want the pending code", status, err)
+		}
+		resp, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: "+1-415-555-0100", OTPCode: sender.sent[phoneNumber]})
+		if err != nil {
+			t.Fatalf("VerifyOTP() unexpected error = %v", err)
+		}
+		if resp.User.PhoneNumber != phoneNumber {
+			t.Errorf("VerifyOTP() phone = %q, want %q", resp.User.PhoneNumber, phoneNumber)
+		}
+	})
+
+	t.Run("RequireE164", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.OTP.RequireE164 = true
+		sender := newMockOTPSender()
+		authService := NewAuthService(newMockUserRepository(), newMockOTPRepository(), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), cfg)
+
+		if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: "+1 (415) 555-0100"}); !errors.Is(err, ErrInvalidPhoneNumber) {
+			t.Errorf("SendOTP() formatted error = %v, want %v", err, ErrInvalidPhoneNumber)
+		}
+		if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+			t.Fatalf("SendOTP() unexpected error = %v", err)
+		}
+		if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: "+1-415-555-0100", OTPCode: sender.sent[phoneNumber]}); !errors.Is(err, ErrInvalidPhoneNumber) {
+			t.Errorf("VerifyOTP() formatted error = %v, want %v", err, ErrInvalidPhoneNumber)
+		}
+		if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: sender.sent[phoneNumber]}); err != nil {
+			t.Errorf("VerifyOTP() unexpected error = %v", err)
+		}
+	})
+}
+
+func TestAuthService_VerifyOTP_SignUpRole(t *testing.T) {
+	const adminPhone, userPhone = "+14155550100", "+14155550101"
+
+	cfg := newTestConfig()
+	cfg.Auth.AdminPhoneNumbers = []string{adminPhone}
+	sender := newMockOTPSender()
+	jwtManager := jwt.NewJWTManager("test-secret", 24, 720)
+	authService := NewAuthService(newMockUserRepository(), newMockOTPRepository(), nil, sender, nil, jwtManager, cfg)
+
+	tests := []struct {
+		phoneNumber string
+		wantRole    model.UserRole
+	}{
+		{adminPhone, model.RoleAdmin},
+		{userPhone, model.RoleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.phoneNumber, func(t *testing.T) {
+			if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: tt.phoneNumber}); err != nil {
+				t.Fatalf("SendOTP() unexpected error = %v", err)
+			}
+			resp, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: tt.phoneNumber, OTPCode: sender.sent[tt.phoneNumber]})
+			if err != nil {
+				t.Fatalf("VerifyOTP() unexpected error = %v", err)
+			}
+			if resp.User.Role != tt.wantRole {
+				t.Errorf("User role = %q, want %q", resp.User.Role, tt.wantRole)
+			}
+
+			claims, err := jwtManager.ValidateToken(resp.Token)
+			if err != nil {
+				t.Fatalf("ValidateToken() unexpected error = %v", err)
+			}
+			if claims.Role != string(tt.wantRole) {
+				t.Errorf("Token role = %q, want %q", claims.Role, tt.wantRole)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package service
+
+import "github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+
+// EmailSender delivers a generated OTP code to an email address, the email
+// channel's counterpart to OTPSender
+type EmailSender interface {
+	Name() string
+	Send(address, code string) error
+}
+
+// consoleEmailSender logs OTP codes instead of emailing them; the codes
+// themselves only appear with debugLog set
+type consoleEmailSender struct {
+	debugLog bool
+}
+
+func NewConsoleEmailSender(debugLog bool) EmailSender {
+	return &consoleEmailSender{debugLog: debugLog}
+}
+
+func (s *consoleEmailSender) Name() string {
+	return "console"
+}
+
+func (s *consoleEmailSender) Send(address, code string) error {
+	utils.LogOTP(address, code, s.debugLog)
+	return nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+)
+
+// Verification results reported to AuthMetricsRecorder
+const (
+	VerifyResultSuccess = "success"
+	VerifyResultInvalid = "invalid"
+	VerifyResultExpired = "expired"
+	VerifyResultTooMany = "too_many"
+	VerifyResultOther   = "other"
+)
+
+// AuthMetricsRecorder receives the outcome of every OTP send and verify;
+// *metrics.Metrics implements it
+type AuthMetricsRecorder interface {
+	ObserveOTPSent(channel string)
+	ObserveOTPRateLimited()
+	ObserveOTPVerify(result string, duration time.Duration)
+}
+
+// instrumentedAuthService reports sends, rate-limit rejections and verify
+// results and latency to a metrics recorder
+type instrumentedAuthService struct {
+	AuthService
+	recorder AuthMetricsRecorder
+}
+
+func NewInstrumentedAuthService(authService AuthService, recorder AuthMetricsRecorder) AuthService {
+	return &instrumentedAuthService{
+		AuthService: authService,
+		recorder:    recorder,
+	}
+}
+
+func (s *instrumentedAuthService) SendOTP(ctx context.Context, req *model.SendOTPRequest) (*model.SendOTPResponse, error) {
+	response, err := s.AuthService.SendOTP(ctx, req)
+	switch {
+	case err == nil:
+		s.recorder.ObserveOTPSent(response.Channel)
+	case errors.Is(err, ErrRateLimitExceeded), errors.Is(err, ErrResendTooSoon):
+		s.recorder.ObserveOTPRateLimited()
+	}
+	return response, err
+}
+
+func (s *instrumentedAuthService) VerifyOTP(ctx context.Context, req *model.VerifyOTPRequest) (*model.AuthResponse, error) {
+	start := time.Now()
+	response, err := s.AuthService.VerifyOTP(ctx, req)
+	s.recorder.ObserveOTPVerify(verifyResult(err), time.Since(start))
+	return response, err
+}
+
+// verifyResult buckets a VerifyOTP error into the few results worth alerting on
+func verifyResult(err error) string {
+	switch {
+	case err == nil:
+		return VerifyResultSuccess
+	case errors.Is(err, ErrInvalidOTP), errors.Is(err, ErrOTPMistyped):
+		return VerifyResultInvalid
+	case errors.Is(err, ErrOTPExpired):
+		return VerifyResultExpired
+	case errors.Is(err, ErrTooManyAttempts), errors.Is(err, ErrAccountLocked), errors.Is(err, ErrVerifyTooSoon):
+		return VerifyResultTooMany
+	default:
+		return VerifyResultOther
+	}
+}
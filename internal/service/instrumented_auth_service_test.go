@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
+)
+
+// recordingAuthMetrics counts what the instrumented service reports
+type recordingAuthMetrics struct {
+	sent        map[string]int
+	rateLimited int
+	verifies    map[string]int
+}
+
+func newRecordingAuthMetrics() *recordingAuthMetrics {
+	return &recordingAuthMetrics{sent: make(map[string]int), verifies: make(map[string]int)}
+}
+
+func (r *recordingAuthMetrics) ObserveOTPSent(channel string) { r.sent[channel]++ }
+func (r *recordingAuthMetrics) ObserveOTPRateLimited()        { r.rateLimited++ }
+func (r *recordingAuthMetrics) ObserveOTPVerify(result string, duration time.Duration) {
+	r.verifies[result]++
+}
+
+// stubAuthService answers SendOTP and VerifyOTP with fixed errors
+type stubAuthService struct {
+	AuthService
+	sendErr   error
+	verifyErr error
+}
+
+func (s *stubAuthService) SendOTP(ctx context.Context, req *model.SendOTPRequest) (*model.SendOTPResponse, error) {
+	if s.sendErr != nil {
+		return nil, s.sendErr
+	}
+	return &model.SendOTPResponse{Channel: "sms"}, nil
+}
+
+func (s *stubAuthService) VerifyOTP(ctx context.Context, req *model.VerifyOTPRequest) (*model.AuthResponse, error) {
+	if s.verifyErr != nil {
+		return nil, s.verifyErr
+	}
+	return &model.AuthResponse{}, nil
+}
+
+func TestInstrumentedAuthService_SendOTP(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		wantSent        int
+		wantRateLimited int
+	}{
+		{name: "sent", wantSent: 1},
+		{name: "rate limited", err: ErrRateLimitExceeded, wantRateLimited: 1},
+		{name: "resend cooldown", err: &apperrors.RetryAfterError{Err: ErrResendTooSoon, RetryAfter: time.Second}, wantRateLimited: 1},
+		{name: "invalid phone", err: ErrInvalidPhoneNumber},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := newRecordingAuthMetrics()
+			authService := NewInstrumentedAuthService(&stubAuthService{sendErr: tt.err}, recorder)
+
+			authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: "+14155550100"})
+
+			if recorder.sent["sms"] != tt.wantSent {
+				t.Errorf("sent[sms] = %d, want %d", recorder.sent["sms"], tt.wantSent)
+			}
+			if recorder.rateLimited != tt.wantRateLimited {
+				t.Errorf("rateLimited = %d, want %d", recorder.rateLimited, tt.wantRateLimited)
+			}
+		})
+	}
+}
+
+func TestInstrumentedAuthService_VerifyOTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantResult string
+	}{
+		{name: "success", wantResult: VerifyResultSuccess},
+		{name: "wrong code", err: &apperrors.AttemptsRemainingError{Err: ErrInvalidOTP, Remaining: 2}, wantResult: VerifyResultInvalid},
+		{name: "mistyped code", err: ErrOTPMistyped, wantResult: VerifyResultInvalid},
+		{name: "expired", err: ErrOTPExpired, wantResult: VerifyResultExpired},
+		{name: "too many attempts", err: ErrTooManyAttempts, wantResult: VerifyResultTooMany},
+		{name: "locked", err: &apperrors.RetryAfterError{Err: ErrAccountLocked, RetryAfter: time.Minute}, wantResult: VerifyResultTooMany},
+		{name: "other", err: fmt.Errorf("lookup user: %w", ErrServiceUnavailable), wantResult: VerifyResultOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := newRecordingAuthMetrics()
+			authService := NewInstrumentedAuthService(&stubAuthService{verifyErr: tt.err}, recorder)
+
+			authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: "+14155550100", OTPCode: "123456"})
+
+			if len(recorder.verifies) != 1 || recorder.verifies[tt.wantResult] != 1 {
+				t.Errorf("verifies = %v, want one %q", recorder.verifies, tt.wantResult)
+			}
+		})
+	}
+}
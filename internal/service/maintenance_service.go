@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+)
+
+type MaintenanceService interface {
+	Status(ctx context.Context) (*model.MaintenanceStatusResponse, error)
+	Enable(ctx context.Context, duration time.Duration) (*model.MaintenanceStatusResponse, error)
+	Disable(ctx context.Context) (*model.MaintenanceStatusResponse, error)
+}
+
+type maintenanceService struct {
+	maintenanceRepo repository.MaintenanceRepository
+	config          *config.Config
+}
+
+func NewMaintenanceService(maintenanceRepo repository.MaintenanceRepository, config *config.Config) MaintenanceService {
+	return &maintenanceService{
+		maintenanceRepo: maintenanceRepo,
+		config:          config,
+	}
+}
+
+// Status combines the static MAINTENANCE_MODE setting with the runtime Redis flag
+func (s *maintenanceService) Status(ctx context.Context) (*model.MaintenanceStatusResponse, error) {
+	if s.config.Server.MaintenanceMode {
+		return &model.MaintenanceStatusResponse{Enabled: true, Source: "config"}, nil
+	}
+
+	enabled, ttl, err := s.maintenanceRepo.GetMaintenance(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance status: %w", err)
+	}
+	if !enabled {
+		return &model.MaintenanceStatusResponse{Enabled: false}, nil
+	}
+
+	status := &model.MaintenanceStatusResponse{Enabled: true, Source: "runtime"}
+	if ttl > 0 {
+		until := time.Now().Add(ttl).UTC()
+		status.Until = &until
+	}
+	return status, nil
+}
+
+// Enable turns maintenance mode on; a zero duration keeps it on until disabled
+func (s *maintenanceService) Enable(ctx context.Context, duration time.Duration) (*model.MaintenanceStatusResponse, error) {
+	if err := s.maintenanceRepo.SetMaintenance(ctx, duration); err != nil {
+		return nil, fmt.Errorf("failed to enable maintenance mode: %w", err)
+	}
+	return s.Status(ctx)
+}
+
+func (s *maintenanceService) Disable(ctx context.Context) (*model.MaintenanceStatusResponse, error) {
+	if err := s.maintenanceRepo.ClearMaintenance(ctx); err != nil {
+		return nil, fmt.Errorf("failed to disable maintenance mode: %w", err)
+	}
+	return s.Status(ctx)
+}
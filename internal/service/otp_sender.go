@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/metrics"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+)
+
+// OTPSender delivers a generated OTP code through a provider; senderID is the
+// region's registered "from" ID and may be empty to use the provider default.
+// SendMessage delivers free text such as the welcome SMS through the same provider.
+type OTPSender interface {
+	Name() string
+	Send(ctx context.Context, senderID, phoneNumber, code string) error
+	SendMessage(ctx context.Context, senderID, phoneNumber, message string) error
+}
+
+// VoiceCaller is implemented by providers that can also read a code out in a
+// phone call; calls always come from the provider's own number
+type VoiceCaller interface {
+	Call(ctx context.Context, phoneNumber, code string) error
+}
+
+// consoleSender logs OTP codes instead of delivering them (per requirements);
+// the codes themselves only appear with debugLog set
+type consoleSender struct {
+	debugLog bool
+}
+
+func NewConsoleSender(debugLog bool) OTPSender {
+	return &consoleSender{debugLog: debugLog}
+}
+
+func (s *consoleSender) Name() string {
+	return "console"
+}
+
+func (s *consoleSender) Send(ctx context.Context, senderID, phoneNumber, code string) error {
+	if senderID != "" {
+		log.Printf("Sending from sender ID %s", senderID)
+	}
+	utils.LogOTP(phoneNumber, code, s.debugLog)
+	return nil
+}
+
+func (s *consoleSender) Call(ctx context.Context, phoneNumber, code string) error {
+	log.Printf("Calling %s", utils.MaskPhoneNumber(phoneNumber))
+	utils.LogOTP(phoneNumber, code, s.debugLog)
+	return nil
+}
+
+func (s *consoleSender) SendMessage(ctx context.Context, senderID, phoneNumber, message string) error {
+	if senderID != "" {
+		log.Printf("Sending from sender ID %s", senderID)
+	}
+	log.Printf("SMS for %s: %s", utils.MaskPhoneNumber(phoneNumber), message)
+	return nil
+}
+
+// instrumentedSender records per-provider latency and errors around each Send call
+type instrumentedSender struct {
+	sender  OTPSender
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedSender keeps the provider's voice calls available when it has them
+func NewInstrumentedSender(sender OTPSender, m *metrics.Metrics) OTPSender {
+	instrumented := &instrumentedSender{
+		sender:  sender,
+		metrics: m,
+	}
+	if caller, ok := sender.(VoiceCaller); ok {
+		return &instrumentedVoiceSender{instrumentedSender: instrumented, caller: caller}
+	}
+	return instrumented
+}
+
+func (s *instrumentedSender) Name() string {
+	return s.sender.Name()
+}
+
+func (s *instrumentedSender) Send(ctx context.Context, senderID, phoneNumber, code string) error {
+	start := time.Now()
+	err := s.sender.Send(ctx, senderID, phoneNumber, code)
+	s.metrics.ObserveSMSSend(s.sender.Name(), time.Since(start), err)
+	return err
+}
+
+func (s *instrumentedSender) SendMessage(ctx context.Context, senderID, phoneNumber, message string) error {
+	start := time.Now()
+	err := s.sender.SendMessage(ctx, senderID, phoneNumber, message)
+	s.metrics.ObserveSMSSend(s.sender.Name(), time.Since(start), err)
+	return err
+}
+
+// instrumentedVoiceSender also records calls, under the provider name with a "_voice" suffix
+type instrumentedVoiceSender struct {
+	*instrumentedSender
+	caller VoiceCaller
+}
+
+func (s *instrumentedVoiceSender) Call(ctx context.Context, phoneNumber, code string) error {
+	start := time.Now()
+	err := s.caller.Call(ctx, phoneNumber, code)
+	s.metrics.ObserveSMSSend(s.sender.Name()+"_voice", time.Since(start), err)
+	return err
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentedSender_RecordsSuccess(t *testing.T) {
+	m := metrics.New()
+	sender := NewInstrumentedSender(newMockOTPSender(), m)
+
+	if err := sender.Send(context.Background(), "", "+1234567890", "123456"); err != nil {
+		t.Fatalf("Send() unexpected error = %v", err)
+	}
+
+	count, err := testutil.GatherAndCount(m.Registry(), "sms_send_duration_seconds")
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("sms_send_duration_seconds series = %v, want 1", count)
+	}
+
+	count, err = testutil.GatherAndCount(m.Registry(), "sms_send_errors_total")
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("sms_send_errors_total series = %v, want 0", count)
+	}
+}
+
+func TestInstrumentedSender_RecordsFailure(t *testing.T) {
+	m := metrics.New()
+	mockSender := newMockOTPSender()
+	mockSender.sendErr = errors.New("provider unavailable")
+	sender := NewInstrumentedSender(mockSender, m)
+
+	if err := sender.Send(context.Background(), "", "+1234567890", "123456"); err == nil {
+		t.Fatal("Send() expected error but got none")
+	}
+
+	count, err := testutil.GatherAndCount(m.Registry(), "sms_send_duration_seconds")
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("sms_send_duration_seconds series = %v, want 1", count)
+	}
+
+	count, err = testutil.GatherAndCount(m.Registry(), "sms_send_errors_total")
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("sms_send_errors_total series = %v, want 1", count)
+	}
+}
+
+func TestInstrumentedSender_VoiceCalls(t *testing.T) {
+	m := metrics.New()
+
+	if _, ok := NewInstrumentedSender(newMockOTPSender(), m).(VoiceCaller); ok {
+		t.Error("Instrumented SMS-only sender claims to place calls")
+	}
+
+	caller, ok := NewInstrumentedSender(NewConsoleSender(false), m).(VoiceCaller)
+	if !ok {
+		t.Fatal("Instrumented console sender lost its voice calls")
+	}
+	if err := caller.Call(context.Background(), "+14155550100", "123456"); err != nil {
+		t.Fatalf("Call() unexpected error = %v", err)
+	}
+	count, err := testutil.GatherAndCount(m.Registry(), "sms_send_duration_seconds")
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("sms_send_duration_seconds series = %v, want 1", count)
+	}
+}
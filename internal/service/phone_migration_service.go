@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
+)
+
+// phoneMigrationBatchSize is how many users are loaded per query
+const phoneMigrationBatchSize = 500
+
+// PhoneMigrationService converts numbers stored before E.164 was enforced
+type PhoneMigrationService interface {
+	Normalize(ctx context.Context, dryRun bool) (*PhoneMigrationReport, error)
+}
+
+// PhoneChange is a stored number and the E.164 form it converts to
+type PhoneChange struct {
+	UserID uint
+	From   string
+	To     string
+}
+
+// PhoneDuplicate is a set of users whose numbers collapse to the same E.164
+// number. None of them is changed; an operator has to decide which to keep.
+type PhoneDuplicate struct {
+	PhoneNumber string
+	UserIDs     []uint
+}
+
+type PhoneMigrationReport struct {
+	Scanned    int
+	Converted  []PhoneChange
+	Duplicates []PhoneDuplicate
+	// Numbers that could not be parsed; To is empty
+	Invalid []PhoneChange
+}
+
+type phoneMigrationService struct {
+	userRepo repository.UserRepository
+	config   *config.Config
+}
+
+func NewPhoneMigrationService(userRepo repository.UserRepository, config *config.Config) PhoneMigrationService {
+	return &phoneMigrationService{
+		userRepo: userRepo,
+		config:   config,
+	}
+}
+
+// Normalize scans every user, soft-deleted ones included because they still
+// hold their number in the unique index. In dry-run mode nothing is written.
+func (s *phoneMigrationService) Normalize(ctx context.Context, dryRun bool) (*PhoneMigrationReport, error) {
+	if s.config.User.PhoneHMACKey != "" {
+		return nil, fmt.Errorf("%w and cannot be normalized", ErrPhonesHashed)
+	}
+
+	report := &PhoneMigrationReport{}
+	var changes []PhoneChange
+	// Every user that holds or would hold each E.164 number
+	holders := make(map[string][]uint)
+
+	var afterID uint
+	for {
+		users, err := s.userRepo.ListPhoneNumbers(ctx, afterID, phoneMigrationBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+
+		for _, user := range users {
+			report.Scanned++
+			normalized, err := utils.NormalizeLegacyPhone(user.PhoneNumber, s.config.User.PhoneDefaultRegion)
+			if err != nil {
+				report.Invalid = append(report.Invalid, PhoneChange{UserID: user.ID, From: user.PhoneNumber})
+				continue
+			}
+
+			holders[normalized] = append(holders[normalized], user.ID)
+			if normalized != user.PhoneNumber {
+				changes = append(changes, PhoneChange{UserID: user.ID, From: user.PhoneNumber, To: normalized})
+			}
+		}
+
+		if len(users) < phoneMigrationBatchSize {
+			break
+		}
+		afterID = users[len(users)-1].ID
+	}
+
+	flagged := make(map[string]bool)
+	for _, change := range changes {
+		if ids := holders[change.To]; len(ids) > 1 {
+			if !flagged[change.To] {
+				flagged[change.To] = true
+				report.Duplicates = append(report.Duplicates, PhoneDuplicate{PhoneNumber: change.To, UserIDs: ids})
+			}
+			continue
+		}
+
+		if !dryRun {
+			if err := s.userRepo.UpdatePhoneNumber(ctx, change.UserID, change.To); err != nil {
+				return report, fmt.Errorf("failed to update user %d: %w", change.UserID, err)
+			}
+		}
+		report.Converted = append(report.Converted, change)
+	}
+
+	s.logReport(report, dryRun)
+	return report, nil
+}
+
+func (s *phoneMigrationService) logReport(report *PhoneMigrationReport, dryRun bool) {
+	verb := "Converted"
+	if dryRun {
+		verb = "Would convert"
+	}
+
+	for _, change := range report.Converted {
+		log.Printf("%s user %d: %s -> %s", verb, change.UserID, utils.MaskPhoneNumber(change.From), utils.MaskPhoneNumber(change.To))
+	}
+	for _, duplicate := range report.Duplicates {
+		ids := make([]string, len(duplicate.UserIDs))
+		for i, id := range duplicate.UserIDs {
+			ids[i] = fmt.Sprint(id)
+		}
+		log.Printf("Skipped duplicate %s held by users %s", utils.MaskPhoneNumber(duplicate.PhoneNumber), strings.Join(ids, ", "))
+	}
+	for _, invalid := range report.Invalid {
+		log.Printf("Skipped user %d: %s is not a valid phone number", invalid.UserID, utils.MaskPhoneNumber(invalid.From))
+	}
+	log.Printf("Phone normalization: %d scanned, %d %s, %d duplicate groups, %d invalid",
+		report.Scanned, len(report.Converted), strings.ToLower(verb), len(report.Duplicates), len(report.Invalid))
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestPhoneMigrationService_Normalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+	}{
+		{"Dry run reports only", true},
+		{"Normalizes rows", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			if err := db.AutoMigrate(&model.User{}); err != nil {
+				t.Fatalf("Failed to migrate database: %v", err)
+			}
+
+			legacy := []model.User{
+				{ID: 1, PhoneNumber: "+14155552671"},   // already E.164
+				{ID: 2, PhoneNumber: "(415) 555-2672"}, // national format
+				{ID: 3, PhoneNumber: "14155552673"},    // country code without plus
+				{ID: 4, PhoneNumber: "4155552671"},     // collapses onto user 1
+				{ID: 5, PhoneNumber: "415-555-2674"},   // collapses with user 6
+				{ID: 6, PhoneNumber: "1 415 555 2674"},
+				{ID: 7, PhoneNumber: "not a number"},
+				{ID: 8, PhoneNumber: "0044 20 7946 0958", DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}},
+			}
+			for i := range legacy {
+				if err := db.Create(&legacy[i]).Error; err != nil {
+					t.Fatalf("Failed to seed user: %v", err)
+				}
+			}
+
+			cfg := &config.Config{User: config.UserConfig{PhoneDefaultRegion: "US"}}
+			migrationService := NewPhoneMigrationService(repository.NewUserRepository(db, cfg), cfg)
+
+			report, err := migrationService.Normalize(context.Background(), tt.dryRun)
+			if err != nil {
+				t.Fatalf("Normalize() unexpected error = %v", err)
+			}
+
+			if report.Scanned != len(legacy) {
+				t.Errorf("Scanned = %d, want %d", report.Scanned, len(legacy))
+			}
+			wantConverted := []PhoneChange{
+				{UserID: 2, From: "(415) 555-2672", To: "+14155552672"},
+				{UserID: 3, From: "14155552673", To: "+14155552673"},
+				{UserID: 8, From: "0044 20 7946 0958", To: "+442079460958"},
+			}
+			if !reflect.DeepEqual(report.Converted, wantConverted) {
+				t.Errorf("Converted = %+v, want %+v", report.Converted, wantConverted)
+			}
+			wantDuplicates := []PhoneDuplicate{
+				{PhoneNumber: "+14155552671", UserIDs: []uint{1, 4}},
+				{PhoneNumber: "+14155552674", UserIDs: []uint{5, 6}},
+			}
+			if !reflect.DeepEqual(report.Duplicates, wantDuplicates) {
+				t.Errorf("Duplicates = %+v, want %+v", report.Duplicates, wantDuplicates)
+			}
+			if len(report.Invalid) != 1 || report.Invalid[0].UserID != 7 {
+				t.Errorf("Invalid = %+v, want user 7", report.Invalid)
+			}
+
+			// Duplicates and invalid rows are never touched; the rest only outside a dry run
+			want := map[uint]string{1: "+14155552671", 4: "4155552671", 5: "415-555-2674", 6: "1 415 555 2674", 7: "not a number"}
+			for _, change := range wantConverted {
+				want[change.UserID] = change.To
+				if tt.dryRun {
+					want[change.UserID] = change.From
+				}
+			}
+
+			var users []model.User
+			db.Unscoped().Order("id").Find(&users)
+			for _, user := range users {
+				if user.PhoneNumber != want[user.ID] {
+					t.Errorf("User %d phone = %q, want %q", user.ID, user.PhoneNumber, want[user.ID])
+				}
+			}
+		})
+	}
+}
+
+func TestPhoneMigrationService_PrivacyMode(t *testing.T) {
+	cfg := &config.Config{User: config.UserConfig{PhoneHMACKey: "key", PhoneDefaultRegion: "US"}}
+	migrationService := NewPhoneMigrationService(newMockUserRepository(), cfg)
+
+	if _, err := migrationService.Normalize(context.Background(), true); !errors.Is(err, ErrPhonesHashed) {
+		t.Errorf("Normalize() error = %v, want %v", err, ErrPhonesHashed)
+	}
+}
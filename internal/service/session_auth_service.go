@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+)
+
+// sessionAuthService records a session for every sign-in, phone number changes
+// included, and moves it to the new access token on each refresh. The refresh
+// token of a revoked session is refused, so revoking a session ends it for good.
+type sessionAuthService struct {
+	AuthService
+	sessionRepo  repository.SessionRepository
+	tokenService TokenService
+}
+
+func NewSessionAuthService(authService AuthService, sessionRepo repository.SessionRepository, tokenService TokenService) AuthService {
+	return &sessionAuthService{
+		AuthService:  authService,
+		sessionRepo:  sessionRepo,
+		tokenService: tokenService,
+	}
+}
+
+func (s *sessionAuthService) VerifyOTP(ctx context.Context, req *model.VerifyOTPRequest) (*model.AuthResponse, error) {
+	response, err := s.AuthService.VerifyOTP(ctx, req)
+	if err == nil {
+		s.recordSession(ctx, response, req.DeviceName, req.ClientIP, req.UserAgent)
+	}
+	return response, err
+}
+
+// ChangePhoneNumber signs the caller in again under the new number, so the new
+// tokens get a session like any other sign-in
+func (s *sessionAuthService) ChangePhoneNumber(ctx context.Context, userID uint, req *model.UpdatePhoneRequest) (*model.AuthResponse, error) {
+	response, err := s.AuthService.ChangePhoneNumber(ctx, userID, req)
+	if err == nil {
+		s.recordSession(ctx, response, req.DeviceName, req.ClientIP, req.UserAgent)
+	}
+	return response, err
+}
+
+func (s *sessionAuthService) RefreshToken(ctx context.Context, req *model.RefreshTokenRequest) (*model.RefreshTokenResponse, error) {
+	// The wrapped service verifies the token; this only needs its jti
+	refresh, err := jwt.ReadClaims(req.RefreshToken)
+	if err == nil && refresh.ID != "" {
+		revoked, err := s.tokenService.IsRevoked(ctx, refresh.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check token revocation: %w", err)
+		}
+		if revoked {
+			return nil, fmt.Errorf("%w: token has been revoked", ErrInvalidRefresh)
+		}
+	}
+
+	response, err := s.AuthService.RefreshToken(ctx, req)
+	if err != nil || refresh == nil || refresh.ID == "" {
+		return response, err
+	}
+
+	access, err := jwt.ReadClaims(response.Token)
+	if err != nil || access.ExpiresAt == nil {
+		log.Printf("Failed to read refreshed token: %v", err)
+		return response, nil
+	}
+	if _, err := s.sessionRepo.Rotate(context.WithoutCancel(ctx), refresh.ID, access.ID, access.ExpiresAt.Time); err != nil {
+		log.Printf("Failed to move session to the refreshed token: %v", err)
+	}
+	return response, nil
+}
+
+// recordSession is best effort, like the attempt history: a sign-in whose
+// session could not be stored still succeeds, it is just not listed
+func (s *sessionAuthService) recordSession(ctx context.Context, response *model.AuthResponse, deviceName, ip, userAgent string) {
+	access, err := jwt.ReadClaims(response.Token)
+	if err != nil || access.ExpiresAt == nil {
+		log.Printf("Failed to record session: access token has no expiry: %v", err)
+		return
+	}
+	refresh, err := jwt.ReadClaims(response.RefreshToken)
+	if err != nil || refresh.ExpiresAt == nil {
+		log.Printf("Failed to record session: refresh token has no expiry: %v", err)
+		return
+	}
+
+	session := &model.Session{
+		TokenID:        access.ID,
+		RefreshTokenID: refresh.ID,
+		UserID:         response.User.ID,
+		DeviceName:     truncate(deviceName, maxDeviceNameLength),
+		IP:             ip,
+		UserAgent:      truncate(userAgent, maxUserAgentLength),
+		ExpiresAt:      refresh.ExpiresAt.Time,
+		Tokens:         []model.SessionToken{{TokenID: access.ID, ExpiresAt: access.ExpiresAt.Time}},
+	}
+	if err := s.sessionRepo.Create(context.WithoutCancel(ctx), session); err != nil {
+		log.Printf("Failed to record session: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+	"gorm.io/gorm"
+)
+
+// SessionService lets users see where they are signed in and sign a device out
+type SessionService interface {
+	// List marks the session that issued currentTokenID as current
+	List(ctx context.Context, userID uint, currentTokenID string) (*model.SessionsResponse, error)
+	// Revoke blacklists the refresh token and every access token the session
+	// issued, then deletes it. tokenID may be any of those access tokens.
+	// Another user's session is ErrSessionNotFound, the same as a missing one.
+	Revoke(ctx context.Context, userID uint, tokenID string) error
+}
+
+type sessionService struct {
+	sessionRepo  repository.SessionRepository
+	tokenService TokenService
+}
+
+func NewSessionService(sessionRepo repository.SessionRepository, tokenService TokenService) SessionService {
+	return &sessionService{
+		sessionRepo:  sessionRepo,
+		tokenService: tokenService,
+	}
+}
+
+func (s *sessionService) List(ctx context.Context, userID uint, currentTokenID string) (*model.SessionsResponse, error) {
+	sessions, err := s.sessionRepo.ListActive(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	// The request may carry an access token older than the session's latest
+	var currentID uint
+	if currentTokenID != "" {
+		current, err := s.sessionRepo.GetByTokenID(ctx, currentTokenID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to get current session: %w", err)
+		}
+		if current != nil {
+			currentID = current.ID
+		}
+	}
+
+	response := &model.SessionsResponse{Sessions: make([]model.SessionResponse, len(sessions))}
+	for i, session := range sessions {
+		response.Sessions[i] = session.ToResponse()
+		response.Sessions[i].Current = currentID != 0 && session.ID == currentID
+	}
+	return response, nil
+}
+
+func (s *sessionService) Revoke(ctx context.Context, userID uint, tokenID string) error {
+	session, err := s.sessionRepo.GetByTokenID(ctx, tokenID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	// The refresh token outlives every access token, so its expiry covers a
+	// latest token recorded before the session kept its Tokens
+	revoke := map[string]time.Time{
+		session.RefreshTokenID: session.ExpiresAt,
+		session.TokenID:        session.ExpiresAt,
+	}
+	for _, token := range session.Tokens {
+		revoke[token.TokenID] = token.ExpiresAt
+	}
+	for id, expiresAt := range revoke {
+		// An access token that already expired is no use to anyone
+		if !expiresAt.After(time.Now()) {
+			continue
+		}
+		if err := s.tokenService.Revoke(ctx, id, expiresAt); err != nil {
+			return err
+		}
+	}
+	if err := s.sessionRepo.Delete(ctx, session.ID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
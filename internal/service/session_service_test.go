@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// mockSessionRepository keeps sessions in insertion order
+type mockSessionRepository struct {
+	sessions []*model.Session
+	nextID   uint
+}
+
+func (m *mockSessionRepository) Create(ctx context.Context, session *model.Session) error {
+	m.nextID++
+	session.ID = m.nextID
+	session.CreatedAt = time.Now()
+	m.sessions = append(m.sessions, session)
+	return nil
+}
+
+func (m *mockSessionRepository) ListActive(ctx context.Context, userID uint) ([]model.Session, error) {
+	var sessions []model.Session
+	for i := len(m.sessions) - 1; i >= 0; i-- {
+		if m.sessions[i].UserID == userID && m.sessions[i].ExpiresAt.After(time.Now()) {
+			sessions = append(sessions, *m.sessions[i])
+		}
+	}
+	return sessions, nil
+}
+
+func (m *mockSessionRepository) GetByTokenID(ctx context.Context, tokenID string) (*model.Session, error) {
+	for _, session := range m.sessions {
+		issued := session.TokenID == tokenID
+		for _, token := range session.Tokens {
+			issued = issued || token.TokenID == tokenID
+		}
+		if issued {
+			found := *session
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *mockSessionRepository) Rotate(ctx context.Context, refreshTokenID, tokenID string, expiresAt time.Time) (bool, error) {
+	for _, session := range m.sessions {
+		if session.RefreshTokenID == refreshTokenID {
+			session.TokenID = tokenID
+			session.Tokens = append(session.Tokens, model.SessionToken{SessionID: session.ID, TokenID: tokenID, ExpiresAt: expiresAt})
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockSessionRepository) Delete(ctx context.Context, id uint) error {
+	for i, session := range m.sessions {
+		if session.ID == id {
+			m.sessions = append(m.sessions[:i], m.sessions[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func createTestTokenService(t *testing.T) TokenService {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewTokenService(repository.NewTokenBlacklist(client))
+}
+
+func TestSessionService_List(t *testing.T) {
+	sessionRepo := &mockSessionRepository{}
+	expiresAt := time.Now().Add(time.Hour)
+	sessionRepo.Create(context.Background(), &model.Session{TokenID: "a1", RefreshTokenID: "r1", UserID: 1, DeviceName: "Laptop", ExpiresAt: expiresAt})
+	sessionRepo.Create(context.Background(), &model.Session{TokenID: "a2", RefreshTokenID: "r2", UserID: 1, DeviceName: "Phone", ExpiresAt: expiresAt})
+	sessionRepo.Create(context.Background(), &model.Session{TokenID: "a3", RefreshTokenID: "r3", UserID: 2, ExpiresAt: expiresAt})
+	sessionService := NewSessionService(sessionRepo, createTestTokenService(t))
+
+	response, err := sessionService.List(context.Background(), 1, "a1")
+	if err != nil {
+		t.Fatalf("List() unexpected error = %v", err)
+	}
+	if len(response.Sessions) != 2 {
+		t.Fatalf("List() returned %d sessions, want 2", len(response.Sessions))
+	}
+	for _, session := range response.Sessions {
+		if session.Current != (session.TokenID == "a1") {
+			t.Errorf("session %s current = %v, want only a1 current", session.TokenID, session.Current)
+		}
+	}
+}
+
+func TestSessionService_Revoke(t *testing.T) {
+	sessionRepo := &mockSessionRepository{}
+	sessionRepo.Create(context.Background(), &model.Session{TokenID: "a1", RefreshTokenID: "r1", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)})
+	tokenService := createTestTokenService(t)
+	sessionService := NewSessionService(sessionRepo, tokenService)
+
+	if err := sessionService.Revoke(context.Background(), 2, "a1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Revoke() of another user's session error = %v, want ErrSessionNotFound", err)
+	}
+	if err := sessionService.Revoke(context.Background(), 1, "unknown"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Revoke() of an unknown session error = %v, want ErrSessionNotFound", err)
+	}
+	if len(sessionRepo.sessions) != 1 {
+		t.Fatalf("Failed revokes removed the session")
+	}
+
+	if err := sessionService.Revoke(context.Background(), 1, "a1"); err != nil {
+		t.Fatalf("Revoke() unexpected error = %v", err)
+	}
+	for _, id := range []string{"a1", "r1"} {
+		if revoked, _ := tokenService.IsRevoked(context.Background(), id); !revoked {
+			t.Errorf("IsRevoked(%q) = false, want true", id)
+		}
+	}
+	if len(sessionRepo.sessions) != 0 {
+		t.Errorf("Revoke() left %d sessions, want 0", len(sessionRepo.sessions))
+	}
+}
+
+func TestSessionAuthService(t *testing.T) {
+	userRepo := newMockUserRepository()
+	otpRepo := newMockOTPRepository()
+	sessionRepo := &mockSessionRepository{}
+	tokenService := createTestTokenService(t)
+	inner := NewAuthService(userRepo, otpRepo, nil, newMockOTPSender(), nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+	authService := NewSessionAuthService(inner, sessionRepo, tokenService)
+
+	otpRepo.StoreOTP(context.Background(), &model.OTP{PhoneNumber: "+14155550100", Code: "123456"}, 2)
+	signIn, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{
+		PhoneNumber: "+14155550100",
+		OTPCode:     "123456",
+		DeviceName:  "Pixel 8",
+		ClientIP:    "203.0.113.7",
+		UserAgent:   "okhttp/4.12",
+	})
+	if err != nil {
+		t.Fatalf("VerifyOTP() unexpected error = %v", err)
+	}
+
+	access, _ := jwt.ReadClaims(signIn.Token)
+	refresh, _ := jwt.ReadClaims(signIn.RefreshToken)
+	if len(sessionRepo.sessions) != 1 {
+		t.Fatalf("VerifyOTP() recorded %d sessions, want 1", len(sessionRepo.sessions))
+	}
+	session := sessionRepo.sessions[0]
+	if session.TokenID != access.ID || session.RefreshTokenID != refresh.ID || session.UserID != signIn.User.ID {
+		t.Errorf("session = %+v, want the issued jtis for user %d", session, signIn.User.ID)
+	}
+	if session.DeviceName != "Pixel 8" || session.IP != "203.0.113.7" || session.UserAgent != "okhttp/4.12" {
+		t.Errorf("session client = %q %q %q, want the request's device, IP and user agent", session.DeviceName, session.IP, session.UserAgent)
+	}
+	if !session.ExpiresAt.Equal(refresh.ExpiresAt.Time) {
+		t.Errorf("session ExpiresAt = %v, want the refresh token's %v", session.ExpiresAt, refresh.ExpiresAt.Time)
+	}
+
+	// A refresh moves the session to the new access token
+	refreshed, err := authService.RefreshToken(context.Background(), &model.RefreshTokenRequest{RefreshToken: signIn.RefreshToken})
+	if err != nil {
+		t.Fatalf("RefreshToken() unexpected error = %v", err)
+	}
+	newAccess, _ := jwt.ReadClaims(refreshed.Token)
+	if session.TokenID != newAccess.ID {
+		t.Errorf("session TokenID = %q after refresh, want %q", session.TokenID, newAccess.ID)
+	}
+
+	// The first access token is still live and still ends the whole session
+	if err := NewSessionService(sessionRepo, tokenService).Revoke(context.Background(), signIn.User.ID, access.ID); err != nil {
+		t.Fatalf("Revoke() by the first access token unexpected error = %v", err)
+	}
+	for _, id := range []string{access.ID, newAccess.ID, refresh.ID} {
+		if revoked, _ := tokenService.IsRevoked(context.Background(), id); !revoked {
+			t.Errorf("IsRevoked(%q) = false after the session was revoked, want true", id)
+		}
+	}
+	if len(sessionRepo.sessions) != 0 {
+		t.Errorf("Revoke() left %d sessions, want 0", len(sessionRepo.sessions))
+	}
+
+	// Once revoked, the session's refresh token no longer works
+	if _, err := authService.RefreshToken(context.Background(), &model.RefreshTokenRequest{RefreshToken: signIn.RefreshToken}); !errors.Is(err, ErrInvalidRefresh) {
+		t.Errorf("RefreshToken() after revoke error = %v, want ErrInvalidRefresh", err)
+	}
+}
+
+func TestSessionAuthService_ChangePhoneNumber(t *testing.T) {
+	const newPhone = "+14155550101"
+
+	userRepo := newMockUserRepository()
+	sender := newMockOTPSender()
+	sessionRepo := &mockSessionRepository{}
+	inner := NewAuthService(userRepo, newMockOTPRepository(), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig())
+	authService := NewSessionAuthService(inner, sessionRepo, createTestTokenService(t))
+
+	user := &model.User{PhoneNumber: "+14155550100", Status: model.UserStatusActive}
+	userRepo.Create(context.Background(), user)
+	if _, err := authService.SendPhoneChangeOTP(context.Background(), user.ID, &model.UpdatePhoneRequest{PhoneNumber: newPhone}); err != nil {
+		t.Fatalf("SendPhoneChangeOTP() unexpected error = %v", err)
+	}
+
+	changed, err := authService.ChangePhoneNumber(context.Background(), user.ID, &model.UpdatePhoneRequest{
+		PhoneNumber: newPhone,
+		OTPCode:     sender.sent[newPhone],
+		DeviceName:  "Pixel 8",
+		ClientIP:    "203.0.113.7",
+	})
+	if err != nil {
+		t.Fatalf("ChangePhoneNumber() unexpected error = %v", err)
+	}
+
+	// The new tokens can be listed and revoked like any sign-in's
+	access, _ := jwt.ReadClaims(changed.Token)
+	refresh, _ := jwt.ReadClaims(changed.RefreshToken)
+	if len(sessionRepo.sessions) != 1 {
+		t.Fatalf("ChangePhoneNumber() recorded %d sessions, want 1", len(sessionRepo.sessions))
+	}
+	session := sessionRepo.sessions[0]
+	if session.TokenID != access.ID || session.RefreshTokenID != refresh.ID || session.DeviceName != "Pixel 8" || session.IP != "203.0.113.7" {
+		t.Errorf("session = %+v, want the new jtis with the request's device and IP", session)
+	}
+}
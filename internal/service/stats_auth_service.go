@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/stats"
+)
+
+// statsAuthService feeds the in-memory admin stats from every send and verify
+type statsAuthService struct {
+	AuthService
+	counters *stats.Counters
+}
+
+func NewStatsAuthService(authService AuthService, counters *stats.Counters) AuthService {
+	return &statsAuthService{
+		AuthService: authService,
+		counters:    counters,
+	}
+}
+
+func (s *statsAuthService) SendOTP(ctx context.Context, req *model.SendOTPRequest) (*model.SendOTPResponse, error) {
+	response, err := s.AuthService.SendOTP(ctx, req)
+	s.counters.RecordSend(err)
+	return response, err
+}
+
+func (s *statsAuthService) VerifyOTP(ctx context.Context, req *model.VerifyOTPRequest) (*model.AuthResponse, error) {
+	response, err := s.AuthService.VerifyOTP(ctx, req)
+	var userID uint
+	if err == nil {
+		userID = response.User.ID
+	}
+	s.counters.RecordVerify(userID, err)
+	return response, err
+}
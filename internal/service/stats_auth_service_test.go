@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/jwt"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/stats"
+)
+
+func TestStatsAuthService(t *testing.T) {
+	sender := newMockOTPSender()
+	counters := stats.NewCounters()
+	authService := NewStatsAuthService(
+		NewAuthService(newMockUserRepository(), newMockOTPRepository(), nil, sender, nil, jwt.NewJWTManager("test-secret", 24, 720), newTestConfig()),
+		counters,
+	)
+
+	for _, phoneNumber := range []string{"+14155550100", "+14155550103"} {
+		if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: phoneNumber}); err != nil {
+			t.Fatalf("SendOTP() unexpected error = %v", err)
+		}
+		wrongCode := "000000"
+		if sender.sent[phoneNumber] == wrongCode {
+			wrongCode = "111111"
+		}
+		if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: wrongCode}); err == nil {
+			t.Fatal("VerifyOTP() with a wrong code unexpectedly succeeded")
+		}
+		if _, err := authService.VerifyOTP(context.Background(), &model.VerifyOTPRequest{PhoneNumber: phoneNumber, OTPCode: sender.sent[phoneNumber]}); err != nil {
+			t.Fatalf("VerifyOTP() unexpected error = %v", err)
+		}
+	}
+	if _, err := authService.SendOTP(context.Background(), &model.SendOTPRequest{PhoneNumber: "invalid"}); err == nil {
+		t.Fatal("SendOTP() with an invalid number unexpectedly succeeded")
+	}
+
+	got := counters.Snapshot()
+	want := stats.Snapshot{Sends: 3, SendFailures: 1, Verifies: 4, VerifyFailures: 2, ActiveUsersToday: 2, Since: got.Since}
+	if got != want {
+		t.Errorf("Snapshot() = %+v, want %+v", got, want)
+	}
+}
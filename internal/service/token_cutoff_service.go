@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+)
+
+// TokenValidator is told the cutoff it must enforce
+type TokenValidator interface {
+	SetMinIssuedAt(t time.Time)
+}
+
+// TokenCutoffService rejects every token issued before a cutoff, a blunt kill
+// switch for when a signing key leaks. The cutoff is the later of
+// JWT_MIN_ISSUED_AT and the one kept in Redis, so every instance applies a
+// runtime change within JWT_MIN_ISSUED_AT_REFRESH_SECONDS.
+type TokenCutoffService interface {
+	Status(ctx context.Context) (*model.TokenCutoffResponse, error)
+	Enable(ctx context.Context) (*model.TokenCutoffResponse, error)
+	Disable(ctx context.Context) (*model.TokenCutoffResponse, error)
+	Start(ctx context.Context)
+}
+
+type tokenCutoffService struct {
+	blacklist  repository.TokenBlacklist
+	validator  TokenValidator
+	configured time.Time
+	config     *config.Config
+}
+
+// NewTokenCutoffService applies JWT_MIN_ISSUED_AT at once; main refuses to start
+// when it does not parse, so an error here only leaves it unset
+func NewTokenCutoffService(blacklist repository.TokenBlacklist, validator TokenValidator, config *config.Config) TokenCutoffService {
+	configured, err := config.JWTMinIssuedAt()
+	if err != nil {
+		log.Printf("Token cutoff from config ignored: %v", err)
+	}
+	validator.SetMinIssuedAt(configured)
+
+	return &tokenCutoffService{
+		blacklist:  blacklist,
+		validator:  validator,
+		configured: configured,
+		config:     config,
+	}
+}
+
+// Status reads the runtime cutoff and applies the effective one
+func (s *tokenCutoffService) Status(ctx context.Context) (*model.TokenCutoffResponse, error) {
+	runtime, err := s.blacklist.GetMinIssuedAt(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token cutoff: %w", err)
+	}
+
+	status := &model.TokenCutoffResponse{}
+	cutoff := s.configured
+	if !cutoff.IsZero() {
+		status.Source = "config"
+	}
+	if runtime.After(cutoff) {
+		cutoff = runtime
+		status.Source = "runtime"
+	}
+	s.validator.SetMinIssuedAt(cutoff)
+
+	if !cutoff.IsZero() {
+		status.Enabled = true
+		utc := cutoff.UTC()
+		status.MinIssuedAt = &utc
+	}
+	return status, nil
+}
+
+// Enable rejects every token issued up to now, including the caller's own
+func (s *tokenCutoffService) Enable(ctx context.Context) (*model.TokenCutoffResponse, error) {
+	now := time.Now()
+	if err := s.blacklist.SetMinIssuedAt(ctx, now); err != nil {
+		return nil, fmt.Errorf("failed to set token cutoff: %w", err)
+	}
+	log.Printf("AUDIT: token cutoff set: min_issued_at=%s", now.UTC().Format(time.RFC3339))
+	return s.Status(ctx)
+}
+
+// Disable lifts the runtime cutoff; JWT_MIN_ISSUED_AT still applies
+func (s *tokenCutoffService) Disable(ctx context.Context) (*model.TokenCutoffResponse, error) {
+	if err := s.blacklist.SetMinIssuedAt(ctx, time.Time{}); err != nil {
+		return nil, fmt.Errorf("failed to clear token cutoff: %w", err)
+	}
+	log.Printf("AUDIT: token cutoff lifted")
+	return s.Status(ctx)
+}
+
+// Start loads the cutoff from Redis, then reloads it on every refresh interval
+// until ctx is cancelled. A failed read keeps the cutoff last applied.
+func (s *tokenCutoffService) Start(ctx context.Context) {
+	if _, err := s.Status(ctx); err != nil {
+		log.Printf("Token cutoff load failed: %v", err)
+	}
+	if s.config.JWT.MinIssuedAtRefresh <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.JWT.MinIssuedAtRefresh)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if _, err := s.Status(ctx); err != nil {
+				log.Printf("Token cutoff refresh failed: %v", err)
+			}
+		}
+	}()
+}
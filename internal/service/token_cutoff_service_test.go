@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+type recordingValidator struct {
+	minIssuedAt time.Time
+}
+
+func (v *recordingValidator) SetMinIssuedAt(t time.Time) {
+	v.minIssuedAt = t
+}
+
+func TestTokenCutoffService(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	blacklist := repository.NewTokenBlacklist(client)
+
+	configured := time.Now().Add(-time.Hour).Truncate(time.Second)
+	validator := &recordingValidator{}
+	cutoffService := NewTokenCutoffService(blacklist, validator, &config.Config{
+		JWT: config.JWTConfig{MinIssuedAt: configured.Format(time.RFC3339)},
+	})
+	if !validator.minIssuedAt.Equal(configured) {
+		t.Fatalf("Cutoff applied at start = %v, want %v", validator.minIssuedAt, configured)
+	}
+
+	status, err := cutoffService.Enable(context.Background())
+	if err != nil {
+		t.Fatalf("Enable() unexpected error = %v", err)
+	}
+	if !status.Enabled || status.Source != "runtime" || time.Since(validator.minIssuedAt) > 2*time.Second {
+		t.Errorf("Enable() = %+v, applied %v, want a runtime cutoff of now", status, validator.minIssuedAt)
+	}
+
+	// Another instance picks the runtime cutoff up on its next refresh
+	otherValidator := &recordingValidator{}
+	other := NewTokenCutoffService(blacklist, otherValidator, &config.Config{})
+	if _, err := other.Status(context.Background()); err != nil {
+		t.Fatalf("Status() unexpected error = %v", err)
+	}
+	if !otherValidator.minIssuedAt.Equal(validator.minIssuedAt) {
+		t.Errorf("Other instance cutoff = %v, want %v", otherValidator.minIssuedAt, validator.minIssuedAt)
+	}
+
+	// Lifting the runtime cutoff falls back to JWT_MIN_ISSUED_AT
+	status, err = cutoffService.Disable(context.Background())
+	if err != nil {
+		t.Fatalf("Disable() unexpected error = %v", err)
+	}
+	if status.Source != "config" || !validator.minIssuedAt.Equal(configured) {
+		t.Errorf("Disable() = %+v, applied %v, want the configured cutoff", status, validator.minIssuedAt)
+	}
+	if status, _ := other.Status(context.Background()); status.Enabled || !otherValidator.minIssuedAt.IsZero() {
+		t.Errorf("Other instance after Disable() = %+v, applied %v, want no cutoff", status, otherValidator.minIssuedAt)
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+)
+
+// TokenService revokes issued tokens by their jti claim
+type TokenService interface {
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+type tokenService struct {
+	blacklist repository.TokenBlacklist
+}
+
+func NewTokenService(blacklist repository.TokenBlacklist) TokenService {
+	return &tokenService{blacklist: blacklist}
+}
+
+// Revoke blacklists the token for the rest of its lifetime
+func (s *tokenService) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return fmt.Errorf("token has no ID to revoke")
+	}
+	if err := s.blacklist.Revoke(ctx, tokenID, time.Until(expiresAt)); err != nil {
+		return err
+	}
+
+	log.Printf("AUDIT: token revoked: jti=%s", tokenID)
+	return nil
+}
+
+// IsRevoked reports false for tokens issued without a jti, which cannot be revoked
+func (s *tokenService) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+	return s.blacklist.IsRevoked(ctx, tokenID)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+)
+
+// UserPurgeService hard-deletes users that stayed soft-deleted past the retention period
+type UserPurgeService interface {
+	Purge(ctx context.Context) (int64, error)
+	Start(ctx context.Context)
+}
+
+type userPurgeService struct {
+	userRepo repository.UserRepository
+	config   *config.Config
+}
+
+func NewUserPurgeService(userRepo repository.UserRepository, config *config.Config) UserPurgeService {
+	return &userPurgeService{
+		userRepo: userRepo,
+		config:   config,
+	}
+}
+
+// Purge runs a single pass; in dry-run mode it only reports how many users would go
+func (s *userPurgeService) Purge(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-s.config.User.PurgeAfter)
+
+	if s.config.User.PurgeDryRun {
+		count, err := s.userRepo.CountDeletedBefore(ctx, cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count deleted users: %w", err)
+		}
+		log.Printf("User purge dry run: %d users deleted before %s would be purged", count, cutoff.Format(time.RFC3339))
+		return count, nil
+	}
+
+	purged, err := s.userRepo.PurgeDeletedBefore(ctx, cutoff, s.config.User.PurgeBatchSize)
+	if err != nil {
+		return purged, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+	if purged > 0 {
+		log.Printf("Purged %d users deleted before %s", purged, cutoff.Format(time.RFC3339))
+	}
+	return purged, nil
+}
+
+// Start purges on every interval until ctx is cancelled; it is a no-op when USER_PURGE_AFTER_DAYS is 0
+func (s *userPurgeService) Start(ctx context.Context) {
+	if s.config.User.PurgeAfter <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.User.PurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Purge(ctx); err != nil {
+				log.Printf("User purge failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"gorm.io/gorm"
+)
+
+func TestUserPurgeService_Purge(t *testing.T) {
+	tests := []struct {
+		name       string
+		dryRun     bool
+		wantCount  int64
+		wantRemain int
+	}{
+		{"Purge removes expired users", false, 1, 2},
+		{"Dry run only counts", true, 1, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := newMockUserRepository()
+			now := time.Now()
+			userRepo.Create(context.Background(), &model.User{PhoneNumber: "+1000000001"})
+			userRepo.Create(context.Background(), &model.User{PhoneNumber: "+1000000002", DeletedAt: gorm.DeletedAt{Time: now.Add(-24 * time.Hour), Valid: true}})
+			userRepo.Create(context.Background(), &model.User{PhoneNumber: "+1000000003", DeletedAt: gorm.DeletedAt{Time: now.Add(-40 * 24 * time.Hour), Valid: true}})
+
+			cfg := &config.Config{
+				User: config.UserConfig{
+					PurgeAfter:     30 * 24 * time.Hour,
+					PurgeBatchSize: 100,
+					PurgeDryRun:    tt.dryRun,
+				},
+			}
+			purgeService := NewUserPurgeService(userRepo, cfg)
+
+			count, err := purgeService.Purge(context.Background())
+			if err != nil {
+				t.Fatalf("Purge() unexpected error = %v", err)
+			}
+			if count != tt.wantCount {
+				t.Errorf("Purge() = %v, want %v", count, tt.wantCount)
+			}
+			if len(userRepo.users) != tt.wantRemain {
+				t.Errorf("Remaining users = %v, want %v", len(userRepo.users), tt.wantRemain)
+			}
+		})
+	}
+}
@@ -1,30 +1,69 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"math"
 
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
 	"github.com/ehsanshojaei/go-otp-auth/internal/repository"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/utils"
 )
 
 type UserService interface {
-	GetUserByID(id uint) (*model.UserResponse, error)
-	GetUsers(req *model.GetUsersRequest) (*model.PaginatedUsersResponse, error)
+	GetUserByID(ctx context.Context, id uint) (*model.UserResponse, error)
+	GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*model.UserResponse, error)
+	GetUserInfo(ctx context.Context, id uint) (*model.UserInfoResponse, error)
+	GetUsers(ctx context.Context, req *model.GetUsersRequest) (*model.PaginatedUsersResponse, error)
+	GetOTPAttempts(ctx context.Context, userID uint, req *model.GetOTPAttemptsRequest) (*model.PaginatedOTPAttemptsResponse, error)
+	SetUserStatus(ctx context.Context, id uint, status model.UserStatus) (*model.UserResponse, error)
+}
+
+// CheckAccountStatus explains why a user may not sign in, or returns nil for active users
+func CheckAccountStatus(status model.UserStatus) error {
+	switch status {
+	case model.UserStatusSuspended:
+		return ErrAccountSuspended
+	case model.UserStatusDeactivated:
+		return ErrAccountDeactivated
+	case model.UserStatusPending:
+		return ErrAccountPending
+	}
+	return nil
 }
 
 type userService struct {
-	userRepo repository.UserRepository
+	userRepo    repository.UserRepository
+	attemptRepo repository.OTPAttemptRepository
 }
 
-func NewUserService(userRepo repository.UserRepository) UserService {
+func NewUserService(userRepo repository.UserRepository, attemptRepo repository.OTPAttemptRepository) UserService {
 	return &userService{
-		userRepo: userRepo,
+		userRepo:    userRepo,
+		attemptRepo: attemptRepo,
 	}
 }
 
-func (s *userService) GetUserByID(id uint) (*model.UserResponse, error) {
-	user, err := s.userRepo.GetByID(id)
+func (s *userService) GetUserByID(ctx context.Context, id uint) (*model.UserResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// GetUserByPhoneNumber normalizes the number first, so any accepted input form
+// finds the user stored under its E.164 form
+func (s *userService) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*model.UserResponse, error) {
+	normalized, err := utils.ValidateAndNormalizePhone(phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByPhoneNumber(ctx, normalized)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -33,10 +72,20 @@ func (s *userService) GetUserByID(id uint) (*model.UserResponse, error) {
 	return &response, nil
 }
 
-func (s *userService) GetUsers(req *model.GetUsersRequest) (*model.PaginatedUsersResponse, error) {
+func (s *userService) GetUserInfo(ctx context.Context, id uint) (*model.UserInfoResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	userInfo := user.ToUserInfo()
+	return &userInfo, nil
+}
+
+func (s *userService) GetUsers(ctx context.Context, req *model.GetUsersRequest) (*model.PaginatedUsersResponse, error) {
 	req.SetDefaults()
 
-	users, total, err := s.userRepo.GetUsers(req.Page, req.PageSize, req.PhoneNumber)
+	users, total, err := s.userRepo.GetUsers(ctx, req.Page, req.PageSize, req.PhoneNumber, req.Sort)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
@@ -56,3 +105,42 @@ func (s *userService) GetUsers(req *model.GetUsersRequest) (*model.PaginatedUser
 		TotalPages: totalPages,
 	}, nil
 }
+
+// GetOTPAttempts pages through a user's verification history, newest first.
+// A missing user is gorm.ErrRecordNotFound rather than an empty page.
+func (s *userService) GetOTPAttempts(ctx context.Context, userID uint, req *model.GetOTPAttemptsRequest) (*model.PaginatedOTPAttemptsResponse, error) {
+	req.SetDefaults()
+
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	attempts, total, err := s.attemptRepo.ListByUser(ctx, userID, req.Page, req.PageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OTP attempts: %w", err)
+	}
+
+	attemptResponses := make([]model.OTPAttemptResponse, len(attempts))
+	for i, attempt := range attempts {
+		attemptResponses[i] = attempt.ToResponse()
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(req.PageSize)))
+
+	return &model.PaginatedOTPAttemptsResponse{
+		Attempts:   attemptResponses,
+		Total:      total,
+		Page:       req.Page,
+		PageSize:   req.PageSize,
+		TotalPages: totalPages,
+	}, nil
+}
+
+func (s *userService) SetUserStatus(ctx context.Context, id uint, status model.UserStatus) (*model.UserResponse, error) {
+	if err := s.userRepo.UpdateStatus(ctx, id, status); err != nil {
+		return nil, fmt.Errorf("failed to update user status: %w", err)
+	}
+	log.Printf("AUDIT: user status changed: user_id=%d status=%s", id, status)
+
+	return s.GetUserByID(ctx, id)
+}
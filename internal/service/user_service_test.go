@@ -1,14 +1,17 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"gorm.io/gorm"
 )
 
 func createTestUserService() (UserService, *mockUserRepository) {
 	userRepo := newMockUserRepository()
-	userService := NewUserService(userRepo)
+	userService := NewUserService(userRepo, &mockOTPAttemptRepository{})
 	return userService, userRepo
 }
 
@@ -19,7 +22,7 @@ func TestUserService_GetUserByID(t *testing.T) {
 	testUser := &model.User{
 		PhoneNumber: "+1234567890",
 	}
-	userRepo.Create(testUser)
+	userRepo.Create(context.Background(), testUser)
 
 	tests := []struct {
 		name    string
@@ -43,7 +46,7 @@ func TestUserService_GetUserByID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			user, err := userService.GetUserByID(tt.userID)
+			user, err := userService.GetUserByID(context.Background(), tt.userID)
 			
 			if tt.wantErr {
 				if err == nil {
@@ -84,7 +87,7 @@ func TestUserService_GetUsers(t *testing.T) {
 	}
 
 	for _, user := range users {
-		userRepo.Create(user)
+		userRepo.Create(context.Background(), user)
 	}
 
 	tests := []struct {
@@ -138,7 +141,7 @@ func TestUserService_GetUsers(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.request.SetDefaults()
 			
-			result, err := userService.GetUsers(tt.request)
+			result, err := userService.GetUsers(context.Background(), tt.request)
 			
 			if tt.wantErr {
 				if err == nil {
@@ -223,3 +226,65 @@ func TestGetUsersRequest_SetDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestUserService_GetUserByPhoneNumber(t *testing.T) {
+	userService, userRepo := createTestUserService()
+	testUser := &model.User{PhoneNumber: "+14155552671"}
+	userRepo.Create(context.Background(), testUser)
+
+	tests := []struct {
+		name        string
+		phoneNumber string
+		wantErr     error
+	}{
+		{name: "E.164", phoneNumber: "+14155552671"},
+		{name: "Formatted", phoneNumber: "+1 (415) 555-2671"},
+		{name: "Unknown number", phoneNumber: "+14155550100", wantErr: gorm.ErrRecordNotFound},
+		{name: "Invalid number", phoneNumber: "not-a-number", wantErr: ErrInvalidPhoneNumber},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := userService.GetUserByPhoneNumber(context.Background(), tt.phoneNumber)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetUserByPhoneNumber() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUserByPhoneNumber() unexpected error = %v", err)
+			}
+			if user.ID != testUser.ID {
+				t.Errorf("GetUserByPhoneNumber() user ID = %v, want %v", user.ID, testUser.ID)
+			}
+		})
+	}
+}
+
+func TestUserService_GetOTPAttempts(t *testing.T) {
+	userRepo := newMockUserRepository()
+	attemptRepo := &mockOTPAttemptRepository{}
+	userService := NewUserService(userRepo, attemptRepo)
+
+	user := &model.User{PhoneNumber: "+14155550100"}
+	userRepo.Create(context.Background(), user)
+	for i := 0; i < 3; i++ {
+		attemptRepo.Create(context.Background(), &model.OTPAttempt{UserID: &user.ID, PhoneNumber: user.PhoneNumber, Success: i == 2})
+	}
+
+	page, err := userService.GetOTPAttempts(context.Background(), user.ID, &model.GetOTPAttemptsRequest{PageSize: 2})
+	if err != nil {
+		t.Fatalf("GetOTPAttempts() unexpected error = %v", err)
+	}
+	if page.Total != 3 || page.TotalPages != 2 || page.Page != 1 || len(page.Attempts) != 2 {
+		t.Errorf("GetOTPAttempts() = %+v, want page 1 of 2 with 2 of 3 attempts", page)
+	}
+	if !page.Attempts[0].Success {
+		t.Errorf("GetOTPAttempts() first attempt = %+v, want the newest", page.Attempts[0])
+	}
+
+	if _, err := userService.GetOTPAttempts(context.Background(), 999, &model.GetOTPAttemptsRequest{}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetOTPAttempts() for a missing user error = %v, want gorm.ErrRecordNotFound", err)
+	}
+}
@@ -0,0 +1,88 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+)
+
+// SMTPSender delivers OTP codes by email through an SMTP relay
+type SMTPSender struct {
+	config   config.SMTPConfig
+	template *template.Template
+
+	// sendMail hands the message to the relay; tests replace it to capture mail
+	sendMail func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTPSender(cfg config.SMTPConfig) (*SMTPSender, error) {
+	if cfg.Host == "" || cfg.From == "" {
+		return nil, errors.New("SMTP host and from address are required")
+	}
+
+	tmpl, err := template.New("otp").Option("missingkey=error").Parse(cfg.MessageTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP message template: %w", err)
+	}
+
+	return &SMTPSender{
+		config:   cfg,
+		template: tmpl,
+		sendMail: smtp.SendMail,
+	}, nil
+}
+
+func (s *SMTPSender) Name() string {
+	return "smtp"
+}
+
+func (s *SMTPSender) Send(address, code string) error {
+	var body bytes.Buffer
+	if err := s.template.Execute(&body, struct{ Code string }{Code: code}); err != nil {
+		return fmt.Errorf("failed to render SMTP message: %w", err)
+	}
+	return s.SendMessage(address, body.String())
+}
+
+// SendMessage sends a plain-text email. smtp.SendMail upgrades to STARTTLS
+// when the relay offers it, and credentials are only sent over TLS.
+func (s *SMTPSender) SendMessage(address, message string) error {
+	// The address was validated, but a header must never carry a line break
+	if strings.ContainsAny(address, "\r\n") {
+		return errors.New("invalid recipient address")
+	}
+
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	}
+
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	if err := s.sendMail(addr, auth, s.config.From, []string{address}, s.buildMessage(address, message)); err != nil {
+		return fmt.Errorf("smtp send failed: %w", err)
+	}
+	return nil
+}
+
+func (s *SMTPSender) buildMessage(address, message string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", address)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", s.config.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(message, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
@@ -0,0 +1,102 @@
+package email
+
+import (
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+)
+
+func newTestSMTPSender(t *testing.T, cfg config.SMTPConfig) *SMTPSender {
+	t.Helper()
+	if cfg.Host == "" {
+		cfg.Host = "smtp.example.com"
+	}
+	cfg.Port = 587
+	cfg.From = "noreply@example.com"
+	cfg.Subject = "Your verification code"
+	cfg.MessageTemplate = "Your code is {{.Code}}"
+
+	sender, err := NewSMTPSender(cfg)
+	if err != nil {
+		t.Fatalf("NewSMTPSender() unexpected error = %v", err)
+	}
+	return sender
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		wantAuth bool
+	}{
+		{"Authenticated relay", "mailer", true},
+		{"Open relay", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := newTestSMTPSender(t, config.SMTPConfig{Username: tt.username, Password: "secret"})
+
+			var gotAddr, gotFrom string
+			var gotAuth smtp.Auth
+			var gotTo []string
+			var gotMsg []byte
+			sender.sendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+				gotAddr, gotAuth, gotFrom, gotTo, gotMsg = addr, auth, from, to, msg
+				return nil
+			}
+
+			if err := sender.Send("user@example.com", "123456"); err != nil {
+				t.Fatalf("Send() unexpected error = %v", err)
+			}
+
+			if gotAddr != "smtp.example.com:587" {
+				t.Errorf("addr = %q, want smtp.example.com:587", gotAddr)
+			}
+			if (gotAuth != nil) != tt.wantAuth {
+				t.Errorf("auth = %v, want auth %v", gotAuth, tt.wantAuth)
+			}
+			if gotFrom != "noreply@example.com" || len(gotTo) != 1 || gotTo[0] != "user@example.com" {
+				t.Errorf("envelope = %q -> %v, want noreply@example.com -> [user@example.com]", gotFrom, gotTo)
+			}
+
+			msg := string(gotMsg)
+			for _, want := range []string{
+				"From: noreply@example.com\r\n",
+				"To: user@example.com\r\n",
+				"Subject: Your verification code\r\n",
+				"\r\n\r\nYour code is 123456\r\n",
+			} {
+				if !strings.Contains(msg, want) {
+					t.Errorf("message missing %q:\n%s", want, msg)
+				}
+			}
+		})
+	}
+}
+
+func TestSMTPSender_Errors(t *testing.T) {
+	if _, err := NewSMTPSender(config.SMTPConfig{From: "noreply@example.com"}); err == nil {
+		t.Error("NewSMTPSender() expected an error without a host")
+	}
+
+	sender := newTestSMTPSender(t, config.SMTPConfig{})
+	sender.sendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		return errors.New("connection refused")
+	}
+	if err := sender.Send("user@example.com", "123456"); err == nil {
+		t.Error("Send() expected the relay error")
+	}
+
+	// A line break would let the recipient inject headers
+	sender.sendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		t.Error("sendMail called for an injected address")
+		return nil
+	}
+	if err := sender.Send("user@example.com\r\nBcc: victim@example.com", "123456"); err == nil {
+		t.Error("Send() expected an error for a header injection")
+	}
+}
@@ -1,12 +1,70 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 // Common application errors - centralized for reusability
 var (
 	ErrInvalidOTP         = errors.New("invalid OTP")
-	ErrOTPExpired        = errors.New("OTP has expired")
-	ErrTooManyAttempts   = errors.New("too many OTP attempts")
-	ErrRateLimitExceeded = errors.New("rate limit exceeded")
+	ErrOTPExpired         = errors.New("OTP has expired")
+	ErrTooManyAttempts    = errors.New("too many OTP attempts")
+	ErrRateLimitExceeded  = errors.New("rate limit exceeded")
 	ErrInvalidPhoneNumber = errors.New("invalid phone number format")
+	ErrDeviceMismatch     = errors.New("device does not match OTP request")
+	ErrTokenIssuance      = errors.New("token could not be issued")
+	ErrQuietHours         = errors.New("SMS sending is paused during quiet hours")
+	ErrInvalidFormToken   = errors.New("form token is missing or invalid")
+	ErrInvalidSearchQuery = errors.New("invalid phone number search")
+	ErrInvalidSort        = errors.New("invalid sort order")
+	ErrAccountLocked      = errors.New("too many failed verification attempts")
+	ErrOTPEvicted         = errors.New("OTP was evicted before it expired")
+	ErrServiceUnavailable = errors.New("service temporarily unavailable")
+	ErrVerifyTooSoon      = errors.New("verify attempted before the backoff elapsed")
+	ErrOTPMistyped        = errors.New("OTP check digit does not match")
+	ErrAccountSuspended   = errors.New("account is suspended")
+	ErrAccountDeactivated = errors.New("account is deactivated")
+	ErrAccountPending     = errors.New("account is pending activation")
+	ErrInvalidRefresh     = errors.New("refresh token is invalid or expired")
+	ErrResendTooSoon      = errors.New("OTP resend requested before the cooldown elapsed")
+	ErrTOTPEnrolled       = errors.New("user signs in with an authenticator app")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrIdentifierConflict = errors.New("provide either a phone number or an email, not both")
+	ErrEmailDisabled      = errors.New("email sign-in is not enabled")
+	ErrPhoneNumberTaken   = errors.New("phone number is already in use")
+	ErrSamePhoneNumber    = errors.New("new phone number matches the current one")
+	ErrAccountDeleted     = errors.New("account was deleted and is awaiting erasure")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrPhonesHashed       = errors.New("phone numbers are stored as HMACs in privacy mode")
 )
+
+// RetryAfterError tells the client how long to wait before trying again
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v: retry after %s", e.Err, e.RetryAfter)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// AttemptsRemainingError tells the client how many verify attempts the OTP has
+// left after a failed one
+type AttemptsRemainingError struct {
+	Err       error
+	Remaining int
+}
+
+func (e *AttemptsRemainingError) Error() string {
+	return fmt.Sprintf("%v: %d attempts remaining", e.Err, e.Remaining)
+}
+
+func (e *AttemptsRemainingError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,109 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used for unknown locales and for keys a bundle lacks
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// bundles maps a locale, named after its file in locales/, to its messages
+var bundles = mustLoadBundles()
+
+func mustLoadBundles() map[string]map[string]string {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: read locales: %v", err))
+	}
+
+	loaded := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: read %s: %v", entry.Name(), err))
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: parse %s: %v", entry.Name(), err))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+	if _, ok := loaded[DefaultLocale]; !ok {
+		panic("i18n: missing the " + DefaultLocale + " bundle")
+	}
+	return loaded
+}
+
+// Locales lists the bundled locales in order
+func Locales() []string {
+	locales := make([]string, 0, len(bundles))
+	for locale := range bundles {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// T returns the message for key in locale. A key the locale lacks falls back to
+// English, and a key no bundle has is returned as is.
+func T(locale, key string) string {
+	if message, ok := bundles[locale][key]; ok {
+		return message
+	}
+	if message, ok := bundles[DefaultLocale][key]; ok {
+		return message
+	}
+	return key
+}
+
+// Match picks the bundled locale for an Accept-Language header, honouring
+// q-values. A regional tag like es-MX matches its language's bundle; when
+// nothing matches it is DefaultLocale.
+func Match(acceptLanguage string) string {
+	type preference struct {
+		tag     string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && quality > 0 {
+			preferences = append(preferences, preference{tag: tag, quality: quality})
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	for _, p := range preferences {
+		if p.tag == "*" {
+			return DefaultLocale
+		}
+		if _, ok := bundles[p.tag]; ok {
+			return p.tag
+		}
+		language, _, _ := strings.Cut(p.tag, "-")
+		if _, ok := bundles[language]; ok {
+			return language
+		}
+	}
+	return DefaultLocale
+}
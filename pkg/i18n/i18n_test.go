@@ -0,0 +1,61 @@
+package i18n
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		want           string
+	}{
+		{name: "empty", acceptLanguage: "", want: "en"},
+		{name: "exact", acceptLanguage: "es", want: "es"},
+		{name: "regional tag", acceptLanguage: "es-MX", want: "es"},
+		{name: "case insensitive", acceptLanguage: "ES-mx", want: "es"},
+		{name: "unknown locale", acceptLanguage: "de-DE", want: "en"},
+		{name: "first known in list", acceptLanguage: "de-DE, es;q=0.8, en;q=0.5", want: "es"},
+		{name: "q-values reorder", acceptLanguage: "en;q=0.4, es;q=0.9", want: "es"},
+		{name: "q=0 excludes", acceptLanguage: "es;q=0, en", want: "en"},
+		{name: "wildcard", acceptLanguage: "*", want: "en"},
+		{name: "malformed q skipped", acceptLanguage: "es;q=abc, en", want: "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.acceptLanguage); got != tt.want {
+				t.Errorf("Match(%q) = %q, want %q", tt.acceptLanguage, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("es", "error.invalid_otp"); got != "Código OTP no válido" {
+		t.Errorf("T(es) = %q, want the Spanish message", got)
+	}
+	if got := T("xx", "error.invalid_otp"); got != "Invalid OTP code" {
+		t.Errorf("T(unknown locale) = %q, want the English message", got)
+	}
+	if got := T("", "otp.sent"); got != "OTP sent successfully" {
+		t.Errorf("T(\"\") = %q, want the English message", got)
+	}
+	if got := T("es", "no.such_key"); got != "no.such_key" {
+		t.Errorf("T(unknown key) = %q, want the key", got)
+	}
+}
+
+// Every bundle translates every English key, so no locale silently mixes in English
+func TestBundlesMatchEnglish(t *testing.T) {
+	for _, locale := range Locales() {
+		for key := range bundles[DefaultLocale] {
+			if _, ok := bundles[locale][key]; !ok {
+				t.Errorf("%s bundle is missing %q", locale, key)
+			}
+		}
+		for key := range bundles[locale] {
+			if _, ok := bundles[DefaultLocale][key]; !ok {
+				t.Errorf("%s bundle has %q, which English lacks", locale, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+)
+
+// JWK is an RSA public key in RFC 7517 form
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Thumbprint is the RFC 7638 SHA-256 thumbprint of the key, used as its kid
+func Thumbprint(key *rsa.PublicKey) string {
+	// Members in lexicographic order with no whitespace, as the RFC requires
+	canonical, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{E: encodeExponent(key.E), Kty: "RSA", N: base64.RawURLEncoding.EncodeToString(key.N.Bytes())})
+
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS lists the current RSA public key first, then any previous ones. It is
+// empty for HS256, whose secret must never be published.
+func (jm *JWTManager) JWKS() JWKS {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, kid := range jm.publicKIDs {
+		key, ok := jm.keysByID[kid].(*rsa.PublicKey)
+		if !ok {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: AlgorithmRS256,
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   encodeExponent(key.E),
+		})
+	}
+	return jwks
+}
+
+// encodeExponent is the big-endian exponent without leading zero bytes
+func encodeExponent(e int) string {
+	return base64.RawURLEncoding.EncodeToString(big.NewInt(int64(e)).Bytes())
+}
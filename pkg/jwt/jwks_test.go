@@ -0,0 +1,99 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestThumbprint_RFC7638(t *testing.T) {
+	// The example key from RFC 7638 section 3.1
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+
+	if got, want := Thumbprint(key), "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("Thumbprint() = %v, want %v", got, want)
+	}
+}
+
+func TestJWTManager_JWKS(t *testing.T) {
+	privPEM, pubPEM := generateRSAKeyPEM(t)
+	manager, err := NewRS256Manager(privPEM, pubPEM, 1, 720)
+	if err != nil {
+		t.Fatalf("NewRS256Manager() unexpected error = %v", err)
+	}
+
+	token, err := manager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("GenerateToken() unexpected error = %v", err)
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(token, &Claims{})
+
+	jwks := manager.JWKS()
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("JWKS() has %d keys, want 1", len(jwks.Keys))
+	}
+	jwk := jwks.Keys[0]
+	if parsed.Header["kid"] != jwk.Kid {
+		t.Errorf("Token kid = %v, want the JWKS kid %v", parsed.Header["kid"], jwk.Kid)
+	}
+	if jwk.Kty != "RSA" || jwk.Alg != AlgorithmRS256 || jwk.Use != "sig" || jwk.E != "AQAB" {
+		t.Errorf("JWKS() key = %+v, want an RS256 signing key with e=AQAB", jwk)
+	}
+
+	// A verifier rebuilding the key from n and e gets the signing key back
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		t.Fatalf("n is not base64url: %v", err)
+	}
+	signingKey, _ := jwt.ParseRSAPrivateKeyFromPEM(privPEM)
+	if new(big.Int).SetBytes(n).Cmp(signingKey.N) != 0 {
+		t.Error("JWKS() modulus does not match the signing key")
+	}
+
+	if keys := NewJWTManager("test-secret-key", 1, 720).JWKS().Keys; len(keys) != 0 {
+		t.Errorf("HS256 JWKS() = %+v, want no keys", keys)
+	}
+}
+
+func TestJWTManager_PreviousPublicKey(t *testing.T) {
+	oldPriv, oldPub := generateRSAKeyPEM(t)
+	newPriv, newPub := generateRSAKeyPEM(t)
+
+	oldManager, _ := NewRS256Manager(oldPriv, oldPub, 1, 720)
+	oldToken, err := oldManager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("GenerateToken() unexpected error = %v", err)
+	}
+
+	manager, _ := NewRS256Manager(newPriv, newPub, 1, 720)
+	if _, err := manager.ValidateToken(oldToken); err == nil {
+		t.Fatal("ValidateToken() accepted a token from an untrusted key")
+	}
+
+	oldKID, err := manager.AddPublicKey(oldPub)
+	if err != nil {
+		t.Fatalf("AddPublicKey() unexpected error = %v", err)
+	}
+	if _, err := manager.ValidateToken(oldToken); err != nil {
+		t.Errorf("ValidateToken() for the previous key error = %v", err)
+	}
+
+	jwks := manager.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[1].Kid != oldKID {
+		t.Errorf("JWKS() = %+v, want the current key then %v", jwks.Keys, oldKID)
+	}
+
+	// Adding the same key twice does not duplicate it
+	manager.AddPublicKey(oldPub)
+	if keys := manager.JWKS().Keys; len(keys) != 2 {
+		t.Errorf("JWKS() has %d keys after re-adding, want 2", len(keys))
+	}
+
+	if _, err := NewJWTManager("test-secret-key", 1, 720).AddPublicKey(oldPub); err == nil {
+		t.Error("AddPublicKey() expected an error on an HS256 manager")
+	}
+}
@@ -1,57 +1,318 @@
 package jwt
 
 import (
+	"crypto/rand"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrTokenExpired = errors.New("token expired")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrInvalidTokenType = errors.New("wrong token type")
+	ErrSigningDisabled  = errors.New("no signing key configured")
+	ErrTokenCutOff      = errors.New("token issued before the revocation cutoff")
+)
+
+// Signing algorithms selected with JWT_ALGORITHM
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+)
+
+// Token types carried in the token_type claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
 )
 
 type Claims struct {
 	UserID      uint   `json:"user_id"`
 	PhoneNumber string `json:"phone_number"`
+	// Empty on access tokens issued before refresh tokens existed
+	TokenType string `json:"token_type,omitempty"`
+	// Empty on tokens issued before roles existed
+	Role string `json:"role,omitempty"`
+	// RegisteredClaims.ID is the jti, a random UUID unique to each issued token
 	jwt.RegisteredClaims
 }
 
 type JWTManager struct {
-	secretKey   string
-	expiryHours int
+	method     jwt.SigningMethod
+	signingKey interface{}
+	// verifyKey checks tokens minted without a kid header
+	verifyKey interface{}
+
+	// mu guards the signing key and key set, which AddKey and SetActiveKey
+	// change while requests are being served
+	mu sync.RWMutex
+	// kid is stamped on minted tokens; keysByID holds every key a token may
+	// name, the current one and any previous ones kept for rotation.
+	// publicKIDs lists the RSA keys in the order JWKS publishes them.
+	kid        string
+	keysByID   map[string]interface{}
+	publicKIDs []string
+
+	// issuer and audience are stamped on minted tokens and, when set,
+	// required of every token validated
+	issuer   string
+	audience string
+
+	// minIssuedAt rejects every token issued before it; guarded by mu, since
+	// SetMinIssuedAt moves it while requests are served
+	minIssuedAt time.Time
+
+	expiryHours        int
+	refreshExpiryHours int
 }
 
-func NewJWTManager(secretKey string, expiryHours int) *JWTManager {
+// NewJWTManager signs and verifies with a shared HMAC secret (HS256)
+func NewJWTManager(secretKey string, expiryHours, refreshExpiryHours int) *JWTManager {
 	return &JWTManager{
-		secretKey:   secretKey,
-		expiryHours: expiryHours,
+		method:             jwt.SigningMethodHS256,
+		signingKey:         []byte(secretKey),
+		verifyKey:          []byte(secretKey),
+		keysByID:           make(map[string]interface{}),
+		expiryHours:        expiryHours,
+		refreshExpiryHours: refreshExpiryHours,
+	}
+}
+
+// NewRS256Manager signs with an RSA private key and verifies with its public
+// key, both PEM encoded. Services that only verify tokens pass a nil privPEM;
+// their manager refuses to issue tokens.
+func NewRS256Manager(privPEM, pubPEM []byte, expiryHours, refreshExpiryHours int) (*JWTManager, error) {
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pubPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RSA public key: %w", err)
+	}
+
+	kid := Thumbprint(publicKey)
+	manager := &JWTManager{
+		method:             jwt.SigningMethodRS256,
+		verifyKey:          publicKey,
+		kid:                kid,
+		keysByID:           map[string]interface{}{kid: publicKey},
+		publicKIDs:         []string{kid},
+		expiryHours:        expiryHours,
+		refreshExpiryHours: refreshExpiryHours,
+	}
+	if len(privPEM) > 0 {
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA private key: %w", err)
+		}
+		if !privateKey.PublicKey.Equal(publicKey) {
+			return nil, errors.New("RSA private key does not match the public key")
+		}
+		manager.signingKey = privateKey
+	}
+	return manager, nil
+}
+
+// AddPublicKey trusts a previous RSA public key, so tokens it signed keep
+// validating after a rotation and it stays in the JWKS. It returns the kid.
+func (jm *JWTManager) AddPublicKey(pubPEM []byte) (string, error) {
+	if jm.method != jwt.SigningMethodRS256 {
+		return "", errors.New("public keys are only used with RS256")
+	}
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pubPEM)
+	if err != nil {
+		return "", fmt.Errorf("invalid RSA public key: %w", err)
+	}
+
+	kid := Thumbprint(publicKey)
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	if _, exists := jm.keysByID[kid]; !exists {
+		jm.keysByID[kid] = publicKey
+		jm.publicKIDs = append(jm.publicKIDs, kid)
+	}
+	return kid, nil
+}
+
+// AddKey trusts an HMAC secret under kid, so tokens it signed validate. It
+// only signs new tokens once made active with SetActiveKey.
+func (jm *JWTManager) AddKey(kid string, key []byte) error {
+	if jm.method != jwt.SigningMethodHS256 {
+		return errors.New("shared keys are only used with HS256; add RSA keys with AddPublicKey")
+	}
+	if kid == "" || len(key) == 0 {
+		return errors.New("key ID and key are required")
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.keysByID[kid] = key
+	return nil
+}
+
+// SetActiveKey signs new tokens with a key added by AddKey. Tokens signed with
+// the previous key keep validating for as long as its kid stays known.
+func (jm *JWTManager) SetActiveKey(kid string) error {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	key, ok := jm.keysByID[kid].([]byte)
+	if !ok {
+		return fmt.Errorf("unknown key ID %q", kid)
 	}
+	jm.signingKey = key
+	jm.kid = kid
+	return nil
+}
+
+// SetIssuer stamps iss on new tokens and rejects tokens from any other issuer.
+// Empty leaves iss unset and unchecked.
+func (jm *JWTManager) SetIssuer(issuer string) {
+	jm.issuer = issuer
 }
 
+// SetAudience stamps aud on new tokens and rejects tokens not meant for it.
+// Empty leaves aud unset and unchecked.
+func (jm *JWTManager) SetAudience(audience string) {
+	jm.audience = audience
+}
+
+// SetMinIssuedAt rejects every token, access or refresh, issued before t, at
+// the one-second precision of the iat claim. The zero time lifts the cutoff.
+func (jm *JWTManager) SetMinIssuedAt(t time.Time) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.minIssuedAt = t
+}
+
+// GenerateToken issues an access token without a role claim
 func (jm *JWTManager) GenerateToken(userID uint, phoneNumber string) (string, error) {
+	return jm.generate(userID, phoneNumber, "", TokenTypeAccess, time.Duration(jm.expiryHours)*time.Hour)
+}
+
+// GenerateTokenPair issues an access token and a longer-lived refresh token,
+// both carrying the user's role
+func (jm *JWTManager) GenerateTokenPair(userID uint, phoneNumber, role string) (accessToken, refreshToken string, err error) {
+	accessToken, err = jm.generate(userID, phoneNumber, role, TokenTypeAccess, time.Duration(jm.expiryHours)*time.Hour)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err = jm.generate(userID, phoneNumber, role, TokenTypeRefresh, time.Duration(jm.refreshExpiryHours)*time.Hour)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// GenerateAccessToken issues an access token carrying the user's role
+func (jm *JWTManager) GenerateAccessToken(userID uint, phoneNumber, role string) (string, error) {
+	return jm.generate(userID, phoneNumber, role, TokenTypeAccess, time.Duration(jm.expiryHours)*time.Hour)
+}
+
+// ValidateRefreshToken accepts refresh tokens only
+func (jm *JWTManager) ValidateRefreshToken(refreshToken string) (*Claims, error) {
+	claims, err := jm.parse(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != TokenTypeRefresh {
+		return nil, ErrInvalidTokenType
+	}
+	return claims, nil
+}
+
+// RefreshAccessToken issues a new access token for a valid refresh token,
+// copying its claims. Callers that can look the user up should use
+// ValidateRefreshToken and GenerateAccessToken so the claims are current.
+func (jm *JWTManager) RefreshAccessToken(refreshToken string) (string, error) {
+	claims, err := jm.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return "", err
+	}
+	return jm.GenerateAccessToken(claims.UserID, claims.PhoneNumber, claims.Role)
+}
+
+// ValidateToken accepts access tokens only, so a refresh token can't be used on API calls
+func (jm *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
+	claims, err := jm.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != "" && claims.TokenType != TokenTypeAccess {
+		return nil, ErrInvalidTokenType
+	}
+
+	return claims, nil
+}
+
+func (jm *JWTManager) generate(userID uint, phoneNumber, role, tokenType string, expiry time.Duration) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	claims := Claims{
 		UserID:      userID,
 		PhoneNumber: phoneNumber,
+		TokenType:   tokenType,
+		Role:        role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(jm.expiryHours) * time.Hour)),
+			ID:        tokenID,
+			Issuer:    jm.issuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if jm.audience != "" {
+		claims.Audience = jwt.ClaimStrings{jm.audience}
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jm.secretKey))
+	jm.mu.RLock()
+	signingKey, kid := jm.signingKey, jm.kid
+	jm.mu.RUnlock()
+
+	if signingKey == nil {
+		return "", ErrSigningDisabled
+	}
+	token := jwt.NewWithClaims(jm.method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(signingKey)
 }
 
-func (jm *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
+func (jm *JWTManager) parse(tokenString string) (*Claims, error) {
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{jm.method.Alg()})}
+	if jm.issuer != "" {
+		options = append(options, jwt.WithIssuer(jm.issuer))
+	}
+	if jm.audience != "" {
+		options = append(options, jwt.WithAudience(jm.audience))
+	}
+
+	// Only the configured alg is accepted, so an RS256 public key can never be
+	// used as an HMAC secret (alg confusion) and "none" is always refused
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if token.Method.Alg() != jm.method.Alg() {
 			return nil, ErrInvalidToken
 		}
-		return []byte(jm.secretKey), nil
-	})
+		kid, hasKID := token.Header["kid"]
+		if !hasKID {
+			return jm.verifyKey, nil
+		}
+		// A kid we never issued or trusted is refused rather than guessed at
+		kidString, _ := kid.(string)
+		jm.mu.RLock()
+		key, ok := jm.keysByID[kidString]
+		jm.mu.RUnlock()
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		return key, nil
+	}, options...)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -65,5 +326,34 @@ func (jm *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, ErrInvalidToken
 	}
 
+	jm.mu.RLock()
+	minIssuedAt := jm.minIssuedAt
+	jm.mu.RUnlock()
+	if !minIssuedAt.IsZero() && (claims.IssuedAt == nil || claims.IssuedAt.Unix() < minIssuedAt.Unix()) {
+		return nil, ErrTokenCutOff
+	}
+
 	return claims, nil
 }
+
+// ReadClaims decodes a token's claims without checking its signature or
+// expiry. It is only for tokens this service has just issued or verifies
+// separately, such as reading the jti of a freshly minted token.
+func ReadClaims(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// newTokenID is a random (version 4) UUID for the jti claim, so a single token can be revoked
+func newTokenID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -1,6 +1,12 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"regexp"
 	"testing"
 	"time"
 
@@ -10,7 +16,7 @@ import (
 func TestJWTManager_GenerateToken(t *testing.T) {
 	secretKey := "test-secret-key"
 	expiryHours := 1
-	jwtManager := NewJWTManager(secretKey, expiryHours)
+	jwtManager := NewJWTManager(secretKey, expiryHours, 720)
 
 	tests := []struct {
 		name        string
@@ -59,7 +65,7 @@ func TestJWTManager_GenerateToken(t *testing.T) {
 func TestJWTManager_ValidateToken(t *testing.T) {
 	secretKey := "test-secret-key"
 	expiryHours := 1
-	jwtManager := NewJWTManager(secretKey, expiryHours)
+	jwtManager := NewJWTManager(secretKey, expiryHours, 720)
 
 	// Generate a valid token
 	userID := uint(123)
@@ -82,7 +88,7 @@ func TestJWTManager_ValidateToken(t *testing.T) {
 	expiredTokenString, _ := expiredToken.SignedString([]byte(secretKey))
 
 	// Generate token with wrong secret
-	wrongSecretManager := NewJWTManager("wrong-secret", expiryHours)
+	wrongSecretManager := NewJWTManager("wrong-secret", expiryHours, 720)
 	wrongSecretToken, _ := wrongSecretManager.GenerateToken(userID, phoneNumber)
 
 	tests := []struct {
@@ -136,7 +142,7 @@ func TestJWTManager_ValidateToken(t *testing.T) {
 func TestJWTManager_TokenExpiry(t *testing.T) {
 	secretKey := "test-secret-key"
 	expiryHours := 1
-	jwtManager := NewJWTManager(secretKey, expiryHours)
+	jwtManager := NewJWTManager(secretKey, expiryHours, 720)
 
 	token, err := jwtManager.GenerateToken(1, "+1234567890")
 	if err != nil {
@@ -156,3 +162,415 @@ func TestJWTManager_TokenExpiry(t *testing.T) {
 		t.Errorf("Token expiry mismatch. Expected around %v, got %v", expectedExpiry, actualExpiry)
 	}
 }
+
+func TestJWTManager_TokenPairTypes(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key", 1, 720)
+
+	accessToken, refreshToken, err := jwtManager.GenerateTokenPair(1, "+1234567890", "admin")
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() unexpected error = %v", err)
+	}
+
+	if _, err := jwtManager.ValidateToken(refreshToken); err != ErrInvalidTokenType {
+		t.Errorf("ValidateToken(refresh) error = %v, want %v", err, ErrInvalidTokenType)
+	}
+	if _, err := jwtManager.RefreshAccessToken(accessToken); err != ErrInvalidTokenType {
+		t.Errorf("RefreshAccessToken(access) error = %v, want %v", err, ErrInvalidTokenType)
+	}
+
+	newAccessToken, err := jwtManager.RefreshAccessToken(refreshToken)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken() unexpected error = %v", err)
+	}
+	claims, err := jwtManager.ValidateToken(newAccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken(refreshed) unexpected error = %v", err)
+	}
+	if claims.UserID != 1 || claims.PhoneNumber != "+1234567890" || claims.TokenType != TokenTypeAccess || claims.Role != "admin" {
+		t.Errorf("Refreshed claims = %+v, want admin access token for user 1", claims)
+	}
+}
+
+func TestJWTManager_IndependentExpiries(t *testing.T) {
+	expiryHours, refreshExpiryHours := 1, 48
+	jwtManager := NewJWTManager("test-secret-key", expiryHours, refreshExpiryHours)
+
+	accessToken, refreshToken, err := jwtManager.GenerateTokenPair(1, "+1234567890", "user")
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		hours int
+	}{
+		{"access", accessToken, expiryHours},
+		{"refresh", refreshToken, refreshExpiryHours},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := jwtManager.parse(tt.token)
+			if err != nil {
+				t.Fatalf("parse() unexpected error = %v", err)
+			}
+
+			expectedExpiry := time.Now().Add(time.Duration(tt.hours) * time.Hour)
+			if claims.ExpiresAt.Time.Sub(expectedExpiry).Abs() > time.Second {
+				t.Errorf("Expiry = %v, want around %v", claims.ExpiresAt.Time, expectedExpiry)
+			}
+		})
+	}
+}
+
+func TestJWTManager_RefreshAccessToken_Expired(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key", 1, 720)
+
+	expired, err := jwtManager.generate(1, "+1234567890", "", TokenTypeRefresh, -time.Hour)
+	if err != nil {
+		t.Fatalf("generate() unexpected error = %v", err)
+	}
+
+	if _, err := jwtManager.RefreshAccessToken(expired); err != ErrTokenExpired {
+		t.Errorf("RefreshAccessToken() error = %v, want %v", err, ErrTokenExpired)
+	}
+}
+
+func TestJWTManager_TokenID(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key", 1, 720)
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	first, err := jwtManager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("GenerateToken() unexpected error = %v", err)
+	}
+	second, err := jwtManager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("GenerateToken() unexpected error = %v", err)
+	}
+
+	firstClaims, err := jwtManager.ValidateToken(first)
+	if err != nil {
+		t.Fatalf("ValidateToken() unexpected error = %v", err)
+	}
+	secondClaims, err := jwtManager.ValidateToken(second)
+	if err != nil {
+		t.Fatalf("ValidateToken() unexpected error = %v", err)
+	}
+
+	if !uuidPattern.MatchString(firstClaims.ID) {
+		t.Errorf("jti = %q, want a version 4 UUID", firstClaims.ID)
+	}
+	if firstClaims.ID == secondClaims.ID {
+		t.Errorf("Back-to-back tokens share jti %q", firstClaims.ID)
+	}
+
+	// The jti is in the signed payload, not only in the struct
+	parsed, _, err := jwt.NewParser().ParseUnverified(first, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() unexpected error = %v", err)
+	}
+	if jti := parsed.Claims.(jwt.MapClaims)["jti"]; jti != firstClaims.ID {
+		t.Errorf("Payload jti = %v, want %q", jti, firstClaims.ID)
+	}
+
+	// Each refresh issues a token with its own jti
+	_, refreshToken, err := jwtManager.GenerateTokenPair(1, "+1234567890", "user")
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() unexpected error = %v", err)
+	}
+	refreshed, err := jwtManager.RefreshAccessToken(refreshToken)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken() unexpected error = %v", err)
+	}
+	refreshedClaims, _ := jwtManager.ValidateToken(refreshed)
+	if refreshedClaims.ID == "" || refreshedClaims.ID == firstClaims.ID {
+		t.Errorf("Refreshed jti = %q, want a new ID", refreshedClaims.ID)
+	}
+}
+
+func TestReadClaims(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key", 1, 720)
+	accessToken, refreshToken, err := jwtManager.GenerateTokenPair(7, "+1234567890", "user")
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() unexpected error = %v", err)
+	}
+
+	for _, token := range []string{accessToken, refreshToken} {
+		verified, err := jwtManager.parse(token)
+		if err != nil {
+			t.Fatalf("parse() unexpected error = %v", err)
+		}
+		claims, err := ReadClaims(token)
+		if err != nil {
+			t.Fatalf("ReadClaims() unexpected error = %v", err)
+		}
+		if claims.ID != verified.ID || claims.UserID != 7 || !claims.ExpiresAt.Equal(verified.ExpiresAt.Time) {
+			t.Errorf("ReadClaims() = %+v, want the claims of the issued token", claims)
+		}
+	}
+
+	if _, err := ReadClaims("not-a-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ReadClaims() error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func generateRSAKeyPEM(t *testing.T) (privPEM, pubPEM []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	privPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	pubPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	return privPEM, pubPEM
+}
+
+func TestRS256Manager(t *testing.T) {
+	privPEM, pubPEM := generateRSAKeyPEM(t)
+
+	signer, err := NewRS256Manager(privPEM, pubPEM, 1, 720)
+	if err != nil {
+		t.Fatalf("NewRS256Manager() unexpected error = %v", err)
+	}
+	verifier, err := NewRS256Manager(nil, pubPEM, 1, 720)
+	if err != nil {
+		t.Fatalf("NewRS256Manager() verify-only unexpected error = %v", err)
+	}
+
+	token, err := signer.GenerateToken(42, "+1234567890")
+	if err != nil {
+		t.Fatalf("GenerateToken() unexpected error = %v", err)
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if alg := parsed.Method.Alg(); alg != AlgorithmRS256 {
+		t.Errorf("Token alg = %v, want %v", alg, AlgorithmRS256)
+	}
+
+	// A service holding only the public key verifies but cannot mint tokens
+	claims, err := verifier.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken() unexpected error = %v", err)
+	}
+	if claims.UserID != 42 {
+		t.Errorf("UserID = %v, want 42", claims.UserID)
+	}
+	if _, err := verifier.GenerateToken(42, "+1234567890"); !errors.Is(err, ErrSigningDisabled) {
+		t.Errorf("GenerateToken() without a private key error = %v, want %v", err, ErrSigningDisabled)
+	}
+
+	otherPriv, _ := generateRSAKeyPEM(t)
+	if _, err := NewRS256Manager(otherPriv, pubPEM, 1, 720); err == nil {
+		t.Error("NewRS256Manager() expected an error for a mismatched key pair")
+	}
+	if _, err := NewRS256Manager(nil, []byte("not a key"), 1, 720); err == nil {
+		t.Error("NewRS256Manager() expected an error for an invalid public key")
+	}
+}
+
+func TestJWTManager_AlgorithmConfusion(t *testing.T) {
+	privPEM, pubPEM := generateRSAKeyPEM(t)
+	rsManager, err := NewRS256Manager(privPEM, pubPEM, 1, 720)
+	if err != nil {
+		t.Fatalf("NewRS256Manager() unexpected error = %v", err)
+	}
+	hsManager := NewJWTManager("test-secret-key", 1, 720)
+
+	claims := Claims{
+		UserID:    1,
+		TokenType: TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+
+	// The classic attack: HS256 keyed with the (public) RSA key
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(pubPEM)
+	if err != nil {
+		t.Fatalf("Failed to sign forged token: %v", err)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("Failed to build unsigned token: %v", err)
+	}
+	rsToken, _ := rsManager.GenerateToken(1, "+1234567890")
+	hsToken, _ := hsManager.GenerateToken(1, "+1234567890")
+
+	tests := []struct {
+		name    string
+		manager *JWTManager
+		token   string
+	}{
+		{"HS256 keyed with the public key", rsManager, forged},
+		{"Unsigned token on RS256", rsManager, unsigned},
+		{"Unsigned token on HS256", hsManager, unsigned},
+		{"HS256 token on RS256", rsManager, hsToken},
+		{"RS256 token on HS256", hsManager, rsToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.manager.ValidateToken(tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ValidateToken() error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestJWTManager_KeyRotation(t *testing.T) {
+	jwtManager := NewJWTManager("legacy-secret", 1, 720)
+	legacyToken, _ := jwtManager.GenerateToken(1, "+1234567890")
+
+	if err := jwtManager.AddKey("2024-01", []byte("old-secret")); err != nil {
+		t.Fatalf("AddKey() unexpected error = %v", err)
+	}
+	if err := jwtManager.SetActiveKey("2024-01"); err != nil {
+		t.Fatalf("SetActiveKey() unexpected error = %v", err)
+	}
+	oldToken, _ := jwtManager.GenerateToken(1, "+1234567890")
+
+	// Roll to a new key at runtime
+	if err := jwtManager.AddKey("2024-06", []byte("new-secret")); err != nil {
+		t.Fatalf("AddKey() unexpected error = %v", err)
+	}
+	if err := jwtManager.SetActiveKey("2024-06"); err != nil {
+		t.Fatalf("SetActiveKey() unexpected error = %v", err)
+	}
+	newToken, _ := jwtManager.GenerateToken(1, "+1234567890")
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() unexpected error = %v", err)
+	}
+	if kid := parsed.Header["kid"]; kid != "2024-06" {
+		t.Errorf("kid header = %v, want 2024-06", kid)
+	}
+
+	unknownManager := NewJWTManager("legacy-secret", 1, 720)
+	unknownManager.AddKey("2099-01", []byte("new-secret"))
+	unknownManager.SetActiveKey("2099-01")
+	unknownToken, _ := unknownManager.GenerateToken(1, "+1234567890")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"Token without kid uses the legacy secret", legacyToken, nil},
+		{"Token signed with the old kid", oldToken, nil},
+		{"Token signed with the active kid", newToken, nil},
+		{"Token with an unknown kid", unknownToken, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := jwtManager.ValidateToken(tt.token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWTManager_KeyRotationErrors(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key", 1, 720)
+	if err := jwtManager.SetActiveKey("missing"); err == nil {
+		t.Error("SetActiveKey() expected an error for an unknown kid")
+	}
+	if err := jwtManager.AddKey("", []byte("secret")); err == nil {
+		t.Error("AddKey() expected an error for an empty kid")
+	}
+
+	privPEM, pubPEM := generateRSAKeyPEM(t)
+	rsManager, err := NewRS256Manager(privPEM, pubPEM, 1, 720)
+	if err != nil {
+		t.Fatalf("NewRS256Manager() unexpected error = %v", err)
+	}
+	if err := rsManager.AddKey("2024-01", []byte("secret")); err == nil {
+		t.Error("AddKey() expected an error on RS256")
+	}
+	// An RSA public key's kid can't become an HMAC signing key
+	if err := rsManager.SetActiveKey(Thumbprint(rsManager.verifyKey.(*rsa.PublicKey))); err == nil {
+		t.Error("SetActiveKey() expected an error for an RSA kid")
+	}
+}
+
+func TestJWTManager_IssuerAudience(t *testing.T) {
+	newManager := func(issuer, audience string) *JWTManager {
+		manager := NewJWTManager("test-secret-key", 1, 720)
+		manager.SetIssuer(issuer)
+		manager.SetAudience(audience)
+		return manager
+	}
+
+	tests := []struct {
+		name     string
+		issuer   *JWTManager
+		verifier *JWTManager
+		wantErr  error
+	}{
+		{"Matching issuer and audience", newManager("otp-auth", "api"), newManager("otp-auth", "api"), nil},
+		{"Wrong issuer", newManager("someone-else", "api"), newManager("otp-auth", "api"), ErrInvalidToken},
+		{"Wrong audience", newManager("otp-auth", "billing"), newManager("otp-auth", "api"), ErrInvalidToken},
+		{"Missing claims when required", newManager("", ""), newManager("otp-auth", "api"), ErrInvalidToken},
+		{"Unchecked when not configured", newManager("otp-auth", "api"), newManager("", ""), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accessToken, refreshToken, err := tt.issuer.GenerateTokenPair(1, "+1234567890", "user")
+			if err != nil {
+				t.Fatalf("GenerateTokenPair() unexpected error = %v", err)
+			}
+
+			claims, err := tt.verifier.ValidateToken(accessToken)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Issuer != tt.issuer.issuer {
+				t.Errorf("Issuer = %q, want %q", claims.Issuer, tt.issuer.issuer)
+			}
+			if _, err := tt.verifier.RefreshAccessToken(refreshToken); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RefreshAccessToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWTManager_MinIssuedAt(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key", 1, 720)
+
+	accessToken, refreshToken, err := jwtManager.GenerateTokenPair(1, "+1234567890", "user")
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() unexpected error = %v", err)
+	}
+
+	// A cutoff after the tokens were issued rejects both of them
+	jwtManager.SetMinIssuedAt(time.Now().Add(time.Minute))
+	if _, err := jwtManager.ValidateToken(accessToken); !errors.Is(err, ErrTokenCutOff) {
+		t.Errorf("ValidateToken() before the cutoff error = %v, want %v", err, ErrTokenCutOff)
+	}
+	if _, err := jwtManager.RefreshAccessToken(refreshToken); !errors.Is(err, ErrTokenCutOff) {
+		t.Errorf("RefreshAccessToken() before the cutoff error = %v, want %v", err, ErrTokenCutOff)
+	}
+
+	// Tokens issued in the cutoff's second or later pass
+	jwtManager.SetMinIssuedAt(time.Now())
+	newToken, err := jwtManager.GenerateToken(1, "+1234567890")
+	if err != nil {
+		t.Fatalf("GenerateToken() unexpected error = %v", err)
+	}
+	if _, err := jwtManager.ValidateToken(newToken); err != nil {
+		t.Errorf("ValidateToken() after the cutoff unexpected error = %v", err)
+	}
+
+	// The zero time lifts the cutoff
+	jwtManager.SetMinIssuedAt(time.Time{})
+	if _, err := jwtManager.ValidateToken(accessToken); err != nil {
+		t.Errorf("ValidateToken() without a cutoff unexpected error = %v", err)
+	}
+}
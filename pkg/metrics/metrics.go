@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Metrics holds the Prometheus collectors exported on /metrics
+type Metrics struct {
+	registry        *prometheus.Registry
+	smsSendDuration *prometheus.HistogramVec
+	smsSendErrors   *prometheus.CounterVec
+	breakGlassUses  prometheus.Counter
+	otpEvictions    prometheus.Counter
+	otpSent         *prometheus.CounterVec
+	otpRateLimited  prometheus.Counter
+	otpVerifies     *prometheus.CounterVec
+	otpVerifyTime   prometheus.Histogram
+	buildInfo       *prometheus.GaugeVec
+	otpLength       prometheus.Gauge
+	otpExpiry       prometheus.Gauge
+	otpMaxAttempts  prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		smsSendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "sms_send_duration_seconds",
+			Help:    "Duration of SMS provider send calls in seconds.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"provider"}),
+		smsSendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sms_send_errors_total",
+			Help: "Total number of failed SMS provider send calls.",
+		}, []string{"provider"}),
+		breakGlassUses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "break_glass_token_uses_total",
+			Help: "Total number of requests authenticated with the break-glass token; alert on any increase.",
+		}),
+		otpEvictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "otp_unexpected_eviction_total",
+			Help: "Total number of OTPs found missing from Redis before their expiry.",
+		}),
+		otpSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "otp_sent_total",
+			Help: "Total number of OTPs sent, by the channel they went out on.",
+		}, []string{"channel"}),
+		otpRateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "otp_rate_limit_rejections_total",
+			Help: "Total number of OTP sends refused by the rate limit or the resend cooldown.",
+		}),
+		otpVerifies: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "otp_verifications_total",
+			Help: "Total number of OTP verifications, by result: success, invalid, expired, too_many or other.",
+		}, []string{"result"}),
+		otpVerifyTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "otp_verify_duration_seconds",
+			Help:    "Duration of OTP verifications in seconds.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		buildInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "build_info",
+			Help: "Build version and commit of the running binary; always 1.",
+		}, []string{"version", "commit"}),
+		otpLength: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "otp_length",
+			Help: "Configured number of digits in an OTP.",
+		}),
+		otpExpiry: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "otp_expiry_minutes",
+			Help: "Configured OTP lifetime in minutes.",
+		}),
+		otpMaxAttempts: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "otp_max_attempts",
+			Help: "Configured verify attempts allowed per OTP.",
+		}),
+	}
+
+	buildVersion, buildCommit := version.Info()
+	m.buildInfo.WithLabelValues(buildVersion, buildCommit).Set(1)
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.smsSendDuration,
+		m.smsSendErrors,
+		m.breakGlassUses,
+		m.otpEvictions,
+		m.otpSent,
+		m.otpRateLimited,
+		m.otpVerifies,
+		m.otpVerifyTime,
+		m.buildInfo,
+		m.otpLength,
+		m.otpExpiry,
+		m.otpMaxAttempts,
+	)
+
+	return m
+}
+
+// Registry returns the registry backing the /metrics endpoint
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// ObserveSMSSend records the latency of a provider send call and counts it as an error when it failed
+func (m *Metrics) ObserveSMSSend(provider string, duration time.Duration, err error) {
+	m.smsSendDuration.WithLabelValues(provider).Observe(duration.Seconds())
+	if err != nil {
+		m.smsSendErrors.WithLabelValues(provider).Inc()
+	}
+}
+
+// ObserveBreakGlassUse counts a request authenticated with the break-glass token
+func (m *Metrics) ObserveBreakGlassUse() {
+	m.breakGlassUses.Inc()
+}
+
+// ObserveOTPEviction counts an OTP that Redis dropped before its TTL ran out
+func (m *Metrics) ObserveOTPEviction() {
+	m.otpEvictions.Inc()
+}
+
+// ObserveOTPSent counts an OTP handed to the given channel
+func (m *Metrics) ObserveOTPSent(channel string) {
+	m.otpSent.WithLabelValues(channel).Inc()
+}
+
+// ObserveOTPRateLimited counts a send refused before any code went out
+func (m *Metrics) ObserveOTPRateLimited() {
+	m.otpRateLimited.Inc()
+}
+
+// ObserveOTPVerify records the latency of a verification and counts it under its result
+func (m *Metrics) ObserveOTPVerify(result string, duration time.Duration) {
+	m.otpVerifyTime.Observe(duration.Seconds())
+	m.otpVerifies.WithLabelValues(result).Inc()
+}
+
+// SetOTPConfig exports the non-secret OTP settings so operators can see what an instance runs with
+func (m *Metrics) SetOTPConfig(length, expiryMinutes, maxAttempts int) {
+	m.otpLength.Set(float64(length))
+	m.otpExpiry.Set(float64(expiryMinutes))
+	m.otpMaxAttempts.Set(float64(maxAttempts))
+}
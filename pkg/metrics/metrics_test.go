@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/pkg/version"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetrics_BuildAndConfigInfo(t *testing.T) {
+	version.Version, version.Commit = "v1.2.3", "abc1234"
+	defer func() { version.Version, version.Commit = "", "" }()
+
+	m := New()
+	m.SetOTPConfig(6, 2, 3)
+	m.ObserveOTPSent("sms")
+	m.ObserveOTPRateLimited()
+	m.ObserveOTPVerify("expired", 10*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(m.Registry(), promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+
+	for _, want := range []string{
+		`build_info{commit="abc1234",version="v1.2.3"} 1`,
+		"otp_length 6",
+		"otp_expiry_minutes 2",
+		"otp_max_attempts 3",
+		`otp_sent_total{channel="sms"} 1`,
+		"otp_rate_limit_rejections_total 1",
+		`otp_verifications_total{result="expired"} 1`,
+		"otp_verify_duration_seconds_count 1",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Metrics output missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last row of a page; the next page starts after it
+type Cursor struct {
+	LastID    uint      `json:"last_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// signedCursor is the JSON carried inside the opaque cursor string
+type signedCursor struct {
+	Payload   json.RawMessage `json:"payload"`
+	Signature string          `json:"signature"`
+}
+
+// EncodeCursor signs the cursor with secret so clients can't forge one to probe data
+func EncodeCursor(secret string, cursor Cursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	signed, err := json.Marshal(signedCursor{Payload: payload, Signature: sign(secret, payload)})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(signed), nil
+}
+
+// DecodeCursor returns ErrInvalidCursor for malformed, tampered or foreign cursors
+func DecodeCursor(secret, encoded string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var signed signedCursor
+	if err := json.Unmarshal(raw, &signed); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if !hmac.Equal([]byte(signed.Signature), []byte(sign(secret, signed.Payload))) {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(signed.Payload, &cursor); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,62 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	cursor := Cursor{LastID: 42, Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	encoded, err := EncodeCursor("test-secret", cursor)
+	if err != nil {
+		t.Fatalf("EncodeCursor() unexpected error = %v", err)
+	}
+
+	decoded, err := DecodeCursor("test-secret", encoded)
+	if err != nil {
+		t.Fatalf("DecodeCursor() unexpected error = %v", err)
+	}
+	if decoded.LastID != cursor.LastID || !decoded.Timestamp.Equal(cursor.Timestamp) {
+		t.Errorf("DecodeCursor() = %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestDecodeCursor_Rejects(t *testing.T) {
+	encoded, err := EncodeCursor("test-secret", Cursor{LastID: 42, Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("EncodeCursor() unexpected error = %v", err)
+	}
+
+	// Same signature, but the payload now points somewhere else
+	raw, _ := base64.RawURLEncoding.DecodeString(encoded)
+	var signed signedCursor
+	if err := json.Unmarshal(raw, &signed); err != nil {
+		t.Fatalf("Failed to unpack cursor: %v", err)
+	}
+	signed.Payload = json.RawMessage(`{"last_id":1,"timestamp":"2024-01-02T03:04:05Z"}`)
+	raw, _ = json.Marshal(signed)
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name    string
+		secret  string
+		encoded string
+	}{
+		{"tampered payload", "test-secret", tampered},
+		{"wrong secret", "other-secret", encoded},
+		{"not base64", "test-secret", "not a cursor!"},
+		{"not json", "test-secret", base64.RawURLEncoding.EncodeToString([]byte("42"))},
+		{"empty", "test-secret", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.secret, tt.encoded); err != ErrInvalidCursor {
+				t.Errorf("DecodeCursor() error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
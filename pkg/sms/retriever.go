@@ -0,0 +1,21 @@
+package sms
+
+import "fmt"
+
+// appHashLength is the length of the hash Android derives from an app's
+// package name and signing certificate
+const appHashLength = 11
+
+// ValidateAppHash checks that an SMS Retriever app hash is well formed
+func ValidateAppHash(appHash string) error {
+	if len(appHash) != appHashLength {
+		return fmt.Errorf("SMS app hash must be %d characters, got %d", appHashLength, len(appHash))
+	}
+	return nil
+}
+
+// RetrieverMessage formats an OTP SMS for Android's SMS Retriever API, which
+// only hands the app messages that start with "<#> " and end with its hash
+func RetrieverMessage(message, appHash string) string {
+	return "<#> " + message + "\n" + appHash
+}
@@ -0,0 +1,217 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+)
+
+// APIError is a non-2xx response from the Twilio Messages or Calls API
+type APIError struct {
+	StatusCode int
+	Code       int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("twilio: status %d, code %d: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("twilio: status %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed if retried. Only rate
+// limiting qualifies: a 5xx may come after Twilio has already queued the
+// message, and posting it again would deliver the code twice.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// TwilioSender delivers OTP codes as SMS through the Twilio Messages API
+type TwilioSender struct {
+	config   config.TwilioConfig
+	client   *http.Client
+	template *template.Template
+
+	// appHash is set when OTP messages use the SMS Retriever format
+	appHash string
+
+	// sleep waits between retries; tests replace it to skip the backoff
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewTwilioSender(smsConfig config.SMSConfig) (*TwilioSender, error) {
+	cfg := smsConfig.Twilio
+	if cfg.AccountSID == "" || cfg.AuthToken == "" || cfg.FromNumber == "" {
+		return nil, errors.New("twilio account SID, auth token and from number are required")
+	}
+
+	tmpl, err := template.New("otp").Option("missingkey=error").Parse(cfg.MessageTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid twilio message template: %w", err)
+	}
+
+	sender := &TwilioSender{
+		config:   cfg,
+		client:   &http.Client{},
+		template: tmpl,
+		sleep:    sleepContext,
+	}
+	if smsConfig.RetrieverFormat {
+		if err := ValidateAppHash(smsConfig.AppHash); err != nil {
+			return nil, err
+		}
+		sender.appHash = smsConfig.AppHash
+	}
+	return sender, nil
+}
+
+func (s *TwilioSender) Name() string {
+	return "twilio"
+}
+
+func (s *TwilioSender) Send(ctx context.Context, senderID, phoneNumber, code string) error {
+	var body bytes.Buffer
+	if err := s.template.Execute(&body, struct{ Code string }{Code: code}); err != nil {
+		return fmt.Errorf("failed to render twilio message: %w", err)
+	}
+
+	message := body.String()
+	if s.appHash != "" {
+		message = RetrieverMessage(message, s.appHash)
+	}
+	return s.SendMessage(ctx, senderID, phoneNumber, message)
+}
+
+// SendMessage posts the message, retrying with exponential backoff when the
+// request never reached Twilio or was rate limited. A regional sender ID
+// replaces the configured from number.
+func (s *TwilioSender) SendMessage(ctx context.Context, senderID, phoneNumber, message string) error {
+	from := s.config.FromNumber
+	if senderID != "" {
+		from = senderID
+	}
+
+	form := url.Values{}
+	form.Set("To", phoneNumber)
+	form.Set("From", from)
+	form.Set("Body", message)
+	return s.postWithRetry(ctx, "Messages.json", form)
+}
+
+// Call reads the code out in a voice call through the Twilio Calls API, digit
+// by digit and twice over. Sender IDs cannot place calls, so the call always
+// comes from the configured from number.
+func (s *TwilioSender) Call(ctx context.Context, phoneNumber, code string) error {
+	form := url.Values{}
+	form.Set("To", phoneNumber)
+	form.Set("From", s.config.FromNumber)
+	form.Set("Twiml", voiceTwiML(code))
+	return s.postWithRetry(ctx, "Calls.json", form)
+}
+
+// voiceTwiML spells the code out so it is read as characters, not as a number
+func voiceTwiML(code string) string {
+	var spoken bytes.Buffer
+	xml.EscapeText(&spoken, []byte(strings.Join(strings.Split(code, ""), ", ")))
+
+	say := "<Say>Your verification code is " + spoken.String() + ".</Say>"
+	return "<Response>" + say + `<Pause length="1"/>` + say + "</Response>"
+}
+
+// postWithRetry posts to an account resource, retrying with exponential backoff
+// only while a retry cannot send the same message or call twice
+func (s *TwilioSender) postWithRetry(ctx context.Context, resource string, form url.Values) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = s.post(ctx, resource, form); err == nil {
+			return nil
+		}
+
+		if !retryable(err) || attempt >= s.config.MaxRetries {
+			return err
+		}
+		if sleepErr := s.sleep(ctx, s.config.RetryBackoff<<attempt); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+func (s *TwilioSender) post(ctx context.Context, resource string, form url.Values) error {
+	if s.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.Timeout)
+		defer cancel()
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/%s",
+		strings.TrimRight(s.config.BaseURL, "/"), url.PathEscape(s.config.AccountSID), resource)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build twilio request: %w", err)
+	}
+	req.SetBasicAuth(s.config.AccountSID, s.config.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("twilio request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	// Twilio describes failures as {"code": ..., "message": ...}; fall back to
+	// the status text when the body is something else
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var payload struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&payload); err == nil && payload.Message != "" {
+		apiErr.Code = payload.Code
+		apiErr.Message = payload.Message
+	} else {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
+
+// retryable reports whether err left Twilio without the request: the
+// connection could not be opened, or the request was rate limited
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
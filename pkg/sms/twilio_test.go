@@ -0,0 +1,295 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ehsanshojaei/go-otp-auth/internal/config"
+)
+
+func newTestTwilioSender(t *testing.T, handler http.HandlerFunc) *TwilioSender {
+	t.Helper()
+	return newTestTwilioSenderWithConfig(t, config.SMSConfig{}, handler)
+}
+
+func newTestTwilioSenderWithConfig(t *testing.T, cfg config.SMSConfig, handler http.HandlerFunc) *TwilioSender {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg.Twilio = config.TwilioConfig{
+		AccountSID:      "AC123",
+		AuthToken:       "secret",
+		FromNumber:      "+15550000000",
+		BaseURL:         server.URL,
+		MessageTemplate: "Your code is {{.Code}}",
+		Timeout:         time.Second,
+		MaxRetries:      2,
+		RetryBackoff:    100 * time.Millisecond,
+	}
+	sender, err := NewTwilioSender(cfg)
+	if err != nil {
+		t.Fatalf("NewTwilioSender() unexpected error = %v", err)
+	}
+
+	sender.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return sender
+}
+
+func TestTwilioSender_Send(t *testing.T) {
+	var got *http.Request
+	sender := newTestTwilioSender(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM123"}`))
+	})
+
+	if err := sender.Send(context.Background(), "", "+1234567890", "123456"); err != nil {
+		t.Fatalf("Send() unexpected error = %v", err)
+	}
+
+	if got.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+		t.Errorf("Path = %q, want the account's Messages.json", got.URL.Path)
+	}
+	if user, pass, ok := got.BasicAuth(); !ok || user != "AC123" || pass != "secret" {
+		t.Errorf("BasicAuth() = %q, %q, %v, want the account SID and auth token", user, pass, ok)
+	}
+	if got.PostForm.Get("To") != "+1234567890" || got.PostForm.Get("From") != "+15550000000" {
+		t.Errorf("To/From = %q/%q, want +1234567890/+15550000000", got.PostForm.Get("To"), got.PostForm.Get("From"))
+	}
+	if body := got.PostForm.Get("Body"); body != "Your code is 123456" {
+		t.Errorf("Body = %q, want %q", body, "Your code is 123456")
+	}
+
+	// A regional sender ID replaces the configured from number
+	if err := sender.Send(context.Background(), "ACME", "+1234567890", "123456"); err != nil {
+		t.Fatalf("Send() unexpected error = %v", err)
+	}
+	if from := got.PostForm.Get("From"); from != "ACME" {
+		t.Errorf("From = %q, want %q", from, "ACME")
+	}
+}
+
+func TestTwilioSender_Call(t *testing.T) {
+	var got *http.Request
+	sender := newTestTwilioSender(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "CA123"}`))
+	})
+
+	if err := sender.Call(context.Background(), "+1234567890", "12<4"); err != nil {
+		t.Fatalf("Call() unexpected error = %v", err)
+	}
+
+	if got.URL.Path != "/2010-04-01/Accounts/AC123/Calls.json" {
+		t.Errorf("Path = %q, want the account's Calls.json", got.URL.Path)
+	}
+	if got.PostForm.Get("To") != "+1234567890" || got.PostForm.Get("From") != "+15550000000" {
+		t.Errorf("To/From = %q/%q, want +1234567890/+15550000000", got.PostForm.Get("To"), got.PostForm.Get("From"))
+	}
+	twiml := got.PostForm.Get("Twiml")
+	if strings.Count(twiml, "1, 2, &lt;, 4") != 2 || !strings.HasPrefix(twiml, "<Response>") {
+		t.Errorf("Twiml = %q, want the escaped code spelled out twice", twiml)
+	}
+}
+
+func TestTwilioSender_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		body       string
+		wantErr    bool
+		wantCode   int
+		wantCalls  int32
+		wantWaits  []time.Duration
+		wantStatus int
+	}{
+		{
+			name:      "Retries 429 then succeeds",
+			statuses:  []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusCreated},
+			wantCalls: 3,
+			wantWaits: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name:       "Gives up after max retries",
+			statuses:   []int{http.StatusTooManyRequests},
+			wantErr:    true,
+			wantCalls:  3,
+			wantWaits:  []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			// Twilio may have queued the message before failing
+			name:       "5xx is not retried",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusCreated},
+			wantErr:    true,
+			wantCalls:  1,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "4xx is not retried",
+			statuses:   []int{http.StatusBadRequest},
+			body:       `{"code": 21211, "message": "The 'To' number is not a valid phone number.", "status": 400}`,
+			wantErr:    true,
+			wantCode:   21211,
+			wantCalls:  1,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			sender := newTestTwilioSender(t, func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1)) - 1
+				status := tt.statuses[min(n, len(tt.statuses)-1)]
+				w.WriteHeader(status)
+				w.Write([]byte(tt.body))
+			})
+			var waits []time.Duration
+			sender.sleep = func(ctx context.Context, d time.Duration) error {
+				waits = append(waits, d)
+				return nil
+			}
+
+			err := sender.Send(context.Background(), "", "+1234567890", "123456")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("Requests = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+			if len(waits) != len(tt.wantWaits) {
+				t.Fatalf("Waits = %v, want %v", waits, tt.wantWaits)
+			}
+			for i := range waits {
+				if waits[i] != tt.wantWaits[i] {
+					t.Errorf("Wait %d = %v, want %v", i, waits[i], tt.wantWaits[i])
+				}
+			}
+
+			if !tt.wantErr {
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Send() error = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.wantStatus || apiErr.Code != tt.wantCode {
+				t.Errorf("APIError = %+v, want status %d code %d", apiErr, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestTwilioSender_ConnectionErrors(t *testing.T) {
+	sender := newTestTwilioSender(t, func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(http.NotFoundHandler())
+	sender.config.BaseURL = server.URL
+	server.Close()
+
+	// Nothing reached Twilio, so the send is retried
+	var waits int
+	sender.sleep = func(ctx context.Context, d time.Duration) error {
+		waits++
+		return nil
+	}
+	if err := sender.Send(context.Background(), "", "+1234567890", "123456"); err == nil {
+		t.Fatal("Send() expected error, got nil")
+	}
+	if waits != 2 {
+		t.Errorf("Waits = %d, want 2", waits)
+	}
+
+	// A cancelled caller stops the send before it starts
+	var calls atomic.Int32
+	sender = newTestTwilioSender(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sender.Send(ctx, "", "+1234567890", "123456"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Send() error = %v, want context.Canceled", err)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("Requests = %d, want 0", calls.Load())
+	}
+}
+
+func TestNewTwilioSender_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.SMSConfig
+	}{
+		{"Missing credentials", config.SMSConfig{Twilio: config.TwilioConfig{MessageTemplate: "{{.Code}}"}}},
+		{"Bad template", config.SMSConfig{Twilio: config.TwilioConfig{AccountSID: "AC123", AuthToken: "secret", FromNumber: "+15550000000", MessageTemplate: "{{.Code"}}},
+		{"Retriever format without app hash", config.SMSConfig{RetrieverFormat: true, Twilio: config.TwilioConfig{AccountSID: "AC123", AuthToken: "secret", FromNumber: "+15550000000", MessageTemplate: "{{.Code}}"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTwilioSender(tt.cfg); err == nil {
+				t.Error("NewTwilioSender() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestTwilioSender_RetrieverFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.SMSConfig
+		wantBody string
+	}{
+		{
+			name:     "Enabled",
+			cfg:      config.SMSConfig{RetrieverFormat: true, AppHash: "FA+9qCX9VSu"},
+			wantBody: "<#> Your code is 123456\nFA+9qCX9VSu",
+		},
+		{
+			name:     "Disabled ignores the app hash",
+			cfg:      config.SMSConfig{AppHash: "FA+9qCX9VSu"},
+			wantBody: "Your code is 123456",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body, welcome string
+			sender := newTestTwilioSenderWithConfig(t, tt.cfg, func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				if body == "" {
+					body = r.PostForm.Get("Body")
+				} else {
+					welcome = r.PostForm.Get("Body")
+				}
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			if err := sender.Send(context.Background(), "", "+1234567890", "123456"); err != nil {
+				t.Fatalf("Send() unexpected error = %v", err)
+			}
+			if body != tt.wantBody {
+				t.Errorf("Body = %q, want %q", body, tt.wantBody)
+			}
+
+			// Only OTP messages carry the retriever format
+			if err := sender.SendMessage(context.Background(), "", "+1234567890", "Welcome!"); err != nil {
+				t.Fatalf("SendMessage() unexpected error = %v", err)
+			}
+			if welcome != "Welcome!" {
+				t.Errorf("SendMessage() body = %q, want %q", welcome, "Welcome!")
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counters keeps cumulative auth counts in memory for deployments without
+// Prometheus. They are safe for concurrent use and start from zero on restart.
+type Counters struct {
+	sends          atomic.Int64
+	sendFailures   atomic.Int64
+	verifies       atomic.Int64
+	verifyFailures atomic.Int64
+
+	mu          sync.Mutex
+	day         string
+	activeToday map[uint]struct{}
+
+	startedAt time.Time
+	// now is swapped in tests to move across midnight
+	now func() time.Time
+}
+
+// Snapshot is a point-in-time copy of the counters
+type Snapshot struct {
+	Sends            int64
+	SendFailures     int64
+	Verifies         int64
+	VerifyFailures   int64
+	ActiveUsersToday int
+	Since            time.Time
+}
+
+func NewCounters() *Counters {
+	return &Counters{
+		activeToday: make(map[uint]struct{}),
+		startedAt:   time.Now(),
+		now:         time.Now,
+	}
+}
+
+// RecordSend counts an OTP send request and whether it failed
+func (c *Counters) RecordSend(err error) {
+	c.sends.Add(1)
+	if err != nil {
+		c.sendFailures.Add(1)
+	}
+}
+
+// RecordVerify counts a verify request; a successful one marks the user active today
+func (c *Counters) RecordVerify(userID uint, err error) {
+	c.verifies.Add(1)
+	if err != nil {
+		c.verifyFailures.Add(1)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rollDay()
+	c.activeToday[userID] = struct{}{}
+}
+
+func (c *Counters) Snapshot() Snapshot {
+	c.mu.Lock()
+	c.rollDay()
+	active := len(c.activeToday)
+	c.mu.Unlock()
+
+	return Snapshot{
+		Sends:            c.sends.Load(),
+		SendFailures:     c.sendFailures.Load(),
+		Verifies:         c.verifies.Load(),
+		VerifyFailures:   c.verifyFailures.Load(),
+		ActiveUsersToday: active,
+		Since:            c.startedAt,
+	}
+}
+
+// rollDay clears the active users once the UTC day changes; c.mu must be held
+func (c *Counters) rollDay() {
+	today := c.now().UTC().Format(time.DateOnly)
+	if today != c.day {
+		c.day = today
+		clear(c.activeToday)
+	}
+}
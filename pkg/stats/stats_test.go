@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCounters_Concurrent(t *testing.T) {
+	counters := NewCounters()
+	errFailed := errors.New("failed")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counters.RecordSend(nil)
+			if i%4 == 0 {
+				counters.RecordSend(errFailed)
+				counters.RecordVerify(0, errFailed)
+			}
+			// Ten distinct users, each verifying many times
+			counters.RecordVerify(uint(i%10), nil)
+		}(i)
+	}
+	wg.Wait()
+
+	got := counters.Snapshot()
+	want := Snapshot{Sends: 125, SendFailures: 25, Verifies: 125, VerifyFailures: 25, ActiveUsersToday: 10, Since: got.Since}
+	if got != want {
+		t.Errorf("Snapshot() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCounters_ActiveUsersResetDaily(t *testing.T) {
+	counters := NewCounters()
+	now := time.Date(2024, 1, 15, 23, 59, 0, 0, time.UTC)
+	counters.now = func() time.Time { return now }
+
+	counters.RecordVerify(1, nil)
+	counters.RecordVerify(2, nil)
+	if active := counters.Snapshot().ActiveUsersToday; active != 2 {
+		t.Fatalf("ActiveUsersToday = %d, want 2", active)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if active := counters.Snapshot().ActiveUsersToday; active != 0 {
+		t.Errorf("ActiveUsersToday after midnight = %d, want 0", active)
+	}
+
+	// Cumulative counts survive the day change
+	counters.RecordVerify(1, nil)
+	got := counters.Snapshot()
+	if got.ActiveUsersToday != 1 || got.Verifies != 3 {
+		t.Errorf("Snapshot() = %+v, want 1 active user and 3 verifies", got)
+	}
+}
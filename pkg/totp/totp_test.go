@@ -0,0 +1,117 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B secret for SHA1, "12345678901234567890"
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode_RFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit values; the last six digits are the 6-digit code
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0), 30*time.Second))
+		if err != nil {
+			t.Fatalf("Code() unexpected error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code() at %d = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate_Skew(t *testing.T) {
+	period := 30 * time.Second
+	now := time.Unix(1111111111, 0)
+	current := Step(now, period)
+
+	tests := []struct {
+		name   string
+		offset int64
+		skew   int
+		wantOK bool
+	}{
+		{"Current step", 0, 1, true},
+		{"One step behind", -1, 1, true},
+		{"One step ahead", 1, 1, true},
+		{"Two steps behind", -2, 1, false},
+		{"Two steps ahead", 2, 1, false},
+		{"No skew tolerance", -1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := Code(rfcSecret, current+tt.offset)
+			step, ok := Validate(rfcSecret, code, now, period, tt.skew)
+			if ok != tt.wantOK {
+				t.Fatalf("Validate() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("Validate() step = %v, want %v", step, current+tt.offset)
+			}
+		})
+	}
+
+	if _, ok := Validate("not base32!", "123456", now, period, 1); ok {
+		t.Error("Validate() accepted a code for an invalid secret")
+	}
+	if _, ok := Validate(rfcSecret, "12345", now, period, 1); ok {
+		t.Error("Validate() accepted a short code")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret(bytes.NewReader(bytes.Repeat([]byte{0xff}, secretSize)))
+	if err != nil {
+		t.Fatalf("GenerateSecret() unexpected error = %v", err)
+	}
+	if len(secret) != 32 || strings.Contains(secret, "=") {
+		t.Errorf("GenerateSecret() = %q, want 32 unpadded base32 characters", secret)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("Code() with generated secret unexpected error = %v", err)
+	}
+
+	if _, err := GenerateSecret(bytes.NewReader(nil)); err == nil {
+		t.Error("GenerateSecret() expected error for an exhausted reader")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("OTP Service", "+1234567890", "JBSWY3DPEHPK3PXP", 30*time.Second)
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("ProvisioningURI() = %q is not a URL: %v", uri, err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("ProvisioningURI() = %q, want otpauth://totp/...", uri)
+	}
+	if parsed.Path != "/OTP Service:+1234567890" {
+		t.Errorf("Label = %q, want %q", parsed.Path, "/OTP Service:+1234567890")
+	}
+
+	query := parsed.Query()
+	for key, want := range map[string]string{"secret": "JBSWY3DPEHPK3PXP", "issuer": "OTP Service", "digits": "6", "period": "30"} {
+		if got := query.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -27,3 +27,14 @@ func RedisContext() (context.Context, context.CancelFunc) {
 func DBContext() (context.Context, context.CancelFunc) {
 	return MediumContext()
 }
+
+// WithRedisTimeout applies the Redis timeout to a caller's context, which can
+// still cancel the operation or end it sooner with its own deadline
+func WithRedisTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, 3*time.Second)
+}
+
+// WithDBTimeout is WithRedisTimeout for database operations
+func WithDBTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, 5*time.Second)
+}
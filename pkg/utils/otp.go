@@ -2,27 +2,117 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"regexp"
 	"strings"
 )
 
+// DigitAlphabet is the default OTP alphabet
+const DigitAlphabet = "0123456789"
+
 func GenerateOTP(length int) (string, error) {
-	const digits = "0123456789"
-	otp := make([]byte, length)
+	return GenerateOTPFrom(rand.Reader, length)
+}
+
+// GenerateOTPFrom draws the OTP digits from r, so tests can pass a deterministic reader
+func GenerateOTPFrom(r io.Reader, length int) (string, error) {
+	return GenerateOTPWithAlphabetFrom(r, length, DigitAlphabet)
+}
+
+// GenerateOTPWithAlphabet draws each character uniformly from alphabet, e.g. letters
+// and digits for shorter codes with the same entropy
+func GenerateOTPWithAlphabet(length int, alphabet string) (string, error) {
+	return GenerateOTPWithAlphabetFrom(rand.Reader, length, alphabet)
+}
+
+func GenerateOTPWithAlphabetFrom(r io.Reader, length int, alphabet string) (string, error) {
+	if err := ValidateOTPAlphabet(alphabet); err != nil {
+		return "", err
+	}
 
+	otp := make([]byte, length)
 	for i := range otp {
-		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(digits))))
+		num, err := rand.Int(r, big.NewInt(int64(len(alphabet))))
 		if err != nil {
 			return "", fmt.Errorf("failed to generate random number: %w", err)
 		}
-		otp[i] = digits[num.Int64()]
+		otp[i] = alphabet[num.Int64()]
 	}
 
 	return string(otp), nil
 }
 
+// ValidateOTPAlphabet rejects alphabets that would yield low-entropy or ambiguous
+// codes: fewer than two distinct characters, repeats, lowercase letters (codes are
+// case-insensitive and compared in upper case) or anything outside printable ASCII
+func ValidateOTPAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return errors.New("OTP alphabet needs at least two characters")
+	}
+
+	seen := make(map[byte]bool, len(alphabet))
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		switch {
+		case c <= ' ' || c > '~':
+			return fmt.Errorf("OTP alphabet contains unsupported character %q", c)
+		case c >= 'a' && c <= 'z':
+			return fmt.Errorf("OTP alphabet must be upper case, got %q", c)
+		case seen[c]:
+			return fmt.Errorf("OTP alphabet repeats %q", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// LuhnCheckDigit returns the Luhn check digit for a string of decimal digits
+func LuhnCheckDigit(digits string) byte {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// ValidLuhn reports whether the last digit of code is the Luhn check digit of the rest
+func ValidLuhn(code string) bool {
+	if len(code) < 2 {
+		return false
+	}
+	return LuhnCheckDigit(code[:len(code)-1]) == code[len(code)-1]
+}
+
+// GenerateFormToken returns a random hex token for web forms to echo back on verify
+func GenerateFormToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate form token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// GenerateCorrelationID returns a random hex ID linking one send to its verify
+func GenerateCorrelationID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate correlation ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
 func ValidatePhoneNumber(phoneNumber string) bool {
 	// Enhanced phone number validation with stricter rules
 	phoneRegex := regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
@@ -43,3 +133,20 @@ func ValidatePhoneNumber(phoneNumber string) bool {
 func NormalizePhoneNumber(phoneNumber string) string {
 	return strings.TrimSpace(phoneNumber)
 }
+
+// MaskPhoneNumber hides all but the leading country digit and the last four digits
+func MaskPhoneNumber(phoneNumber string) string {
+	if len(phoneNumber) <= 6 {
+		return strings.Repeat("*", len(phoneNumber))
+	}
+	return phoneNumber[:2] + strings.Repeat("*", len(phoneNumber)-6) + phoneNumber[len(phoneNumber)-4:]
+}
+
+// MaskEmail hides the local part of an address but its first character
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return strings.Repeat("*", len(email))
+	}
+	return email[:1] + strings.Repeat("*", at-1) + email[at:]
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +43,62 @@ func TestGenerateOTP(t *testing.T) {
 	}
 }
 
+func TestGenerateOTPFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		entropy []byte
+		length  int
+		want    string
+		wantErr bool
+	}{
+		{"One byte per digit", []byte{1, 2, 3, 4, 5, 6}, 6, "123456", false},
+		{"High bits are masked", []byte{0x10, 0x29}, 2, "09", false},
+		{"Out of range nibbles are rejected", []byte{0x0a, 0x0f, 0x07}, 1, "7", false},
+		{"Exhausted reader", []byte{1, 2}, 4, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			otp, err := GenerateOTPFrom(bytes.NewReader(tt.entropy), tt.length)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateOTPFrom() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if otp != tt.want {
+				t.Errorf("GenerateOTPFrom() = %q, want %q", otp, tt.want)
+			}
+		})
+	}
+}
+
+func TestLuhnCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"7992739871", '3'},
+		{"123456", '6'},
+		{"000000", '0'},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.digits, func(t *testing.T) {
+			if got := LuhnCheckDigit(tt.digits); got != tt.want {
+				t.Errorf("LuhnCheckDigit() = %c, want %c", got, tt.want)
+			}
+			if !ValidLuhn(tt.digits + string(tt.want)) {
+				t.Errorf("ValidLuhn(%s%c) = false, want true", tt.digits, tt.want)
+			}
+		})
+	}
+
+	// Single-digit typos and adjacent swaps are caught
+	for _, code := range []string{"1234576", "1234556", "2134566"} {
+		if ValidLuhn(code) {
+			t.Errorf("ValidLuhn(%s) = true, want false", code)
+		}
+	}
+}
+
 func TestValidatePhoneNumber(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -89,3 +147,67 @@ func TestNormalizePhoneNumber(t *testing.T) {
 		})
 	}
 }
+
+func TestMaskPhoneNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"+1234567890", "+1*****7890"},
+		{"+989123456789", "+9*******6789"},
+		{"+12345", "******"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := MaskPhoneNumber(tt.input); got != tt.expected {
+				t.Errorf("MaskPhoneNumber() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateOTPWithAlphabet(t *testing.T) {
+	const alphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+	otp, err := GenerateOTPWithAlphabet(8, alphabet)
+	if err != nil {
+		t.Fatalf("GenerateOTPWithAlphabet() unexpected error = %v", err)
+	}
+	if len(otp) != 8 {
+		t.Errorf("GenerateOTPWithAlphabet() length = %v, want 8", len(otp))
+	}
+	for _, char := range otp {
+		if !strings.ContainsRune(alphabet, char) {
+			t.Errorf("GenerateOTPWithAlphabet() contains %c outside the alphabet", char)
+		}
+	}
+}
+
+func TestValidateOTPAlphabet(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		wantErr  bool
+	}{
+		{"Digits", DigitAlphabet, false},
+		{"Upper alphanumeric", "ABCDEFGHJKMNPQRSTUVWXYZ23456789", false},
+		{"Empty", "", true},
+		{"Single character", "7", true},
+		{"Repeated character", "AAB", true},
+		{"Lowercase letters", "abc123", true},
+		{"Whitespace", "AB C", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOTPAlphabet(tt.alphabet)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOTPAlphabet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := GenerateOTPWithAlphabet(6, tt.alphabet); (err != nil) != tt.wantErr {
+				t.Errorf("GenerateOTPWithAlphabet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// PhoneProtector keeps raw phone numbers out of storage: an HMAC serves as the
+// lookup key and, when an encryption key is set, AES-GCM holds the reversible value
+type PhoneProtector struct {
+	hmacKey []byte
+	aead    cipher.AEAD
+}
+
+// NewPhoneProtector builds a protector from the HMAC key and an optional
+// hex-encoded 32-byte AES key; without the AES key phone numbers are write-only
+func NewPhoneProtector(hmacKey, encryptionKey string) (*PhoneProtector, error) {
+	if hmacKey == "" {
+		return nil, errors.New("phone HMAC key is required")
+	}
+
+	p := &PhoneProtector{hmacKey: []byte(hmacKey)}
+	if encryptionKey == "" {
+		return p, nil
+	}
+
+	key, err := hex.DecodeString(encryptionKey)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("phone encryption key must be 64 hex characters")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create phone cipher: %w", err)
+	}
+	if p.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, fmt.Errorf("failed to create phone cipher: %w", err)
+	}
+	return p, nil
+}
+
+// Hash returns the deterministic lookup key for a phone number
+func (p *PhoneProtector) Hash(phoneNumber string) string {
+	mac := hmac.New(sha256.New, p.hmacKey)
+	mac.Write([]byte(phoneNumber))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Reversible reports whether encrypted phone numbers can be read back
+func (p *PhoneProtector) Reversible() bool {
+	return p.aead != nil
+}
+
+// Encrypt seals the phone number; it returns "" in write-only mode
+func (p *PhoneProtector) Encrypt(phoneNumber string) (string, error) {
+	if p.aead == nil {
+		return "", nil
+	}
+
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := p.aead.Seal(nonce, nonce, []byte(phoneNumber), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt
+func (p *PhoneProtector) Decrypt(encrypted string) (string, error) {
+	if p.aead == nil || encrypted == "" {
+		return "", nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < p.aead.NonceSize() {
+		return "", errors.New("malformed encrypted phone number")
+	}
+	nonce, ciphertext := sealed[:p.aead.NonceSize()], sealed[p.aead.NonceSize():]
+	phoneNumber, err := p.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt phone number: %w", err)
+	}
+	return string(phoneNumber), nil
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily local-time window during which SMS must not be sent
+type QuietHours struct {
+	start       time.Duration
+	end         time.Duration
+	zones       []quietHoursZone
+	defaultZone *time.Location
+}
+
+type quietHoursZone struct {
+	prefix   string
+	location *time.Location
+}
+
+// ParseQuietHours builds a QuietHours from a "HH:MM-HH:MM" window and a list
+// of "+<prefix>=<IANA zone>" entries. An empty window disables quiet hours.
+func ParseQuietHours(window string, zones []string, defaultZone string) (*QuietHours, error) {
+	if window == "" {
+		return nil, nil
+	}
+
+	startStr, endStr, ok := strings.Cut(window, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid quiet hours window %q", window)
+	}
+	start, err := parseClock(startStr)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(endStr)
+	if err != nil {
+		return nil, err
+	}
+
+	quietHours := &QuietHours{start: start, end: end}
+
+	for _, zone := range zones {
+		prefix, name, ok := strings.Cut(zone, "=")
+		if !ok || !strings.HasPrefix(prefix, "+") {
+			return nil, fmt.Errorf("invalid quiet hours timezone %q", zone)
+		}
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours timezone %q: %w", zone, err)
+		}
+		quietHours.zones = append(quietHours.zones, quietHoursZone{prefix: prefix, location: location})
+	}
+
+	// Longest prefix wins, e.g. +1808 (Hawaii) over +1
+	sort.Slice(quietHours.zones, func(i, j int) bool {
+		return len(quietHours.zones[i].prefix) > len(quietHours.zones[j].prefix)
+	})
+
+	if defaultZone != "" {
+		location, err := time.LoadLocation(defaultZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours default timezone %q: %w", defaultZone, err)
+		}
+		quietHours.defaultZone = location
+	}
+
+	return quietHours, nil
+}
+
+// Active reports whether now falls inside quiet hours for the number's region.
+// Numbers without a known region are never held back.
+func (q *QuietHours) Active(phoneNumber string, now time.Time) bool {
+	if q == nil || q.start == q.end {
+		return false
+	}
+
+	location := q.defaultZone
+	for _, zone := range q.zones {
+		if strings.HasPrefix(phoneNumber, zone.prefix) {
+			location = zone.location
+			break
+		}
+	}
+	if location == nil {
+		return false
+	}
+
+	local := now.In(location)
+	timeOfDay := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+
+	// Windows such as 22:00-07:00 wrap past midnight
+	if q.start < q.end {
+		return timeOfDay >= q.start && timeOfDay < q.end
+	}
+	return timeOfDay >= q.start || timeOfDay < q.end
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid quiet hours time %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHours_Active(t *testing.T) {
+	quietHours, err := ParseQuietHours("22:00-07:00", []string{"+98=Asia/Tehran", "+1808=Pacific/Honolulu"}, "UTC")
+	if err != nil {
+		t.Fatalf("ParseQuietHours() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		phoneNumber string
+		now         time.Time
+		want        bool
+	}{
+		{"Default zone inside window", "+4412345678", time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), true},
+		{"Default zone after midnight", "+4412345678", time.Date(2024, 1, 1, 6, 59, 0, 0, time.UTC), true},
+		{"Default zone outside window", "+4412345678", time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC), false},
+		// 20:00 UTC is 23:30 in Tehran
+		{"Regional zone inside window", "+989123456789", time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC), true},
+		// 23:00 UTC is 13:00 in Honolulu, despite +1 having no zone of its own
+		{"Longest prefix wins", "+18085551234", time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quietHours.Active(tt.phoneNumber, tt.now); got != tt.want {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  string
+		zones   []string
+		wantErr bool
+	}{
+		{"Empty window disables", "", nil, false},
+		{"Valid window", "22:00-07:00", []string{"+98=Asia/Tehran"}, false},
+		{"Missing separator", "22:00", nil, true},
+		{"Invalid time", "25:00-07:00", nil, true},
+		{"Unknown timezone", "22:00-07:00", []string{"+98=Mars/Olympus"}, true},
+		{"Prefix without plus", "22:00-07:00", []string{"98=Asia/Tehran"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseQuietHours(tt.window, tt.zones, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseQuietHours() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,15 +2,65 @@ package utils
 
 import "fmt"
 
+// EmailIdentifier stands in for a phone number in the keys below when a code
+// goes by email, so otp:email:<addr> never collides with a phone's keys
+func EmailIdentifier(email string) string {
+	return "email:" + email
+}
+
 // Redis key helpers for consistent key formatting
 func OTPKey(phoneNumber string) string {
 	return fmt.Sprintf("otp:%s", phoneNumber)
 }
 
+func OTPAttemptsKey(phoneNumber string) string {
+	return fmt.Sprintf("otp_attempts:%s", phoneNumber)
+}
+
+// OTPSentKey marks a live OTP; it outlives an OTP key that Redis evicted early
+func OTPSentKey(phoneNumber string) string {
+	return fmt.Sprintf("otp_sent:%s", phoneNumber)
+}
+
+func VerifyNotBeforeKey(phoneNumber string) string {
+	return fmt.Sprintf("verify_not_before:%s", phoneNumber)
+}
+
+func SendLockKey(phoneNumber string) string {
+	return fmt.Sprintf("send_lock:%s", phoneNumber)
+}
+
+func VerifyFailuresKey(phoneNumber string) string {
+	return fmt.Sprintf("verify_failures:%s", phoneNumber)
+}
+
 func RateLimitKey(phoneNumber string) string {
 	return fmt.Sprintf("rate_limit:%s", phoneNumber)
 }
 
+// IPRateLimitKey holds the global limiter's hit counts for a client IP
+func IPRateLimitKey(ip string) string {
+	return fmt.Sprintf("ip_rate_limit:%s", ip)
+}
+
+func RateLimitPenaltyKey(phoneNumber string) string {
+	return fmt.Sprintf("rate_limit_penalty:%s", phoneNumber)
+}
+
+// RevokedTokenKey marks a logged-out token by its jti until the token would have expired
+func RevokedTokenKey(tokenID string) string {
+	return fmt.Sprintf("revoked_token:%s", tokenID)
+}
+
+// TokenMinIssuedAtKey holds the Unix time before which every token is rejected
+func TokenMinIssuedAtKey() string {
+	return "token_min_issued_at"
+}
+
+func MaintenanceKey() string {
+	return "maintenance_mode"
+}
+
 // Generic key builder for future extensions
 func BuildKey(prefix, identifier string) string {
 	return fmt.Sprintf("%s:%s", prefix, identifier)
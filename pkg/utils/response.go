@@ -1,10 +1,22 @@
 package utils
 
 import (
+	"math"
+	"strconv"
+	"time"
+
 	"github.com/ehsanshojaei/go-otp-auth/internal/model"
+	"github.com/ehsanshojaei/go-otp-auth/pkg/i18n"
 	"github.com/gofiber/fiber/v2"
 )
 
+// Message looks key up in the locale middleware.Locale resolved for the
+// request, or in English when it did not run
+func Message(c *fiber.Ctx, key string) string {
+	locale, _ := c.Locals("locale").(string)
+	return i18n.T(locale, key)
+}
+
 // Response helpers for cleaner handler code
 func SuccessResponse(c *fiber.Ctx, message string, data ...interface{}) error {
 	response := model.SuccessResponse{Message: message}
@@ -37,6 +49,47 @@ func TooManyRequests(c *fiber.Ctx, message string) error {
 	return ErrorResponse(c, fiber.StatusTooManyRequests, "rate_limit_exceeded", message)
 }
 
+// LimitExceeded is an error response that also names the limit that tripped
+func LimitExceeded(c *fiber.Ctx, code int, errorType, limitType, message string) error {
+	return c.Status(code).JSON(model.ErrorResponse{
+		Error:     errorType,
+		Message:   message,
+		LimitType: limitType,
+	})
+}
+
+// RetryLater is a 429 that tells the client, in the body and the Retry-After
+// header, how many whole seconds to wait
+func RetryLater(c *fiber.Ctx, errorType, limitType, message string, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(model.ErrorResponse{
+		Error:      errorType,
+		Message:    message,
+		LimitType:  limitType,
+		RetryAfter: seconds,
+	})
+}
+
+// Locked is a 423 for a lockout. When the remaining time is known it is sent as
+// Retry-After and retry_after, and as the locked_until timestamp.
+func Locked(c *fiber.Ctx, errorType, limitType, message string, wait time.Duration) error {
+	if wait <= 0 {
+		return LimitExceeded(c, fiber.StatusLocked, errorType, limitType, message)
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	lockedUntil := time.Now().Add(time.Duration(seconds) * time.Second).UTC().Truncate(time.Second)
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusLocked).JSON(model.ErrorResponse{
+		Error:       errorType,
+		Message:     message,
+		LimitType:   limitType,
+		RetryAfter:  seconds,
+		LockedUntil: &lockedUntil,
+	})
+}
+
 func InternalError(c *fiber.Ctx, message string) error {
 	return ErrorResponse(c, fiber.StatusInternalServerError, "internal_error", message)
 }
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SenderIDs picks the SMS sender ID registered for a number's region
+type SenderIDs struct {
+	entries  []senderIDEntry
+	fallback string
+}
+
+type senderIDEntry struct {
+	prefix   string
+	senderID string
+}
+
+// ParseSenderIDs builds SenderIDs from "+<prefix>=<sender ID>" entries; numbers
+// matching no prefix get fallback
+func ParseSenderIDs(entries []string, fallback string) (*SenderIDs, error) {
+	senderIDs := &SenderIDs{fallback: fallback}
+
+	for _, entry := range entries {
+		prefix, senderID, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(prefix, "+") || senderID == "" {
+			return nil, fmt.Errorf("invalid sender ID entry %q", entry)
+		}
+		senderIDs.entries = append(senderIDs.entries, senderIDEntry{prefix: prefix, senderID: senderID})
+	}
+
+	// Longest prefix wins, e.g. +1808 over +1
+	sort.Slice(senderIDs.entries, func(i, j int) bool {
+		return len(senderIDs.entries[i].prefix) > len(senderIDs.entries[j].prefix)
+	})
+
+	return senderIDs, nil
+}
+
+// For returns the sender ID for the number, or the fallback
+func (s *SenderIDs) For(phoneNumber string) string {
+	if s == nil {
+		return ""
+	}
+
+	for _, entry := range s.entries {
+		if strings.HasPrefix(phoneNumber, entry.prefix) {
+			return entry.senderID
+		}
+	}
+	return s.fallback
+}
@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestSenderIDs_For(t *testing.T) {
+	senderIDs, err := ParseSenderIDs([]string{"+1=12345", "+1808=HIALERT", "+98=MyApp"}, "OTPSVC")
+	if err != nil {
+		t.Fatalf("ParseSenderIDs() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		phoneNumber string
+		want        string
+	}{
+		{"US number", "+12025550123", "12345"},
+		{"Longer prefix wins", "+18085550123", "HIALERT"},
+		{"Iran number", "+989121234567", "MyApp"},
+		{"Unmapped region falls back", "+4915112345678", "OTPSVC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := senderIDs.For(tt.phoneNumber); got != tt.want {
+				t.Errorf("For() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSenderIDs_Invalid(t *testing.T) {
+	for _, entry := range []string{"1=12345", "+1", "+1="} {
+		if _, err := ParseSenderIDs([]string{entry}, ""); err == nil {
+			t.Errorf("ParseSenderIDs(%q) error = nil, want error", entry)
+		}
+	}
+}
@@ -1,8 +1,21 @@
 package utils
 
-import "log"
+import (
+	"log"
+	"strings"
+)
 
-// LogOTP - centralized OTP logging for console output (per requirements)
-func LogOTP(phoneNumber, otpCode string) {
-	log.Printf("OTP for %s: %s", phoneNumber, otpCode)
+// LogOTP - centralized OTP logging for console output. The phone number or
+// email is always masked, and the code itself is only written when showCode
+// is set (OTP_DEBUG_LOG), which must stay off in production.
+func LogOTP(target, otpCode string, showCode bool) {
+	masked := MaskPhoneNumber(target)
+	if strings.Contains(target, "@") {
+		masked = MaskEmail(target)
+	}
+	if !showCode {
+		log.Printf("OTP sent to %s", masked)
+		return
+	}
+	log.Printf("OTP for %s: %s", masked, otpCode)
 }
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		showCode bool
+		want     string
+	}{
+		{name: "phone", target: "+14155552671", want: "OTP sent to +1******2671"},
+		{name: "email", target: "user@example.com", want: "OTP sent to u***@example.com"},
+		{name: "debug", target: "+14155552671", showCode: true, want: "OTP for +1******2671: 123456"},
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			LogOTP(tt.target, "123456", tt.showCode)
+
+			got := buf.String()
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("LogOTP() logged %q, want %q", got, tt.want)
+			}
+			if strings.Contains(got, tt.target) {
+				t.Errorf("LogOTP() logged the unmasked %q", tt.target)
+			}
+			if !tt.showCode && strings.Contains(got, "123456") {
+				t.Errorf("LogOTP() logged the code with showCode off: %q", got)
+			}
+		})
+	}
+}
@@ -1,40 +1,188 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/mail"
+	"regexp"
 	"strings"
 
 	apperrors "github.com/ehsanshojaei/go-otp-auth/pkg/errors"
+	"github.com/nyaruka/phonenumbers"
 )
 
-// ValidateAndNormalizePhone - centralized phone validation and normalization
+var digitRunRegex = regexp.MustCompile(`[0-9]+`)
+
+// phoneInputRegex admits the punctuation people type around a number; letters
+// (vanity numbers) and extensions are refused before parsing
+var phoneInputRegex = regexp.MustCompile(`^\+?[0-9 ()\-.]+$`)
+
+// maxPhoneInputLength bounds the formatted input handed to the parser
+const maxPhoneInputLength = 32
+
+// defaultPhoneRegion is the region national-format numbers are read in; set once at startup
+var defaultPhoneRegion string
+
+// SetDefaultPhoneRegion sets the ISO 3166 region (e.g. "US") used to parse numbers
+// entered without a leading +. Empty requires international format.
+func SetDefaultPhoneRegion(region string) {
+	defaultPhoneRegion = strings.ToUpper(strings.TrimSpace(region))
+}
+
+// ValidateAndNormalizePhone - centralized phone validation and normalization. The
+// number is checked against its region's numbering plan and returned in E.164, so
+// "+1 (415) 555-2671" and, with region US, "(415) 555-2671" become "+14155552671".
 func ValidateAndNormalizePhone(phoneNumber string) (string, error) {
 	phoneNumber = NormalizePhoneNumber(phoneNumber)
-	phoneNumber = strings.TrimSpace(phoneNumber)
 
-	if len(phoneNumber) > 20 || len(phoneNumber) < 8 {
+	if len(phoneNumber) > maxPhoneInputLength || !phoneInputRegex.MatchString(phoneNumber) {
 		return "", apperrors.ErrInvalidPhoneNumber
 	}
 
-	if !ValidatePhoneNumber(phoneNumber) {
+	region := defaultPhoneRegion
+	if strings.HasPrefix(phoneNumber, "+") {
+		region = ""
+	} else if region == "" {
 		return "", apperrors.ErrInvalidPhoneNumber
 	}
 
-	return phoneNumber, nil
+	parsed, err := phonenumbers.Parse(phoneNumber, region)
+	if err != nil || !phonenumbers.IsValidNumber(parsed) {
+		return "", apperrors.ErrInvalidPhoneNumber
+	}
+
+	return phonenumbers.Format(parsed, phonenumbers.E164), nil
 }
 
-// ValidateOTPCode - centralized OTP code validation
-func ValidateOTPCode(otpCode string, expectedLength int) (string, error) {
-	otpCode = strings.TrimSpace(otpCode)
+// maxEmailLength is the longest address SMTP can carry (RFC 5321)
+const maxEmailLength = 254
+
+// ValidateAndNormalizeEmail - the email channel's counterpart to ValidateAndNormalizePhone.
+// Only a bare address is accepted, lowercased so one mailbox maps to one user.
+func ValidateAndNormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || len(email) > maxEmailLength {
+		return "", apperrors.ErrInvalidEmail
+	}
+
+	// Display names ("Jo <jo@example.com>") and comments are refused
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", apperrors.ErrInvalidEmail
+	}
+
+	// A mailbox on a bare host such as "root@localhost" is not a sign-up address
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", apperrors.ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+// NormalizeLegacyPhone converts a number stored before E.164 was enforced, such as
+// "(555) 123-4567" or "15551234567", reading it in defaultRegion unless it only
+// makes sense with its leading digits as a country code
+func NormalizeLegacyPhone(phoneNumber, defaultRegion string) (string, error) {
+	phoneNumber = strings.TrimSpace(phoneNumber)
+	if strings.HasPrefix(phoneNumber, "00") {
+		phoneNumber = "+" + phoneNumber[2:]
+	}
+
+	parsed, err := phonenumbers.Parse(phoneNumber, strings.ToUpper(defaultRegion))
+	if err != nil || !phonenumbers.IsValidNumber(parsed) {
+		if strings.HasPrefix(phoneNumber, "+") {
+			return "", apperrors.ErrInvalidPhoneNumber
+		}
+		parsed, err = phonenumbers.Parse("+"+phoneNumber, "")
+		if err != nil || !phonenumbers.IsValidNumber(parsed) {
+			return "", apperrors.ErrInvalidPhoneNumber
+		}
+	}
+
+	return ValidateAndNormalizePhone(phonenumbers.Format(parsed, phonenumbers.E164))
+}
+
+// ExtractOTPCode - pulls the code out of pasted input like "Code: 123456." when exactly
+// one run of expectedLength digits is present; ambiguous input is left untouched
+func ExtractOTPCode(input string, expectedLength int) (string, bool) {
+	var matches []string
+	for _, run := range digitRunRegex.FindAllString(input, -1) {
+		if len(run) == expectedLength {
+			matches = append(matches, run)
+		}
+	}
+
+	if len(matches) != 1 {
+		return "", false
+	}
+	return matches[0], true
+}
+
+// ValidateOTPCode - centralized OTP code validation; codes are case-insensitive,
+// so the input is upper-cased before it is checked against the alphabet
+func ValidateOTPCode(otpCode string, expectedLength int, alphabet string) (string, error) {
+	otpCode = strings.ToUpper(strings.TrimSpace(otpCode))
 
 	if len(otpCode) != expectedLength {
 		return "", apperrors.ErrInvalidOTP
 	}
 
 	for _, char := range otpCode {
-		if char < '0' || char > '9' {
+		if !strings.ContainsRune(alphabet, char) {
 			return "", apperrors.ErrInvalidOTP
 		}
 	}
 
 	return otpCode, nil
 }
+
+// HashDeviceID - device fingerprints are stored hashed alongside the OTP
+func HashDeviceID(deviceID string) string {
+	return hashValue(deviceID)
+}
+
+// HashFormToken - form tokens are stored hashed alongside the OTP
+func HashFormToken(token string) string {
+	return hashValue(token)
+}
+
+// HashOTPCode - keyed hash of a code, bound to its phone number so it can't be replayed for another
+func HashOTPCode(key, phoneNumber, code string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(phoneNumber + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// JWT_PHONE_CLAIM modes for what the phone_number claim carries
+const (
+	PhoneClaimFull   = "full"
+	PhoneClaimMasked = "masked"
+	PhoneClaimHashed = "hashed"
+)
+
+// PhoneClaim is the phone_number value for a JWT: the number itself, a masked
+// form for display, or a keyed hash that only this server can match
+func PhoneClaim(mode, key, phoneNumber string) string {
+	switch mode {
+	case PhoneClaimMasked:
+		return MaskPhoneNumber(phoneNumber)
+	case PhoneClaimHashed:
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte("phone_claim:" + phoneNumber))
+		return hex.EncodeToString(mac.Sum(nil))
+	default:
+		return phoneNumber
+	}
+}
+
+func hashValue(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
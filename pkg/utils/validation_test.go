@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractOTPCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   string
+		wantOK bool
+	}{
+		{"Plain code", "123456", "123456", true},
+		{"Trailing punctuation", "123456.", "123456", true},
+		{"Labelled code", "Code: 123456", "123456", true},
+		{"Other short digit runs", "Step 2: 123456", "123456", true},
+		{"Two candidate codes", "123456 or 654321", "", false},
+		{"Embedded in longer run", "1234567890", "", false},
+		{"Too short", "Code: 12345", "", false},
+		{"No digits", "no code here", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ExtractOTPCode(tt.input, 6)
+			if ok != tt.wantOK {
+				t.Errorf("ExtractOTPCode() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractOTPCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateOTPCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		alphabet string
+		want     string
+		wantErr  bool
+	}{
+		{"Digits", " 123456 ", DigitAlphabet, "123456", false},
+		{"Letter with digit alphabet", "12345A", DigitAlphabet, "", true},
+		{"Wrong length", "12345", DigitAlphabet, "", true},
+		{"Alphanumeric", "AB12CD", "ABCD12", "AB12CD", false},
+		{"Alphanumeric lowercase input", "ab12cd", "ABCD12", "AB12CD", false},
+		{"Outside alphabet", "AB12CE", "ABCD12", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateOTPCode(tt.code, 6, tt.alphabet)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOTPCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ValidateOTPCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhoneClaim(t *testing.T) {
+	phone := "+1234567890"
+
+	if got := PhoneClaim(PhoneClaimFull, "key", phone); got != phone {
+		t.Errorf("PhoneClaim(full) = %q, want %q", got, phone)
+	}
+	if got := PhoneClaim("", "key", phone); got != phone {
+		t.Errorf("PhoneClaim(\"\") = %q, want %q", got, phone)
+	}
+	if got := PhoneClaim(PhoneClaimMasked, "key", phone); got != "+1*****7890" {
+		t.Errorf("PhoneClaim(masked) = %q, want %q", got, "+1*****7890")
+	}
+
+	hashed := PhoneClaim(PhoneClaimHashed, "key", phone)
+	if len(hashed) != 64 || strings.Contains(hashed, "7890") {
+		t.Errorf("PhoneClaim(hashed) = %q, want a 64-character hex digest", hashed)
+	}
+	if PhoneClaim(PhoneClaimHashed, "key", phone) != hashed {
+		t.Error("PhoneClaim(hashed) is not stable for the same key")
+	}
+	if PhoneClaim(PhoneClaimHashed, "other-key", phone) == hashed {
+		t.Error("PhoneClaim(hashed) does not depend on the key")
+	}
+}
+
+func TestValidateAndNormalizePhone(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		region  string
+		want    string
+		wantErr bool
+	}{
+		{"E.164", "+14155552671", "", "+14155552671", false},
+		{"International with punctuation", " +1 (415) 555-2671 ", "", "+14155552671", false},
+		{"National format with region", "(415) 555-2671", "US", "+14155552671", false},
+		{"National with dots and region", "415.555.2671", "us", "+14155552671", false},
+		{"National UK with region", "020 7946 0958", "GB", "+442079460958", false},
+		{"Country code overrides region", "+44 20 7946 0958", "US", "+442079460958", false},
+		{"National format without region", "(415) 555-2671", "", "", true},
+		{"Unassigned area code", "+1234567890", "", "", true},
+		{"Too short for the region", "+1415555267", "", "", true},
+		{"Invalid country code", "+0234567890", "", "", true},
+		{"Letters", "+1 800 FLOWERS", "", "", true},
+		{"Extension", "+1 415 555 2671 ext 12", "", "", true},
+		{"Too long", "+1 " + strings.Repeat("4", 40), "", "", true},
+		{"Empty", "", "US", "", true},
+	}
+
+	defer SetDefaultPhoneRegion("")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDefaultPhoneRegion(tt.region)
+			got, err := ValidateAndNormalizePhone(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateAndNormalizePhone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ValidateAndNormalizePhone() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Send and verify key on the normalized number, so every way of writing one
+// number must come out the same, and normalizing that result must change nothing
+func TestValidateAndNormalizePhone_Canonical(t *testing.T) {
+	numbers := []struct {
+		want         string
+		countryCode  string
+		groups       []string
+		region       string
+		nationalLead string
+	}{
+		{"+14155552671", "1", []string{"415", "555", "2671"}, "US", ""},
+		{"+442079460958", "44", []string{"20", "7946", "0958"}, "GB", "0"},
+		{"+4915123456789", "49", []string{"151", "2345", "6789"}, "DE", "0"},
+	}
+	separators := []string{"", " ", "-", ".", " - "}
+
+	defer SetDefaultPhoneRegion("")
+	for _, n := range numbers {
+		t.Run(n.want, func(t *testing.T) {
+			var forms []string
+			for _, sep := range separators {
+				national := strings.Join(n.groups, sep)
+				forms = append(forms,
+					"+"+n.countryCode+sep+national,
+					"+"+n.countryCode+" ("+n.groups[0]+") "+strings.Join(n.groups[1:], sep),
+					"\t +"+n.countryCode+sep+national+" \n",
+				)
+			}
+
+			SetDefaultPhoneRegion("")
+			for _, form := range forms {
+				assertCanonical(t, form, n.want)
+			}
+
+			// National forms only resolve with the number's own region as default
+			SetDefaultPhoneRegion(n.region)
+			for _, sep := range separators {
+				assertCanonical(t, n.nationalLead+strings.Join(n.groups, sep), n.want)
+			}
+			for _, form := range forms {
+				assertCanonical(t, form, n.want)
+			}
+		})
+	}
+}
+
+func assertCanonical(t *testing.T, input, want string) {
+	t.Helper()
+	for i := 0; i < 3; i++ {
+		got, err := ValidateAndNormalizePhone(input)
+		if err != nil || got != want {
+			t.Fatalf("ValidateAndNormalizePhone(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	again, err := ValidateAndNormalizePhone(want)
+	if err != nil || again != want {
+		t.Fatalf("ValidateAndNormalizePhone(%q) = %q, %v, want it unchanged", want, again, err)
+	}
+}
+
+func TestNormalizeLegacyPhone(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		region  string
+		want    string
+		wantErr bool
+	}{
+		{"Already E.164", "+14155552671", "US", "+14155552671", false},
+		{"National format", "(415) 555-2671", "US", "+14155552671", false},
+		{"Country code without plus", "14155552671", "US", "+14155552671", false},
+		{"International prefix", "0044 20 7946 0958", "US", "+442079460958", false},
+		{"Foreign number without plus", "442079460958", "US", "+442079460958", false},
+		{"National with trunk prefix", "020 7946 0958", "gb", "+442079460958", false},
+		{"No region for a national number", "4155552671", "", "", true},
+		{"Garbage", "not a number", "US", "", true},
+		{"Invalid with plus", "+999", "US", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeLegacyPhone(tt.input, tt.region)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeLegacyPhone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeLegacyPhone() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAndNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		want    string
+		wantErr bool
+	}{
+		{"Plain address", "user@example.com", "user@example.com", false},
+		{"Lowercased and trimmed", "  User.Name+tag@Example.COM ", "user.name+tag@example.com", false},
+		{"Empty", "", "", true},
+		{"Missing at", "user.example.com", "", true},
+		{"Display name", "User <user@example.com>", "", true},
+		{"Bare host", "root@localhost", "", true},
+		{"Trailing dot", "user@example.", "", true},
+		{"Two addresses", "a@example.com, b@example.com", "", true},
+		{"Too long", strings.Repeat("a", 250) + "@example.com", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateAndNormalizeEmail(tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateAndNormalizeEmail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ValidateAndNormalizeEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package version
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Backend is an external dependency whose server version should be at least Minimum
+type Backend struct {
+	Name    string
+	Minimum string
+	Fetch   func(ctx context.Context) (string, error)
+}
+
+// CheckBackends warns about every backend older than its minimum; in strict mode
+// such a backend, or one whose version can't be read, is an error instead.
+// Backends without a minimum are skipped.
+func CheckBackends(ctx context.Context, strict bool, backends ...Backend) error {
+	for _, backend := range backends {
+		if backend.Minimum == "" {
+			continue
+		}
+
+		actual, err := backend.Fetch(ctx)
+		if err == nil {
+			var ok bool
+			if ok, err = AtLeast(actual, backend.Minimum); err == nil && !ok {
+				err = fmt.Errorf("%s %s is older than the minimum supported %s", backend.Name, actual, backend.Minimum)
+			}
+		} else {
+			err = fmt.Errorf("failed to read %s version: %w", backend.Name, err)
+		}
+		if err == nil {
+			continue
+		}
+
+		if strict {
+			return err
+		}
+		log.Printf("WARNING: %v", err)
+	}
+	return nil
+}
+
+// AtLeast compares the leading dotted numbers of two versions, so
+// "16.2 (Debian 16.2-1)" is at least "14" and "7.0.15" is below "7.2"
+func AtLeast(actual, minimum string) (bool, error) {
+	a, err := parseVersion(actual)
+	if err != nil {
+		return false, err
+	}
+	m, err := parseVersion(minimum)
+	if err != nil {
+		return false, err
+	}
+
+	for i := 0; i < len(a) || i < len(m); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(m) {
+			y = m[i]
+		}
+		if x != y {
+			return x > y, nil
+		}
+	}
+	return true, nil
+}
+
+func parseVersion(v string) ([]int, error) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if end := strings.IndexFunc(v, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); end >= 0 {
+		v = v[:end]
+	}
+
+	var parts []int
+	for _, field := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", v)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
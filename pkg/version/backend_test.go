@@ -0,0 +1,83 @@
+package version
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func stubBackend(actual string, err error) Backend {
+	return Backend{
+		Name:    "Redis",
+		Minimum: "6.2",
+		Fetch: func(ctx context.Context) (string, error) {
+			return actual, err
+		},
+	}
+}
+
+func TestCheckBackends(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     Backend
+		strict      bool
+		wantErr     bool
+		wantWarning bool
+	}{
+		{"Above minimum", stubBackend("7.2.4", nil), false, false, false},
+		{"Equal to minimum", stubBackend("6.2", nil), true, false, false},
+		{"Below minimum warns", stubBackend("6.0.16", nil), false, false, true},
+		{"Below minimum strict", stubBackend("6.0.16", nil), true, true, false},
+		{"Unreadable version warns", stubBackend("", errors.New("connection refused")), false, false, true},
+		{"Unreadable version strict", stubBackend("", errors.New("connection refused")), true, true, false},
+		{"No minimum", Backend{Name: "Redis", Fetch: func(ctx context.Context) (string, error) { return "1.0", nil }}, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			err := CheckBackends(context.Background(), tt.strict, tt.backend)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckBackends() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if warned := strings.Contains(logs.String(), "WARNING"); warned != tt.wantWarning {
+				t.Errorf("Warning logged = %v, want %v (log: %q)", warned, tt.wantWarning, logs.String())
+			}
+		})
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		actual  string
+		minimum string
+		want    bool
+		wantErr bool
+	}{
+		{"16.2 (Debian 16.2-1.pgdg120+2)", "13", true, false},
+		{"12.18", "13", false, false},
+		{"7.0.15", "7.2", false, false},
+		{"7.2", "7.2.0", true, false},
+		{"v6.2.14", "6.2", true, false},
+		{"unknown", "6.2", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.actual+" >= "+tt.minimum, func(t *testing.T) {
+			got, err := AtLeast(tt.actual, tt.minimum)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AtLeast() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("AtLeast() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package version
+
+import "runtime/debug"
+
+// Set at build time, e.g.
+// -ldflags "-X github.com/ehsanshojaei/go-otp-auth/pkg/version.Version=v1.2.0 -X github.com/ehsanshojaei/go-otp-auth/pkg/version.Commit=abc1234"
+var (
+	Version = ""
+	Commit  = ""
+)
+
+// Info returns the build version and commit, falling back to the module
+// version and VCS revision Go embeds when ldflags were not set
+func Info() (version, commit string) {
+	version, commit = Version, Commit
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if commit == "" && setting.Key == "vcs.revision" {
+				commit = setting.Value
+			}
+		}
+	}
+
+	if version == "" {
+		version = "dev"
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	return version, commit
+}